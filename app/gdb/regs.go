@@ -0,0 +1,120 @@
+package gdb
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/blackchip-org/retro-cs/rcs"
+	"github.com/blackchip-org/retro-cs/rcs/m6502"
+	"github.com/blackchip-org/retro-cs/rcs/z80"
+)
+
+// register is a register of a CPU in the order and size expected by the
+// debugger. Values are sent in little endian order.
+type register struct {
+	name string
+	size int    // in bytes
+	typ  string // type in the target description, if not an integer
+	get  func() int
+	set  func(int)
+}
+
+// registers returns the registers of the CPU. The Z80 registers are in the
+// same order as those of the z80 architecture in GDB. CPUs that are not
+// known only have the program counter.
+func registers(cpu rcs.CPU) []register {
+	switch c := cpu.(type) {
+	case *z80.CPU:
+		return z80Registers(c)
+	case *m6502.CPU:
+		return m6502Registers(c)
+	}
+	return []register{pcRegister(cpu)}
+}
+
+func z80Registers(c *z80.CPU) []register {
+	pair := func(name string, hi *uint8, lo *uint8) register {
+		return register{
+			name: name,
+			size: 2,
+			get:  func() int { return int(*hi)<<8 | int(*lo) },
+			set:  func(v int) { *hi, *lo = uint8(v>>8), uint8(v) },
+		}
+	}
+	sp := register{
+		name: "sp",
+		size: 2,
+		typ:  "data_ptr",
+		get:  func() int { return int(c.SP) },
+		set:  func(v int) { c.SP = uint16(v) },
+	}
+	return []register{
+		pair("af", &c.A, &c.F),
+		pair("bc", &c.B, &c.C),
+		pair("de", &c.D, &c.E),
+		pair("hl", &c.H, &c.L),
+		sp,
+		pcRegister(c),
+		pair("ix", &c.IXH, &c.IXL),
+		pair("iy", &c.IYH, &c.IYL),
+		pair("af'", &c.A1, &c.F1),
+		pair("bc'", &c.B1, &c.C1),
+		pair("de'", &c.D1, &c.E1),
+		pair("hl'", &c.H1, &c.L1),
+		pair("ir", &c.I, &c.R),
+	}
+}
+
+func m6502Registers(c *m6502.CPU) []register {
+	reg := func(name string, r *uint8) register {
+		return register{
+			name: name,
+			size: 1,
+			get:  func() int { return int(*r) },
+			set:  func(v int) { *r = uint8(v) },
+		}
+	}
+	return []register{
+		reg("a", &c.A),
+		reg("x", &c.X),
+		reg("y", &c.Y),
+		reg("sp", &c.SP),
+		reg("sr", &c.SR),
+		pcRegister(c),
+	}
+}
+
+// pcRegister is the address of the next instruction to be executed, which
+// includes the offset of the CPU.
+func pcRegister(c rcs.CPU) register {
+	return register{
+		name: "pc",
+		size: 2,
+		typ:  "code_ptr",
+		get:  func() int { return c.PC() + c.Offset() },
+		set:  func(v int) { c.SetPC(v - c.Offset()) },
+	}
+}
+
+// targetXML returns the description of the registers of the CPU that is
+// read by the debugger with qXfer:features:read.
+func targetXML(cpu rcs.CPU) string {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0"?>` + "\n")
+	buf.WriteString(`<!DOCTYPE target SYSTEM "gdb-target.dtd">` + "\n")
+	buf.WriteString("<target>\n")
+	if _, ok := cpu.(*z80.CPU); ok {
+		buf.WriteString("  <architecture>z80</architecture>\n")
+	}
+	buf.WriteString(`  <feature name="org.blackchip.retro-cs.cpu">` + "\n")
+	for _, r := range registers(cpu) {
+		typ := r.typ
+		if typ == "" {
+			typ = "int"
+		}
+		fmt.Fprintf(&buf, `    <reg name="%v" bitsize="%v" type="%v"/>`+"\n", r.name, r.size*8, typ)
+	}
+	buf.WriteString("  </feature>\n")
+	buf.WriteString("</target>\n")
+	return buf.String()
+}
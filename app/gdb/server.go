@@ -0,0 +1,749 @@
+// Package gdb is a server for the GDB remote serial protocol so that an
+// external debugger can attach to a running machine.
+//
+// Each CPU of the machine is a thread, numbered from one in the order the
+// CPUs are found in the components. Registers, memory, and breakpoints
+// are those of the CPU of the thread selected with "Hg". The debugger
+// stops the whole machine, and continuing runs all CPUs, while a single
+// step only counts the instructions of one CPU.
+package gdb
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/blackchip-org/retro-cs/rcs"
+)
+
+// Signals sent in stop replies.
+const (
+	sigint  = 2
+	sigtrap = 5
+)
+
+// packetSize is the largest packet accepted from the debugger.
+const packetSize = 0x1000
+
+// errDetach ends a session when the debugger detaches or kills the
+// target.
+var errDetach = errors.New("detach")
+
+// Server handles connections from debuggers, one at a time.
+type Server struct {
+	mach    *rcs.Mach
+	threads []string  // CPU name of each thread, starting with thread 1
+	stops   chan stop // machine stopped running
+}
+
+// stop is a change of the machine status to something other than Run.
+type stop struct {
+	status rcs.Status
+	cpu    string // CPU that caused a break, if known
+}
+
+// New creates a server for the machine. The Callback of the machine is
+// replaced with one that also calls the existing Callback, so the server
+// should be created after the monitor.
+func New(mach *rcs.Mach) (*Server, error) {
+	if err := mach.Init(); err != nil {
+		return nil, err
+	}
+	s := &Server{
+		mach:  mach,
+		stops: make(chan stop, 1),
+	}
+	for _, comp := range mach.Comps {
+		if _, ok := mach.CPU[comp.Name]; ok {
+			s.threads = append(s.threads, comp.Name)
+		}
+	}
+	if len(s.threads) == 0 {
+		return nil, errors.New("no CPUs to debug")
+	}
+	prev := mach.Callback
+	mach.Callback = func(evt rcs.MachEvent, args ...interface{}) {
+		if prev != nil {
+			prev(evt, args...)
+		}
+		if evt == rcs.StatusEvent {
+			s.notify(args...)
+		}
+	}
+	return s, nil
+}
+
+// notify is called on the machine goroutine when the status changes. It
+// must not block the machine.
+func (s *Server) notify(args ...interface{}) {
+	status := args[0].(rcs.Status)
+	if status == rcs.Run {
+		return
+	}
+	st := stop{status: status}
+	if len(args) > 1 {
+		st.cpu, _ = args[1].(string)
+	}
+	select {
+	case s.stops <- st:
+	default:
+	}
+}
+
+// drain discards stops that were not waited for.
+func (s *Server) drain() {
+	for {
+		select {
+		case <-s.stops:
+		default:
+			return
+		}
+	}
+}
+
+// ListenAndServe listens on the TCP address and then calls Serve.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on the listener and handles them one at a
+// time until the listener is closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		if err := s.handle(conn); err != nil {
+			log.Printf("gdb: %v", err)
+		}
+		conn.Close()
+	}
+}
+
+// frame is a packet or an interrupt received from the debugger.
+type frame struct {
+	data      string
+	valid     bool // checksum is correct
+	interrupt bool // ctrl-c
+}
+
+type session struct {
+	srv    *Server
+	mach   *rcs.Mach
+	w      *bufio.Writer
+	in     chan frame
+	err    error // reason that in was closed
+	noAck  bool
+	thread int // selected with Hg
+	step   int // selected with Hc, zero for any
+	last   stop
+	breaks map[breakpoint]bool // set by the debugger
+}
+
+type breakpoint struct {
+	cpu  string
+	addr int
+}
+
+// handle runs a session with the debugger on the connection. The machine
+// is paused while the debugger is attached and resumes running once it
+// detaches.
+func (s *Server) handle(conn net.Conn) error {
+	ses := &session{
+		srv:    s,
+		mach:   s.mach,
+		w:      bufio.NewWriter(conn),
+		in:     make(chan frame),
+		thread: 1,
+		last:   stop{status: rcs.Break},
+		breaks: make(map[breakpoint]bool),
+	}
+	go ses.read(bufio.NewReader(conn))
+	if _, err := s.mach.Call(rcs.MachPause); err != nil {
+		return err
+	}
+	s.drain()
+	err := ses.run()
+	if derr := ses.detach(); err == nil {
+		err = derr
+	}
+	// let the reader finish
+	conn.Close()
+	for range ses.in {
+	}
+	if err == errDetach || err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// read sends each frame received to the session until there is an error.
+func (ses *session) read(r *bufio.Reader) {
+	defer close(ses.in)
+	for {
+		ch, err := r.ReadByte()
+		if err != nil {
+			ses.err = err
+			return
+		}
+		switch ch {
+		case 0x03:
+			ses.in <- frame{interrupt: true}
+		case '$':
+			data, err := r.ReadString('#')
+			if err != nil {
+				ses.err = err
+				return
+			}
+			data = data[:len(data)-1]
+			var sum [2]byte
+			if _, err := io.ReadFull(r, sum[:]); err != nil {
+				ses.err = err
+				return
+			}
+			ses.in <- frame{
+				data:  data,
+				valid: string(sum[:]) == checksum(data),
+			}
+		}
+		// acknowledgments, "+" and "-", and anything else are ignored
+	}
+}
+
+func checksum(data string) string {
+	sum := uint8(0)
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return fmt.Sprintf("%02x", sum)
+}
+
+// next returns the next packet received, skipping interrupts and packets
+// with a bad checksum.
+func (ses *session) next() (string, error) {
+	for f := range ses.in {
+		if f.interrupt {
+			continue
+		}
+		if ses.noAck {
+			return f.data, nil
+		}
+		ack := "+"
+		if !f.valid {
+			ack = "-"
+		}
+		ses.w.WriteString(ack)
+		if err := ses.w.Flush(); err != nil {
+			return "", err
+		}
+		if f.valid {
+			return f.data, nil
+		}
+	}
+	return "", ses.err
+}
+
+func (ses *session) reply(data string) error {
+	fmt.Fprintf(ses.w, "$%v#%v", data, checksum(data))
+	return ses.w.Flush()
+}
+
+func (ses *session) run() error {
+	for {
+		data, err := ses.next()
+		if err != nil {
+			return err
+		}
+		reply, err := ses.packet(data)
+		if err != nil && err != errDetach {
+			return err
+		}
+		// there is no reply to a kill
+		if data != "k" {
+			if werr := ses.reply(reply); werr != nil {
+				return werr
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if data == "QStartNoAckMode" {
+			ses.noAck = true
+		}
+	}
+}
+
+// detach removes the breakpoints set by the debugger and resumes the
+// machine.
+func (ses *session) detach() error {
+	_, err := ses.mach.Call(rcs.MachExec, func() error {
+		for b := range ses.breaks {
+			delete(ses.mach.Breakpoints[b.cpu], b.addr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = ses.mach.Call(rcs.MachStart)
+	return err
+}
+
+// packet handles a packet and returns the reply. Packets that are not
+// supported have an empty reply.
+func (ses *session) packet(data string) (string, error) {
+	if data == "" {
+		return "", nil
+	}
+	var reply string
+	var err error
+	cmd, args := data[0], data[1:]
+	switch cmd {
+	case '?':
+		return ses.stopReply(ses.last), nil
+	case 'q':
+		return ses.query(args), nil
+	case 'Q':
+		if args == "StartNoAckMode" {
+			return "OK", nil
+		}
+		return "", nil
+	case 'H':
+		reply, err = ses.setThread(args)
+	case 'T':
+		_, err = ses.parseThread(args)
+		reply = "OK"
+	case 'g':
+		reply, err = ses.readRegisters()
+	case 'G':
+		err = ses.writeRegisters(args)
+		reply = "OK"
+	case 'p':
+		reply, err = ses.readRegister(args)
+	case 'P':
+		err = ses.writeRegister(args)
+		reply = "OK"
+	case 'm':
+		reply, err = ses.readMemory(args)
+	case 'M':
+		err = ses.writeMemory(args)
+		reply = "OK"
+	case 'Z', 'z':
+		reply, err = ses.breakpoint(cmd == 'Z', args)
+	case 'c':
+		return ses.resume(args, false)
+	case 's':
+		return ses.resume(args, true)
+	case 'D':
+		return "OK", errDetach
+	case 'k':
+		return "", errDetach
+	}
+	if err != nil {
+		return "E01", nil
+	}
+	return reply, nil
+}
+
+func (ses *session) query(args string) string {
+	name := args
+	if i := strings.IndexAny(args, ":,"); i >= 0 {
+		name = args[:i]
+	}
+	switch name {
+	case "Supported":
+		return fmt.Sprintf("PacketSize=%x;qXfer:features:read+;QStartNoAckMode+", packetSize)
+	case "Attached":
+		return "1"
+	case "C":
+		return fmt.Sprintf("QC%x", ses.thread)
+	case "fThreadInfo":
+		ids := make([]string, len(ses.srv.threads))
+		for i := range ids {
+			ids[i] = fmt.Sprintf("%x", i+1)
+		}
+		return "m" + strings.Join(ids, ",")
+	case "sThreadInfo":
+		return "l"
+	case "ThreadExtraInfo":
+		id, err := ses.parseThread(strings.TrimPrefix(args, name+","))
+		if err != nil {
+			return "E01"
+		}
+		return hex.EncodeToString([]byte(ses.srv.threads[id-1]))
+	case "Xfer":
+		return ses.features(strings.TrimPrefix(args, name+":"))
+	}
+	return ""
+}
+
+// features returns part of the target description for the CPU of the
+// selected thread, "features:read:target.xml:offset,length".
+func (ses *session) features(args string) string {
+	const prefix = "features:read:target.xml:"
+	if !strings.HasPrefix(args, prefix) {
+		return ""
+	}
+	offset, length, err := parseRange(strings.TrimPrefix(args, prefix))
+	if err != nil {
+		return "E01"
+	}
+	var xml string
+	_, err = ses.mach.Call(rcs.MachExec, func() error {
+		xml = targetXML(ses.cpu())
+		return nil
+	})
+	if err != nil {
+		return "E01"
+	}
+	if offset >= len(xml) {
+		return "l"
+	}
+	if offset+length >= len(xml) {
+		return "l" + xml[offset:]
+	}
+	return "m" + xml[offset:offset+length]
+}
+
+func (ses *session) cpu() rcs.CPU {
+	return ses.mach.CPU[ses.srv.threads[ses.thread-1]]
+}
+
+// parseThread parses a thread id and returns an error if there is no such
+// thread.
+func (ses *session) parseThread(str string) (int, error) {
+	id, err := strconv.ParseInt(str, 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	if id < 1 || int(id) > len(ses.srv.threads) {
+		return 0, fmt.Errorf("no such thread: %v", id)
+	}
+	return int(id), nil
+}
+
+// setThread selects the thread for registers and memory, "Hg", or for
+// stepping, "Hc". A thread of zero or -1 is any thread.
+func (ses *session) setThread(args string) (string, error) {
+	if args == "" {
+		return "", errors.New("missing thread")
+	}
+	op, str := args[0], args[1:]
+	id := 0
+	if str != "0" && str != "-1" {
+		var err error
+		if id, err = ses.parseThread(str); err != nil {
+			return "", err
+		}
+	}
+	switch op {
+	case 'g':
+		if id != 0 {
+			ses.thread = id
+		}
+	case 'c':
+		ses.step = id
+	default:
+		return "", fmt.Errorf("invalid operation: %c", op)
+	}
+	return "OK", nil
+}
+
+func (ses *session) readRegisters() (string, error) {
+	var buf strings.Builder
+	_, err := ses.mach.Call(rcs.MachExec, func() error {
+		for _, r := range registers(ses.cpu()) {
+			buf.WriteString(encodeValue(r.get(), r.size))
+		}
+		return nil
+	})
+	return buf.String(), err
+}
+
+func (ses *session) writeRegisters(args string) error {
+	_, err := ses.mach.Call(rcs.MachExec, func() error {
+		regs := registers(ses.cpu())
+		values := make([]int, len(regs))
+		for i, r := range regs {
+			n := r.size * 2
+			if len(args) < n {
+				return errors.New("not enough values")
+			}
+			v, err := decodeValue(args[:n])
+			if err != nil {
+				return err
+			}
+			values[i] = v
+			args = args[n:]
+		}
+		for i, r := range regs {
+			r.set(values[i])
+		}
+		return nil
+	})
+	return err
+}
+
+func (ses *session) readRegister(args string) (string, error) {
+	n, err := strconv.ParseInt(args, 16, 64)
+	if err != nil {
+		return "", err
+	}
+	var reply string
+	_, err = ses.mach.Call(rcs.MachExec, func() error {
+		regs := registers(ses.cpu())
+		if n < 0 || int(n) >= len(regs) {
+			return fmt.Errorf("no such register: %v", n)
+		}
+		r := regs[n]
+		reply = encodeValue(r.get(), r.size)
+		return nil
+	})
+	return reply, err
+}
+
+func (ses *session) writeRegister(args string) error {
+	kv := strings.SplitN(args, "=", 2)
+	if len(kv) != 2 {
+		return errors.New("missing value")
+	}
+	n, err := strconv.ParseInt(kv[0], 16, 64)
+	if err != nil {
+		return err
+	}
+	_, err = ses.mach.Call(rcs.MachExec, func() error {
+		regs := registers(ses.cpu())
+		if n < 0 || int(n) >= len(regs) {
+			return fmt.Errorf("no such register: %v", n)
+		}
+		r := regs[n]
+		if len(kv[1]) != r.size*2 {
+			return fmt.Errorf("invalid value: %v", kv[1])
+		}
+		v, err := decodeValue(kv[1])
+		if err != nil {
+			return err
+		}
+		r.set(v)
+		return nil
+	})
+	return err
+}
+
+// encodeValue returns the hex digits of a value of size bytes in little
+// endian order.
+func encodeValue(v int, size int) string {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = uint8(v >> uint(8*i))
+	}
+	return hex.EncodeToString(b)
+}
+
+func decodeValue(str string) (int, error) {
+	b, err := hex.DecodeString(str)
+	if err != nil {
+		return 0, err
+	}
+	v := 0
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | int(b[i])
+	}
+	return v, nil
+}
+
+// parseRange parses "addr,length" in hex.
+func parseRange(str string) (int, int, error) {
+	fields := strings.Split(str, ",")
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("invalid range: %v", str)
+	}
+	addr, err := strconv.ParseInt(fields[0], 16, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := strconv.ParseInt(fields[1], 16, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(addr), int(length), nil
+}
+
+// memory returns the memory of the selected CPU after checking that the
+// range is valid. Must be called on the machine goroutine.
+func (ses *session) memory(addr int, length int) (*rcs.Memory, error) {
+	mem := ses.cpu().Memory()
+	if mem == nil {
+		return nil, errors.New("CPU does not have memory")
+	}
+	if addr < 0 || length < 0 || addr+length > mem.MaxAddr+1 {
+		return nil, fmt.Errorf("invalid range: $%x, %v bytes", addr, length)
+	}
+	return mem, nil
+}
+
+func (ses *session) readMemory(args string) (string, error) {
+	addr, length, err := parseRange(args)
+	if err != nil {
+		return "", err
+	}
+	if length > packetSize/2 {
+		length = packetSize / 2
+	}
+	values := make([]uint8, length)
+	_, err = ses.mach.Call(rcs.MachExec, func() error {
+		mem, err := ses.memory(addr, length)
+		if err != nil {
+			return err
+		}
+		for i := range values {
+			values[i] = mem.Read(addr + i)
+		}
+		return nil
+	})
+	return hex.EncodeToString(values), err
+}
+
+func (ses *session) writeMemory(args string) error {
+	parts := strings.SplitN(args, ":", 2)
+	if len(parts) != 2 {
+		return errors.New("missing values")
+	}
+	addr, length, err := parseRange(parts[0])
+	if err != nil {
+		return err
+	}
+	values, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	if len(values) != length {
+		return fmt.Errorf("expecting %v values but got %v", length, len(values))
+	}
+	_, err = ses.mach.Call(rcs.MachExec, func() error {
+		mem, err := ses.memory(addr, length)
+		if err != nil {
+			return err
+		}
+		for i, v := range values {
+			mem.Write(addr+i, v)
+		}
+		return nil
+	})
+	return err
+}
+
+// breakpoint inserts or removes a software, "Z0", or hardware, "Z1",
+// breakpoint for the CPU of the selected thread. An existing breakpoint
+// set by the monitor is left alone.
+func (ses *session) breakpoint(insert bool, args string) (string, error) {
+	fields := strings.Split(args, ",")
+	if len(fields) < 2 || (fields[0] != "0" && fields[0] != "1") {
+		return "", nil
+	}
+	addr, err := strconv.ParseInt(fields[1], 16, 64)
+	if err != nil {
+		return "", err
+	}
+	b := breakpoint{cpu: ses.srv.threads[ses.thread-1], addr: int(addr)}
+	_, err = ses.mach.Call(rcs.MachExec, func() error {
+		bps := ses.mach.Breakpoints[b.cpu]
+		if !insert {
+			if ses.breaks[b] {
+				delete(bps, b.addr)
+				delete(ses.breaks, b)
+			}
+			return nil
+		}
+		if _, exists := bps[b.addr]; !exists {
+			bps[b.addr] = &rcs.Breakpoint{}
+			ses.breaks[b] = true
+		}
+		return nil
+	})
+	return "OK", err
+}
+
+// resume continues the machine, or steps the thread selected with "Hc",
+// and waits until the machine stops. An address, if given, is where the
+// thread resumes.
+func (ses *session) resume(args string, step bool) (string, error) {
+	id := ses.step
+	if id == 0 {
+		id = ses.thread
+	}
+	cpu := ses.srv.threads[id-1]
+	var addr int64 = -1
+	if args != "" {
+		var err error
+		if addr, err = strconv.ParseInt(args, 16, 64); err != nil {
+			return "E01", nil
+		}
+	}
+	ses.srv.drain()
+	_, err := ses.mach.Call(rcs.MachExec, func() error {
+		if addr >= 0 {
+			pcRegister(ses.mach.CPU[cpu]).set(int(addr))
+		}
+		if step {
+			return ses.mach.Step(cpu)
+		}
+		return nil
+	})
+	if err != nil {
+		return "E01", nil
+	}
+	if !step {
+		if _, err := ses.mach.Call(rcs.MachStart); err != nil {
+			return "", err
+		}
+	}
+	return ses.wait()
+}
+
+// wait returns the stop reply once the machine stops. An interrupt from
+// the debugger pauses the machine.
+func (ses *session) wait() (string, error) {
+	for {
+		select {
+		case st := <-ses.srv.stops:
+			ses.last = st
+			return ses.stopReply(st), nil
+		case f, ok := <-ses.in:
+			if !ok {
+				return "", ses.err
+			}
+			if f.interrupt {
+				if _, err := ses.mach.Call(rcs.MachPause); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+}
+
+// stopReply selects the thread of the CPU that caused a break and returns
+// the reply for the stop.
+func (ses *session) stopReply(st stop) string {
+	for i, name := range ses.srv.threads {
+		if name == st.cpu {
+			ses.thread = i + 1
+		}
+	}
+	sig := sigint
+	if st.status == rcs.Break {
+		sig = sigtrap
+	}
+	return fmt.Sprintf("T%02xthread:%x;", sig, ses.thread)
+}
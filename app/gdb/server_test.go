@@ -0,0 +1,241 @@
+package gdb
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/blackchip-org/retro-cs/rcs"
+	"github.com/blackchip-org/retro-cs/rcs/m6502"
+	"github.com/blackchip-org/retro-cs/rcs/z80"
+)
+
+// newTestMach has a Z80, "cpu1", and a 6502, "cpu2", each with its own
+// memory filled with nop instructions.
+func newTestMach() *rcs.Mach {
+	ram1 := make([]uint8, 0x10000)
+	mem1 := rcs.NewMemory(1, len(ram1))
+	mem1.MapRAM(0, ram1)
+	ram2 := make([]uint8, 0x10000)
+	for i := range ram2 {
+		ram2[i] = 0xea
+	}
+	mem2 := rcs.NewMemory(1, len(ram2))
+	mem2.MapRAM(0, ram2)
+	return &rcs.Mach{
+		Comps: []rcs.Component{
+			rcs.NewComponent("mem1", "mem", "", mem1),
+			rcs.NewComponent("cpu1", "z80", "mem1", z80.New(mem1)),
+			rcs.NewComponent("mem2", "mem", "", mem2),
+			rcs.NewComponent("cpu2", "m6502", "mem2", m6502.New(mem2)),
+		},
+		Clock: 1000000,
+	}
+}
+
+// client is a scripted debugger.
+type client struct {
+	t     *testing.T
+	conn  net.Conn
+	r     *bufio.Reader
+	noAck bool
+}
+
+func (c *client) send(data string) {
+	fmt.Fprintf(c.conn, "$%v#%v", data, checksum(data))
+}
+
+// recv returns the data of the next packet and checks its checksum.
+func (c *client) recv() string {
+	if !c.noAck {
+		ack, err := c.r.ReadByte()
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if ack != '+' {
+			c.t.Fatalf("expected ack but got %q", ack)
+		}
+	}
+	if _, err := c.r.ReadString('$'); err != nil {
+		c.t.Fatal(err)
+	}
+	data, err := c.r.ReadString('#')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	data = data[:len(data)-1]
+	sum := make([]byte, 2)
+	if _, err := c.r.Read(sum); err != nil {
+		c.t.Fatal(err)
+	}
+	if string(sum) != checksum(data) {
+		c.t.Fatalf("invalid checksum for %q: %v", data, string(sum))
+	}
+	return data
+}
+
+func TestServer(t *testing.T) {
+	mach := newTestMach()
+	srv, err := New(mach)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- mach.Run() }()
+	for !mach.Running() {
+		runtime.Gosched()
+	}
+	defer func() {
+		mach.Command(rcs.MachQuit)
+		<-done
+	}()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go srv.Serve(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+
+	script := []struct {
+		send string
+		want string
+	}{
+		{"qSupported:multiprocess+", "PacketSize=1000;qXfer:features:read+;QStartNoAckMode+"},
+		{"QStartNoAckMode", "OK"},
+		{"?", "T05thread:1;"},
+		{"qfThreadInfo", "m1,2"},
+		{"qsThreadInfo", "l"},
+		{"qThreadExtraInfo,2", "63707532"},
+		{"T3", "E01"},
+		{"vMustReplyEmpty", ""},
+
+		// z80 registers and memory
+		{"Hg1", "OK"},
+		{"P5=3412", "OK"},
+		{"p5", "3412"},
+		{"P0=0201", "OK"},
+		{"M2000,3:abcdef", "OK"},
+		{"m2000,3", "abcdef"},
+		{"m1234,2", "0000"},
+		{"m10000,1", "E01"},
+		{"s", "T05thread:1;"},
+		{"p5", "3512"},
+		{"Z0,1240,1", "OK"},
+		{"c", "T05thread:1;"},
+		{"p5", "4012"},
+		{"z0,1240,1", "OK"},
+
+		// m6502 registers, the program counter includes the offset
+		{"Hg2", "OK"},
+		{"P5=0030", "OK"},
+		{"g", "00000000000030"},
+		{"Hc2", "OK"},
+		{"s", "T05thread:2;"},
+		{"p5", "0130"},
+		{"Hc0", "OK"},
+		{"s3100", "T05thread:2;"},
+		{"p5", "0131"},
+		{"G0102030405ff10", "OK"},
+		{"g", "0102030405ff10"},
+	}
+	for _, step := range script {
+		c.send(step.send)
+		have := c.recv()
+		if step.send == "QStartNoAckMode" {
+			c.noAck = true
+		}
+		if have != step.want {
+			t.Fatalf("%v:\n have: %v \n want: %v", step.send, have, step.want)
+		}
+	}
+
+	// target description of the 6502
+	c.send("qXfer:features:read:target.xml:0,1000")
+	have := c.recv()
+	if !strings.HasPrefix(have, "l<?xml") || strings.Contains(have, "architecture") ||
+		!strings.Contains(have, `<reg name="sr" bitsize="8" type="int"/>`) {
+		t.Errorf("unexpected target description: %v", have)
+	}
+	c.send("Hg1")
+	c.recv()
+	c.send("qXfer:features:read:target.xml:0,1000")
+	have = c.recv()
+	if !strings.Contains(have, "<architecture>z80</architecture>") {
+		t.Errorf("unexpected target description: %v", have)
+	}
+
+	// interrupt while running
+	c.send("c")
+	conn.Write([]byte{0x03})
+	if have, want := c.recv(), "T02thread:1;"; have != want {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+
+	c.send("Z0,4000,1")
+	c.recv()
+	c.send("D")
+	if have, want := c.recv(), "OK"; have != want {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+	// breakpoints are removed and the machine is running after a detach
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Fatal("expected connection to close")
+	}
+	var status rcs.Status
+	var n int
+	mach.Call(rcs.MachExec, func() error {
+		status, n = mach.Status, len(mach.Breakpoints["cpu1"])
+		return nil
+	})
+	if status != rcs.Run || n != 0 {
+		t.Errorf("\n have: %v %v \n want: %v %v", status, n, rcs.Run, 0)
+	}
+}
+
+func TestServerMonitorBreakpoint(t *testing.T) {
+	mach := newTestMach()
+	if err := mach.Init(); err != nil {
+		t.Fatal(err)
+	}
+	mach.Breakpoints["cpu2"][0x1234] = &rcs.Breakpoint{}
+	srv, err := New(mach)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go srv.Serve(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+	c.send("Hg2")
+	c.recv()
+	c.send("Z0,1234,1")
+	c.recv()
+	c.send("z0,1234,1")
+	c.recv()
+	c.send("k")
+	// wait for the session to end, there is only an ack for the kill
+	if rest, _ := ioutil.ReadAll(c.r); string(rest) != "+" {
+		t.Fatalf("unexpected reply: %q", rest)
+	}
+	if _, ok := mach.Breakpoints["cpu2"][0x1234]; !ok {
+		t.Errorf("breakpoint removed")
+	}
+}
@@ -84,7 +84,7 @@ type modC128MMU struct {
 func newModC128MMU(mon *Monitor, comp rcs.Component) module {
 	return &modC128MMU{
 		mon: mon,
-		out: mon.out,
+		out: mon.cmdOut,
 		mmu: comp.C.(*c128.MMU),
 	}
 }
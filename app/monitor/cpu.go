@@ -1,8 +1,10 @@
 package monitor
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"sort"
 	"strings"
 
@@ -19,7 +21,7 @@ type modCPU struct {
 	cpu    rcs.CPU
 	mem    *rcs.Memory
 	dasm   *rcs.Disassembler
-	brkpts map[int]struct{}
+	brkpts map[int]*rcs.Breakpoint
 }
 
 func newModCPU(mon *Monitor, comp rcs.Component) module {
@@ -28,6 +30,7 @@ func newModCPU(mon *Monitor, comp rcs.Component) module {
 	cpud, ok := c.(rcs.CPUDisassembler)
 	if ok {
 		dasm = cpud.NewDisassembler()
+		dasm.Symbols = mon.mach.Symbols[comp.Name]
 	}
 	mod := &modCPU{
 		name:   comp.Name,
@@ -48,6 +51,8 @@ func (m *modCPU) Command(args []string) error {
 		return m.cmdInfo(args[0:])
 	}
 	switch args[0] {
+	case "assemble", "a":
+		return m.cmdAssemble(args[1:])
 	case "breakpoint-clear", "bpc":
 		return m.cmdBreakpointClear(args[1:])
 	case "breakpoint-list", "bp", "bpl":
@@ -58,23 +63,82 @@ func (m *modCPU) Command(args []string) error {
 		return m.cmdBreakpointSet(args[1:])
 	case "disassemble", "d":
 		return m.cmdDisassemble(args[1:])
+	case "history", "h":
+		return m.cmdHistory(args[1:])
 	case "info", "i":
 		return m.cmdInfo(args[1:])
 	case "next", "n":
 		return m.cmdNext(args[1:])
+	case "run-to", "rt":
+		return m.cmdRunTo(args[1:])
 	case "step", "s":
 		return m.cmdStep(args[1:])
+	case "step-out", "sr":
+		return m.cmdStepOut(args[1:])
+	case "step-over", "so":
+		return m.cmdStepOver(args[1:])
+	case "symbols":
+		return m.cmdSymbols(args[1:])
 	case "trace", "t":
 		return m.cmdTrace(args[1:])
 	}
 	return fmt.Errorf("no such command: %v", args[0])
 }
 
+// assembly is an interactive session started with the assemble command.
+// Each line entered is assembled and written to memory until a blank line
+// is entered.
+type assembly struct {
+	mod  *modCPU
+	asm  *rcs.Assembler
+	addr int // address of the next line
+}
+
+func (m *modCPU) cmdAssemble(args []string) error {
+	if err := checkLen(args, 1, 1); err != nil {
+		return err
+	}
+	cpua, ok := m.cpu.(rcs.CPUAssembler)
+	if !ok {
+		return fmt.Errorf("cannot assemble for this processor")
+	}
+	addr, err := m.mon.parseAddress(m.mem, args[0])
+	if err != nil {
+		return err
+	}
+	asm := cpua.NewAssembler()
+	for addr, name := range m.mon.mach.Symbols[m.name] {
+		asm.Define(name, addr)
+	}
+	m.mon.asm = &assembly{mod: m, asm: asm, addr: addr}
+	return nil
+}
+
+// assemble assembles a line of source at the next address of the session
+// and shows the result. Labels defined are added to the symbols of the
+// CPU.
+func (m *modCPU) assemble(a *assembly, line string) error {
+	code, err := a.asm.AssembleLine(a.addr, line)
+	if err != nil {
+		return err
+	}
+	m.mon.mach.Symbols[m.name].Add(a.asm.Labels())
+	m.mem.WriteN(a.addr, code...)
+	if m.dasm != nil {
+		m.dasm.SetPC(a.addr)
+		for m.dasm.PC() < a.addr+len(code) {
+			m.mon.cmdOut.Printf("%v%v\n", m.prefix(), m.dasm.NextListing())
+		}
+	}
+	a.addr = (a.addr + len(code)) & m.mem.MaxAddr
+	return nil
+}
+
 func (m *modCPU) cmdBreakpointClear(args []string) error {
 	if err := checkLen(args, 1, 1); err != nil {
 		return err
 	}
-	addr, err := parseAddress(m.mem, args[0])
+	addr, err := m.mon.parseAddress(m.mem, args[0])
 	if err != nil {
 		return err
 	}
@@ -90,12 +154,25 @@ func (m *modCPU) cmdBreakpointList(args []string) error {
 		return nil
 	}
 	addrs := make([]string, 0, 0)
-	for k := range m.brkpts {
+	for k, b := range m.brkpts {
 		// FIXME: Hard-coded format
-		addrs = append(addrs, fmt.Sprintf("%v$%04x", m.prefix(), k))
+		line := fmt.Sprintf("%v$%04x", m.prefix(), k)
+		if b.Hits > 0 {
+			line += fmt.Sprintf(" hits %v", b.Hits)
+		}
+		if b.Temp {
+			line += " temp"
+		}
+		if b.Ignore > 0 {
+			line += fmt.Sprintf(" ignore %v", b.Ignore)
+		}
+		if b.Cond != nil {
+			line += " if " + b.Cond.String()
+		}
+		addrs = append(addrs, line)
 	}
 	sort.Strings(addrs)
-	m.mon.out.Printf(strings.Join(addrs, "\n"))
+	m.mon.cmdOut.Print(strings.Join(addrs, "\n"))
 	return nil
 }
 
@@ -109,15 +186,51 @@ func (m *modCPU) cmdBreakpointNone(args []string) error {
 	return nil
 }
 
+// cmdBreakpointSet sets a breakpoint, replacing any existing one at the
+// same address:
+//
+//	breakpoint-set addr [temp] [ignore n] [if expr]
+//
+// The condition comes last and uses the rest of the line.
 func (m *modCPU) cmdBreakpointSet(args []string) error {
-	if err := checkLen(args, 1, 1); err != nil {
+	if err := checkLen(args, 1, maxArgs); err != nil {
 		return err
 	}
-	addr, err := parseAddress(m.mem, args[0])
+	addr, err := m.mon.parseAddress(m.mem, args[0])
 	if err != nil {
 		return err
 	}
-	m.brkpts[addr] = struct{}{}
+	b := &rcs.Breakpoint{}
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "temp":
+			b.Temp = true
+		case "ignore":
+			if i+1 >= len(args) {
+				return errors.New("not enough arguments")
+			}
+			i++
+			n, err := parseValue(args[i])
+			if err != nil {
+				return err
+			}
+			b.Ignore = n
+		case "if":
+			src := strings.Join(args[i+1:], " ")
+			if src == "" {
+				return errors.New("not enough arguments")
+			}
+			cond, err := rcs.CompileExpr(src, m.cpu)
+			if err != nil {
+				return fmt.Errorf("invalid condition: %v", err)
+			}
+			b.Cond = cond
+			i = len(args)
+		default:
+			return fmt.Errorf("invalid argument: %v", args[i])
+		}
+	}
+	m.brkpts[addr] = b
 	return nil
 }
 
@@ -129,7 +242,7 @@ func (m *modCPU) cmdDisassemble(args []string) error {
 		return fmt.Errorf("cannot disassemble this processor")
 	}
 	if len(args) > 0 {
-		addr, err := parseAddress(m.mem, args[0])
+		addr, err := m.mon.parseAddress(m.mem, args[0])
 		if err != nil {
 			return err
 		}
@@ -137,12 +250,12 @@ func (m *modCPU) cmdDisassemble(args []string) error {
 	}
 	if len(args) > 1 {
 		// list until at ending address
-		addrEnd, err := parseAddress(m.mem, args[1])
+		addrEnd, err := m.mon.parseAddress(m.mem, args[1])
 		if err != nil {
 			return err
 		}
 		for m.dasm.PC() <= addrEnd {
-			m.mon.out.Printf("%v%v\n", m.prefix(), m.dasm.Next())
+			m.mon.cmdOut.Printf("%v%v\n", m.prefix(), m.dasm.NextListing())
 		}
 	} else {
 		// list number of lines
@@ -158,23 +271,43 @@ func (m *modCPU) cmdDisassemble(args []string) error {
 			}
 		}
 		for i := 0; i < lines; i++ {
-			m.mon.out.Printf("%v%v\n", m.prefix(), m.dasm.Next())
+			m.mon.cmdOut.Printf("%v%v\n", m.prefix(), m.dasm.NextListing())
 		}
 	}
 	// m.lastCmd = m.cmdDasmList
 	return nil
 }
 
+func (m *modCPU) cmdHistory(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	n := defaultHistoryLines
+	if len(args) > 0 {
+		v, err := parseValue(args[0])
+		if err != nil {
+			return err
+		}
+		n = v
+	}
+	list, err := m.mon.mach.History(m.name)
+	if err != nil {
+		return err
+	}
+	if n < len(list) {
+		list = list[len(list)-n:]
+	}
+	for _, e := range list {
+		m.mon.cmdOut.Println(rcs.FormatHistory(e, m.cpu, m.dasm))
+	}
+	return nil
+}
+
 func (m *modCPU) cmdInfo(args []string) error {
 	if err := checkLen(args, 0, 0); err != nil {
 		return err
 	}
-	name := ""
-	if m.name != "cpu" {
-		name = m.name + ":"
-	}
-	m.mon.out.Printf("[%v%v]\n", name, m.mon.mach.Status)
-	m.mon.out.Printf("%v", m.cpu)
+	m.mon.cpuInfo(m.mon.cmdOut, m.name)
 	return nil
 }
 
@@ -184,11 +317,22 @@ func (m *modCPU) cmdNext(args []string) error {
 	}
 	ppc := m.dasm.PC()
 	m.dasm.SetPC(m.cpu.PC() + m.cpu.Offset())
-	m.mon.out.Println(m.dasm.Next())
+	m.mon.cmdOut.Println(m.dasm.Next())
 	m.dasm.SetPC(ppc)
 	return nil
 }
 
+func (m *modCPU) cmdRunTo(args []string) error {
+	if err := checkLen(args, 1, 1); err != nil {
+		return err
+	}
+	addr, err := m.mon.parseAddress(m.mem, args[0])
+	if err != nil {
+		return err
+	}
+	return m.mon.mach.RunTo(m.name, addr)
+}
+
 func (m *modCPU) cmdStep(args []string) error {
 	if err := checkLen(args, 0, 0); err != nil {
 		return err
@@ -196,38 +340,81 @@ func (m *modCPU) cmdStep(args []string) error {
 	m.cpu.Next()
 	ppc := m.dasm.PC()
 	m.dasm.SetPC(m.cpu.PC() + m.cpu.Offset())
-	m.mon.out.Println(m.dasm.Next())
+	m.mon.cmdOut.Println(m.dasm.Next())
 	m.dasm.SetPC(ppc)
 	// m.lastCmd = m.cmdStep
 	return nil
 }
 
+func (m *modCPU) cmdStepOut(args []string) error {
+	if err := checkLen(args, 0, 0); err != nil {
+		return err
+	}
+	return m.mon.mach.StepOut(m.name)
+}
+
+func (m *modCPU) cmdStepOver(args []string) error {
+	if err := checkLen(args, 0, 0); err != nil {
+		return err
+	}
+	return m.mon.mach.StepOver(m.name)
+}
+
+func (m *modCPU) cmdSymbols(args []string) error {
+	if err := checkLen(args, 1, 1); err != nil {
+		return err
+	}
+	in, err := os.Open(loadPath(args[0]))
+	if err != nil {
+		return fmt.Errorf("unable to load symbols: %v", err)
+	}
+	defer in.Close()
+	syms, err := rcs.ReadSymbols(in)
+	if err != nil {
+		return fmt.Errorf("unable to load symbols: %v", err)
+	}
+	m.mon.mach.Symbols[m.name].Add(syms)
+	return nil
+}
+
 func (m *modCPU) cmdTrace(args []string) error {
 	if err := checkLen(args, 0, 1); err != nil {
 		return err
 	}
 	if len(args) == 0 {
-		m.mon.mach.Command(rcs.MachTrace, m.name)
-		return nil
+		return m.mon.mach.SetTrace(m.name, !m.mon.mach.Tracing(m.name))
 	}
 	v, err := parseBool(args[0])
 	if err != nil {
 		return err
 	}
-	m.mon.mach.Command(rcs.MachTrace, m.name, v)
-	return nil
+	return m.mon.mach.SetTrace(m.name, v)
 }
 
 func (m *modCPU) AutoComplete() []readline.PrefixCompleterInterface {
 	return []readline.PrefixCompleterInterface{
+		readline.PcItem("assemble",
+			readline.PcItemDynamic(acSymbols(m.mon)),
+		),
 		readline.PcItem("breakpoint-clear"),
 		readline.PcItem("breakpoint-list"),
 		readline.PcItem("breakpoint-none"),
-		readline.PcItem("breakpoint-set"),
-		readline.PcItem("disassemble"),
+		readline.PcItem("breakpoint-set",
+			readline.PcItemDynamic(acSymbols(m.mon)),
+		),
+		readline.PcItem("disassemble",
+			readline.PcItemDynamic(acSymbols(m.mon)),
+		),
+		readline.PcItem("history"),
 		readline.PcItem("info"),
 		readline.PcItem("next"),
+		readline.PcItem("run-to",
+			readline.PcItemDynamic(acSymbols(m.mon)),
+		),
 		readline.PcItem("step"),
+		readline.PcItem("step-out"),
+		readline.PcItem("step-over"),
+		readline.PcItem("symbols"),
 		readline.PcItem("trace"),
 	}
 }
@@ -251,7 +438,7 @@ func newModM6502(mon *Monitor, comp rcs.Component) module {
 	return &modM6502{
 		parent: newModCPU(mon, comp),
 		mon:    mon,
-		out:    mon.out,
+		out:    mon.cmdOut,
 		cpu:    cpu,
 	}
 }
@@ -324,7 +511,7 @@ func newModZ80(mon *Monitor, comp rcs.Component) module {
 	return &modZ80{
 		parent: newModCPU(mon, comp),
 		mon:    mon,
-		out:    mon.out,
+		out:    mon.cmdOut,
 		cpu:    cpu,
 	}
 }
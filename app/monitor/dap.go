@@ -0,0 +1,1051 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/blackchip-org/retro-cs/rcs"
+)
+
+// =========================================================================
+// Debug Adapter Protocol
+//
+// Each CPU is a thread with a single stack frame that has the same id as
+// the thread. Memory, disassembly, and breakpoints are those of the CPU
+// of the thread most recently named in a request, such as "stackTrace".
+// Until then, it is the CPU selected in the monitor or given at launch.
+
+// dapRequest is a request from the editor.
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapResponse struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+// dapThreadArgs are the arguments of requests that only name a thread,
+// such as "continue" and "next".
+type dapThreadArgs struct {
+	ThreadID int `json:"threadId"`
+}
+
+type dapLaunchArgs struct {
+	CPU         string `json:"cpu"`         // CPU to debug
+	Program     string `json:"program"`     // PRG file to load
+	Start       string `json:"start"`       // address to start at
+	Symbols     string `json:"symbols"`     // symbol file to load
+	StopOnEntry bool   `json:"stopOnEntry"` // pause once configured
+}
+
+type dapBreakpointArgs struct {
+	Breakpoints []struct {
+		Name                 string `json:"name"`
+		InstructionReference string `json:"instructionReference"`
+		Offset               int    `json:"offset"`
+		Condition            string `json:"condition"`
+		HitCondition         string `json:"hitCondition"`
+	} `json:"breakpoints"`
+}
+
+type dapBreakpoint struct {
+	ID                   int    `json:"id"`
+	Verified             bool   `json:"verified"`
+	Message              string `json:"message,omitempty"`
+	InstructionReference string `json:"instructionReference,omitempty"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+type dapInstruction struct {
+	Address          string `json:"address"`
+	InstructionBytes string `json:"instructionBytes,omitempty"`
+	Instruction      string `json:"instruction"`
+	Symbol           string `json:"symbol,omitempty"`
+	PresentationHint string `json:"presentationHint,omitempty"`
+}
+
+// breakpointAt is a breakpoint set in the machine by the editor.
+type breakpointAt struct {
+	cpu  string
+	addr int
+}
+
+type dapSession struct {
+	mon     *Monitor
+	r       *bufio.Reader
+	out     chan interface{} // messages to send to the editor
+	threads []string         // CPU name of each thread, starting with 1
+	nextID  int              // id of the next breakpoint
+	owned   map[breakpointAt]bool
+	funcs   []breakpointAt // set by setFunctionBreakpoints
+	insts   []breakpointAt // set by setInstructionBreakpoints
+	launch  bool           // machine should run once configured
+
+	// cpu is only changed on the session goroutine and is guarded
+	// along with the following, which are used by the callback
+	mu         sync.Mutex
+	cpu        string // CPU of the current thread
+	configured bool   // events are only sent once configured
+	stepping   bool   // a step was requested
+	entry      bool   // the next pause is the stop on entry
+}
+
+// ListenAndServeDAP listens on the TCP address and then calls ServeDAP.
+func (m *Monitor) ListenAndServeDAP(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return m.ServeDAP(l)
+}
+
+// ServeDAP accepts connections from editors using the Debug Adapter
+// Protocol on the listener. Connections are handled one at a time until
+// the listener is closed.
+func (m *Monitor) ServeDAP(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		if err := m.serveDAPConn(conn); err != nil {
+			log.Printf("dap: %v", err)
+		}
+		conn.Close()
+	}
+}
+
+func (m *Monitor) serveDAPConn(conn net.Conn) error {
+	// the CPU selected at the console, once no command is changing it
+	m.mu.Lock()
+	sc := m.sc
+	m.mu.Unlock()
+	ses := &dapSession{
+		mon:   m,
+		r:     bufio.NewReader(conn),
+		out:   make(chan interface{}, 64),
+		cpu:   sc,
+		owned: make(map[breakpointAt]bool),
+	}
+	for _, comp := range m.mach.Comps {
+		if _, ok := m.cpu[comp.Name]; ok {
+			ses.threads = append(ses.threads, comp.Name)
+		}
+	}
+	written := make(chan struct{})
+	go func() {
+		ses.write(conn)
+		close(written)
+	}()
+
+	m.dapMu.Lock()
+	m.dap = ses
+	m.dapMu.Unlock()
+	err := ses.run()
+	m.dapMu.Lock()
+	m.dap = nil
+	m.dapMu.Unlock()
+
+	if derr := ses.disconnect(); err == nil {
+		err = derr
+	}
+	close(ses.out)
+	<-written
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// write sends each message to the editor. Once there is an error, the
+// remaining messages are discarded.
+func (ses *dapSession) write(w io.Writer) {
+	seq := 1
+	var err error
+	for msg := range ses.out {
+		if err != nil {
+			continue
+		}
+		switch v := msg.(type) {
+		case *dapResponse:
+			v.Seq = seq
+		case *dapEvent:
+			v.Seq = seq
+		}
+		seq++
+		var data []byte
+		if data, err = json.Marshal(msg); err != nil {
+			continue
+		}
+		_, err = fmt.Fprintf(w, "Content-Length: %v\r\n\r\n%s", len(data), data)
+	}
+}
+
+// maxMessageSize is the largest message accepted from the editor.
+const maxMessageSize = 1 << 20
+
+func (ses *dapSession) read() (*dapRequest, error) {
+	header, err := textproto.NewReader(ses.r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || n < 0 || n > maxMessageSize {
+		return nil, fmt.Errorf("invalid content length: %v", header.Get("Content-Length"))
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(ses.r, data); err != nil {
+		return nil, err
+	}
+	req := &dapRequest{}
+	if err := json.Unmarshal(data, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (ses *dapSession) run() error {
+	for {
+		req, err := ses.read()
+		if err != nil {
+			return err
+		}
+		body, err := ses.handle(req)
+		resp := &dapResponse{
+			Type:       "response",
+			RequestSeq: req.Seq,
+			Success:    err == nil,
+			Command:    req.Command,
+			Body:       body,
+		}
+		if err != nil {
+			resp.Message = err.Error()
+		}
+		ses.out <- resp
+		switch req.Command {
+		case "initialize":
+			if err == nil {
+				ses.out <- &dapEvent{Type: "event", Event: "initialized"}
+			}
+		case "disconnect":
+			return nil
+		}
+	}
+}
+
+// event sends an event without blocking as it is also used from the
+// machine goroutine.
+func (ses *dapSession) event(name string, body interface{}) {
+	select {
+	case ses.out <- &dapEvent{Type: "event", Event: name, Body: body}:
+	default:
+	}
+}
+
+// status is called on the machine goroutine when the status of the
+// machine changes.
+func (ses *dapSession) status(args ...interface{}) {
+	ses.mu.Lock()
+	defer ses.mu.Unlock()
+	if !ses.configured {
+		return
+	}
+	status := args[0].(rcs.Status)
+	if status == rcs.Run {
+		ses.event("continued", map[string]interface{}{
+			"threadId":            ses.threadID(ses.cpu),
+			"allThreadsContinued": true,
+		})
+		return
+	}
+	cpu := ses.cpu
+	if len(args) > 1 {
+		cpu = args[1].(string)
+	}
+	reason := "pause"
+	switch {
+	case status == rcs.Break && ses.stepping:
+		reason = "step"
+	case status == rcs.Break:
+		reason = "breakpoint"
+	case ses.entry:
+		reason = "entry"
+	}
+	ses.stepping, ses.entry = false, false
+	ses.event("stopped", map[string]interface{}{
+		"reason":            reason,
+		"threadId":          ses.threadID(cpu),
+		"allThreadsStopped": true,
+	})
+}
+
+func (ses *dapSession) threadID(cpu string) int {
+	for i, name := range ses.threads {
+		if name == cpu {
+			return i + 1
+		}
+	}
+	return 1
+}
+
+// thread selects the CPU of the thread as the current one.
+func (ses *dapSession) thread(id int) error {
+	if id < 1 || id > len(ses.threads) {
+		return fmt.Errorf("no such thread: %v", id)
+	}
+	ses.mu.Lock()
+	ses.cpu = ses.threads[id-1]
+	ses.mu.Unlock()
+	return nil
+}
+
+// exec runs fn on the machine goroutine.
+func (ses *dapSession) exec(fn func() error) error {
+	_, err := ses.mon.mach.Call(rcs.MachExec, fn)
+	return err
+}
+
+func (ses *dapSession) handle(req *dapRequest) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest":  true,
+			"supportsFunctionBreakpoints":       true,
+			"supportsConditionalBreakpoints":    true,
+			"supportsHitConditionalBreakpoints": true,
+			"supportsEvaluateForHovers":         true,
+			"supportsSetVariable":               true,
+			"supportsReadMemoryRequest":         true,
+			"supportsWriteMemoryRequest":        true,
+			"supportsDisassembleRequest":        true,
+			"supportsInstructionBreakpoints":    true,
+			"supportsSteppingGranularity":       true,
+		}, nil
+	case "launch":
+		return nil, ses.cmdLaunch(req.Arguments, true)
+	case "attach":
+		return nil, ses.cmdLaunch(req.Arguments, false)
+	case "configurationDone":
+		return nil, ses.cmdConfigurationDone()
+	case "setBreakpoints":
+		return ses.cmdSetBreakpoints(req.Arguments)
+	case "setExceptionBreakpoints":
+		return nil, nil
+	case "setFunctionBreakpoints":
+		return ses.cmdSetCodeBreakpoints(req.Arguments, &ses.funcs)
+	case "setInstructionBreakpoints":
+		return ses.cmdSetCodeBreakpoints(req.Arguments, &ses.insts)
+	case "threads":
+		return ses.cmdThreads()
+	case "stackTrace":
+		return ses.cmdStackTrace(req.Arguments)
+	case "scopes":
+		return ses.cmdScopes(req.Arguments)
+	case "variables":
+		return ses.cmdVariables(req.Arguments)
+	case "setVariable":
+		return ses.cmdSetVariable(req.Arguments)
+	case "evaluate":
+		return ses.cmdEvaluate(req.Arguments)
+	case "readMemory":
+		return ses.cmdReadMemory(req.Arguments)
+	case "writeMemory":
+		return ses.cmdWriteMemory(req.Arguments)
+	case "disassemble":
+		return ses.cmdDisassemble(req.Arguments)
+	case "continue":
+		return ses.cmdContinue(req.Arguments)
+	case "next", "stepIn", "stepOut":
+		return nil, ses.cmdStep(req.Command, req.Arguments)
+	case "pause":
+		_, err := ses.mon.mach.Call(rcs.MachPause)
+		return nil, err
+	case "disconnect":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported command: %v", req.Command)
+}
+
+// unmarshal decodes the arguments of a request, which may be missing.
+func unmarshal(data json.RawMessage, v interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// cmdLaunch selects the CPU to debug. When launching, the machine is
+// paused while the program and symbols are loaded and it runs once
+// configured.
+func (ses *dapSession) cmdLaunch(data json.RawMessage, launch bool) error {
+	var args dapLaunchArgs
+	if err := unmarshal(data, &args); err != nil {
+		return err
+	}
+	if args.CPU != "" {
+		if _, ok := ses.mon.cpu[args.CPU]; !ok {
+			return fmt.Errorf("no such CPU: %v", args.CPU)
+		}
+	}
+	ses.launch = launch
+	ses.mu.Lock()
+	if args.CPU != "" {
+		ses.cpu = args.CPU
+	}
+	ses.entry = args.StopOnEntry
+	ses.mu.Unlock()
+	if !launch {
+		return nil
+	}
+	if _, err := ses.mon.mach.Call(rcs.MachPause); err != nil {
+		return err
+	}
+	var prg []uint8
+	if args.Program != "" {
+		var err error
+		if prg, err = ioutil.ReadFile(args.Program); err != nil {
+			return err
+		}
+		if len(prg) < 2 {
+			return fmt.Errorf("%v: missing load address", args.Program)
+		}
+	}
+	var syms rcs.Symbols
+	if args.Symbols != "" {
+		var err error
+		if syms, err = readSymbolFile(args.Symbols); err != nil {
+			return err
+		}
+	}
+	return ses.exec(func() error {
+		cpu := ses.mon.cpu[ses.cpu]
+		mem := cpu.Memory()
+		ses.mon.mach.Symbols[ses.cpu].Add(syms)
+		if prg != nil {
+			addr := int(prg[0]) | int(prg[1])<<8
+			for i, v := range prg[2:] {
+				mem.Write(addr+i, v)
+			}
+		}
+		if args.Start != "" {
+			addr, err := ses.mon.parseAddress(mem, args.Start)
+			if err != nil {
+				return err
+			}
+			cpu.SetPC(addr - cpu.Offset())
+		}
+		return nil
+	})
+}
+
+func readSymbolFile(filename string) (rcs.Symbols, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	syms, err := rcs.ReadSymbols(strings.NewReader(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return syms, nil
+}
+
+func (ses *dapSession) cmdConfigurationDone() error {
+	ses.mu.Lock()
+	ses.configured = true
+	entry := ses.entry
+	ses.mu.Unlock()
+	cmd := rcs.MachStart
+	switch {
+	case entry:
+		cmd = rcs.MachPause
+	case !ses.launch:
+		return nil
+	}
+	_, err := ses.mon.mach.Call(cmd)
+	return err
+}
+
+// cmdSetBreakpoints rejects breakpoints on source lines as there is no
+// line information.
+func (ses *dapSession) cmdSetBreakpoints(data json.RawMessage) (interface{}, error) {
+	var args dapBreakpointArgs
+	if err := unmarshal(data, &args); err != nil {
+		return nil, err
+	}
+	var bps []dapBreakpoint
+	for range args.Breakpoints {
+		ses.nextID++
+		bps = append(bps, dapBreakpoint{
+			ID:      ses.nextID,
+			Message: "source lines are not known, use a function or instruction breakpoint",
+		})
+	}
+	return map[string]interface{}{"breakpoints": bps}, nil
+}
+
+// cmdSetCodeBreakpoints replaces the breakpoints of one kind, function or
+// instruction, with those in the request. Functions are symbols or
+// addresses. An existing breakpoint set in the monitor is left alone.
+func (ses *dapSession) cmdSetCodeBreakpoints(data json.RawMessage, set *[]breakpointAt) (interface{}, error) {
+	var args dapBreakpointArgs
+	if err := unmarshal(data, &args); err != nil {
+		return nil, err
+	}
+	var bps []dapBreakpoint
+	err := ses.exec(func() error {
+		brkpts := ses.mon.mach.Breakpoints
+		for _, b := range *set {
+			if ses.owned[b] {
+				delete(brkpts[b.cpu], b.addr)
+				delete(ses.owned, b)
+			}
+		}
+		*set = nil
+
+		cpu := ses.mon.cpu[ses.cpu]
+		mem := cpu.Memory()
+		for _, arg := range args.Breakpoints {
+			ses.nextID++
+			bp := dapBreakpoint{ID: ses.nextID}
+			bps = append(bps, bp)
+			var addr int
+			var err error
+			if arg.InstructionReference != "" {
+				addr, err = parseReference(arg.InstructionReference, arg.Offset)
+			} else {
+				addr, err = ses.mon.parseAddress(mem, arg.Name)
+			}
+			if err != nil {
+				bps[len(bps)-1].Message = err.Error()
+				continue
+			}
+			b := &rcs.Breakpoint{}
+			if arg.Condition != "" {
+				if b.Cond, err = rcs.CompileExpr(arg.Condition, cpu); err != nil {
+					bps[len(bps)-1].Message = err.Error()
+					continue
+				}
+			}
+			if arg.HitCondition != "" {
+				n, err := parseValue(arg.HitCondition)
+				if err != nil || n < 1 {
+					bps[len(bps)-1].Message = fmt.Sprintf("invalid hit count: %v", arg.HitCondition)
+					continue
+				}
+				b.Ignore = n - 1
+			}
+			at := breakpointAt{cpu: ses.cpu, addr: addr}
+			if _, exists := brkpts[at.cpu][addr]; !exists {
+				brkpts[at.cpu][addr] = b
+				ses.owned[at] = true
+			}
+			*set = append(*set, at)
+			bps[len(bps)-1].Verified = true
+			bps[len(bps)-1].InstructionReference = formatReference(addr)
+		}
+		return nil
+	})
+	return map[string]interface{}{"breakpoints": bps}, err
+}
+
+// parseReference returns the address of a memory or instruction
+// reference, "0xc000", plus the offset.
+func parseReference(ref string, offset int) (int, error) {
+	addr, err := strconv.ParseInt(ref, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid reference: %v", ref)
+	}
+	return int(addr) + offset, nil
+}
+
+func formatReference(addr int) string {
+	if addr < 0 {
+		// padding before the start of memory
+		return fmt.Sprintf("-0x%04x", -addr)
+	}
+	return fmt.Sprintf("0x%04x", addr)
+}
+
+func (ses *dapSession) cmdThreads() (interface{}, error) {
+	var threads []map[string]interface{}
+	for i, name := range ses.threads {
+		threads = append(threads, map[string]interface{}{
+			"id":   i + 1,
+			"name": name,
+		})
+	}
+	return map[string]interface{}{"threads": threads}, nil
+}
+
+func (ses *dapSession) cmdStackTrace(data json.RawMessage) (interface{}, error) {
+	var args dapThreadArgs
+	if err := unmarshal(data, &args); err != nil {
+		return nil, err
+	}
+	if err := ses.thread(args.ThreadID); err != nil {
+		return nil, err
+	}
+	var addr int
+	var name string
+	err := ses.exec(func() error {
+		cpu := ses.mon.cpu[ses.cpu]
+		addr = cpu.PC() + cpu.Offset()
+		name = ses.mon.mach.Symbols[ses.cpu].Lookup(addr)
+		return nil
+	})
+	if name == "" {
+		name = fmt.Sprintf("$%04x", addr)
+	}
+	frame := map[string]interface{}{
+		"id":                          args.ThreadID,
+		"name":                        name,
+		"line":                        0,
+		"column":                      0,
+		"instructionPointerReference": formatReference(addr),
+	}
+	return map[string]interface{}{
+		"stackFrames": []interface{}{frame},
+		"totalFrames": 1,
+	}, err
+}
+
+// Variable references are the thread id shifted left by one with the low
+// bit clear for registers and set for flags.
+const (
+	scopeRegisters = 0
+	scopeFlags     = 1
+)
+
+var scopePrefixes = map[int]string{
+	scopeRegisters: "r.",
+	scopeFlags:     "f.",
+}
+
+func (ses *dapSession) cmdScopes(data json.RawMessage) (interface{}, error) {
+	var args struct {
+		FrameID int `json:"frameId"`
+	}
+	if err := unmarshal(data, &args); err != nil {
+		return nil, err
+	}
+	if err := ses.thread(args.FrameID); err != nil {
+		return nil, err
+	}
+	scopes := []map[string]interface{}{
+		{"name": "Registers", "variablesReference": args.FrameID<<1 | scopeRegisters, "expensive": false},
+		{"name": "Flags", "variablesReference": args.FrameID<<1 | scopeFlags, "expensive": false},
+	}
+	return map[string]interface{}{"scopes": scopes}, nil
+}
+
+// registers returns the registers or flags of the CPU named without the
+// prefix. The program counter is first and the others are sorted by name.
+// Must be called on the machine goroutine.
+func (ses *dapSession) registers(scope int) []dapVariable {
+	r, ok := ses.mon.cpu[ses.cpu].(rcs.CPURegisters)
+	if !ok {
+		return nil
+	}
+	prefix := scopePrefixes[scope]
+	var vars []dapVariable
+	for name, load := range r.Registers() {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		vars = append(vars, dapVariable{
+			Name:  strings.TrimPrefix(name, prefix),
+			Value: formatRegister(scope, load()),
+		})
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		if vars[i].Name == "pc" || vars[j].Name == "pc" {
+			return vars[i].Name == "pc"
+		}
+		return vars[i].Name < vars[j].Name
+	})
+	return vars
+}
+
+func formatRegister(scope int, v int) string {
+	switch {
+	case scope == scopeFlags:
+		return strconv.Itoa(v)
+	case v > 0xff:
+		return fmt.Sprintf("$%04x", v)
+	}
+	return fmt.Sprintf("$%02x", v)
+}
+
+// variableScope selects the thread of a variable reference and returns the
+// scope.
+func (ses *dapSession) variableScope(ref int) (int, error) {
+	scope := ref & 1
+	return scope, ses.thread(ref >> 1)
+}
+
+func (ses *dapSession) cmdVariables(data json.RawMessage) (interface{}, error) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	if err := unmarshal(data, &args); err != nil {
+		return nil, err
+	}
+	scope, err := ses.variableScope(args.VariablesReference)
+	if err != nil {
+		return nil, err
+	}
+	vars := []dapVariable{}
+	err = ses.exec(func() error {
+		vars = append(vars, ses.registers(scope)...)
+		return nil
+	})
+	return map[string]interface{}{"variables": vars}, err
+}
+
+// cmdSetVariable sets a register or flag with the same command used in
+// the monitor, "r.a $41".
+func (ses *dapSession) cmdSetVariable(data json.RawMessage) (interface{}, error) {
+	var args struct {
+		VariablesReference int    `json:"variablesReference"`
+		Name               string `json:"name"`
+		Value              string `json:"value"`
+	}
+	if err := unmarshal(data, &args); err != nil {
+		return nil, err
+	}
+	scope, err := ses.variableScope(args.VariablesReference)
+	if err != nil {
+		return nil, err
+	}
+	var value string
+	err = ses.exec(func() error {
+		name := scopePrefixes[scope] + args.Name
+		if err := ses.mon.mods[ses.cpu].Command([]string{name, args.Value}); err != nil {
+			return err
+		}
+		for _, v := range ses.registers(scope) {
+			if v.Name == args.Name {
+				value = v.Value
+			}
+		}
+		return nil
+	})
+	return map[string]interface{}{"value": value}, err
+}
+
+// cmdEvaluate evaluates an expression in the same way as a breakpoint
+// condition.
+func (ses *dapSession) cmdEvaluate(data json.RawMessage) (interface{}, error) {
+	var args struct {
+		Expression string `json:"expression"`
+		FrameID    int    `json:"frameId"`
+	}
+	if err := unmarshal(data, &args); err != nil {
+		return nil, err
+	}
+	if args.FrameID != 0 {
+		if err := ses.thread(args.FrameID); err != nil {
+			return nil, err
+		}
+	}
+	var result string
+	err := ses.exec(func() error {
+		expr, err := rcs.CompileExpr(args.Expression, ses.mon.cpu[ses.cpu])
+		if err != nil {
+			return err
+		}
+		result = formatValue(expr.Eval())
+		return nil
+	})
+	return map[string]interface{}{
+		"result":             result,
+		"variablesReference": 0,
+	}, err
+}
+
+// memoryRange returns the memory of the current CPU and the address of the
+// reference, plus the offset, after checking that it is valid. Must be
+// called on the machine goroutine.
+func (ses *dapSession) memoryRange(ref string, offset int) (*rcs.Memory, int, error) {
+	mem := ses.mon.cpu[ses.cpu].Memory()
+	if mem == nil {
+		return nil, 0, errors.New("CPU does not have memory")
+	}
+	addr, err := parseReference(ref, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if addr < 0 || addr > mem.MaxAddr {
+		return nil, 0, fmt.Errorf("invalid address: $%x", addr)
+	}
+	return mem, addr, nil
+}
+
+func (ses *dapSession) cmdReadMemory(data json.RawMessage) (interface{}, error) {
+	var args struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Count           int    `json:"count"`
+	}
+	if err := unmarshal(data, &args); err != nil {
+		return nil, err
+	}
+	var values []uint8
+	var addr int
+	err := ses.exec(func() error {
+		var mem *rcs.Memory
+		var err error
+		if mem, addr, err = ses.memoryRange(args.MemoryReference, args.Offset); err != nil {
+			return err
+		}
+		for i := 0; i < args.Count && addr+i <= mem.MaxAddr; i++ {
+			values = append(values, mem.Read(addr+i))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"address":         formatReference(addr),
+		"data":            base64.StdEncoding.EncodeToString(values),
+		"unreadableBytes": args.Count - len(values),
+	}, nil
+}
+
+func (ses *dapSession) cmdWriteMemory(data json.RawMessage) (interface{}, error) {
+	var args struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Data            string `json:"data"`
+	}
+	if err := unmarshal(data, &args); err != nil {
+		return nil, err
+	}
+	values, err := base64.StdEncoding.DecodeString(args.Data)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	err = ses.exec(func() error {
+		mem, addr, err := ses.memoryRange(args.MemoryReference, args.Offset)
+		if err != nil {
+			return err
+		}
+		for ; n < len(values) && addr+n <= mem.MaxAddr; n++ {
+			mem.Write(addr+n, values[n])
+		}
+		return nil
+	})
+	return map[string]interface{}{"bytesWritten": n}, err
+}
+
+// maxInstructionSize is the most bytes used by an instruction of any CPU,
+// used to find the instructions before an address.
+const maxInstructionSize = 4
+
+// maxInstructions is the most instructions returned, or skipped with the
+// instruction offset, for a single disassemble request.
+const maxInstructions = 0x1000
+
+// cmdDisassemble disassembles with the tracer of the current CPU. For the
+// instructions before the reference, disassembly starts far enough back
+// to find them, but it may not be aligned with the actual code. Where
+// there is no memory, each invalid instruction is given an address one
+// byte away from the one next to it.
+func (ses *dapSession) cmdDisassemble(data json.RawMessage) (interface{}, error) {
+	var args struct {
+		MemoryReference   string `json:"memoryReference"`
+		Offset            int    `json:"offset"`
+		InstructionOffset int    `json:"instructionOffset"`
+		InstructionCount  int    `json:"instructionCount"`
+	}
+	if err := unmarshal(data, &args); err != nil {
+		return nil, err
+	}
+	if args.InstructionCount > maxInstructions {
+		args.InstructionCount = maxInstructions
+	}
+	if args.InstructionOffset > maxInstructions {
+		args.InstructionOffset = maxInstructions
+	}
+	if args.InstructionOffset < -maxInstructions {
+		args.InstructionOffset = -maxInstructions
+	}
+	var insts []dapInstruction
+	err := ses.exec(func() error {
+		dasm := ses.mon.tracers[ses.cpu]
+		if dasm == nil {
+			return errors.New("disassembly not supported by CPU")
+		}
+		mem, addr, err := ses.memoryRange(args.MemoryReference, args.Offset)
+		if err != nil {
+			return err
+		}
+		invalid := func(addr int) dapInstruction {
+			return dapInstruction{
+				Address:          formatReference(addr),
+				Instruction:      "??",
+				PresentationHint: "invalid",
+			}
+		}
+
+		start := addr
+		if args.InstructionOffset < 0 {
+			back := -args.InstructionOffset
+			var before []rcs.Stmt
+			from := addr - back*maxInstructionSize
+			if from < 0 {
+				from = 0
+			}
+			dasm.SetPC(from)
+			for dasm.PC() < addr {
+				before = append(before, dasm.NextStmt())
+			}
+			if len(before) > back {
+				before = before[len(before)-back:]
+			}
+			first := from
+			if len(before) > 0 {
+				first = before[0].Addr
+			}
+			for i := back - len(before); i > 0; i-- {
+				insts = append(insts, invalid(first-i))
+			}
+			for _, s := range before {
+				insts = append(insts, newDAPInstruction(s))
+			}
+			start = dasm.PC()
+		} else {
+			dasm.SetPC(addr)
+			for i := 0; i < args.InstructionOffset; i++ {
+				dasm.NextStmt()
+			}
+			start = dasm.PC()
+		}
+
+		dasm.SetPC(start)
+		next := start
+		for len(insts) < args.InstructionCount {
+			if next > mem.MaxAddr {
+				insts = append(insts, invalid(next))
+				next++
+				continue
+			}
+			s := dasm.NextStmt()
+			insts = append(insts, newDAPInstruction(s))
+			next = s.Addr + len(s.Bytes)
+		}
+		if len(insts) > args.InstructionCount {
+			insts = insts[:args.InstructionCount]
+		}
+		return nil
+	})
+	return map[string]interface{}{"instructions": insts}, err
+}
+
+func newDAPInstruction(s rcs.Stmt) dapInstruction {
+	var code []string
+	for _, b := range s.Bytes {
+		code = append(code, fmt.Sprintf("%02x", b))
+	}
+	return dapInstruction{
+		Address:          formatReference(s.Addr),
+		InstructionBytes: strings.Join(code, " "),
+		Instruction:      s.Op,
+		Symbol:           s.Label,
+	}
+}
+
+func (ses *dapSession) cmdContinue(data json.RawMessage) (interface{}, error) {
+	var args dapThreadArgs
+	if err := unmarshal(data, &args); err != nil {
+		return nil, err
+	}
+	if _, err := ses.mon.mach.Call(rcs.MachStart); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"allThreadsContinued": true}, nil
+}
+
+// cmdStep steps the CPU of the thread one instruction. A "next" steps
+// over subroutine calls when supported by the CPU.
+func (ses *dapSession) cmdStep(cmd string, data json.RawMessage) error {
+	var args dapThreadArgs
+	if err := unmarshal(data, &args); err != nil {
+		return err
+	}
+	if err := ses.thread(args.ThreadID); err != nil {
+		return err
+	}
+	ses.mu.Lock()
+	ses.stepping = true
+	ses.mu.Unlock()
+	err := ses.exec(func() error {
+		mach := ses.mon.mach
+		_, stepper := ses.mon.cpu[ses.cpu].(rcs.CPUStepper)
+		switch {
+		case cmd == "next" && stepper:
+			return mach.StepOver(ses.cpu)
+		case cmd == "stepOut":
+			return mach.StepOut(ses.cpu)
+		}
+		return mach.Step(ses.cpu)
+	})
+	if err != nil {
+		ses.mu.Lock()
+		ses.stepping = false
+		ses.mu.Unlock()
+	}
+	return err
+}
+
+// disconnect removes the breakpoints set by the editor and resumes the
+// machine.
+func (ses *dapSession) disconnect() error {
+	err := ses.exec(func() error {
+		for b := range ses.owned {
+			delete(ses.mon.mach.Breakpoints[b.cpu], b.addr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = ses.mon.mach.Call(rcs.MachStart)
+	return err
+}
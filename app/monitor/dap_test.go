@@ -0,0 +1,340 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/blackchip-org/retro-cs/rcs"
+	"github.com/blackchip-org/retro-cs/rcs/m6502"
+)
+
+// dapClient is a scripted editor.
+type dapClient struct {
+	t      *testing.T
+	conn   net.Conn
+	r      *bufio.Reader
+	seq    int
+	events []map[string]interface{}
+}
+
+func (c *dapClient) recv() map[string]interface{} {
+	header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	n, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		c.t.Fatal(err)
+	}
+	var msg map[string]interface{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+// request sends a request and returns the body of the response. Events
+// received before the response are queued.
+func (c *dapClient) request(cmd string, args interface{}) map[string]interface{} {
+	c.seq++
+	data, err := json.Marshal(map[string]interface{}{
+		"seq":       c.seq,
+		"type":      "request",
+		"command":   cmd,
+		"arguments": args,
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	fmt.Fprintf(c.conn, "Content-Length: %v\r\n\r\n%s", len(data), data)
+	for {
+		msg := c.recv()
+		if msg["type"] == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if msg["request_seq"] != float64(c.seq) || msg["command"] != cmd {
+			c.t.Fatalf("unexpected response to %v: %v", cmd, msg)
+		}
+		if msg["success"] != true {
+			c.t.Fatalf("%v: %v", cmd, msg["message"])
+		}
+		body, _ := msg["body"].(map[string]interface{})
+		return body
+	}
+}
+
+// event returns the body of the next event with the given name, skipping
+// any others.
+func (c *dapClient) event(name string) map[string]interface{} {
+	for {
+		var msg map[string]interface{}
+		if len(c.events) > 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = c.recv()
+		}
+		if msg["type"] == "event" && msg["event"] == name {
+			body, _ := msg["body"].(map[string]interface{})
+			return body
+		}
+	}
+}
+
+// get returns the value at the path in a decoded message.
+func get(v interface{}, path ...interface{}) interface{} {
+	for _, p := range path {
+		switch k := p.(type) {
+		case string:
+			v = v.(map[string]interface{})[k]
+		case int:
+			v = v.([]interface{})[k]
+		}
+	}
+	return v
+}
+
+func newDAPMach() *rcs.Mach {
+	ram := make([]uint8, 0x10000)
+	mem := rcs.NewMemory(1, len(ram))
+	mem.MapRAM(0, ram)
+	return &rcs.Mach{
+		Comps: []rcs.Component{
+			rcs.NewComponent("mem", "mem", "", mem),
+			rcs.NewComponent("cpu", "m6502", "mem", m6502.New(mem)),
+		},
+		Clock: 1000000,
+	}
+}
+
+func TestDAP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// $c000: lda #$41
+	// loop:  inx
+	//        jmp loop
+	prg := filepath.Join(dir, "test.prg")
+	code := []uint8{0x00, 0xc0, 0xa9, 0x41, 0xe8, 0x4c, 0x02, 0xc0}
+	if err := ioutil.WriteFile(prg, code, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sym := filepath.Join(dir, "test.sym")
+	if err := ioutil.WriteFile(sym, []byte("loop = $c002\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mach := newDAPMach()
+	mon, err := New(mach)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mon.out.SetOutput(ioutil.Discard)
+	mon.cmdOut.SetOutput(ioutil.Discard)
+	done := make(chan error)
+	go func() { done <- mach.Run() }()
+	for !mach.Running() {
+		runtime.Gosched()
+	}
+	defer func() {
+		mach.Command(rcs.MachQuit)
+		<-done
+	}()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go mon.ServeDAP(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := &dapClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+
+	check := func(name string, have interface{}, want interface{}) {
+		t.Helper()
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("%v:\n have: %v \n want: %v", name, have, want)
+		}
+	}
+
+	body := c.request("initialize", map[string]interface{}{"adapterID": "retro-cs"})
+	check("disassemble", body["supportsDisassembleRequest"], true)
+	c.event("initialized")
+	c.request("launch", map[string]interface{}{
+		"program":     prg,
+		"symbols":     sym,
+		"start":       "$c000",
+		"stopOnEntry": true,
+	})
+	body = c.request("setFunctionBreakpoints", map[string]interface{}{
+		"breakpoints": []interface{}{
+			map[string]interface{}{"name": "loop"},
+			map[string]interface{}{"name": "nowhere"},
+		},
+	})
+	check("loop verified", get(body, "breakpoints", 0, "verified"), true)
+	check("loop reference", get(body, "breakpoints", 0, "instructionReference"), "0xc002")
+	check("nowhere verified", get(body, "breakpoints", 1, "verified"), false)
+	c.request("setExceptionBreakpoints", map[string]interface{}{"filters": []interface{}{}})
+	c.request("configurationDone", nil)
+	body = c.event("stopped")
+	check("entry", body["reason"], "entry")
+
+	body = c.request("threads", nil)
+	check("threads", get(body, "threads", 0, "name"), "cpu")
+	body = c.request("stackTrace", map[string]interface{}{"threadId": 1})
+	check("entry frame", get(body, "stackFrames", 0, "instructionPointerReference"), "0xc000")
+
+	c.request("continue", map[string]interface{}{"threadId": 1})
+	body = c.event("stopped")
+	check("breakpoint", body["reason"], "breakpoint")
+	body = c.request("stackTrace", map[string]interface{}{"threadId": 1})
+	check("breakpoint frame", get(body, "stackFrames", 0, "name"), "loop")
+
+	body = c.request("scopes", map[string]interface{}{"frameId": 1})
+	check("scopes", get(body, "scopes", 1, "name"), "Flags")
+	regs := int(get(body, "scopes", 0, "variablesReference").(float64))
+	body = c.request("variables", map[string]interface{}{"variablesReference": regs})
+	check("pc name", get(body, "variables", 0, "name"), "pc")
+	check("a name", get(body, "variables", 1, "name"), "a")
+	check("a value", get(body, "variables", 1, "value"), "$41")
+	body = c.request("setVariable", map[string]interface{}{
+		"variablesReference": regs,
+		"name":               "x",
+		"value":              "$10",
+	})
+	check("set x", body["value"], "$10")
+
+	c.request("next", map[string]interface{}{"threadId": 1})
+	body = c.event("stopped")
+	check("step", body["reason"], "step")
+	body = c.request("evaluate", map[string]interface{}{"expression": "x + 1", "frameId": 1})
+	check("evaluate", body["result"], formatValue(0x12))
+
+	body = c.request("readMemory", map[string]interface{}{
+		"memoryReference": "0xc000",
+		"offset":          1,
+		"count":           2,
+	})
+	check("read address", body["address"], "0xc001")
+	check("read data", body["data"], "Qeg=")
+	body = c.request("writeMemory", map[string]interface{}{
+		"memoryReference": "0xc001",
+		"data":            "Qg==",
+	})
+	check("write", body["bytesWritten"], float64(1))
+
+	body = c.request("disassemble", map[string]interface{}{
+		"memoryReference":   "0xc002",
+		"instructionOffset": -1,
+		"instructionCount":  3,
+	})
+	check("dasm before", get(body, "instructions", 0, "instruction"), "lda #$42")
+	check("dasm symbol", get(body, "instructions", 1, "symbol"), "loop")
+	check("dasm jump", get(body, "instructions", 2, "instruction"), "jmp loop")
+	check("dasm bytes", get(body, "instructions", 2, "instructionBytes"), "4c 02 c0")
+
+	// padding before and after memory
+	addrs := func(body map[string]interface{}) []string {
+		var have []string
+		for _, inst := range body["instructions"].([]interface{}) {
+			have = append(have, get(inst, "address").(string))
+		}
+		return have
+	}
+	body = c.request("disassemble", map[string]interface{}{
+		"memoryReference":   "0x0001",
+		"instructionOffset": -3,
+		"instructionCount":  4,
+	})
+	check("dasm start", addrs(body), []string{"-0x0002", "-0x0001", "0x0000", "0x0001"})
+	body = c.request("disassemble", map[string]interface{}{
+		"memoryReference":  "0xfffe",
+		"instructionCount": 4,
+	})
+	check("dasm end", addrs(body), []string{"0xfffe", "0xffff", "0x10000", "0x10001"})
+	body = c.request("disassemble", map[string]interface{}{
+		"memoryReference":  "0xc000",
+		"instructionCount": 1000000,
+	})
+	check("dasm count", len(addrs(body)), maxInstructions)
+
+	c.request("setFunctionBreakpoints", map[string]interface{}{"breakpoints": []interface{}{}})
+	c.request("continue", map[string]interface{}{"threadId": 1})
+	c.request("pause", map[string]interface{}{"threadId": 1})
+	body = c.event("stopped")
+	check("pause", body["reason"], "pause")
+
+	body = c.request("setInstructionBreakpoints", map[string]interface{}{
+		"breakpoints": []interface{}{
+			map[string]interface{}{"instructionReference": "0xc000", "offset": 2},
+		},
+	})
+	check("instruction", get(body, "breakpoints", 0, "instructionReference"), "0xc002")
+	c.request("disconnect", nil)
+	// breakpoints are removed and the machine is running after a
+	// disconnect
+	if _, err := c.r.ReadByte(); err != io.EOF {
+		t.Fatalf("expected connection to close: %v", err)
+	}
+	var status rcs.Status
+	var n int
+	mach.Call(rcs.MachExec, func() error {
+		status, n = mach.Status, len(mach.Breakpoints["cpu"])
+		return nil
+	})
+	check("disconnect", []interface{}{status, n}, []interface{}{rcs.Run, 0})
+}
+
+func TestDAPInvalidLength(t *testing.T) {
+	mon := NewHeadless(newDAPMach())
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go mon.ServeDAP(l)
+
+	for _, length := range []string{"-1", strconv.Itoa(maxMessageSize + 1)} {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(conn, "Content-Length: %v\r\n\r\n", length)
+		// the session ends without taking down the server
+		if _, err := bufio.NewReader(conn).ReadByte(); err != io.EOF {
+			t.Errorf("%v: expected connection to close: %v", length, err)
+		}
+		conn.Close()
+	}
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := &dapClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	body := c.request("initialize", map[string]interface{}{"adapterID": "retro-cs"})
+	if have, want := body["supportsDisassembleRequest"], true; have != want {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+}
@@ -19,7 +19,7 @@ type modGalaga struct {
 func newModGalaga(mon *Monitor, comp rcs.Component) module {
 	return &modGalaga{
 		mon:    mon,
-		out:    mon.out,
+		out:    mon.cmdOut,
 		galaga: comp.C.(*galaga.System),
 	}
 }
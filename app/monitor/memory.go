@@ -2,33 +2,34 @@ package monitor
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/chzyer/readline"
 
+	"github.com/blackchip-org/retro-cs/config"
 	"github.com/blackchip-org/retro-cs/rcs"
 )
 
 type modMemory struct {
-	name    string
-	mon     *Monitor
-	mem     *rcs.Memory
-	ptr     *rcs.Pointer
-	watches map[int]string
+	name string
+	mon  *Monitor
+	mem  *rcs.Memory
+	ptr  *rcs.Pointer
 }
 
 func newModMemory(mon *Monitor, comp rcs.Component) module {
 	mem := comp.C.(*rcs.Memory)
 	mod := &modMemory{
-		name:    comp.Name,
-		mon:     mon,
-		mem:     mem,
-		ptr:     rcs.NewPointer(mem),
-		watches: make(map[int]string),
+		name: comp.Name,
+		mon:  mon,
+		mem:  mem,
+		ptr:  rcs.NewPointer(mem),
 	}
-	mem.Callback = mod.watchCallback
 	return mod
 }
 
@@ -40,6 +41,14 @@ func (m *modMemory) Command(args []string) error {
 		return m.cmdDump(args[0:])
 	}
 	switch args[0] {
+	case "coverage":
+		return m.cmdCoverage(args[1:])
+	case "coverage-load":
+		return m.cmdCoverageLoad(args[1:])
+	case "coverage-reset":
+		return m.cmdCoverageReset(args[1:])
+	case "coverage-save":
+		return m.cmdCoverageSave(args[1:])
 	case "dump":
 		return m.cmdDump(args[1:])
 	case "fill":
@@ -60,6 +69,75 @@ func (m *modMemory) Command(args []string) error {
 	return m.cmdDump(args[0:])
 }
 
+func (m *modMemory) cmdCoverage(args []string) error {
+	if err := checkLen(args, 0, 0); err != nil {
+		return err
+	}
+	var code, read, write int
+	for addr := 0; addr <= m.mem.MaxAddr; addr++ {
+		c := m.mem.Coverage(addr)
+		if c&rcs.CoverCode != 0 {
+			code++
+		}
+		if c&rcs.CoverRead != 0 {
+			read++
+		}
+		if c&rcs.CoverWrite != 0 {
+			write++
+		}
+	}
+	m.mon.cmdOut.Printf("%vcode: %v, read: %v, written: %v\n", m.prefix(), code, read, write)
+	return nil
+}
+
+func (m *modMemory) cmdCoverageLoad(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	in, err := os.Open(m.coverageFile(args))
+	if err != nil {
+		return fmt.Errorf("unable to load coverage: %v", err)
+	}
+	defer in.Close()
+	if err := m.mem.ReadCoverage(in); err != nil {
+		return fmt.Errorf("unable to load coverage: %v", err)
+	}
+	return nil
+}
+
+func (m *modMemory) cmdCoverageReset(args []string) error {
+	if err := checkLen(args, 0, 0); err != nil {
+		return err
+	}
+	m.mem.ResetCoverage()
+	return nil
+}
+
+func (m *modMemory) cmdCoverageSave(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	out, err := os.Create(m.coverageFile(args))
+	if err != nil {
+		return fmt.Errorf("unable to save coverage: %v", err)
+	}
+	defer out.Close()
+	if err := m.mem.WriteCoverage(out); err != nil {
+		return fmt.Errorf("unable to save coverage: %v", err)
+	}
+	return nil
+}
+
+// coverageFile returns the file given in args, or the default name for
+// this memory, in the directory for runtime data.
+func (m *modMemory) coverageFile(args []string) string {
+	filename := m.name + ".coverage"
+	if len(args) > 0 {
+		filename = args[0]
+	}
+	return filepath.Join(config.VarDir, filename)
+}
+
 func (m *modMemory) cmdDump(args []string) error {
 	if err := checkLen(args, 0, 2); err != nil {
 		return err
@@ -69,7 +147,7 @@ func (m *modMemory) cmdDump(args []string) error {
 		addrStart = m.ptr.Addr()
 	}
 	if len(args) > 0 {
-		addr, err := parseAddress(m.mem, args[0])
+		addr, err := m.mon.parseAddress(m.mem, args[0])
 		if err != nil {
 			return err
 		}
@@ -77,7 +155,7 @@ func (m *modMemory) cmdDump(args []string) error {
 	}
 	addrEnd := addrStart + (m.mon.memLines * 16)
 	if len(args) > 1 {
-		addr, err := parseAddress(m.mem, args[1])
+		addr, err := m.mon.parseAddress(m.mem, args[1])
 		if err != nil {
 			return err
 		}
@@ -87,7 +165,7 @@ func (m *modMemory) cmdDump(args []string) error {
 	if !ok {
 		return fmt.Errorf("invalid encoding: %v", m.mon.encoding)
 	}
-	m.mon.out.Println(dump(m.mem, addrStart, addrEnd, decoder, m.prefix()))
+	m.mon.cmdOut.Println(dump(m.mem, addrStart, addrEnd, decoder, m.prefix()))
 	m.ptr.SetAddr(addrEnd)
 	//mon.lastCmd = m.cmdMemoryDump
 	return nil
@@ -97,11 +175,11 @@ func (m *modMemory) cmdFill(args []string) error {
 	if err := checkLen(args, 3, 3); err != nil {
 		return err
 	}
-	startAddr, err := parseAddress(m.mem, args[0])
+	startAddr, err := m.mon.parseAddress(m.mem, args[0])
 	if err != nil {
 		return err
 	}
-	endAddr, err := parseAddress(m.mem, args[1])
+	endAddr, err := m.mon.parseAddress(m.mem, args[1])
 	if err != nil {
 		return err
 	}
@@ -122,12 +200,12 @@ func (m *modMemory) cmdPeek(args []string) error {
 	if err := checkLen(args, 1, 1); err != nil {
 		return err
 	}
-	addr, err := parseAddress(m.mem, args[0])
+	addr, err := m.mon.parseAddress(m.mem, args[0])
 	if err != nil {
 		return err
 	}
 	v := m.mem.Read(addr)
-	m.mon.out.Print(formatValue(int(v)))
+	m.mon.cmdOut.Print(formatValue(int(v)))
 	return nil
 }
 
@@ -135,7 +213,7 @@ func (m *modMemory) cmdPoke(args []string) error {
 	if err := checkLen(args, 2, maxArgs); err != nil {
 		return err
 	}
-	addr, err := parseAddress(m.mem, args[0])
+	addr, err := m.mon.parseAddress(m.mem, args[0])
 	if err != nil {
 		return err
 	}
@@ -155,13 +233,14 @@ func (m *modMemory) cmdWatchClear(args []string) error {
 	if err := checkLen(args, 1, 1); err != nil {
 		return err
 	}
-	addr, err := parseAddress(m.mem, args[0])
+	start, end, err := m.parseRange(args[0])
 	if err != nil {
 		return err
 	}
-	if _, ok := m.watches[addr]; ok {
-		delete(m.watches, addr)
-		m.mem.Unwatch(addr)
+	for addr := start; addr <= end; addr++ {
+		if err := m.mon.mach.ClearWatchpoint(m.name, addr); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -170,15 +249,35 @@ func (m *modMemory) cmdWatchList(args []string) error {
 	if err := checkLen(args, 0, 0); err != nil {
 		return err
 	}
-	if len(m.watches) == 0 {
+	watches := m.mon.mach.Watchpoints(m.name)
+	if len(watches) == 0 {
 		return nil
 	}
-	list := make([]string, 0, len(m.watches))
-	for addr, mode := range m.watches {
-		list = append(list, fmt.Sprintf("%v$%04x %v", m.prefix(), addr, mode))
+	list := make([]string, 0, len(watches))
+	for addr, w := range watches {
+		mode := "rw"
+		if !w.Write {
+			mode = "r"
+		} else if !w.Read {
+			mode = "w"
+		}
+		line := fmt.Sprintf("%v$%04x %v", m.prefix(), addr, mode)
+		if w.Hits > 0 {
+			line += fmt.Sprintf(" hits %v", w.Hits)
+		}
+		if w.Break {
+			line += " break"
+		}
+		if w.Filter {
+			line += fmt.Sprintf(" value $%02x", w.Min)
+			if w.Max != w.Min {
+				line += fmt.Sprintf("-$%02x", w.Max)
+			}
+		}
+		list = append(list, line)
 	}
 	sort.Strings(list)
-	m.mon.out.Print(strings.Join(list, "\n"))
+	m.mon.cmdOut.Print(strings.Join(list, "\n"))
 	return nil
 }
 
@@ -186,50 +285,110 @@ func (m *modMemory) cmdWatchNone(args []string) error {
 	if err := checkLen(args, 0, 0); err != nil {
 		return err
 	}
-	for addr := range m.watches {
-		delete(m.watches, addr)
-		m.mem.Unwatch(addr)
+	for addr := range m.mon.mach.Watchpoints(m.name) {
+		if err := m.mon.mach.ClearWatchpoint(m.name, addr); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// cmdWatchSet sets a watchpoint on an address, or each address in a
+// range, replacing any existing ones:
+//
+//	watch-set addr[-end] mode [break] [value v[-v2]]
 func (m *modMemory) cmdWatchSet(args []string) error {
-	if err := checkLen(args, 2, 2); err != nil {
+	if err := checkLen(args, 2, 5); err != nil {
 		return err
 	}
-	addr, err := parseAddress(m.mem, args[0])
+	start, end, err := m.parseRange(args[0])
 	if err != nil {
 		return err
 	}
-	mode := args[1]
-	switch mode {
+	var proto rcs.Watchpoint
+	switch mode := args[1]; mode {
 	case "r", "ro":
-		m.mem.WatchRO(addr)
-		m.watches[addr] = "r"
+		proto.Read = true
 	case "w", "wo":
-		m.mem.WatchWO(addr)
-		m.watches[addr] = "w"
+		proto.Write = true
 	case "rw":
-		m.mem.WatchRW(addr)
-		m.watches[addr] = "rw"
+		proto.Read, proto.Write = true, true
 	default:
 		return fmt.Errorf("unknown watch mode: %v", mode)
 	}
+	for i := 2; i < len(args); i++ {
+		switch args[i] {
+		case "break":
+			proto.Break = true
+		case "value":
+			if i+1 >= len(args) {
+				return errors.New("not enough arguments")
+			}
+			i++
+			lo, hi := args[i], args[i]
+			if n := strings.Index(args[i], "-"); n >= 0 {
+				lo, hi = args[i][:n], args[i][n+1:]
+			}
+			min, err := parseValue8(lo)
+			if err != nil {
+				return err
+			}
+			max, err := parseValue8(hi)
+			if err != nil {
+				return err
+			}
+			proto.Filter, proto.Min, proto.Max = true, int(min), int(max)
+		default:
+			return fmt.Errorf("invalid argument: %v", args[i])
+		}
+	}
+	for addr := start; addr <= end; addr++ {
+		w := proto
+		if err := m.mon.mach.SetWatchpoint(m.name, addr, &w); err != nil {
+			return err
+		}
+	}
 	return nil
+}
 
+// parseRange parses an address or a range of addresses, "$1000-$10ff".
+func (m *modMemory) parseRange(str string) (int, int, error) {
+	n := strings.Index(str, "-")
+	if n < 0 {
+		addr, err := m.mon.parseAddress(m.mem, str)
+		return addr, addr, err
+	}
+	start, err := m.mon.parseAddress(m.mem, str[:n])
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := m.mon.parseAddress(m.mem, str[n+1:])
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("invalid range: %v", str)
+	}
+	return start, end, nil
 }
 
-func (m *modMemory) watchCallback(evt rcs.MemoryEvent) {
+func (m *modMemory) watchEvent(hit rcs.WatchHit) {
 	// FIXME: hard coded address format
-	a := fmt.Sprintf("$%04x", evt.Addr)
+	a := fmt.Sprintf("$%04x", hit.Addr)
 	if m.mem.NBank > 1 {
-		a = fmt.Sprintf("%v:$%04x", evt.Bank, evt.Addr)
+		a = fmt.Sprintf("%v:$%04x", hit.Bank, hit.Addr)
+	}
+	at := ""
+	if hit.CPU == "cpu" {
+		at = fmt.Sprintf(" at $%04x", hit.PC)
+	} else if hit.CPU != "" {
+		at = fmt.Sprintf(" at %v:$%04x", hit.CPU, hit.PC)
 	}
-	if evt.Read {
-		m.mon.out.Printf("%v$%02x <= read(%v)", m.prefix(), evt.Value, a)
+	if hit.Read {
+		m.mon.out.Printf("%v$%02x <= read(%v)%v", m.prefix(), hit.Value, a, at)
 	} else {
 		// FIXME: change the arrow to <=
-		m.mon.out.Printf("%vwrite(%v) => $%02x", m.prefix(), a, evt.Value)
+		m.mon.out.Printf("%vwrite(%v) => $%02x%v", m.prefix(), a, hit.Value, at)
 	}
 }
 
@@ -242,14 +401,24 @@ func (m *modMemory) prefix() string {
 
 func (m *modMemory) AutoComplete() []readline.PrefixCompleterInterface {
 	return []readline.PrefixCompleterInterface{
+		readline.PcItem("coverage"),
+		readline.PcItem("coverage-load"),
+		readline.PcItem("coverage-reset"),
+		readline.PcItem("coverage-save"),
 		readline.PcItem("dump"),
 		readline.PcItem("fill"),
-		readline.PcItem("peek"),
-		readline.PcItem("poke"),
+		readline.PcItem("peek",
+			readline.PcItemDynamic(acSymbols(m.mon)),
+		),
+		readline.PcItem("poke",
+			readline.PcItemDynamic(acSymbols(m.mon)),
+		),
 		readline.PcItem("watch-clear"),
 		readline.PcItem("watch-list"),
 		readline.PcItem("watch-none"),
-		readline.PcItem("watch-set"),
+		readline.PcItem("watch-set",
+			readline.PcItemDynamic(acSymbols(m.mon)),
+		),
 	}
 }
 
@@ -25,7 +25,9 @@ import (
 var cmds = map[string]func(*Monitor, []string) error{}
 
 const (
-	maxArgs = 0x100
+	maxArgs             = 0x100
+	defaultHistoryLines = 20 // instructions shown by history
+	defaultProfileLines = 20 // instructions shown by profile
 )
 
 type module interface {
@@ -46,38 +48,85 @@ var modules = map[string]func(m *Monitor, comp rcs.Component) module{
 	"z80":      newModZ80,
 }
 
-type Monitor struct {
-	mach      *rcs.Mach
-	comps     map[string]rcs.Component
-	mods      map[string]module
-	cpu       map[string]rcs.CPU
-	tracers   map[string]*rcs.Disassembler
+// sessionState is the part of the monitor that belongs to whoever is
+// entering commands: the console or a session connected with Serve.
+type sessionState struct {
 	sc        string // selected CPU core
-	in        io.ReadCloser
-	out       *log.Logger
-	rl        *readline.Instance
 	encoding  string
 	lastCmd   func([]string) error
 	memLines  int
 	dasmLines int
+	asm       *assembly // assembling lines entered, if not nil
 }
 
+type Monitor struct {
+	sessionState // of the console or the session running a command
+	mach         *rcs.Mach
+	comps        map[string]rcs.Component
+	mods         map[string]module
+	cpu          map[string]rcs.CPU
+	tracers      map[string]*rcs.Disassembler
+	in           io.ReadCloser
+	out          *log.Logger        // to the console and every session
+	cmdOut       *log.Logger        // to where the command being run came from
+	rl           *readline.Instance // nil without a console
+	outputs      *outputs
+	defaults     sessionState // of a new session
+	active       *session     // running a command, nil for the console
+	mu           sync.Mutex   // one command at a time
+	dap          *dapSession
+	dapMu        sync.Mutex // guards dap which is used by the callback
+}
+
+// New creates a monitor that reads commands from the console.
 func New(mach *rcs.Mach) (*Monitor, error) {
-	mach.Init()
+	m := newMonitor(mach)
 	cw := newConsoleWriter(os.Stdout)
 	rw := newRepeatWriter(cw)
 	log.SetOutput(rw)
+	m.outputs.console = cw
+	m.in = readline.NewCancelableStdin(os.Stdin)
 
-	m := &Monitor{
-		mach:     mach,
-		comps:    make(map[string]rcs.Component),
-		mods:     make(map[string]module),
-		cpu:      make(map[string]rcs.CPU),
-		tracers:  make(map[string]*rcs.Disassembler),
-		in:       readline.NewCancelableStdin(os.Stdin),
-		out:      log.New(cw, "", 0),
-		memLines: 16, // show a full page on "m" command
+	historyFile := ""
+	if config.UserDir != "" {
+		historyFile = filepath.Join(config.UserDir, "history")
 	}
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:       m.getPrompt(),
+		Stdin:        m.in,
+		HistoryFile:  historyFile,
+		AutoComplete: newCompleter(m),
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.rl = rl
+	cw.RefreshFunc = func() { m.rl.Refresh() }
+	m.rl.SetPrompt(m.getPrompt())
+	return m, nil
+}
+
+// NewHeadless creates a monitor that does not use the console. Commands
+// are only accepted from sessions with Serve and from Eval.
+func NewHeadless(mach *rcs.Mach) *Monitor {
+	return newMonitor(mach)
+}
+
+func newMonitor(mach *rcs.Mach) *Monitor {
+	mach.Init()
+	m := &Monitor{
+		mach:    mach,
+		comps:   make(map[string]rcs.Component),
+		mods:    make(map[string]module),
+		cpu:     make(map[string]rcs.CPU),
+		tracers: make(map[string]*rcs.Disassembler),
+		outputs: &outputs{sessions: make(map[*session]bool)},
+		sessionState: sessionState{
+			memLines: 16, // show a full page on "m" command
+		},
+	}
+	m.out = log.New(m.outputs, "", 0)
+	m.cmdOut = log.New(m.outputs, "", 0)
 
 	mach.Callback = m.cpuCallback
 	if mach.DefaultEncoding != "" {
@@ -103,28 +152,13 @@ func New(mach *rcs.Mach) (*Monitor, error) {
 			cpud, ok := cpu.(rcs.CPUDisassembler)
 			if ok {
 				tracer = cpud.NewDisassembler()
+				tracer.Symbols = mach.Symbols[comp.Name]
 			}
 			m.tracers[comp.Name] = tracer
 		}
 	}
-
-	historyFile := ""
-	if config.UserDir != "" {
-		historyFile = filepath.Join(config.UserDir, "history")
-	}
-	rl, err := readline.NewEx(&readline.Config{
-		Prompt:       m.getPrompt(),
-		Stdin:        m.in,
-		HistoryFile:  historyFile,
-		AutoComplete: newCompleter(m),
-	})
-	if err != nil {
-		return nil, err
-	}
-	m.rl = rl
-	cw.RefreshFunc = func() { m.rl.Refresh() }
-	m.rl.SetPrompt(m.getPrompt())
-	return m, nil
+	m.defaults = m.sessionState
+	return m
 }
 
 func (m *Monitor) Run() error {
@@ -136,19 +170,28 @@ func (m *Monitor) Run() error {
 		if err != nil {
 			return err
 		}
-		m.parse(line)
+		m.parseLocked(line)
 	}
 }
 
 func (m *Monitor) Eval(str string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	lines := strings.Split(str, "\n")
 	for _, line := range lines {
+		if m.asm != nil {
+			if strings.TrimSpace(line) != "" {
+				m.cmdOut.Printf("+ %v\n", line)
+			}
+			m.assembleLine(line)
+			continue
+		}
 		args := splitArgs(line)
 		if len(args) > 0 {
-			m.out.Printf("+ %v\n", line)
+			m.cmdOut.Printf("+ %v\n", line)
 			err := m.dispatch(args)
 			if err != nil {
-				m.out.Printf("%v", err)
+				m.cmdOut.Printf("%v", err)
 			}
 		}
 	}
@@ -156,11 +199,26 @@ func (m *Monitor) Eval(str string) error {
 }
 
 func (m *Monitor) Close() {
+	if m.rl == nil {
+		return
+	}
 	m.in.Close()
 	m.rl.Close()
 }
 
+// parseLocked parses a line once commands from other sessions are done.
+// The lock is released with a defer as quit does not return.
+func (m *Monitor) parseLocked(line string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.parse(line)
+}
+
 func (m *Monitor) parse(line string) {
+	if m.asm != nil {
+		m.assembleLine(line)
+		return
+	}
 	line = strings.TrimSpace(line)
 	if line == "" && m.lastCmd != nil {
 		m.lastCmd([]string{})
@@ -173,28 +231,66 @@ func (m *Monitor) parse(line string) {
 	args := splitArgs(line)
 	err := m.dispatch(args)
 	if err != nil {
-		m.out.Printf("%v", err)
+		m.cmdOut.Printf("%v", err)
 		return
 	}
+	if m.asm != nil {
+		m.updatePrompt()
+	}
+}
+
+// assembleLine passes a line to the session started by the assemble
+// command. A blank line ends the session.
+func (m *Monitor) assembleLine(line string) {
+	a := m.asm
+	if strings.TrimSpace(line) == "" {
+		m.asm = nil
+	} else {
+		_, err := m.mach.Call(rcs.MachExec, func() error {
+			return a.mod.assemble(a, line)
+		})
+		if err != nil {
+			m.cmdOut.Printf("%v", err)
+		}
+	}
+	m.updatePrompt()
+}
+
+// updatePrompt changes the prompt of the console after a command from
+// the console. Sessions are sent the prompt after each line instead.
+func (m *Monitor) updatePrompt() {
+	if m.rl != nil && m.active == nil {
+		m.rl.SetPrompt(m.getPrompt())
+	}
 }
 
 func (m *Monitor) dispatch(args []string) error {
 	switch args[0] {
 	case
+		"assemble", "a",
 		"breakpoint-clear", "bpc",
 		"breakpoint-list", "bpl", "bp",
 		"breakpoint-none", "bpn",
 		"breakpoint-set", "bps",
 		"disassemble", "d",
+		"history", "h",
 		"info", "i",
 		"next", "n",
+		"run-to", "rt",
 		"step", "s",
+		"step-out", "sr",
+		"step-over", "so",
+		"symbols",
 		"trace", "t":
-		return m.mods[m.sc].Command(args)
+		return m.exec(m.mods[m.sc], args)
 	case "m":
 		parent := m.comps[m.sc].Parent
-		return m.mods[parent].Command(args[1:])
+		return m.exec(m.mods[parent], args[1:])
 	case
+		"coverage",
+		"coverage-load",
+		"coverage-reset",
+		"coverage-save",
 		"peek",
 		"poke",
 		"watch-clear", "wc",
@@ -202,7 +298,7 @@ func (m *Monitor) dispatch(args []string) error {
 		"watch-none", "wn",
 		"watch-set", "ws":
 		parent := m.comps[m.sc].Parent
-		return m.mods[parent].Command(args)
+		return m.exec(m.mods[parent], args)
 	case "config":
 		return m.cmdConfig(args[1:])
 	case "encoding", "e":
@@ -213,8 +309,42 @@ func (m *Monitor) dispatch(args []string) error {
 		return m.cmdGo(args[1:])
 	case "import":
 		return m.cmdImport(args[1:])
+	case "movie-play":
+		return m.cmdMoviePlay(args[1:])
+	case "movie-record":
+		return m.cmdMovieRecord(args[1:])
+	case "movie-stop":
+		return m.cmdMovieStop(args[1:])
 	case "pause", "p":
 		return m.cmdPause(args[1:])
+	case "press":
+		return m.cmdInput(args[1:], true)
+	case "profile":
+		return m.cmdProfile(args[1:])
+	case "profile-export":
+		return m.cmdProfileExport(args[1:])
+	case "profile-reset":
+		return m.cmdProfileReset(args[1:])
+	case "profile-start":
+		return m.cmdProfileStart(args[1:])
+	case "profile-stop":
+		return m.cmdProfileStop(args[1:])
+	case "release":
+		return m.cmdInput(args[1:], false)
+	case "record":
+		return m.cmdRecord(args[1:])
+	case "record-stop":
+		return m.cmdRecordStop(args[1:])
+	case "record-audio":
+		return m.cmdRecordAudio(args[1:])
+	case "record-audio-stop":
+		return m.cmdRecordAudioStop(args[1:])
+	case "rewind":
+		return m.cmdRewind(args[1:])
+	case "screenshot":
+		return m.cmdScreenshot(args[1:])
+	case "select":
+		return m.cmdSelect(args[1:])
 	case "sleep":
 		return m.cmdSleep(args[1:])
 	case "q", "quit":
@@ -222,12 +352,12 @@ func (m *Monitor) dispatch(args []string) error {
 	}
 
 	if mod, ok := m.mods[args[0]]; ok {
-		return mod.Command(args[1:])
+		return m.exec(mod, args[1:])
 	}
 
 	val, err := parseValue(args[0])
 	if err == nil {
-		m.out.Print(formatValue(val))
+		m.cmdOut.Print(formatValue(val))
 		return nil
 	}
 
@@ -243,9 +373,9 @@ func (m *Monitor) cmdConfig(args []string) error {
 	}
 	switch args[0] {
 	case "lines-memory":
-		return valueInt(m.out, &m.memLines, args[1:])
+		return valueInt(m.cmdOut, &m.memLines, args[1:])
 	case "lines-disassembly":
-		return valueInt(m.out, &m.dasmLines, args[1:])
+		return valueInt(m.cmdOut, &m.dasmLines, args[1:])
 	}
 	return fmt.Errorf("no such configuration: %v", args[0])
 }
@@ -259,8 +389,8 @@ func (m *Monitor) cmdExport(args []string) error {
 		filename = args[0]
 	}
 	file := filepath.Join(config.VarDir, filename)
-	m.mach.Command(rcs.MachExport, file)
-	return nil
+	_, err := m.mach.Call(rcs.MachExport, file)
+	return err
 }
 
 func (m *Monitor) cmdEncoding(args []string) error {
@@ -268,7 +398,7 @@ func (m *Monitor) cmdEncoding(args []string) error {
 	for k := range m.mach.CharDecoders {
 		list = append(list, k)
 	}
-	return valueList(m.out, &m.encoding, list, args)
+	return valueList(m.cmdOut, &m.encoding, list, args)
 }
 
 func (m *Monitor) cmdImport(args []string) error {
@@ -280,33 +410,261 @@ func (m *Monitor) cmdImport(args []string) error {
 		filename = args[0]
 	}
 	file := filepath.Join(config.VarDir, filename)
-	m.mach.Command(rcs.MachImport, file)
-	return nil
+	_, err := m.mach.Call(rcs.MachImport, file)
+	return err
 }
 
 func (m *Monitor) cmdGo(args []string) error {
 	if err := checkLen(args, 0, 0); err != nil {
 		return err
 	}
-	m.mach.Command(rcs.MachStart)
-	return nil
+	_, err := m.mach.Call(rcs.MachStart)
+	return err
+}
+
+func (m *Monitor) cmdMoviePlay(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	filename := "movie"
+	if len(args) > 0 {
+		filename = args[0]
+	}
+	_, err := m.mach.Call(rcs.MachMoviePlay, filepath.Join(config.VarDir, filename))
+	return err
+}
+
+func (m *Monitor) cmdMovieRecord(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	filename := "movie"
+	if len(args) > 0 {
+		filename = args[0]
+	}
+	_, err := m.mach.Call(rcs.MachMovieRecord, filepath.Join(config.VarDir, filename))
+	return err
+}
+
+func (m *Monitor) cmdMovieStop(args []string) error {
+	if err := checkLen(args, 0, 0); err != nil {
+		return err
+	}
+	_, err := m.mach.Call(rcs.MachMovieStop)
+	return err
 }
 
 func (m *Monitor) cmdPause(args []string) error {
 	if err := checkLen(args, 0, 0); err != nil {
 		return err
 	}
-	m.mach.Command(rcs.MachPause)
+	_, err := m.mach.Call(rcs.MachPause)
+	return err
+}
+
+func (m *Monitor) cmdProfile(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	n := defaultProfileLines
+	if len(args) > 0 {
+		v, err := parseValue(args[0])
+		if err != nil {
+			return err
+		}
+		n = v
+	}
+	_, err := m.mach.Call(rcs.MachExec, func() error {
+		list := m.mach.Profile()
+		totals := make(map[string]int)
+		for _, e := range list {
+			totals[e.CPU] += e.Count
+		}
+		if n < len(list) {
+			list = list[:n]
+		}
+		dasms := make(map[string]*rcs.Disassembler)
+		for name, cpu := range m.mach.CPU {
+			if d, ok := cpu.(rcs.CPUDisassembler); ok {
+				dasms[name] = d.NewDisassembler()
+			}
+		}
+		m.cmdOut.Println("   count      %    cycles  instruction")
+		for _, e := range list {
+			prefix := ""
+			if e.CPU != "cpu" {
+				prefix = e.CPU + "  "
+			}
+			code := fmt.Sprintf("$%04x", e.Addr)
+			if dasm, ok := dasms[e.CPU]; ok {
+				dasm.SetPC(e.Addr)
+				code = dasm.Next()
+			}
+			if sym := m.mach.Symbols[e.CPU].Lookup(e.Addr); sym != "" {
+				code = fmt.Sprintf("%-32s  ; %v", code, sym)
+			}
+			pct := float64(e.Count) * 100 / float64(totals[e.CPU])
+			m.cmdOut.Printf("%8d %5.1f%% %9d  %v%v\n", e.Count, pct, e.Cycles, prefix, code)
+		}
+		return nil
+	})
+	return err
+}
+
+func (m *Monitor) cmdProfileExport(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	filename := "profile.csv"
+	if len(args) > 0 {
+		filename = args[0]
+	}
+	_, err := m.mach.Call(rcs.MachExec, func() error {
+		out, err := os.Create(filepath.Join(config.VarDir, filename))
+		if err != nil {
+			return fmt.Errorf("unable to export profile: %v", err)
+		}
+		defer out.Close()
+		if err := m.mach.WriteProfile(out); err != nil {
+			return fmt.Errorf("unable to export profile: %v", err)
+		}
+		return nil
+	})
+	return err
+}
+
+func (m *Monitor) cmdProfileReset(args []string) error {
+	if err := checkLen(args, 0, 0); err != nil {
+		return err
+	}
+	_, err := m.mach.Call(rcs.MachExec, func() error {
+		m.mach.ResetProfile()
+		return nil
+	})
+	return err
+}
+
+func (m *Monitor) cmdProfileStart(args []string) error {
+	if err := checkLen(args, 0, 0); err != nil {
+		return err
+	}
+	_, err := m.mach.Call(rcs.MachExec, m.mach.StartProfile)
+	return err
+}
+
+func (m *Monitor) cmdProfileStop(args []string) error {
+	if err := checkLen(args, 0, 0); err != nil {
+		return err
+	}
+	_, err := m.mach.Call(rcs.MachExec, func() error {
+		m.mach.StopProfile()
+		return nil
+	})
+	return err
+}
+
+func (m *Monitor) cmdRecord(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	name := "recording"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	_, err := m.mach.Call(rcs.MachRecord, filepath.Join(config.VarDir, name))
+	return err
+}
+
+func (m *Monitor) cmdRecordStop(args []string) error {
+	if err := checkLen(args, 0, 0); err != nil {
+		return err
+	}
+	_, err := m.mach.Call(rcs.MachRecordStop)
+	return err
+}
+
+func (m *Monitor) cmdRecordAudio(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	filename := "audio.wav"
+	if len(args) > 0 {
+		filename = args[0]
+	}
+	_, err := m.mach.Call(rcs.MachRecordAudio, filepath.Join(config.VarDir, filename))
+	return err
+}
+
+func (m *Monitor) cmdRecordAudioStop(args []string) error {
+	if err := checkLen(args, 0, 0); err != nil {
+		return err
+	}
+	_, err := m.mach.Call(rcs.MachRecordAudioStop)
+	return err
+}
+
+func (m *Monitor) cmdRewind(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	frames := rcs.DefaultRewindInterval
+	if len(args) > 0 {
+		v, err := parseValue(args[0])
+		if err != nil {
+			return err
+		}
+		frames = v
+	}
+	_, err := m.mach.Call(rcs.MachRewind, frames)
+	return err
+}
+
+func (m *Monitor) cmdScreenshot(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	filename := "screenshot.png"
+	if len(args) > 0 {
+		filename = args[0]
+	}
+	_, err := m.mach.Call(rcs.MachScreenshot, filepath.Join(config.VarDir, filename))
+	return err
+}
+
+func (m *Monitor) cmdInput(args []string, pressed bool) error {
+	if err := checkLen(args, 1, maxArgs); err != nil {
+		return err
+	}
+	for _, name := range args {
+		e := rcs.InputEvent{Control: rcs.Control(name), Pressed: pressed}
+		if _, err := m.mach.Call(rcs.MachInput, e); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (m *Monitor) cmdQuit(args []string) error {
-	m.rl.Close()
+	if m.rl != nil {
+		m.rl.Close()
+	}
 	m.mach.Command(rcs.MachQuit)
 	runtime.Goexit()
 	return nil
 }
 
+func (m *Monitor) cmdSelect(args []string) error {
+	list := make([]string, 0, len(m.cpu))
+	for k := range m.cpu {
+		list = append(list, k)
+	}
+	if err := valueList(m.cmdOut, &m.sc, list, args); err != nil {
+		return err
+	}
+	m.updatePrompt()
+	return nil
+}
+
 func (m *Monitor) cmdSleep(args []string) error {
 	if err := checkLen(args, 0, 1); err != nil {
 		return err
@@ -337,10 +695,15 @@ func (n byName) Less(i, j int) bool {
 
 func newCompleter(m *Monitor) *readline.PrefixCompleter {
 	cmds := []readline.PrefixCompleterInterface{
+		readline.PcItem("assemble",
+			readline.PcItemDynamic(acSymbols(m)),
+		),
 		readline.PcItem("breakpoint-clear"),
 		readline.PcItem("breakpoint-list"),
 		readline.PcItem("breakpoint-none"),
-		readline.PcItem("breakpoint-set"),
+		readline.PcItem("breakpoint-set",
+			readline.PcItemDynamic(acSymbols(m)),
+		),
 		readline.PcItem("config",
 			readline.PcItem("lines-memory"),
 			readline.PcItem("lines-disassembly"),
@@ -348,18 +711,56 @@ func newCompleter(m *Monitor) *readline.PrefixCompleter {
 		readline.PcItem("encoding",
 			readline.PcItemDynamic(acEncodings(m)),
 		),
+		readline.PcItem("coverage"),
+		readline.PcItem("coverage-load"),
+		readline.PcItem("coverage-reset"),
+		readline.PcItem("coverage-save"),
 		readline.PcItem("export"),
-		readline.PcItem("disassemble"),
+		readline.PcItem("disassemble",
+			readline.PcItemDynamic(acSymbols(m)),
+		),
+		readline.PcItem("history"),
 		readline.PcItem("import"),
 		readline.PcItem("info"),
+		readline.PcItem("movie-play"),
+		readline.PcItem("movie-record"),
+		readline.PcItem("movie-stop"),
 		readline.PcItem("next"),
+		readline.PcItem("press",
+			readline.PcItemDynamic(acControls(m)),
+		),
+		readline.PcItem("profile"),
+		readline.PcItem("profile-export"),
+		readline.PcItem("profile-reset"),
+		readline.PcItem("profile-start"),
+		readline.PcItem("profile-stop"),
 		readline.PcItem("quit"),
+		readline.PcItem("record"),
+		readline.PcItem("record-audio"),
+		readline.PcItem("record-audio-stop"),
+		readline.PcItem("record-stop"),
+		readline.PcItem("release",
+			readline.PcItemDynamic(acControls(m)),
+		),
+		readline.PcItem("rewind"),
+		readline.PcItem("run-to",
+			readline.PcItemDynamic(acSymbols(m)),
+		),
+		readline.PcItem("screenshot"),
+		readline.PcItem("select",
+			readline.PcItemDynamic(acCPUs(m)),
+		),
 		readline.PcItem("step"),
+		readline.PcItem("step-out"),
+		readline.PcItem("step-over"),
 		readline.PcItem("sleep"),
+		readline.PcItem("symbols"),
 		readline.PcItem("watch-clear"),
 		readline.PcItem("watch-list"),
 		readline.PcItem("watch-none"),
-		readline.PcItem("watch-set"),
+		readline.PcItem("watch-set",
+			readline.PcItemDynamic(acSymbols(m)),
+		),
 	}
 	for key, mod := range m.mods {
 		cmds = append(cmds, []readline.PrefixCompleterInterface{
@@ -402,6 +803,34 @@ func acDataFiles(m *Monitor, suffix string) func(string) []string {
 	}
 }
 
+func acControls(m *Monitor) func(string) []string {
+	return func(line string) []string {
+		return m.mach.Bindings.Controls()
+	}
+}
+
+// acSymbols completes the names of symbols. The symbols are read on the
+// machine goroutine as commands add to them there.
+func acSymbols(m *Monitor) func(string) []string {
+	return func(line string) []string {
+		seen := make(map[string]bool)
+		names := make([]string, 0)
+		m.mach.Call(rcs.MachExec, func() error {
+			for _, syms := range m.mach.Symbols {
+				for _, name := range syms {
+					if !seen[name] {
+						seen[name] = true
+						names = append(names, name)
+					}
+				}
+			}
+			return nil
+		})
+		sort.Strings(names)
+		return names
+	}
+}
+
 func acEncodings(m *Monitor) func(string) []string {
 	return func(line string) []string {
 		names := make([]string, 0)
@@ -413,6 +842,17 @@ func acEncodings(m *Monitor) func(string) []string {
 	}
 }
 
+func acCPUs(m *Monitor) func(string) []string {
+	return func(line string) []string {
+		names := make([]string, 0)
+		for k := range m.cpu {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		return names
+	}
+}
+
 // ============================================================================
 // aux
 
@@ -425,20 +865,56 @@ func (m *Monitor) cpuCallback(evt rcs.MachEvent, args ...interface{}) {
 		if name != "cpu" {
 			prefix = name + "  "
 		}
-		m.tracers[name].SetPC(pc + m.cpu[m.sc].Offset())
+		m.tracers[name].SetPC(pc + m.cpu[name].Offset())
 		m.out.Printf("%v%v", prefix, m.tracers[name].Next())
 	case rcs.ErrorEvent:
 		m.out.Println(args[0])
+	case rcs.WatchEvent:
+		hit := args[0].(rcs.WatchHit)
+		if mod, ok := m.mods[hit.Mem].(*modMemory); ok {
+			mod.watchEvent(hit)
+		}
 	case rcs.StatusEvent:
+		m.dapMu.Lock()
+		if m.dap != nil {
+			m.dap.status(args...)
+		}
+		m.dapMu.Unlock()
 		status := args[0].(rcs.Status)
 		if status == rcs.Break {
+			// show the CPU that stopped, the selected CPU may be that
+			// of a session
+			name := args[1].(string)
 			m.out.Println()
-			m.dispatch([]string{"i"})
-			m.rl.Refresh()
+			// already on the machine goroutine
+			m.cpuInfo(m.out, name)
+			if m.rl != nil {
+				m.rl.Refresh()
+			}
 		}
 	}
 }
 
+// cpuInfo shows the status of the machine and the registers of the CPU
+// with the given name.
+func (m *Monitor) cpuInfo(out *log.Logger, name string) {
+	label := ""
+	if name != "cpu" {
+		label = name + ":"
+	}
+	out.Printf("[%v%v]\n", label, m.mach.Status)
+	out.Printf("%v", m.cpu[name])
+}
+
+// exec runs a module command on the machine goroutine so that it does not
+// race the emulation. The module must not use Mach.Call.
+func (m *Monitor) exec(mod module, args []string) error {
+	_, err := m.mach.Call(rcs.MachExec, func() error {
+		return mod.Command(args)
+	})
+	return err
+}
+
 func checkLen(args []string, min int, max int) error {
 	if len(args) < min {
 		return errors.New("not enough arguments")
@@ -683,14 +1159,43 @@ func terminal(args []string, fn func() error) error {
 	return fn()
 }
 
-func parseAddress(mem *rcs.Memory, str string) (int, error) {
+// parseAddress parses an address in mem. When the address is not a number,
+// it is looked up in the symbols of the CPUs that use mem. An offset can
+// be added to a symbol, "CHROUT+3".
+func (m *Monitor) parseAddress(mem *rcs.Memory, str string) (int, error) {
 	value, err := parseUint(str, 64)
-	if err != nil || int(value) > mem.MaxAddr {
+	if err != nil {
+		return m.parseSymbol(mem, str)
+	}
+	if int(value) > mem.MaxAddr {
 		return 0, fmt.Errorf("invalid address: %v", str)
 	}
 	return int(value), nil
 }
 
+func (m *Monitor) parseSymbol(mem *rcs.Memory, str string) (int, error) {
+	name, offset := str, 0
+	if i := strings.Index(str, "+"); i > 0 {
+		v, err := parseUint(str[i+1:], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid address: %v", str)
+		}
+		name, offset = str[:i], int(v)
+	}
+	for cpuName, cpu := range m.mach.CPU {
+		if cpu.Memory() != mem {
+			continue
+		}
+		if addr, ok := m.mach.Symbols[cpuName].Addr(name); ok {
+			if addr+offset > mem.MaxAddr {
+				break
+			}
+			return addr + offset, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid address: %v", str)
+}
+
 // =========================================================================
 // console
 
@@ -704,11 +1209,24 @@ const (
 )
 
 func (m *Monitor) getPrompt() string {
+	return m.prompt(ansiLightGreen, ansiLightBlue, ansiReset)
+}
+
+// plainPrompt is the prompt without color and the trailing space that is
+// sent to sessions.
+func (m *Monitor) plainPrompt() string {
+	return strings.TrimSpace(m.prompt("", "", ""))
+}
+
+func (m *Monitor) prompt(green string, blue string, reset string) string {
+	if m.asm != nil {
+		return fmt.Sprintf("%v$%04x%v> ", green, m.asm.addr, reset)
+	}
 	c := ""
 	if len(m.mach.CPU) > 1 {
-		c = fmt.Sprintf(":%v%v%v", ansiLightBlue, m.sc, ansiReset)
+		c = fmt.Sprintf(":%v%v%v", blue, m.sc, reset)
 	}
-	return fmt.Sprintf("%vmonitor%v%v> ", ansiLightGreen, ansiReset, c)
+	return fmt.Sprintf("%vmonitor%v%v> ", green, reset, c)
 }
 
 type consoleWriter struct {
@@ -735,6 +1253,8 @@ func newConsoleWriter(w io.Writer) *consoleWriter {
 }
 
 func (c *consoleWriter) Write(p []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	for _, b := range p {
 		c.line.WriteByte(b)
 		if b == '\n' {
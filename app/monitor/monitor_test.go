@@ -2,18 +2,23 @@ package monitor
 
 import (
 	"bytes"
-	"log"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
+	"github.com/blackchip-org/retro-cs/config"
 	"github.com/blackchip-org/retro-cs/mock"
 	"github.com/blackchip-org/retro-cs/rcs"
 )
 
 type monitorFixture struct {
-	cpu *mock.CPU
-	out bytes.Buffer
-	mon *Monitor
+	cpu  *mock.CPU
+	out  bytes.Buffer
+	mon  *Monitor
+	done chan error
 }
 
 func newMonitorFixture() *monitorFixture {
@@ -28,19 +33,35 @@ func newMonitorFixture() *monitorFixture {
 		mon: mon,
 		cpu: cpu,
 	}
-	f.mon.out = log.New(&f.out, "", 0)
+	// one logger so that output from the machine goroutine is serialized
+	f.mon.cmdOut.SetOutput(&f.out)
+	f.mon.out = f.mon.cmdOut
 	return f
 }
 
+// start runs the machine and waits until commands are handled by it.
+func (f *monitorFixture) start() {
+	f.done = make(chan error)
+	go func() { f.done <- f.mon.mach.Run() }()
+	for !f.mon.mach.Running() {
+		runtime.Gosched()
+	}
+}
+
+// stop quits the machine and waits for it to finish so that the output
+// can be read.
+func (f *monitorFixture) stop() {
+	f.mon.mach.Command(rcs.MachQuit)
+	<-f.done
+}
+
 func TestMonitor(t *testing.T) {
 	for _, test := range monitorTests {
 		t.Run(test.name, func(t *testing.T) {
 			f := newMonitorFixture()
-			go f.mon.mach.Run()
-			defer func() {
-				f.mon.mach.Command(rcs.MachQuit)
-			}()
+			f.start()
 			f.mon.Eval(strings.Join(test.in, "\n"))
+			f.stop()
 			have := strings.TrimSpace(f.out.String())
 			want := strings.TrimSpace(test.want)
 			if have != want {
@@ -78,6 +99,12 @@ var monitorTests = []struct {
 			"bpn",
 			"bp",
 			"bps $123456",
+			"bps $1234 temp ignore 2 if A == $41 && peek($10) > $80",
+			"bps $2345 if r.b == %101",
+			"bp",
+			"bps $3456 if x == 1",
+			"bps $3456 forever",
+			"bps $3456 ignore",
 		},
 		`
 + bps $3456
@@ -95,6 +122,17 @@ $3456
 + bp
 + bps $123456
 invalid address: $123456
++ bps $1234 temp ignore 2 if A == $41 && peek($10) > $80
++ bps $2345 if r.b == %101
++ bp
+$1234 temp ignore 2 if A == $41 && peek($10) > $80
+$2345 if r.b == %101
++ bps $3456 if x == 1
+invalid condition: no such register: x
++ bps $3456 forever
+invalid argument: forever
++ bps $3456 ignore
+not enough arguments
 		`,
 	}, {
 		"dasm",
@@ -367,6 +405,47 @@ write($0010) => $22
 + wn
 + w
 		`,
+	}, {
+		"watch options",
+		[]string{
+			"ws $10-$12 w break value $20-$2f",
+			"w",
+			"poke $11 $05",
+			"poke $11 $22",
+			"w",
+			"wc $10-$12",
+			"ws $10 rw value 7",
+			"w",
+			"wn",
+			"ws $12-$10 w",
+			"ws $10 w forever",
+			"ws $10 w value",
+		},
+		`
++ ws $10-$12 w break value $20-$2f
++ w
+$0010 w break value $20-$2f
+$0011 w break value $20-$2f
+$0012 w break value $20-$2f
++ poke $11 $05
++ poke $11 $22
+write($0011) => $22
++ w
+$0010 w break value $20-$2f
+$0011 w hits 1 break value $20-$2f
+$0012 w break value $20-$2f
++ wc $10-$12
++ ws $10 rw value 7
++ w
+$0010 rw value $07
++ wn
++ ws $12-$10 w
+invalid range: $12-$10
++ ws $10 w forever
+invalid argument: forever
++ ws $10 w value
+not enough arguments
+		`,
 	},
 }
 
@@ -378,11 +457,9 @@ bps $10
 g
 sleep 100
 	`
-	go f.mon.mach.Run()
-	defer func() {
-		f.mon.mach.Command(rcs.MachQuit)
-	}()
+	f.start()
 	f.mon.Eval(cmds)
+	f.stop()
 	have := strings.TrimSpace(f.out.String())
 	want := strings.TrimSpace(`
 + bps $10
@@ -397,6 +474,244 @@ pc:000f a:00 b:00 q:false z:false
 	}
 }
 
+func TestBreakpointCond(t *testing.T) {
+	f := newMonitorFixture()
+	f.cpu.A = 1
+	cmds := `
+bps $08 if a == 0
+bps $10 if a == 1
+g
+sleep 100
+bp
+	`
+	f.start()
+	f.mon.Eval(cmds)
+	f.stop()
+	have := strings.TrimSpace(f.out.String())
+	want := strings.TrimSpace(`
++ bps $08 if a == 0
++ bps $10 if a == 1
++ g
++ sleep 100
+
+[break]
+pc:0010 a:01 b:00 q:false z:false
++ bp
+$0008 if a == 0
+$0010 hits 1 if a == 1
+`)
+	if have != want {
+		t.Errorf("\n have: \n%v \n want: \n%v", have, want)
+	}
+}
+
+func TestWatchBreak(t *testing.T) {
+	f := newMonitorFixture()
+	cmds := `
+ws $08 r break
+g
+sleep 100
+	`
+	f.start()
+	f.mon.Eval(cmds)
+	f.stop()
+	have := strings.TrimSpace(f.out.String())
+	want := strings.TrimSpace(`
++ ws $08 r break
++ g
++ sleep 100
+$00 <= read($0008) at $0008
+
+[break]
+pc:0009 a:00 b:00 q:false z:false
+`)
+	if have != want {
+		t.Errorf("\n have: \n%v \n want: \n%v", have, want)
+	}
+}
+
+func TestRunTo(t *testing.T) {
+	f := newMonitorFixture()
+	cmds := `
+rt $10
+sleep 100
+so
+	`
+	f.start()
+	f.mon.Eval(cmds)
+	f.stop()
+	have := strings.TrimSpace(f.out.String())
+	want := strings.TrimSpace(`
++ rt $10
++ sleep 100
+
+[break]
+pc:0010 a:00 b:00 q:false z:false
++ so
+stepping not supported by CPU: cpu
+`)
+	if have != want {
+		t.Errorf("\n have: \n%v \n want: \n%v", have, want)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	f := newMonitorFixture()
+	f.cpu.A = 0x12
+	f.cpu.Memory().WriteN(0x02, 0x10, 0xab)
+	cmds := `
+rt $06
+sleep 100
+history 3
+	`
+	f.start()
+	f.mon.Eval(cmds)
+	f.stop()
+	have := strings.TrimSpace(f.out.String())
+	want := strings.TrimSpace(`
++ rt $06
++ sleep 100
+
+[break]
+pc:0006 a:12 b:00 q:false z:false
++ history 3
+$0002:  10 ab     i10 $ab             a:12 b:00 q:false z:false
+$0004:  00        i00                 a:12 b:00 q:false z:false
+$0005:  00        i00                 a:12 b:00 q:false z:false
+`)
+	if have != want {
+		t.Errorf("\n have: \n%v \n want: \n%v", have, want)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	f := newMonitorFixture()
+	f.cpu.Memory().WriteN(0x02, 0x10, 0xab)
+	symFile := filepath.Join(t.TempDir(), "symbols")
+	if err := ioutil.WriteFile(symFile, []byte("$02 START\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmds := `
+symbols ` + symFile + `
+profile-start
+rt $05
+sleep 100
+profile-stop
+profile 3
+	`
+	f.start()
+	f.mon.Eval(cmds)
+	f.stop()
+	have := strings.TrimSpace(f.out.String())
+	have = strings.Replace(have, symFile, "symbols", 1)
+	want := strings.TrimSpace(`
++ symbols symbols
++ profile-start
++ rt $05
++ sleep 100
+
+[break]
+pc:0005 a:00 b:00 q:false z:false
++ profile-stop
++ profile 3
+   count      %    cycles  instruction
+       1  25.0%         1  $0000:  00        i00
+       1  25.0%         1  $0001:  00        i00
+       1  25.0%         1  $0002:  10 ab     i10 $ab         ; START
+`)
+	if have != want {
+		t.Errorf("\n have: \n%v \n want: \n%v", have, want)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	varDir := config.VarDir
+	defer func() { config.VarDir = varDir }()
+	config.VarDir = t.TempDir()
+
+	f := newMonitorFixture()
+	cmds := `
+coverage-reset
+rt $05
+sleep 100
+coverage
+coverage-save
+coverage-reset
+coverage
+coverage-load
+coverage
+	`
+	f.start()
+	f.mon.Eval(cmds)
+	f.stop()
+	have := strings.TrimSpace(f.out.String())
+	want := strings.TrimSpace(`
++ coverage-reset
++ rt $05
++ sleep 100
+
+[break]
+pc:0005 a:00 b:00 q:false z:false
++ coverage
+code: 5, read: 0, written: 0
++ coverage-save
++ coverage-reset
++ coverage
+code: 0, read: 0, written: 0
++ coverage-load
++ coverage
+code: 5, read: 0, written: 0
+`)
+	if have != want {
+		t.Errorf("\n have: \n%v \n want: \n%v", have, want)
+	}
+}
+
+// Commands that use the state of the machine while it is running are
+// handled on the machine goroutine. Run with -race to check.
+func TestMonitorRunning(t *testing.T) {
+	f := newMonitorFixture()
+	cmds := `
+g
+sleep 50
+ws $2000 w
+poke $2000 $05
+wn
+peek $2000
+mem fill $3000 $3001 $07
+peek $3001
+bps $4000
+bpn
+t off
+i
+	`
+	f.start()
+	f.mon.Eval(cmds)
+	f.stop()
+	have := strings.TrimSpace(f.out.String())
+	want := strings.TrimSpace(`
++ g
++ sleep 50
++ ws $2000 w
++ poke $2000 $05
+write($2000) => $05
++ wn
++ peek $2000
+5 $5 %101
++ mem fill $3000 $3001 $07
++ peek $3001
+7 $7 %111
++ bps $4000
++ bpn
++ t off
++ i
+[run]
+`)
+	if !strings.HasPrefix(have, want) {
+		t.Errorf("\n have: \n%v \n want: \n%v", have, want)
+	}
+}
+
 func TestDump(t *testing.T) {
 	var dumpTests = []struct {
 		name     string
@@ -523,3 +838,93 @@ func TestFormatBits(t *testing.T) {
 		}
 	}
 }
+
+func TestSymbolAddress(t *testing.T) {
+	f := newMonitorFixture()
+	f.cpu.Memory().WriteN(0x02, 0x10, 0xab)
+	symFile := filepath.Join(t.TempDir(), "symbols")
+	if err := ioutil.WriteFile(symFile, []byte("START = $02\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmds := `
+symbols ` + symFile + `
+poke start+1 $cd
+d START START
+peek FOO
+	`
+	f.start()
+	f.mon.Eval(cmds)
+	f.stop()
+	have := strings.TrimSpace(f.out.String())
+	have = strings.Replace(have, symFile, "symbols", 1)
+	want := strings.TrimSpace(`
++ symbols symbols
++ poke start+1 $cd
++ d START START
+START:
+$0002:  10 cd     i10 $cd
++ peek FOO
+invalid address: FOO
+`)
+	if have != want {
+		t.Errorf("\n have: \n%v \n want: \n%v", have, want)
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	f := newMonitorFixture()
+	cmds := `
+assemble $10
+start: i10 $ab
+i20 start
+i99
+
+d $10 $14
+	`
+	f.start()
+	f.mon.Eval(cmds)
+	f.stop()
+	have := strings.TrimSpace(f.out.String())
+	want := strings.TrimSpace(`
++ assemble $10
++ start: i10 $ab
+start:
+$0010:  10 ab     i10 $ab
++ i20 start
+$0012:  20 10 00  i20 $0010
++ i99
+no such instruction: i99
++ d $10 $14
+start:
+$0010:  10 ab     i10 $ab
+$0012:  20 10 00  i20 $0010
+`)
+	if have != want {
+		t.Errorf("\n have: \n%v \n want: \n%v", have, want)
+	}
+}
+
+func TestCompleteSymbols(t *testing.T) {
+	f := newMonitorFixture()
+	f.start()
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			f.mon.mach.Call(rcs.MachExec, func() error {
+				f.mon.mach.Symbols["cpu"].Add(rcs.Symbols{i: fmt.Sprintf("L%03d", i)})
+				return nil
+			})
+		}
+		close(done)
+	}()
+	complete := acSymbols(f.mon)
+	for i := 0; i < 100; i++ {
+		complete("")
+	}
+	<-done
+	names := complete("")
+	f.stop()
+	if len(names) != 100 || names[0] != "L000" {
+		t.Errorf("\n have: %v \n want: L000 to L099", names)
+	}
+}
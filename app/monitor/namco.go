@@ -19,7 +19,7 @@ type modN06XX struct {
 func newModN06XX(mon *Monitor, comp rcs.Component) module {
 	return &modN06XX{
 		mon:   mon,
-		out:   mon.out,
+		out:   mon.cmdOut,
 		n06xx: comp.C.(*namco.N06XX),
 	}
 }
@@ -82,7 +82,7 @@ type modN51XX struct {
 func newModN51XX(mon *Monitor, comp rcs.Component) module {
 	return &modN51XX{
 		mon:   mon,
-		out:   mon.out,
+		out:   mon.cmdOut,
 		n51xx: comp.C.(*namco.N51XX),
 	}
 }
@@ -130,7 +130,7 @@ type modN54XX struct {
 func newModN54XX(mon *Monitor, comp rcs.Component) module {
 	return &modN54XX{
 		mon:   mon,
-		out:   mon.out,
+		out:   mon.cmdOut,
 		n54xx: comp.C.(*namco.N54XX),
 	}
 }
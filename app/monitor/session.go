@@ -0,0 +1,189 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// =========================================================================
+// sessions
+//
+// A session is a connection that sends commands one line at a time, the
+// same as those typed at the console. After a line is handled, the prompt
+// is sent on a line of its own so that a script can read up to it. Each
+// session has its own selected CPU, encoding, and assembly in progress.
+// Output that is not from a command, such as a breakpoint being hit, is
+// sent to the console and to every session.
+
+// sessionBacklog is the number of writes queued for a session before
+// output not from its commands is dropped.
+const sessionBacklog = 1024
+
+type session struct {
+	sessionState
+	conn net.Conn
+	out  chan []byte
+	done chan struct{}
+}
+
+func newSession(conn net.Conn, state sessionState) *session {
+	s := &session{
+		sessionState: state,
+		conn:         conn,
+		out:          make(chan []byte, sessionBacklog),
+		done:         make(chan struct{}),
+	}
+	go s.writer()
+	return s
+}
+
+// Write queues the output of a command of the session and waits if the
+// client is not keeping up. It is only used by the session goroutine and
+// never while a command is running, so a slow client only holds up its
+// own session.
+func (s *session) Write(p []byte) (int, error) {
+	s.out <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+// post queues output that is not from a command of the session. It is
+// dropped instead of stopping the machine if the client is not keeping
+// up.
+func (s *session) post(p []byte) {
+	select {
+	case s.out <- append([]byte(nil), p...):
+	default:
+	}
+}
+
+func (s *session) writer() {
+	for p := range s.out {
+		// keep draining after an error, the reader notices the closed
+		// connection
+		s.conn.Write(p)
+	}
+	close(s.done)
+}
+
+// outputs sends the monitor output to the console and to every session.
+// It does not wait for a session so that it can be used on the machine
+// goroutine.
+type outputs struct {
+	mu       sync.Mutex
+	console  *consoleWriter // nil without a console
+	sessions map[*session]bool
+}
+
+func (o *outputs) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.console != nil {
+		o.console.Write(p)
+	}
+	for s := range o.sessions {
+		s.post(p)
+	}
+	return len(p), nil
+}
+
+func (o *outputs) add(s *session) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sessions[s] = true
+}
+
+func (o *outputs) remove(s *session) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.sessions, s)
+}
+
+// ListenAndServe listens on the address and then calls Serve. An address
+// that contains a slash is the path of a Unix socket and is replaced if it
+// exists as a socket. Otherwise it is a TCP address.
+func (m *Monitor) ListenAndServe(addr string) error {
+	network := "tcp"
+	if strings.Contains(addr, "/") {
+		network = "unix"
+		if info, err := os.Stat(addr); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(addr)
+		}
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	return m.Serve(l)
+}
+
+// Serve accepts sessions on the listener until it is closed. Any number of
+// sessions can be connected at once.
+func (m *Monitor) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go m.serveSession(conn)
+	}
+}
+
+func (m *Monitor) serveSession(conn net.Conn) {
+	m.mu.Lock()
+	s := newSession(conn, m.defaults)
+	m.mu.Unlock()
+	m.outputs.add(s)
+	// deferred as quit does not return
+	defer func() {
+		m.outputs.remove(s)
+		close(s.out)
+		<-s.done
+		conn.Close()
+	}()
+
+	m.withSession(s, func() {})
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		m.withSession(s, func() { m.parse(line) })
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("monitor session: %v", err)
+	}
+}
+
+// withSession runs fn with the state of the session and then sends the
+// output of the command to the session, followed by the prompt. The output
+// is collected while fn runs, which may be on the machine goroutine, and
+// only sent once other sessions and the machine are free to continue.
+// Output that is not from the command still goes to every session.
+func (m *Monitor) withSession(s *session, fn func()) {
+	var buf bytes.Buffer
+	m.runSession(s, &buf, fn)
+	s.Write(buf.Bytes())
+}
+
+// runSession runs fn for withSession with the output of the command going
+// to buf. The lock is released with a defer as quit does not return.
+func (m *Monitor) runSession(s *session, buf *bytes.Buffer, fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	console := m.sessionState
+	out := m.cmdOut.Writer()
+	m.sessionState = s.sessionState
+	m.active = s
+	m.cmdOut.SetOutput(buf)
+	defer func() {
+		s.sessionState = m.sessionState
+		m.sessionState = console
+		m.active = nil
+		m.cmdOut.SetOutput(out)
+	}()
+	fn()
+	buf.WriteString(m.plainPrompt() + "\n")
+}
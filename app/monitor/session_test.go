@@ -0,0 +1,214 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blackchip-org/retro-cs/mock"
+	"github.com/blackchip-org/retro-cs/rcs"
+)
+
+// sessionClient is a scripted session.
+type sessionClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialSession(t *testing.T, l net.Listener) *sessionClient {
+	conn, err := net.Dial(l.Addr().Network(), l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &sessionClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// readLine returns the next line without the newline.
+func (c *sessionClient) readLine() string {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return strings.TrimSuffix(line, "\n")
+}
+
+// prompt reads lines until the prompt and returns the lines before it.
+func (c *sessionClient) prompt(want string) []string {
+	c.t.Helper()
+	lines := []string{}
+	for {
+		line := c.readLine()
+		if strings.HasSuffix(line, ">") {
+			if line != want {
+				c.t.Fatalf("\n have: %v \n want: %v", line, want)
+			}
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+// cmd sends a line and returns the output before the prompt.
+func (c *sessionClient) cmd(line string, prompt string) []string {
+	c.t.Helper()
+	fmt.Fprintln(c.conn, line)
+	return c.prompt(prompt)
+}
+
+func newSessionMach() *rcs.Mach {
+	mach := mock.NewMach()
+	mach.Comps = []rcs.Component{
+		rcs.NewComponent("mem", "mem", "", mock.TestMemory),
+		rcs.NewComponent("cpu1", "cpu", "mem", mock.NewCPU(mock.TestMemory)),
+		rcs.NewComponent("cpu2", "cpu", "mem", mock.NewCPU(mock.TestMemory)),
+	}
+	return mach
+}
+
+func TestSessions(t *testing.T) {
+	mach := newSessionMach()
+	mon := NewHeadless(mach)
+	done := make(chan error)
+	go func() { done <- mach.Run() }()
+	for !mach.Running() {
+		runtime.Gosched()
+	}
+	defer func() {
+		mach.Command(rcs.MachQuit)
+		<-done
+	}()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go mon.Serve(l)
+
+	a := dialSession(t, l)
+	defer a.conn.Close()
+	a.prompt("monitor:cpu1>")
+	b := dialSession(t, l)
+	defer b.conn.Close()
+	b.prompt("monitor:cpu1>")
+
+	check := func(name string, have []string, want ...string) {
+		t.Helper()
+		if len(have) != len(want) || (len(want) > 0 && !reflect.DeepEqual(have, want)) {
+			t.Errorf("%v:\n have: %v \n want: %v", name, have, want)
+		}
+	}
+	check("select", a.cmd("select cpu2", "monitor:cpu2>"))
+	check("select a", a.cmd("select", "monitor:cpu2>"), "cpu2")
+	check("select b", b.cmd("select", "monitor:cpu1>"), "cpu1")
+	check("no cpu", b.cmd("select cpu3", "monitor:cpu1>"), "invalid value: cpu3")
+	check("encoding", a.cmd("encoding az26", "monitor:cpu2>"))
+	check("encoding a", a.cmd("encoding", "monitor:cpu2>"), "az26")
+	check("encoding b", b.cmd("encoding", "monitor:cpu1>"), "ascii")
+	check("assemble", b.cmd("a $1000", "$1000>"))
+	check("prompt a", a.cmd("", "monitor:cpu2>"))
+	check("assemble end", b.cmd("", "monitor:cpu1>"))
+
+	// a breakpoint on the CPU selected by one session is shown to all
+	a.cmd("bps $1234", "monitor:cpu2>")
+	a.cmd("g", "monitor:cpu2>")
+	for _, c := range []*sessionClient{a, b} {
+		for {
+			if line := c.readLine(); line == "[cpu2:break]" {
+				break
+			}
+		}
+	}
+}
+
+func TestSessionEvents(t *testing.T) {
+	mon := NewHeadless(newSessionMach())
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go mon.Serve(l)
+
+	a := dialSession(t, l)
+	defer a.conn.Close()
+	a.prompt("monitor:cpu1>")
+	b := dialSession(t, l)
+	defer b.conn.Close()
+	b.prompt("monitor:cpu1>")
+
+	// output from the machine while a session runs a command is not only
+	// for that session
+	mon.outputs.mu.Lock()
+	var s *session
+	for s = range mon.outputs.sessions {
+		break
+	}
+	mon.outputs.mu.Unlock()
+	mon.withSession(s, func() {
+		mon.cpuCallback(rcs.ErrorEvent, "event")
+	})
+	for _, c := range []*sessionClient{a, b} {
+		c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if line := c.readLine(); line != "event" {
+			t.Errorf("\n have: %v \n want: %v", line, "event")
+		}
+	}
+}
+
+func TestSessionSlow(t *testing.T) {
+	mon := NewHeadless(newSessionMach())
+	// a session where nothing is sent until the client reads it
+	s := &session{sessionState: mon.defaults, out: make(chan []byte)}
+	go mon.withSession(s, func() { mon.cmdOut.Print("slow") })
+
+	// other commands are not held up by the session
+	done := make(chan struct{})
+	go func() {
+		mon.Eval("$2a")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("command blocked by session")
+	}
+	have, want := string(<-s.out), "slow\nmonitor:cpu1>\n"
+	if have != want {
+		t.Errorf("\n have: %q \n want: %q", have, want)
+	}
+}
+
+func TestSessionUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mon := NewHeadless(mock.NewMach())
+	l, err := net.Listen("unix", filepath.Join(dir, "monitor.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go mon.Serve(l)
+
+	c := dialSession(t, l)
+	c.prompt("monitor>")
+	if have, want := c.cmd("$2a", "monitor>"), []string{formatValue(42)}; !reflect.DeepEqual(have, want) {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+	// the session ends with the connection
+	c.conn.(*net.UnixConn).CloseWrite()
+	if rest, _ := ioutil.ReadAll(c.r); len(rest) != 0 {
+		t.Errorf("unexpected output: %q", rest)
+	}
+}
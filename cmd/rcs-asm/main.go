@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blackchip-org/retro-cs/rcs"
+	"github.com/blackchip-org/retro-cs/rcs/m6502"
+	"github.com/blackchip-org/retro-cs/rcs/z80"
+)
+
+var writers = map[string]rcs.CodeWriter{
+	"m6502": m6502.Writer,
+	"z80":   z80.Writer,
+}
+
+var (
+	optCPU     string
+	optFormat  string
+	optOut     string
+	optSymbols string
+)
+
+func init() {
+	flag.StringVar(&optCPU, "c", "m6502", "assemble for this `cpu`: m6502 or z80")
+	flag.StringVar(&optFormat, "f", "prg", "output `format`: prg or raw")
+	flag.StringVar(&optOut, "o", "", "write output to `filename`")
+	flag.StringVar(&optSymbols, "s", "", "write labels to symbol `filename`")
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: rcs-asm [options] source\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	writer, ok := writers[optCPU]
+	if !ok {
+		log.Fatalf("no such cpu: %v", optCPU)
+	}
+	if optFormat != "prg" && optFormat != "raw" {
+		log.Fatalf("no such format: %v", optFormat)
+	}
+
+	src := flag.Arg(0)
+	in, err := os.Open(src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	prog, err := rcs.NewAssembler(writer).Assemble(in)
+	in.Close()
+	if err != nil {
+		log.Fatalf("%v: %v", src, err)
+	}
+
+	out := optOut
+	if out == "" {
+		ext := ".prg"
+		if optFormat == "raw" {
+			ext = ".bin"
+		}
+		out = strings.TrimSuffix(src, filepath.Ext(src)) + ext
+	}
+	if err := writeProgram(out, prog); err != nil {
+		log.Fatal(err)
+	}
+	if optSymbols != "" {
+		if err := writeSymbols(optSymbols, prog.Symbols); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func writeProgram(filename string, prog *rcs.Program) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if optFormat == "raw" {
+		err = prog.WriteRaw(f)
+	} else {
+		err = prog.WritePRG(f)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeSymbols writes the labels in a format that can be loaded by the
+// monitor.
+func writeSymbols(filename string, syms rcs.Symbols) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	var addrs []int
+	for addr := range syms {
+		addrs = append(addrs, addr)
+	}
+	sort.Ints(addrs)
+	for _, addr := range addrs {
+		fmt.Fprintf(f, "%v = $%04x\n", syms[addr], addr)
+	}
+	return f.Close()
+}
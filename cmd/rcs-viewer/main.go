@@ -44,7 +44,7 @@ func init() {
 type view struct {
 	system string
 	roms   []rcs.ROM
-	render func(*sdl.Renderer, map[string][]byte) (rcs.TileSheet, error)
+	render func(map[string][]byte) (rcs.TileSheet, error)
 }
 
 func main() {
@@ -98,7 +98,7 @@ func main() {
 		fmt.Printf("unable to set swap interval: %v\n", err)
 	}
 
-	sheet, err := v.render(r, roms)
+	sheet, err := v.render(roms)
 	if err != nil {
 		log.Fatalf("unable to create sheet: %v", err)
 	}
@@ -108,8 +108,11 @@ func main() {
 	window.Show()
 
 	var scanlines *sdl.Texture
-	// Now that the window has been shown, the texture needs to be rerendered.
-	sheet, _ = v.render(r, roms)
+	// Create the texture now that the window has been shown
+	tex, err := rcs.NewTexture(r, sheet.Image)
+	if err != nil {
+		log.Fatal(err)
+	}
 	slwidth := int32(scale / 2)
 	if slwidth == 0 {
 		slwidth = 1
@@ -137,7 +140,7 @@ func main() {
 		r.SetRenderTarget(nil)
 		r.SetDrawColor(0, 0, 0, 0)
 		r.Clear()
-		r.Copy(sheet.Texture, nil, nil)
+		r.Copy(tex, nil, nil)
 		if scanlines != nil {
 			r.Copy(scanlines, nil, nil)
 		}
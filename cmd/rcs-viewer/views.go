@@ -8,88 +8,87 @@ import (
 	"github.com/blackchip-org/retro-cs/system/c64"
 	"github.com/blackchip-org/retro-cs/system/galaga"
 	"github.com/blackchip-org/retro-cs/system/pacman"
-	"github.com/veandco/go-sdl2/sdl"
 )
 
 var views = map[string]view{
 	"c64:chars": view{
 		system: "c64",
 		roms:   c64.SystemROM,
-		render: func(r *sdl.Renderer, d map[string][]byte) (rcs.TileSheet, error) {
-			return c64.CharGen(r, d["chargen"])
+		render: func(d map[string][]byte) (rcs.TileSheet, error) {
+			return c64.CharGen(d["chargen"])
 		},
 	},
 	"c64:colors": view{
 		system: "c64",
-		render: func(r *sdl.Renderer, _ map[string][]byte) (rcs.TileSheet, error) {
+		render: func(_ map[string][]byte) (rcs.TileSheet, error) {
 			palettes := [][]color.RGBA{c64.Palette}
-			return rcs.NewColorSheet(r, palettes)
+			return rcs.NewColorSheet(palettes)
 		},
 	},
 	"galaga:sprites": view{
 		system: "galaga",
 		roms:   galaga.ROM["galaga"],
-		render: func(r *sdl.Renderer, d map[string][]byte) (rcs.TileSheet, error) {
-			return namco.NewTileSheet(r, d["sprite"],
+		render: func(d map[string][]byte) (rcs.TileSheet, error) {
+			return namco.NewTileSheet(d["sprites"],
 				galaga.VideoConfig.SpriteLayout, namco.ViewerPalette)
 		},
 	},
 	"galaga:tiles": view{
 		system: "galaga",
 		roms:   galaga.ROM["galaga"],
-		render: func(r *sdl.Renderer, d map[string][]byte) (rcs.TileSheet, error) {
-			return namco.NewTileSheet(r, d["tile"],
+		render: func(d map[string][]byte) (rcs.TileSheet, error) {
+			return namco.NewTileSheet(d["tiles"],
 				galaga.VideoConfig.TileLayout, namco.ViewerPalette)
 		},
 	},
 	"mspacman:sprites": view{
 		system: "mspacman",
 		roms:   pacman.ROM["mspacman"],
-		render: func(r *sdl.Renderer, d map[string][]byte) (rcs.TileSheet, error) {
-			return namco.NewTileSheet(r, d["sprite"],
+		render: func(d map[string][]byte) (rcs.TileSheet, error) {
+			return namco.NewTileSheet(d["sprites"],
 				pacman.VideoConfig.SpriteLayout, namco.ViewerPalette)
 		},
 	},
 	"mspacman:tiles": view{
 		system: "mspacman",
 		roms:   pacman.ROM["mspacman"],
-		render: func(r *sdl.Renderer, d map[string][]byte) (rcs.TileSheet, error) {
-			return namco.NewTileSheet(r, d["tile"],
+		render: func(d map[string][]byte) (rcs.TileSheet, error) {
+			return namco.NewTileSheet(d["tiles"],
 				pacman.VideoConfig.TileLayout, namco.ViewerPalette)
 		},
 	},
 	"pacman:colors": view{
 		system: "pacman",
 		roms:   pacman.ROM["pacman"],
-		render: func(r *sdl.Renderer, d map[string][]byte) (rcs.TileSheet, error) {
+		render: func(d map[string][]byte) (rcs.TileSheet, error) {
 			config := pacman.VideoConfig
-			colors := namco.ColorTable(config, d["color"])
-			return rcs.NewColorSheet(r, [][]color.RGBA{colors})
+			colors := namco.ColorTable(config, d["colors"])
+			return rcs.NewColorSheet([][]color.RGBA{colors})
 		},
 	},
 	"pacman:palettes": view{
 		system: "pacman",
 		roms:   pacman.ROM["pacman"],
-		render: func(r *sdl.Renderer, d map[string][]byte) (rcs.TileSheet, error) {
+		render: func(d map[string][]byte) (rcs.TileSheet, error) {
 			config := pacman.VideoConfig
-			colors := namco.ColorTable(config, d["color"])
-			palettes := namco.PaletteTable(config, d["palette"], colors)
-			return rcs.NewColorSheet(r, palettes)
+			colors := namco.ColorTable(config, d["colors"])
+			palettes := namco.PaletteTable(config, d["palettes"], colors)
+			return rcs.NewColorSheet(palettes)
 		},
 	},
 	"pacman:sprites": view{
 		system: "pacman",
 		roms:   pacman.ROM["pacman"],
-		render: func(r *sdl.Renderer, d map[string][]byte) (rcs.TileSheet, error) {
-			return namco.NewTileSheet(r, d["sprite"],
+		render: func(d map[string][]byte) (rcs.TileSheet, error) {
+			return namco.NewTileSheet(d["sprites"],
 				pacman.VideoConfig.SpriteLayout, namco.ViewerPalette)
 		},
 	},
 	"pacman:tiles": view{
 		system: "pacman",
 		roms:   pacman.ROM["pacman"],
-		render: func(r *sdl.Renderer, d map[string][]byte) (rcs.TileSheet, error) {
-			return namco.NewTileSheet(r, d["tile"],
+		render: func(d map[string][]byte) (rcs.TileSheet, error) {
+			return namco.NewTileSheet(d["tiles"],
 				pacman.VideoConfig.TileLayout, namco.ViewerPalette)
 		},
 	},
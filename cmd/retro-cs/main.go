@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"runtime/pprof"
 
+	"github.com/blackchip-org/retro-cs/app/gdb"
 	"github.com/blackchip-org/retro-cs/app/monitor"
 	"github.com/blackchip-org/retro-cs/mock"
 
@@ -24,25 +25,37 @@ const (
 )
 
 var (
+	optDAP       string
 	optFullStart bool
+	optGDB       string
 	optProfC     bool
 	optPanic     bool
 	optSystem    string
 	optMonitor   bool
+	optMonAddr   string
 	optImport    string
+	optPlayMovie string
+	optRecMovie  string
 	optNoAudio   bool
+	optRecAudio  string
 	optNoVideo   bool
 	optTrace     bool
 	optWait      bool
 )
 
 func init() {
+	flag.StringVar(&optDAP, "dap", "", "listen for an editor using the Debug Adapter Protocol on `address`")
 	flag.BoolVar(&optFullStart, "f", false, "full start -- do not bypass POST")
+	flag.StringVar(&optGDB, "gdb", "", "listen for a GDB remote debugger on `address`")
 	flag.StringVar(&optImport, "i", "", "import state from `filename`")
 	flag.BoolVar(&optProfC, "profc", false, "enable cpu profiling")
 	flag.BoolVar(&optNoAudio, "no-audio", false, "disable audio")
 	flag.BoolVar(&optNoVideo, "no-video", false, "disable video")
+	flag.StringVar(&optRecAudio, "record-audio", "", "record audio to WAV `filename`")
+	flag.StringVar(&optPlayMovie, "play-movie", "", "play back the movie in `filename`")
+	flag.StringVar(&optRecMovie, "record-movie", "", "record input from power-on to movie `filename`")
 	flag.BoolVar(&optMonitor, "m", false, "enable monitor")
+	flag.StringVar(&optMonAddr, "monitor-addr", "", "listen for monitor sessions on `address`, a TCP address or the path of a Unix socket")
 	flag.BoolVar(&optPanic, "panic", false, "install panic log writer")
 	flag.StringVar(&optSystem, "s", "c64", "start this `system`")
 	flag.BoolVar(&optTrace, "t", false, "enable tracing")
@@ -123,13 +136,17 @@ func main() {
 		ctx.Renderer = r
 	}
 
-	if !optNoAudio {
-		requestSpec := sdl.AudioSpec{
-			Freq:     22050,
-			Format:   sdl.AUDIO_S16LSB,
-			Channels: 2,
-			Samples:  367,
-		}
+	requestSpec := sdl.AudioSpec{
+		Freq:     22050,
+		Format:   sdl.AUDIO_S16LSB,
+		Channels: 2,
+		Samples:  367,
+	}
+	if optNoAudio && optRecAudio != "" {
+		// generate audio for the recording without playing it
+		ctx.AudioSpec = requestSpec
+		ctx.AudioSink = rcs.NewNullSink()
+	} else if !optNoAudio {
 		if err := sdl.OpenAudio(&requestSpec, &ctx.AudioSpec); err != nil {
 			log.Fatalf("unable to initialize audio: %v", err)
 		}
@@ -140,16 +157,64 @@ func main() {
 	if err != nil {
 		log.Fatalf("unable to create machine: \n%v", err)
 	}
+	if err := mach.LoadSymbols(config.DataDir); err != nil {
+		log.Printf("unable to load symbols: %v", err)
+	}
 
+	// the console is only used with -m so that it does not read from
+	// standard input otherwise
 	var mon *monitor.Monitor
-	mon, err = monitor.New(mach)
-	if err != nil {
-		log.Fatalf("unable to create monitor: %v\n", err)
+	if optMonitor {
+		mon, err = monitor.New(mach)
+		if err != nil {
+			log.Fatalf("unable to create monitor: %v\n", err)
+		}
+	} else {
+		mon = monitor.NewHeadless(mach)
 	}
 	defer func() {
 		mon.Close()
 	}()
 
+	// servers are started once the machine is running as their clients
+	// use Mach.Call
+	var servers []func()
+	if optMonAddr != "" {
+		servers = append(servers, func() {
+			if err := mon.ListenAndServe(optMonAddr); err != nil {
+				log.Fatalf("monitor server error: %v", err)
+			}
+		})
+	}
+
+	if optDAP != "" {
+		servers = append(servers, func() {
+			if err := mon.ListenAndServeDAP(optDAP); err != nil {
+				log.Fatalf("dap server error: %v", err)
+			}
+		})
+	}
+
+	// the server chains the callback installed by the monitor
+	if optGDB != "" {
+		srv, err := gdb.New(mach)
+		if err != nil {
+			log.Fatalf("unable to create gdb server: %v", err)
+		}
+		servers = append(servers, func() {
+			if err := srv.ListenAndServe(optGDB); err != nil {
+				log.Fatalf("gdb server error: %v", err)
+			}
+		})
+	}
+
+	// bindings are always available once the monitor has initialized
+	// the machine
+	keysFile := filepath.Join(config.UserDir, optSystem+".keys")
+	if err := mach.Bindings.LoadFile(keysFile); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("unable to load key bindings: %v", err)
+	}
+
 	if optMonitor {
 		go func() {
 			err := mon.Run()
@@ -179,6 +244,27 @@ func main() {
 		}
 	*/
 
+	if optRecAudio != "" {
+		if err := mach.StartAudioRecording(optRecAudio); err != nil {
+			log.Fatalf("unable to record audio: %v", err)
+		}
+	}
+
+	if optPlayMovie != "" {
+		mv, err := rcs.LoadMovie(optPlayMovie)
+		if err != nil {
+			log.Fatalf("unable to load movie: %v", err)
+		}
+		if err := mach.PlayMovie(mv); err != nil {
+			log.Fatalf("unable to play movie: %v", err)
+		}
+	}
+	if optRecMovie != "" {
+		if err := mach.StartMovie(optRecMovie); err != nil {
+			log.Fatalf("unable to record movie: %v", err)
+		}
+	}
+
 	if optPanic {
 		log.SetOutput(&mock.PanicWriter{})
 	}
@@ -189,5 +275,14 @@ func main() {
 		mon.Eval(string(cmds))
 	}
 
-	mach.Run()
+	// handled by Run after the status above is in place
+	mach.Command(rcs.MachExec, func() error {
+		for _, serve := range servers {
+			go serve()
+		}
+		return nil
+	})
+	if err := mach.Run(); err != nil {
+		log.Printf("error: %v", err)
+	}
 }
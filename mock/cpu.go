@@ -2,6 +2,7 @@ package mock
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/blackchip-org/retro-cs/rcs"
 )
@@ -17,6 +18,8 @@ type CPU struct {
 	// Offset to be added to the program counter to get the address of the
 	// next instruction.
 	OffsetPC int
+
+	cycles int
 }
 
 func NewCPU(mem *rcs.Memory) *CPU {
@@ -39,13 +42,19 @@ func (c *CPU) Memory() *rcs.Memory {
 	return c.mem
 }
 
+// Cycles is the number of instructions executed. Each instruction takes
+// one cycle.
+func (c *CPU) Cycles() int {
+	return c.cycles
+}
+
 // Next reads the next byte at the program counter as the "opcode". The high
 // nibble is the number of "arguments" it will fetch (max two).
 func (c *CPU) Next() {
 	if c.OffsetPC == 1 {
 		c.pc++
 	}
-	opcode := c.mem.Read(int(c.pc))
+	opcode := c.mem.Fetch(int(c.pc))
 	if c.OffsetPC == 0 {
 		c.pc++
 	}
@@ -53,10 +62,47 @@ func (c *CPU) Next() {
 	if narg > 2 {
 		narg = 2
 	}
+	for i := 0; i < narg; i++ {
+		c.mem.Fetch(int(c.pc + uint16(c.OffsetPC+i)))
+	}
 	c.pc += uint16(narg)
+	c.cycles++
 	return
 }
 
+func (c *CPU) Registers() map[string]rcs.Load {
+	boolean := func(b *bool) rcs.Load {
+		return func() int {
+			if *b {
+				return 1
+			}
+			return 0
+		}
+	}
+	return map[string]rcs.Load{
+		"r.pc": c.PC,
+		"r.a":  func() int { return int(c.A) },
+		"r.b":  func() int { return int(c.B) },
+		"f.q":  boolean(&c.Q),
+		"f.z":  boolean(&c.Z),
+	}
+}
+
+func (c *CPU) SnapshotRegisters(r *rcs.RegisterSnapshot) {
+	r[0], r[1] = c.A, c.B
+	r[2], r[3] = 0, 0
+	if c.Q {
+		r[2] = 1
+	}
+	if c.Z {
+		r[3] = 1
+	}
+}
+
+func (c *CPU) FormatSnapshot(r *rcs.RegisterSnapshot) string {
+	return fmt.Sprintf("a:%02x b:%02x q:%v z:%v", r[0], r[1], r[2] != 0, r[3] != 0)
+}
+
 func (c *CPU) String() string {
 	return fmt.Sprintf("pc:%04x a:%02x b:%02x q:%v z:%v", c.pc, c.A, c.B, c.Q, c.Z)
 }
@@ -95,3 +141,30 @@ func formatter() rcs.CodeFormatter {
 func (c *CPU) NewDisassembler() *rcs.Disassembler {
 	return rcs.NewDisassembler(c.mem, reader, formatter())
 }
+
+// writer encodes the instructions produced by reader. The opcode is the
+// hex value after "i", "i10", and the value is a byte or word depending on
+// the high nibble.
+func writer(e rcs.AsmEval) ([]uint8, error) {
+	opcode, err := strconv.ParseUint(e.Op[1:], 16, 8)
+	if e.Op[0] != 'i' || err != nil || opcode>>4 > 2 {
+		return nil, fmt.Errorf("no such instruction: %v", e.Op)
+	}
+	code := []uint8{uint8(opcode)}
+	argN := opcode >> 4
+	if argN == 0 {
+		return code, nil
+	}
+	v, err := e.Eval(e.Operand)
+	if err != nil {
+		return nil, err
+	}
+	if argN == 1 {
+		return append(code, uint8(v)), nil
+	}
+	return append(code, uint8(v), uint8(v>>8)), nil
+}
+
+func (c *CPU) NewAssembler() *rcs.Assembler {
+	return rcs.NewAssembler(writer)
+}
@@ -14,6 +14,7 @@ func NewMach() *rcs.Mach {
 			"az26":  AZ26Decoder,
 		},
 		DefaultEncoding: "ascii",
+		Clock:           1000000,
 	}
 }
 
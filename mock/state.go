@@ -0,0 +1,196 @@
+package mock
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/blackchip-org/retro-cs/rcs"
+)
+
+// StateTest describes the machine of a system for TestState.
+type StateTest struct {
+	// NewMach creates the machine with the given ROMs.
+	NewMach func(roms map[string][]byte) (*rcs.Mach, error)
+	// ROMs are the ROMs given to each machine created.
+	ROMs map[string][]byte
+	// Before is the number of frames run before the state is exported or
+	// the movie is started.
+	Before int
+	// Frames is the number of frames run after the export and the length
+	// of the movie.
+	Frames int
+	// Inputs are sent while the movie is recorded. The movie is only
+	// replayed if there are inputs.
+	Inputs []rcs.MovieEvent
+}
+
+// TestState runs RoundTrip and ReplayMovie on the machine described by
+// test.
+func TestState(t *testing.T, test StateTest) {
+	newMach := func() (*rcs.Mach, error) {
+		return test.NewMach(test.ROMs)
+	}
+	t.Run("round trip", func(t *testing.T) {
+		if err := RoundTrip(newMach, test.Before, test.Frames); err != nil {
+			t.Error(err)
+		}
+	})
+	if len(test.Inputs) == 0 {
+		return
+	}
+	t.Run("movie", func(t *testing.T) {
+		if err := ReplayMovie(newMach, test.Before, test.Frames, test.Inputs); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// Pattern returns n bytes that repeat every 256 bytes. It fills graphics
+// ROMs so that tiles and sprites are not blank.
+func Pattern(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i * 7)
+	}
+	return b
+}
+
+// RoundTrip checks that a machine restored from a savestate continues
+// exactly like the machine that was saved. A machine created with
+// newMach is run for the number of frames in before, exported, and then
+// run for the number of frames in after. A second machine is imported
+// from the export and run for the same number of frames. An error is
+// returned if any section of the final states, or the screens, differ.
+func RoundTrip(newMach func() (*rcs.Mach, error), before int, after int) error {
+	m1, err := newMach()
+	if err != nil {
+		return err
+	}
+	if err := m1.RunFrames(before); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := m1.Export(&buf); err != nil {
+		return err
+	}
+	if err := m1.RunFrames(after); err != nil {
+		return err
+	}
+
+	m2, err := newMach()
+	if err != nil {
+		return err
+	}
+	if err := m2.Import(&buf); err != nil {
+		return err
+	}
+	if err := m2.RunFrames(after); err != nil {
+		return err
+	}
+	return compare(m1, m2)
+}
+
+// ReplayMovie checks that playing back a movie reproduces the session it
+// was recorded from. A machine created with newMach is run for the number
+// of frames in before and then a movie is recorded while it is run for
+// the number of frames in length. Each input is sent after the number of
+// frames, since the start of the movie, given by its frame. A second
+// machine plays back the movie. An error is returned if any section of
+// the final states, or the screens, differ.
+func ReplayMovie(newMach func() (*rcs.Mach, error), before int, length int, inputs []rcs.MovieEvent) error {
+	dir, err := ioutil.TempDir("", "rcs-movie")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "movie")
+
+	m1, err := newMach()
+	if err != nil {
+		return err
+	}
+	if err := m1.RunFrames(before); err != nil {
+		return err
+	}
+	if err := m1.StartMovie(filename); err != nil {
+		return err
+	}
+	next := 0
+	for frame := 0; frame < length; frame++ {
+		for next < len(inputs) && inputs[next].Frame <= frame {
+			if err := m1.SendInput(inputs[next].Input); err != nil {
+				return err
+			}
+			next++
+		}
+		if err := m1.RunFrames(1); err != nil {
+			return err
+		}
+	}
+	if err := m1.StopMovie(); err != nil {
+		return err
+	}
+
+	mv, err := rcs.LoadMovie(filename)
+	if err != nil {
+		return err
+	}
+	m2, err := newMach()
+	if err != nil {
+		return err
+	}
+	if err := m2.PlayMovie(mv); err != nil {
+		return err
+	}
+	if err := m2.RunFrames(mv.Frames); err != nil {
+		return err
+	}
+	if m2.MoviePlaying() {
+		return fmt.Errorf("movie did not end after %v frames", mv.Frames)
+	}
+	return compare(m1, m2)
+}
+
+// compare returns an error if any section of the states of the two
+// machines, or their screens, differ.
+func compare(m1 *rcs.Mach, m2 *rcs.Mach) error {
+	st1, err := m1.SaveState()
+	if err != nil {
+		return err
+	}
+	st2, err := m2.SaveState()
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range st1.Sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !bytes.Equal(st1.Sections[name], st2.Sections[name]) {
+			return fmt.Errorf("section %v differs", name)
+		}
+	}
+
+	if m1.Screen.W == 0 {
+		return nil
+	}
+	img1, err := m1.DrawScreen()
+	if err != nil {
+		return err
+	}
+	img2, err := m2.DrawScreen()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(img1.Pix, img2.Pix) {
+		return fmt.Errorf("screen differs")
+	}
+	return nil
+}
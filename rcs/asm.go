@@ -0,0 +1,439 @@
+package rcs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CodeWriter encodes the instruction in AsmEval and returns its bytes.
+type CodeWriter func(AsmEval) ([]uint8, error)
+
+// AsmEval is an instruction to be encoded by a CodeWriter.
+type AsmEval struct {
+	Addr    int    // Address of the instruction
+	Op      string // Mnemonic in lower case, "lda"
+	Operand string // Everything after the mnemonic, "($20),y"
+	Final   bool   // All labels are defined and errors should be reported
+	asm     *Assembler
+	forward *bool
+}
+
+// Eval returns the value of an expression in the operand.
+func (e AsmEval) Eval(expr string) (int, error) {
+	return e.asm.eval(expr, e.Addr, e.forward)
+}
+
+// Forward returns true if an expression evaluated on this line refers to a
+// label that was not defined before the line in the first pass. Its value
+// is not yet known and the CodeWriter must not pick a shorter encoding
+// based on it, such as using zero page addressing on the 6502. Forward
+// only has meaning after Eval has been called.
+func (e AsmEval) Forward() bool {
+	return *e.forward
+}
+
+// Program is the output of an Assembler.
+type Program struct {
+	Origin  int     // Address of the first byte of Code
+	Code    []uint8 // Gaps between origins are filled with zeros
+	Symbols Symbols // Labels defined in the source
+}
+
+// WriteRaw writes the code with nothing else.
+func (p *Program) WriteRaw(w io.Writer) error {
+	_, err := w.Write(p.Code)
+	return err
+}
+
+// WritePRG writes the code with the origin as the load address in the
+// first two bytes, the format used by Commodore programs.
+func (p *Program) WritePRG(w io.Writer) error {
+	if err := binary.Write(w, binary.LittleEndian, uint16(p.Origin)); err != nil {
+		return err
+	}
+	return p.WriteRaw(w)
+}
+
+// Assembler translates source code into machine code in two passes. The
+// first pass finds the address of each label and the second pass encodes
+// the instructions using a CodeWriter provided by the CPU.
+//
+// Each line has an optional label, an instruction or directive, and an
+// optional comment that starts with ";":
+//
+//	chrout = $ffd2          ; assign a value to a name
+//	        .org $c000      ; set the address of the next line
+//	start:  ldx #0          ; define a label for the address of the line
+//	loop:   lda msg,x
+//	        beq done
+//	        jsr chrout
+//	        inx
+//	        bne loop
+//	done:   rts
+//	msg:    .byte "HELLO", 13, 0
+//	        .word start, loop
+//
+// Mnemonics and directives are not case sensitive but names are. The
+// origin is zero until set with .org. Values in .byte are from -128 to
+// 255 and may also be strings in double quotes. Values in .word are
+// written as little-endian.
+//
+// Expressions are the same as in Expr except that names are the labels
+// defined in the source or with Define instead of registers. A "*" in
+// place of a value is the address of the current line. The unary operators
+// "<" and ">" return the low and high byte of a value: "lda #<msg".
+type Assembler struct {
+	write    CodeWriter
+	names    map[string]int
+	labels   Symbols
+	final    bool
+	tainted  map[string]bool // names that depend on a forward reference
+	forwards []bool          // lines with forward references in the first pass
+	sizes    []int           // size of each line in the first pass
+}
+
+// NewAssembler creates an assembler that encodes instructions with w.
+func NewAssembler(w CodeWriter) *Assembler {
+	return &Assembler{
+		write:   w,
+		names:   make(map[string]int),
+		labels:  make(Symbols),
+		tainted: make(map[string]bool),
+	}
+}
+
+// Define assigns a value to a name that can be used in expressions.
+func (a *Assembler) Define(name string, value int) {
+	a.names[name] = value
+}
+
+// Labels returns the labels defined so far by their addresses.
+func (a *Assembler) Labels() Symbols {
+	labels := make(Symbols)
+	labels.Add(a.labels)
+	return labels
+}
+
+// asmLine is a line of source split into its parts.
+type asmLine struct {
+	label   string // defined with "label:"
+	name    string // defined with "name = expr"
+	op      string // mnemonic or directive in lower case
+	operand string
+}
+
+// Assemble reads the source in r and returns the assembled program.
+// Errors include the line number.
+func (a *Assembler) Assemble(r io.Reader) (*Program, error) {
+	var lines []asmLine
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line, err := parseAsmLine(s.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", n, err)
+		}
+		lines = append(lines, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	a.forwards = make([]bool, len(lines))
+	a.sizes = make([]int, len(lines))
+	a.final = false
+	if _, err := a.pass(lines); err != nil {
+		return nil, err
+	}
+	a.final = true
+	chunks, err := a.pass(lines)
+	if err != nil {
+		return nil, err
+	}
+
+	prog := &Program{Symbols: a.Labels()}
+	lo, hi := -1, -1
+	for _, c := range chunks {
+		if lo < 0 || c.addr < lo {
+			lo = c.addr
+		}
+		if end := c.addr + len(c.code); end > hi {
+			hi = end
+		}
+	}
+	if lo < 0 {
+		return prog, nil
+	}
+	prog.Origin = lo
+	prog.Code = make([]uint8, hi-lo)
+	for _, c := range chunks {
+		copy(prog.Code[c.addr-lo:], c.code)
+	}
+	return prog, nil
+}
+
+type asmChunk struct {
+	addr int
+	code []uint8
+}
+
+func (a *Assembler) pass(lines []asmLine) ([]asmChunk, error) {
+	var chunks []asmChunk
+	addr := 0
+	for i, line := range lines {
+		if !a.final {
+			a.forwards[i] = false
+		}
+		if line.op == ".org" {
+			v, err := a.eval(line.operand, addr, &a.forwards[i])
+			if err == nil && a.forwards[i] {
+				err = fmt.Errorf("origin must be defined before use")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %v", i+1, err)
+			}
+			addr = v
+		}
+		code, err := a.line(line, addr, &a.forwards[i])
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", i+1, err)
+		}
+		if !a.final {
+			a.sizes[i] = len(code)
+		} else if len(code) != a.sizes[i] {
+			return nil, fmt.Errorf("line %v: size changed between passes", i+1)
+		}
+		if len(code) > 0 {
+			chunks = append(chunks, asmChunk{addr: addr, code: code})
+		}
+		addr += len(code)
+	}
+	return chunks, nil
+}
+
+// AssembleLine assembles a single line of source as if it were at addr.
+// All names must already be defined. Labels defined by the line are
+// available to the lines that follow.
+func (a *Assembler) AssembleLine(addr int, src string) ([]uint8, error) {
+	line, err := parseAsmLine(src)
+	if err != nil {
+		return nil, err
+	}
+	if line.op == ".org" {
+		return nil, fmt.Errorf("directive not supported here: %v", line.op)
+	}
+	a.final = true
+	forward := false
+	return a.line(line, addr, &forward)
+}
+
+func (a *Assembler) line(line asmLine, addr int, forward *bool) ([]uint8, error) {
+	if line.label != "" {
+		a.names[line.label] = addr
+		a.labels[addr] = line.label
+	}
+	if line.name != "" {
+		v, err := a.eval(line.operand, addr, forward)
+		if err != nil {
+			return nil, err
+		}
+		a.names[line.name] = v
+		a.tainted[line.name] = *forward
+		return nil, nil
+	}
+	switch line.op {
+	case "", ".org":
+		return nil, nil
+	case ".byte":
+		return a.data(line.operand, addr, forward, 1)
+	case ".word":
+		return a.data(line.operand, addr, forward, 2)
+	}
+	if strings.HasPrefix(line.op, ".") {
+		return nil, fmt.Errorf("no such directive: %v", line.op)
+	}
+	return a.write(AsmEval{
+		Addr:    addr,
+		Op:      line.op,
+		Operand: line.operand,
+		Final:   a.final,
+		asm:     a,
+		forward: forward,
+	})
+}
+
+func (a *Assembler) data(operand string, addr int, forward *bool, size int) ([]uint8, error) {
+	var code []uint8
+	for _, arg := range SplitOperands(operand) {
+		if size == 1 && strings.HasPrefix(arg, `"`) {
+			if len(arg) < 2 || !strings.HasSuffix(arg, `"`) {
+				return nil, fmt.Errorf("unterminated string: %v", arg)
+			}
+			code = append(code, arg[1:len(arg)-1]...)
+			continue
+		}
+		v, err := a.eval(arg, addr, forward)
+		if err != nil {
+			return nil, err
+		}
+		if size == 1 {
+			if err := CheckByte(v); err != nil {
+				return nil, err
+			}
+			code = append(code, uint8(v))
+		} else {
+			if err := CheckWord(v); err != nil {
+				return nil, err
+			}
+			code = append(code, uint8(v), uint8(v>>8))
+		}
+	}
+	if len(code) == 0 {
+		return nil, fmt.Errorf("expecting a value")
+	}
+	return code, nil
+}
+
+func (a *Assembler) eval(expr string, addr int, forward *bool) (int, error) {
+	if strings.TrimSpace(expr) == "" {
+		return 0, fmt.Errorf("expecting a value")
+	}
+	return evalAsm(expr, func(name string) (int, error) {
+		if name == "*" {
+			return addr, nil
+		}
+		v, ok := a.names[name]
+		if a.tainted[name] && !a.final {
+			*forward = true
+		}
+		if ok {
+			return v, nil
+		}
+		if a.final {
+			return 0, fmt.Errorf("undefined: %v", name)
+		}
+		*forward = true
+		return 0, nil
+	})
+}
+
+// parseAsmLine splits a line of source into its parts.
+func parseAsmLine(src string) (asmLine, error) {
+	var line asmLine
+	text := strings.TrimSpace(stripComment(src))
+	if i := strings.Index(text, ":"); i > 0 && isName(text[:i]) {
+		line.label = text[:i]
+		text = strings.TrimSpace(text[i+1:])
+	}
+	if i := strings.Index(text, "="); i > 0 && isName(strings.TrimSpace(text[:i])) {
+		if line.label != "" {
+			return line, fmt.Errorf("unexpected label: %v", line.label)
+		}
+		line.name = strings.TrimSpace(text[:i])
+		line.operand = strings.TrimSpace(text[i+1:])
+		return line, nil
+	}
+	if text == "" {
+		return line, nil
+	}
+	line.op = text
+	if i := strings.IndexAny(text, " \t"); i > 0 {
+		line.op, line.operand = text[:i], strings.TrimSpace(text[i+1:])
+	}
+	line.op = strings.ToLower(line.op)
+	return line, nil
+}
+
+// stripComment removes the comment that starts with a ";" that is not
+// within a string.
+func stripComment(src string) string {
+	quoted := false
+	for i, ch := range src {
+		switch {
+		case ch == '"':
+			quoted = !quoted
+		case ch == ';' && !quoted:
+			return src[:i]
+		}
+	}
+	return src
+}
+
+func isName(str string) bool {
+	if str == "" || isDigit(str[0]) {
+		return false
+	}
+	for i := 0; i < len(str); i++ {
+		if !isNameChar(str[i]) && str[i] != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// SplitOperands splits an operand at the commas that are not within
+// parentheses or strings. Each part is trimmed of spaces. An empty operand
+// has no parts.
+func SplitOperands(operand string) []string {
+	var parts []string
+	depth, quoted, start := 0, false, 0
+	for i, ch := range operand {
+		switch {
+		case ch == '"':
+			quoted = !quoted
+		case quoted:
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+		case ch == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(operand[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(operand[start:]); last != "" || len(parts) > 0 {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+// IsWrapped returns true if the entire operand is within a single pair of
+// parentheses, "($20)" but not "($20),y" or "(1+2)*3".
+func IsWrapped(operand string) bool {
+	if !strings.HasPrefix(operand, "(") || !strings.HasSuffix(operand, ")") {
+		return false
+	}
+	depth := 0
+	for i, ch := range operand {
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 && i != len(operand)-1 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// CheckByte returns an error if v cannot be stored in a byte as either a
+// signed or unsigned value.
+func CheckByte(v int) error {
+	if v < -0x80 || v > 0xff {
+		return fmt.Errorf("value out of range: %v", v)
+	}
+	return nil
+}
+
+// CheckWord returns an error if v cannot be stored in a 16-bit word as
+// either a signed or unsigned value.
+func CheckWord(v int) error {
+	if v < -0x8000 || v > 0xffff {
+		return fmt.Errorf("value out of range: %v", v)
+	}
+	return nil
+}
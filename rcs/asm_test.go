@@ -0,0 +1,122 @@
+package rcs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// testWriter encodes "op expr" as the opcode $ff followed by the value as
+// a word. "nop" is a single zero byte.
+func testWriter(e AsmEval) ([]uint8, error) {
+	if e.Op == "nop" {
+		return []uint8{0}, nil
+	}
+	v, err := e.Eval(e.Operand)
+	if err != nil {
+		return nil, err
+	}
+	return []uint8{0xff, uint8(v), uint8(v >> 8)}, nil
+}
+
+func TestAssembler(t *testing.T) {
+	src := `
+; comment
+base = $1000
+        .org base
+start:  op end
+        op *        ; comment
+        .org base + 8
+data:   .byte 1, -1, "a;b", <$1234, >$1234
+end:    .word start, end - start
+`
+	a := NewAssembler(testWriter)
+	prog, err := a.Assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint8{
+		0xff, 0x0f, 0x10,
+		0xff, 0x03, 0x10,
+		0x00, 0x00,
+		0x01, 0xff, 'a', ';', 'b', 0x34, 0x12,
+		0x00, 0x10, 0x0f, 0x00,
+	}
+	if prog.Origin != 0x1000 || !bytes.Equal(prog.Code, want) {
+		t.Errorf("\n have: $%04x % x \n want: $1000 % x", prog.Origin, prog.Code, want)
+	}
+	if prog.Symbols[0x1008] != "data" || prog.Symbols[0x100f] != "end" {
+		t.Errorf("\n have: %v \n want: data at $1008, end at $100f", prog.Symbols)
+	}
+	if _, ok := prog.Symbols[0x1000]; !ok {
+		t.Errorf("start not found: %v", prog.Symbols)
+	}
+
+	var out bytes.Buffer
+	if err := prog.WritePRG(&out); err != nil {
+		t.Fatal(err)
+	}
+	if have := out.Bytes()[:3]; !bytes.Equal(have, []uint8{0x00, 0x10, 0xff}) {
+		t.Errorf("\n have: % x \n want: 00 10 ff", have)
+	}
+}
+
+func TestAssemblerDefine(t *testing.T) {
+	a := NewAssembler(testWriter)
+	a.Define("CHROUT", 0xffd2)
+	have, err := a.AssembleLine(0x1000, "loop: op CHROUT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint8{0xff, 0xd2, 0xff}; !bytes.Equal(have, want) {
+		t.Errorf("\n have: % x \n want: % x", have, want)
+	}
+	if have, _ := a.AssembleLine(0x1003, "op loop"); have[1] != 0x00 || have[2] != 0x10 {
+		t.Errorf("\n have: % x \n want: ff 00 10", have)
+	}
+	if a.Labels()[0x1000] != "loop" {
+		t.Errorf("\n have: %v \n want: loop", a.Labels())
+	}
+}
+
+func TestAssemblerErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"op nowhere", "line 1: undefined: nowhere"},
+		{"\n.org later\nlater = 1", "line 2: origin must be defined before use"},
+		{".byte 256", "line 1: value out of range: 256"},
+		{".byte", "line 1: expecting a value"},
+		{`.byte "abc`, "line 1: unterminated string: \"abc"},
+		{".word $10000", "line 1: value out of range: 65536"},
+		{".foo", "line 1: no such directive: .foo"},
+		{"op 1 +", "line 1: unexpected end of expression"},
+	}
+	for _, test := range tests {
+		a := NewAssembler(testWriter)
+		_, err := a.Assemble(strings.NewReader(test.src))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("\n have: %v \n want: %v", err, test.want)
+		}
+	}
+}
+
+func TestSplitOperands(t *testing.T) {
+	tests := []struct {
+		operand string
+		want    []string
+	}{
+		{"", nil},
+		{"a", []string{"a"}},
+		{"($20),y", []string{"($20)", "y"}},
+		{"($20,x)", []string{"($20,x)"}},
+		{` "a,b" , 1`, []string{`"a,b"`, "1"}},
+	}
+	for _, test := range tests {
+		have := SplitOperands(test.operand)
+		if strings.Join(have, "|") != strings.Join(test.want, "|") || len(have) != len(test.want) {
+			t.Errorf("%q:\n have: %q \n want: %q", test.operand, have, test.want)
+		}
+	}
+}
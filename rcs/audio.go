@@ -2,7 +2,9 @@ package rcs
 
 import (
 	"fmt"
+	"io"
 	"math"
+	"time"
 
 	"github.com/veandco/go-sdl2/sdl"
 )
@@ -58,10 +60,13 @@ func (v *Voice) Fill(out []float64, n int) {
 type Synth struct {
 	Spec sdl.AudioSpec
 	V    []*Voice
+	Sink AudioSink // where the audio is sent, the SDL device by default
+	Tap  io.Writer // if not nil, receives a copy of the queued audio
 
 	samples [][]float64
 	mixed   []float64
 	data    []byte
+	frac    int64 // fraction of a sample carried over to the next frame
 }
 
 func NewSynth(spec sdl.AudioSpec, voiceN int) (*Synth, error) {
@@ -73,6 +78,7 @@ func NewSynth(spec sdl.AudioSpec, voiceN int) (*Synth, error) {
 	}
 	s := &Synth{}
 	s.Spec = spec
+	s.Sink = NewSDLSink(spec)
 	s.V = make([]*Voice, voiceN)
 	samplesLen := s.Spec.Samples * Buffer
 	s.samples = make([][]float64, voiceN, voiceN)
@@ -86,9 +92,18 @@ func NewSynth(spec sdl.AudioSpec, voiceN int) (*Synth, error) {
 	return s, nil
 }
 
+// Queue generates the audio for a single frame and writes it to the sink.
 func (s *Synth) Queue() error {
-	q := sdl.GetQueuedAudioSize(1) / 4
-	n := int(s.Spec.Samples*Buffer) - int(q)
+	// the number of samples in a frame is not a whole number so the
+	// remainder is carried over to the next frame.
+	s.frac += int64(s.Spec.Freq) * int64(vblank)
+	perFrame := int(s.frac / int64(time.Second))
+	s.frac %= int64(time.Second)
+
+	n := s.Sink.Request(perFrame)
+	if n > len(s.mixed) {
+		n = len(s.mixed)
+	}
 	if n <= 0 {
 		return nil
 	}
@@ -109,7 +124,13 @@ func (s *Synth) Queue() error {
 		s.data[d+2] = byte(sample & 0xff)
 		s.data[d+3] = byte(sample >> 8)
 	}
-	return sdl.QueueAudio(1, s.data[0:n*4])
+	if s.Tap != nil {
+		if _, err := s.Tap.Write(s.data[0 : n*4]); err != nil {
+			return err
+		}
+	}
+	_, err := s.Sink.Write(s.data[0 : n*4])
+	return err
 }
 
 func convert(f float64) int16 {
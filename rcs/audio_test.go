@@ -3,8 +3,12 @@ package rcs
 import (
 	"fmt"
 	"math"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+
+	"github.com/veandco/go-sdl2/sdl"
 )
 
 func TestFill(t *testing.T) {
@@ -71,3 +75,75 @@ func TestConvertSample(t *testing.T) {
 		})
 	}
 }
+
+type countSink struct {
+	NullSink
+	n int
+}
+
+func (s *countSink) Write(data []byte) (int, error) {
+	s.n += len(data) / 4
+	return len(data), nil
+}
+
+var testSpec = sdl.AudioSpec{
+	Freq:     22050,
+	Format:   sdl.AUDIO_S16LSB,
+	Channels: 2,
+	Samples:  367,
+}
+
+func TestSynthSamplesPerFrame(t *testing.T) {
+	s, err := NewSynth(testSpec, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &countSink{}
+	s.Sink = sink
+	for i := 0; i < 100; i++ {
+		s.Queue()
+	}
+	// 22050 Hz * 16.67 ms * 100 frames
+	have := sink.n
+	want := 36757
+	if have != want {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+}
+
+func TestMachRecordAudio(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	s, err := NewSynth(testSpec, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Sink = NewNullSink()
+	m := &Mach{
+		Ctx:        SDLContext{AudioSpec: testSpec},
+		Synth:      s,
+		QueueAudio: s.Queue,
+	}
+	filename := filepath.Join(dir, "audio.wav")
+	if err := m.StartAudioRecording(filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RunFrames(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.StopAudioRecording(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Tap != nil {
+		t.Errorf("tap not removed")
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := info.Size()
+	want := int64(44 + (367+368)*4)
+	if have != want {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+}
@@ -0,0 +1,152 @@
+package rcs
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SavePNG writes the image to filename in the PNG format.
+func SavePNG(filename string, img image.Image) error {
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(out, img); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Recorder captures each frame of the screen and the audio that is
+// played along with it.
+//
+// If the name of the recording ends with ".gif", the frames are stored
+// in an animated GIF and the audio is written to a file with the same
+// name ending in ".wav" instead. The frames are kept in memory until the
+// recorder is closed. Otherwise, the name is a directory and each frame is
+// written as a numbered PNG file with the audio in "audio.wav".
+type Recorder struct {
+	name   string
+	anim   *gif.GIF
+	frames int
+	wav    *WAVSink
+}
+
+// NewRecorder starts a recording with the given name. If rate is not zero,
+// audio sampled at that rate in hertz is recorded in stereo.
+func NewRecorder(name string, rate int) (*Recorder, error) {
+	r := &Recorder{name: name}
+	var wavFile string
+	if strings.HasSuffix(strings.ToLower(name), ".gif") {
+		r.anim = &gif.GIF{}
+		wavFile = strings.TrimSuffix(name, filepath.Ext(name)) + ".wav"
+	} else {
+		if err := os.MkdirAll(name, 0755); err != nil {
+			return nil, err
+		}
+		wavFile = filepath.Join(name, "audio.wav")
+	}
+	if rate != 0 {
+		wav, err := NewWAVSink(wavFile, rate)
+		if err != nil {
+			return nil, err
+		}
+		r.wav = wav
+	}
+	return r, nil
+}
+
+// Frame adds an image of the screen to the recording.
+func (r *Recorder) Frame(img *image.RGBA) error {
+	defer func() { r.frames++ }()
+	if r.anim == nil {
+		filename := filepath.Join(r.name, fmt.Sprintf("%06d.png", r.frames))
+		return SavePNG(filename, img)
+	}
+	// GIF delays are in hundredths of a second. Spread the rounding
+	// error across frames so the animation runs at the frame rate.
+	perFrame := vblank.Seconds() * 100
+	delay := int(float64(r.frames+1)*perFrame+0.5) - int(float64(r.frames)*perFrame+0.5)
+	r.anim.Image = append(r.anim.Image, paletted(img))
+	r.anim.Delay = append(r.anim.Delay, delay)
+	return nil
+}
+
+// Write adds audio data to the recording. The data must be 16-bit
+// signed little endian stereo samples. If audio is not being recorded,
+// the data is discarded.
+func (r *Recorder) Write(data []byte) (int, error) {
+	if r.wav == nil {
+		return len(data), nil
+	}
+	return r.wav.Write(data)
+}
+
+// Frames is the number of frames that have been recorded.
+func (r *Recorder) Frames() int {
+	return r.frames
+}
+
+// Close finishes the recording and writes any data that is held in
+// memory.
+func (r *Recorder) Close() error {
+	var result error
+	if r.wav != nil {
+		result = r.wav.Close()
+	}
+	if r.anim != nil {
+		out, err := os.Create(r.name)
+		if err != nil {
+			return err
+		}
+		if err := gif.EncodeAll(out, r.anim); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+	return result
+}
+
+// paletted converts the image for use in a GIF. Screens rarely use more
+// than 256 colors so the exact colors are used when possible. Otherwise
+// the image is dithered to a standard palette.
+func paletted(img *image.RGBA) *image.Paletted {
+	var pal color.Palette
+	index := make(map[color.RGBA]uint8)
+	for i := 0; i < len(img.Pix); i += 4 {
+		c := color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}
+		if _, ok := index[c]; ok {
+			continue
+		}
+		if len(pal) == 256 {
+			pal = nil
+			break
+		}
+		index[c] = uint8(len(pal))
+		pal = append(pal, c)
+	}
+	if pal == nil {
+		p := image.NewPaletted(img.Rect, palette.Plan9)
+		draw.FloydSteinberg.Draw(p, img.Rect, img, img.Rect.Min)
+		return p
+	}
+	p := image.NewPaletted(img.Rect, pal)
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			p.SetColorIndex(x, y, index[img.RGBAAt(x, y)])
+		}
+	}
+	return p
+}
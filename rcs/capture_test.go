@@ -0,0 +1,191 @@
+package rcs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newCaptureMach() *Mach {
+	n := 0
+	return &Mach{
+		Screen: Screen{
+			W: 4,
+			H: 2,
+			Draw: func(img *image.RGBA) error {
+				// a different color for each frame
+				FillRect(img, img.Rect, color.RGBA{uint8(n), 0, 0, 0xff})
+				n++
+				return nil
+			},
+		},
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "rcs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestScreenshot(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	m := newCaptureMach()
+	filename := filepath.Join(dir, "screen.png")
+	if err := m.Screenshot(filename); err != nil {
+		t.Fatal(err)
+	}
+	in, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	img, err := png.Decode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 4, 2) {
+		t.Errorf("unexpected bounds: %v", img.Bounds())
+	}
+}
+
+func TestRecordPNG(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	m := newCaptureMach()
+	name := filepath.Join(dir, "rec")
+	if err := m.StartRecording(name); err != nil {
+		t.Fatal(err)
+	}
+	m.RunFrames(3)
+	if err := m.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"000000.png", "000001.png", "000002.png"} {
+		in, err := os.Open(filepath.Join(name, want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(in)
+		in.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, _, _, _ := img.At(0, 0).RGBA()
+		if have := int(r >> 8); have != i {
+			t.Errorf("frame %v: \n have: %v \n want: %v", i, have, i)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(name, "000003.png")); !os.IsNotExist(err) {
+		t.Errorf("expected only 3 frames")
+	}
+}
+
+func TestRecordGIF(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	m := newCaptureMach()
+	name := filepath.Join(dir, "rec.gif")
+	if err := m.StartRecording(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.StartRecording(name); err == nil {
+		t.Errorf("expected error when already recording")
+	}
+	m.RunFrames(6)
+	if err := m.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+	in, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	anim, err := gif.DecodeAll(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 6 {
+		t.Fatalf("\n have: %v frames \n want: 6", len(anim.Image))
+	}
+	// 6 frames at 60 Hz is 1/10th of a second
+	total := 0
+	for _, d := range anim.Delay {
+		total += d
+	}
+	if total != 10 {
+		t.Errorf("\n have: %v \n want: %v", total, 10)
+	}
+	have := anim.Image[5].At(3, 1).(color.RGBA)
+	want := color.RGBA{5, 0, 0, 0xff}
+	if have != want {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+}
+
+func TestPalettedDither(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i+0] = uint8(i / 4)
+		img.Pix[i+1] = uint8(i / 4 >> 8)
+		img.Pix[i+3] = 0xff
+	}
+	p := paletted(img)
+	if len(p.Palette) != 256 {
+		t.Errorf("expected standard palette")
+	}
+}
+
+func TestWAVWriter(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	out, err := os.Create(filepath.Join(dir, "audio.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wav, err := NewWAVWriter(out, 22050, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wav.Write([]byte{1, 2, 3, 4})
+	wav.Write([]byte{5, 6, 7, 8})
+	if err := wav.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	data, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 52 {
+		t.Fatalf("\n have: %v bytes \n want: 52", len(data))
+	}
+	if !bytes.Equal(data[0:4], []byte("RIFF")) || !bytes.Equal(data[8:12], []byte("WAVE")) {
+		t.Errorf("invalid header: %v", data[0:12])
+	}
+	riff := binary.LittleEndian.Uint32(data[4:])
+	if riff != 44 {
+		t.Errorf("riff size: \n have: %v \n want: %v", riff, 44)
+	}
+	rate := binary.LittleEndian.Uint32(data[24:])
+	if rate != 22050 {
+		t.Errorf("rate: \n have: %v \n want: %v", rate, 22050)
+	}
+	size := binary.LittleEndian.Uint32(data[40:])
+	if size != 8 {
+		t.Errorf("data size: \n have: %v \n want: %v", size, 8)
+	}
+	if !bytes.Equal(data[44:], []byte{1, 2, 3, 4, 5, 6, 7, 8}) {
+		t.Errorf("\n have: %v \n want: %v", data[44:], []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	}
+}
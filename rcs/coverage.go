@@ -0,0 +1,103 @@
+package rcs
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Coverage flags record how each address in memory has been accessed by
+// the instructions of a CPU.
+const (
+	CoverCode  = 1 << iota // Fetched as part of an instruction
+	CoverRead              // Read as data
+	CoverWrite             // Written
+)
+
+// coverage tracks the accesses made to a memory while an instruction is
+// executed.
+type coverage struct {
+	flags   []uint8                  // by address
+	active  bool                     // an instruction is being executed
+	fetched int                      // number of values in code
+	code    [maxInstructionLen]uint8 // values fetched by the instruction
+}
+
+// maxInstructionLen is the number of values fetched by an instruction
+// that are kept.
+const maxInstructionLen = 4
+
+func (c *coverage) fetch(addr int, v uint8) {
+	c.flags[addr] |= CoverCode
+	if c.fetched < len(c.code) {
+		c.code[c.fetched] = v
+		c.fetched++
+	}
+}
+
+// EnableCoverage starts tracking the accesses made by instructions. The
+// bank is not taken into account.
+func (m *Memory) EnableCoverage() {
+	if m.cover == nil {
+		m.cover = &coverage{flags: make([]uint8, m.MaxAddr+1)}
+	}
+}
+
+// Coverage returns the coverage flags for addr. Zero is returned if the
+// address has not been accessed or coverage is not enabled.
+func (m *Memory) Coverage(addr int) uint8 {
+	if m.cover == nil || addr < 0 || addr > m.MaxAddr {
+		return 0
+	}
+	return m.cover.flags[addr]
+}
+
+// ResetCoverage clears the coverage flags for all addresses.
+func (m *Memory) ResetCoverage() {
+	if m.cover == nil {
+		return
+	}
+	for i := range m.cover.flags {
+		m.cover.flags[i] = 0
+	}
+}
+
+// WriteCoverage writes the coverage flags to w with one byte for each
+// address.
+func (m *Memory) WriteCoverage(w io.Writer) error {
+	if m.cover == nil {
+		return fmt.Errorf("coverage not enabled")
+	}
+	_, err := w.Write(m.cover.flags)
+	return err
+}
+
+// ReadCoverage replaces the coverage flags with those read from r, as
+// written by WriteCoverage. Coverage is enabled if it was not already.
+func (m *Memory) ReadCoverage(r io.Reader) error {
+	flags, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(flags) != m.MaxAddr+1 {
+		return fmt.Errorf("coverage is for $%x addresses, expecting $%x",
+			len(flags), m.MaxAddr+1)
+	}
+	m.EnableCoverage()
+	copy(m.cover.flags, flags)
+	return nil
+}
+
+// beginInstruction starts tracking the accesses made by an instruction.
+func (m *Memory) beginInstruction() {
+	m.cover.active = true
+	m.cover.fetched = 0
+	m.cover.code = [maxInstructionLen]uint8{}
+}
+
+// endInstruction stops tracking accesses and returns the values fetched
+// by the instruction in the order they were fetched. The rest are zero.
+func (m *Memory) endInstruction() [maxInstructionLen]uint8 {
+	m.cover.active = false
+	return m.cover.code
+}
@@ -0,0 +1,167 @@
+package rcs
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// dataCPU executes two byte instructions from $00 to $3f. Each one reads
+// the value at $80 and writes it to $90.
+type dataCPU struct {
+	cycleCPU
+}
+
+func (c *dataCPU) Next() {
+	c.mem.Fetch(c.pc)
+	c.mem.Fetch(c.pc + 1)
+	c.mem.Write(0x90, c.mem.Read(0x80))
+	c.pc = (c.pc + 2) & 0x3f
+	c.cycles += c.per
+}
+
+func newCoverageMach() (*Mach, *Memory) {
+	mem := NewMemory(1, 0x100)
+	mem.MapRAM(0, make([]uint8, 0x100))
+	cpu := &dataCPU{}
+	cpu.mem = mem
+	cpu.per = 4
+	m := &Mach{Clock: 3072000}
+	m.Comps = []Component{
+		NewComponent("mem", "mem", "", mem),
+		NewComponent("cpu1", "cpu", "mem", cpu),
+	}
+	return m, mem
+}
+
+func TestCoverage(t *testing.T) {
+	m, mem := newCoverageMach()
+	if err := m.RunFrames(1); err != nil {
+		t.Fatal(err)
+	}
+	// not made by an instruction
+	mem.Read(0xa0)
+	mem.Write(0xb0, 1)
+	for addr := 0; addr <= mem.MaxAddr; addr++ {
+		var want uint8
+		switch {
+		case addr < 0x40:
+			want = CoverCode
+		case addr == 0x80:
+			want = CoverRead
+		case addr == 0x90:
+			want = CoverWrite
+		}
+		if have := mem.Coverage(addr); have != want {
+			t.Errorf("$%02x: \n have: %v \n want: %v", addr, have, want)
+		}
+	}
+}
+
+// shortCPU executes one byte instructions at the even addresses from $00
+// to $3f. Each one reads the byte after it as data.
+type shortCPU struct {
+	cycleCPU
+}
+
+func (c *shortCPU) Next() {
+	c.mem.Fetch(c.pc)
+	c.mem.Read(c.pc + 1)
+	c.pc = (c.pc + 2) & 0x3f
+	c.cycles += c.per
+}
+
+func TestCoverageShortInstruction(t *testing.T) {
+	mem := NewMemory(1, 0x100)
+	ram := make([]uint8, 0x100)
+	for i := range ram {
+		ram[i] = uint8(i)
+	}
+	mem.MapRAM(0, ram)
+	cpu := &shortCPU{}
+	cpu.mem = mem
+	cpu.per = 4
+	m := &Mach{Clock: 3072000}
+	m.Comps = []Component{
+		NewComponent("mem", "mem", "", mem),
+		NewComponent("cpu1", "cpu", "mem", cpu),
+	}
+	if err := m.RunFrames(1); err != nil {
+		t.Fatal(err)
+	}
+	for addr := 0; addr < 0x40; addr++ {
+		want := uint8(CoverCode)
+		if addr%2 == 1 {
+			want = CoverRead
+		}
+		if have := mem.Coverage(addr); have != want {
+			t.Errorf("$%02x: \n have: %v \n want: %v", addr, have, want)
+		}
+	}
+	list, err := m.History("cpu1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := list[len(list)-1]
+	if want := [4]uint8{uint8(e.PC)}; e.Code != want {
+		t.Errorf("\n have: % x \n want: % x", e.Code, want)
+	}
+}
+
+func TestCoverageSaveLoad(t *testing.T) {
+	m, mem := newCoverageMach()
+	if err := m.RunFrames(1); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := mem.WriteCoverage(&buf); err != nil {
+		t.Fatal(err)
+	}
+	mem.ResetCoverage()
+	if mem.Coverage(0x80) != 0 {
+		t.Fatalf("coverage not reset")
+	}
+	if err := mem.ReadCoverage(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if mem.Coverage(0x80) != CoverRead || mem.Coverage(0x00) != CoverCode {
+		t.Errorf("coverage not loaded")
+	}
+	err := mem.ReadCoverage(bytes.NewReader(make([]uint8, 0x10)))
+	want := "coverage is for $10 addresses, expecting $100"
+	if err == nil || err.Error() != want {
+		t.Errorf("\n have: %v \n want: %v", err, want)
+	}
+}
+
+func TestDisassembleData(t *testing.T) {
+	m, mem := newCoverageMach()
+	if err := m.RunFrames(1); err != nil {
+		t.Fatal(err)
+	}
+	mem.WriteN(0x7f, 0x01, 0x02, 0x03)
+	reader := func(e StmtEval) {
+		e.Stmt.Addr = e.Ptr.Addr()
+		op := e.Ptr.Fetch()
+		e.Stmt.Bytes = append(e.Stmt.Bytes, op)
+		e.Stmt.Op = fmt.Sprintf("op%02x", op)
+	}
+	format := func(s Stmt) string { return FormatStmt(s, FormatOptions{}) }
+	dasm := NewDisassembler(mem, reader, format)
+	dasm.SetPC(0x7f)
+	want := []string{
+		"$007f:  01  op01",
+		"$0080:  02  .byte $02",
+		"$0081:  03  op03",
+	}
+	for _, w := range want {
+		if have := dasm.Next(); have != w {
+			t.Errorf("\n have: %v \n want: %v", have, w)
+		}
+	}
+	// only written, such as code being loaded
+	dasm.SetPC(0x90)
+	if have, want := dasm.Next(), "$0090:  00  op00"; have != want {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+}
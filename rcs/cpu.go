@@ -19,12 +19,17 @@ type Proc interface {
 // before fetching the instruction opcode. In this case, one should be
 // returned. If the program counter is incremented after the fetch, zero
 // should be returned.
+//
+// Cycles is the total number of clock cycles consumed by the CPU since it
+// was created. The number of cycles used by a single instruction is the
+// difference in this value before and after a call to Next.
 type CPU interface {
 	Next()           // Execute the next instruction
 	PC() int         // Address of the program counter
 	SetPC(int)       // Set the address of the program counter
 	Offset() int     // The next instruction is at PC() + Offset()
 	Memory() *Memory // View of memory
+	Cycles() int     // Total number of clock cycles consumed
 }
 
 // CPUDisassembler provides a disassembler instance for CPUs that
@@ -33,6 +38,37 @@ type CPUDisassembler interface {
 	NewDisassembler() *Disassembler
 }
 
+// CPUAssembler provides an assembler instance for CPUs that support this
+// method.
+type CPUAssembler interface {
+	NewAssembler() *Assembler
+}
+
+// CPURegisters provides the registers and flags of CPUs that support this
+// method for use in expressions. Registers are named with an "r." prefix,
+// "r.a", and flags with an "f." prefix, "f.z". A flag is one when set and
+// zero when clear.
+type CPURegisters interface {
+	Registers() map[string]Load
+}
+
+// CPUStepper is implemented by CPUs that can step over and out of
+// subroutines. The stack is expected to grow downward.
+type CPUStepper interface {
+	StackPointer() int // Current value of the stack pointer
+	IsCall() bool      // Next instruction calls a subroutine
+	IsReturn() bool    // Next instruction returns from a subroutine or interrupt
+}
+
+// CPUHistory is implemented by CPUs that can save their registers in the
+// execution history. SnapshotRegisters is called before each instruction
+// and must not allocate. FormatSnapshot formats the registers saved in the
+// snapshot on a single line.
+type CPUHistory interface {
+	SnapshotRegisters(*RegisterSnapshot)
+	FormatSnapshot(*RegisterSnapshot) string
+}
+
 // Stmt represents a single statement in a disassembly.
 type Stmt struct {
 	Addr    int     // Address of the instruction
@@ -51,15 +87,28 @@ type CodeReader func(StmtEval)
 type CodeFormatter func(Stmt) string
 
 type Disassembler struct {
-	mem    *Memory
-	ptr    *Pointer
-	read   CodeReader
-	format CodeFormatter
+	Symbols Symbols // names used for labels and targets, may be nil
+	mem     *Memory
+	ptr     *Pointer
+	read    CodeReader
+	format  CodeFormatter
+	scratch []uint8 // memory used by Code
+	smem    *Memory
 }
 
 type StmtEval struct {
-	Ptr  *Pointer
-	Stmt *Stmt
+	Ptr     *Pointer
+	Stmt    *Stmt
+	Symbols Symbols
+}
+
+// Target formats addr as the target of a branch or a jump. The name of
+// the address is used if known, otherwise it is shown in hex.
+func (e StmtEval) Target(addr int) string {
+	if name, ok := e.Symbols[addr]; ok {
+		return name
+	}
+	return fmt.Sprintf("$%04x", addr)
 }
 
 func NewDisassembler(mem *Memory, r CodeReader, f CodeFormatter) *Disassembler {
@@ -71,21 +120,78 @@ func NewDisassembler(mem *Memory, r CodeReader, f CodeFormatter) *Disassembler {
 	}
 }
 
+// NextStmt reads the next statement. When the coverage of the memory
+// shows that the address has been read as data but never executed, the
+// byte is shown as data with ".byte". Writes are not considered as code
+// is often written before it runs, such as a program being loaded. The
+// label is set when the address has a name in Symbols.
 func (d *Disassembler) NextStmt() Stmt {
+	addr := d.ptr.Addr()
+	if isData(d.mem.Coverage(addr)) {
+		v := d.ptr.Fetch()
+		return Stmt{
+			Addr:  addr,
+			Label: d.Symbols[addr],
+			Op:    fmt.Sprintf(".byte $%02x", v),
+			Bytes: []uint8{v},
+		}
+	}
 	eval := StmtEval{
 		Ptr: d.ptr,
 		Stmt: &Stmt{
 			Bytes: make([]byte, 0, 0),
 		},
+		Symbols: d.Symbols,
 	}
 	d.read(eval)
+	eval.Stmt.Label = d.Symbols[addr]
 	return *eval.Stmt
 }
 
+func isData(cover uint8) bool {
+	return cover&CoverCode == 0 && cover&CoverRead != 0
+}
+
+// Next returns the next statement formatted on a single line.
 func (d *Disassembler) Next() string {
 	return d.format(d.NextStmt())
 }
 
+// NextListing returns the next statement formatted as in a listing. When
+// the statement has a label, it is on a line of its own before the
+// statement.
+func (d *Disassembler) NextListing() string {
+	s := d.NextStmt()
+	if s.Label != "" {
+		return s.Label + ":\n" + d.format(s)
+	}
+	return d.format(s)
+}
+
+// Code disassembles the instruction in code as if it were at addr. This
+// is used for instructions that may no longer be in memory.
+func (d *Disassembler) Code(addr int, code []uint8) string {
+	if d.smem == nil {
+		d.scratch = make([]uint8, 0x10000)
+		d.smem = NewMemory(1, len(d.scratch))
+		d.smem.MapRAM(0, d.scratch)
+	}
+	for i, b := range code {
+		d.scratch[(addr+i)&0xffff] = b
+	}
+	ptr := NewPointer(d.smem)
+	ptr.SetAddr(addr)
+	eval := StmtEval{
+		Ptr: ptr,
+		Stmt: &Stmt{
+			Bytes: make([]byte, 0, 0),
+		},
+		Symbols: d.Symbols,
+	}
+	d.read(eval)
+	return d.format(*eval.Stmt)
+}
+
 func (d *Disassembler) SetPC(addr int) {
 	d.ptr.SetAddr(addr)
 }
@@ -0,0 +1,421 @@
+package rcs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr is an expression that is evaluated using the registers, flags, and
+// memory of a CPU. It is used as the condition of a breakpoint.
+//
+// All values are integers. Comparisons and logical operators result in
+// one when true and zero when false and any value other than zero is
+// true. The binary operators have the same precedence as in Go. From
+// highest to lowest, they are "* / << >> &", "+ - | ^", the comparisons
+// "== != < <= > >=", "&&", and "||". The unary operators are "-", "!",
+// and "^" for the complement. Division by zero results in zero.
+//
+// Numbers are written as in the monitor: 42, $2a, 0x2a, %101010, or
+// 0b101010. Registers and flags are referenced by the names provided by
+// CPURegisters, such as "r.a" or "f.z". Names are not case sensitive and
+// the "r." prefix may be omitted. The program counter is always available
+// as "pc". The value in memory at an address is read with peek(addr),
+// which does not trigger watches.
+type Expr struct {
+	src  string
+	eval Load
+}
+
+// CompileExpr parses the expression in src for evaluation with cpu.
+func CompileExpr(src string, cpu CPU) (*Expr, error) {
+	toks, err := scanExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{
+		toks: toks,
+		regs: map[string]Load{"r.pc": cpu.PC},
+		mem:  cpu.Memory(),
+	}
+	if r, ok := cpu.(CPURegisters); ok {
+		for name, load := range r.Registers() {
+			p.regs[strings.ToLower(name)] = load
+		}
+	}
+	eval, err := p.parse(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %v", t)
+	}
+	return &Expr{src: strings.TrimSpace(src), eval: eval}, nil
+}
+
+// evalAsm evaluates an expression in the source given to an Assembler.
+// Names are labels which are resolved with lookup. A "*" in place of a
+// value is the address of the current line and is resolved with the name
+// "*". The unary operators "<" and ">" return the low and high byte of a
+// value.
+func evalAsm(src string, lookup func(string) (int, error)) (int, error) {
+	toks, err := scanExpr(src)
+	if err != nil {
+		return 0, err
+	}
+	p := &exprParser{
+		toks:   toks,
+		lookup: lookup,
+	}
+	eval, err := p.parse(0)
+	if err != nil {
+		return 0, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return 0, fmt.Errorf("unexpected %v", t)
+	}
+	return eval(), nil
+}
+
+// Eval returns the current value of the expression.
+func (e *Expr) Eval() int {
+	return e.eval()
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+const (
+	tokEOF = iota
+	tokNum
+	tokName
+	tokOp
+)
+
+type exprToken struct {
+	kind int
+	text string
+	val  int
+}
+
+func (t exprToken) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// exprOps is in order so that the longest operator is matched first.
+var exprOps = []string{
+	"&&", "||", "==", "!=", "<=", ">=", "<<", ">>",
+	"<", ">", "+", "-", "*", "/", "&", "|", "^", "!", "(", ")",
+}
+
+func scanExpr(src string) ([]exprToken, error) {
+	var toks []exprToken
+	i := 0
+	for i < len(src) {
+		ch := src[i]
+		switch {
+		case ch == ' ' || ch == '\t':
+			i++
+		case isDigit(ch) || ch == '$' || (ch == '%' && i+1 < len(src) && isBit(src[i+1])):
+			j := i + 1
+			for j < len(src) && (isNameChar(src[j]) || src[j] == ':' || src[j] == '.') {
+				j++
+			}
+			v, err := parseNumber(src[i:j])
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, exprToken{kind: tokNum, text: src[i:j], val: v})
+			i = j
+		case isNameChar(ch):
+			j := i + 1
+			for j < len(src) && (isNameChar(src[j]) || src[j] == '.') {
+				j++
+			}
+			toks = append(toks, exprToken{kind: tokName, text: src[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, o := range exprOps {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q", ch)
+			}
+			toks = append(toks, exprToken{kind: tokOp, text: op})
+			i += len(op)
+		}
+	}
+	return append(toks, exprToken{kind: tokEOF}), nil
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isBit(ch byte) bool {
+	return ch == '0' || ch == '1'
+}
+
+func isNameChar(ch byte) bool {
+	return isDigit(ch) || ch == '_' ||
+		(ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func parseNumber(str string) (int, error) {
+	s := str
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "$"):
+		s, base = s[1:], 16
+	case strings.HasPrefix(s, "0x"):
+		s, base = s[2:], 16
+	case strings.HasPrefix(s, "%"):
+		s, base = s[1:], 2
+	case strings.HasPrefix(s, "0b"):
+		s, base = s[2:], 2
+	}
+	if base == 2 {
+		s = strings.Replace(s, ":", "", -1)
+		s = strings.Replace(s, ".", "", -1)
+	}
+	v, err := strconv.ParseInt(s, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number: %v", str)
+	}
+	return int(v), nil
+}
+
+// exprLevels are the binary operators from lowest to highest precedence.
+var exprLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-", "|", "^"},
+	{"*", "/", "<<", ">>", "&"},
+}
+
+type exprParser struct {
+	toks   []exprToken
+	pos    int
+	regs   map[string]Load
+	mem    *Memory
+	lookup func(string) (int, error) // resolves labels, if set
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.toks[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(op string) error {
+	if !p.accept(op) {
+		return fmt.Errorf("expected %q but found %v", op, p.peek())
+	}
+	return nil
+}
+
+// parse parses the binary operators at the given level of precedence
+// and above.
+func (p *exprParser) parse(level int) (Load, error) {
+	if level == len(exprLevels) {
+		return p.parseUnary()
+	}
+	left, err := p.parse(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || !hasOp(exprLevels[level], t.text) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parse(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryOp(t.text, left, right)
+	}
+}
+
+func (p *exprParser) parseUnary() (Load, error) {
+	ops := []string{"-", "!", "^"}
+	if p.lookup != nil {
+		ops = append(ops, "<", ">")
+	}
+	for _, op := range ops {
+		if p.accept(op) {
+			x, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return unaryOp(op, x), nil
+		}
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (Load, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokNum:
+		v := t.val
+		return func() int { return v }, nil
+	case t.kind == tokName && p.lookup != nil:
+		return p.parseLabel(t.text)
+	case t.kind == tokOp && t.text == "*" && p.lookup != nil:
+		return p.parseLabel(t.text)
+	case t.kind == tokName:
+		if p.accept("(") {
+			return p.parseCall(t.text)
+		}
+		name := strings.ToLower(t.text)
+		if name == "pc" {
+			name = "r.pc"
+		}
+		if load, ok := p.regs[name]; ok {
+			return load, nil
+		}
+		if load, ok := p.regs["r."+name]; ok {
+			return load, nil
+		}
+		return nil, fmt.Errorf("no such register: %v", t.text)
+	case t.kind == tokOp && t.text == "(":
+		x, err := p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return x, nil
+	}
+	return nil, fmt.Errorf("unexpected %v", t)
+}
+
+func (p *exprParser) parseLabel(name string) (Load, error) {
+	v, err := p.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return func() int { return v }, nil
+}
+
+func (p *exprParser) parseCall(name string) (Load, error) {
+	if strings.ToLower(name) != "peek" {
+		return nil, fmt.Errorf("no such function: %v", name)
+	}
+	addr, err := p.parse(0)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	mem := p.mem
+	return func() int {
+		a := addr()
+		if a < 0 || a > mem.MaxAddr {
+			return 0
+		}
+		return int(mem.Peek(a))
+	}, nil
+}
+
+func hasOp(ops []string, op string) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func truth(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func unaryOp(op string, x Load) Load {
+	switch op {
+	case "-":
+		return func() int { return -x() }
+	case "!":
+		return func() int { return truth(x() == 0) }
+	case "<":
+		return func() int { return x() & 0xff }
+	case ">":
+		return func() int { return x() >> 8 & 0xff }
+	}
+	return func() int { return ^x() }
+}
+
+func binaryOp(op string, l, r Load) Load {
+	switch op {
+	case "||":
+		return func() int { return truth(l() != 0 || r() != 0) }
+	case "&&":
+		return func() int { return truth(l() != 0 && r() != 0) }
+	case "==":
+		return func() int { return truth(l() == r()) }
+	case "!=":
+		return func() int { return truth(l() != r()) }
+	case "<":
+		return func() int { return truth(l() < r()) }
+	case "<=":
+		return func() int { return truth(l() <= r()) }
+	case ">":
+		return func() int { return truth(l() > r()) }
+	case ">=":
+		return func() int { return truth(l() >= r()) }
+	case "+":
+		return func() int { return l() + r() }
+	case "-":
+		return func() int { return l() - r() }
+	case "|":
+		return func() int { return l() | r() }
+	case "^":
+		return func() int { return l() ^ r() }
+	case "*":
+		return func() int { return l() * r() }
+	case "/":
+		return func() int {
+			d := r()
+			if d == 0 {
+				return 0
+			}
+			return l() / d
+		}
+	case "<<":
+		return func() int { return l() << uint(r()) }
+	case ">>":
+		return func() int { return l() >> uint(r()) }
+	}
+	return func() int { return l() & r() }
+}
@@ -0,0 +1,119 @@
+package rcs
+
+import (
+	"testing"
+)
+
+// regCPU is a cycleCPU with a register and a flag that can be used in
+// expressions.
+type regCPU struct {
+	cycleCPU
+	a    uint8
+	flag bool
+}
+
+func (c *regCPU) Registers() map[string]Load {
+	return map[string]Load{
+		"r.a": func() int { return int(c.a) },
+		"f.z": func() int {
+			if c.flag {
+				return 1
+			}
+			return 0
+		},
+	}
+}
+
+func newRegCPU() *regCPU {
+	mem := NewMemory(1, 0x10000)
+	mem.MapRAM(0, make([]uint8, 0x10000))
+	c := &regCPU{a: 0x41, flag: true}
+	c.mem = mem
+	c.pc = 0x1234
+	mem.Write(0xd012, 0x90)
+	return c
+}
+
+func TestExpr(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int
+	}{
+		{"42", 42},
+		{"$2a + 0x2a + %10.1010 + 0b101010", 168},
+		{"A", 0x41},
+		{"r.a == $41", 1},
+		{"a != $41", 0},
+		{"f.z", 1},
+		{"!F.Z", 0},
+		{"pc", 0x1234},
+		{"peek($d012)", 0x90},
+		{"peek($d000 + $12) > $80", 1},
+		{"peek(-1) + peek($10000)", 0},
+		{"A == $41 && peek($d012) > $80", 1},
+		{"A == $42 || f.z && 0", 0},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"1 << 4 | 1", 17},
+		{"$f0 & $3c ^ $ff", 0xcf},
+		{"-1 < 0", 1},
+		{"^0", -1},
+		{"10 / 3", 3},
+		{"1 / 0", 0},
+		{"3 >= 3 == 1", 1},
+	}
+	cpu := newRegCPU()
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			e, err := CompileExpr(test.src, cpu)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := e.Eval(); have != test.want {
+				t.Errorf("\n have: %v \n want: %v", have, test.want)
+			}
+		})
+	}
+}
+
+func TestExprPeekWatch(t *testing.T) {
+	cpu := newRegCPU()
+	events := 0
+	cpu.mem.Callback = func(MemoryEvent) { events++ }
+	cpu.mem.WatchRO(0xd012)
+	e, err := CompileExpr("peek($d012)", cpu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := e.Eval(), 0x90; have != want {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+	if events != 0 {
+		t.Errorf("watch triggered %v times", events)
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"", "unexpected end of expression"},
+		{"x == 1", "no such register: x"},
+		{"poke(1)", "no such function: poke"},
+		{"(1 + 2", `expected ")" but found end of expression`},
+		{"1 2", `unexpected "2"`},
+		{"$zz", "invalid number: $zz"},
+		{"a = 1", "unexpected '='"},
+		{"1 +", "unexpected end of expression"},
+	}
+	cpu := newRegCPU()
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			_, err := CompileExpr(test.src, cpu)
+			if err == nil || err.Error() != test.want {
+				t.Errorf("\n have: %v \n want: %v", err, test.want)
+			}
+		})
+	}
+}
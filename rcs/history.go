@@ -0,0 +1,109 @@
+package rcs
+
+import (
+	"fmt"
+)
+
+// DefaultHistorySize is the number of instructions kept in the history of
+// each CPU when Mach.HistorySize is zero.
+const DefaultHistorySize = 256
+
+// RegisterSnapshot is a copy of the registers of a CPU that implements
+// CPUHistory. The layout is up to the CPU.
+type RegisterSnapshot [16]uint8
+
+// HistoryEntry is an instruction in the execution history of a CPU.
+type HistoryEntry struct {
+	PC   int              // Address of the instruction
+	Code [4]uint8         // Bytes fetched by the instruction, zero if not
+	Regs RegisterSnapshot // Registers before the instruction was executed
+}
+
+// history is a ring buffer of the instructions most recently executed by
+// a CPU.
+type history struct {
+	cpu     CPU
+	regs    CPUHistory // nil if registers are not saved
+	entries []HistoryEntry
+	next    int  // index of the entry to use next
+	full    bool // all entries are in use
+	stuck   bool // last instruction did not advance the program counter
+}
+
+func newHistory(cpu CPU, size int) *history {
+	h := &history{
+		cpu:     cpu,
+		entries: make([]HistoryEntry, size),
+	}
+	h.regs, _ = cpu.(CPUHistory)
+	return h
+}
+
+func (h *history) add() *HistoryEntry {
+	e := &h.entries[h.next]
+	h.next++
+	if h.next == len(h.entries) {
+		h.next = 0
+		h.full = true
+	}
+	return e
+}
+
+func (h *history) list() []HistoryEntry {
+	if !h.full {
+		return append([]HistoryEntry(nil), h.entries[:h.next]...)
+	}
+	list := make([]HistoryEntry, 0, len(h.entries))
+	list = append(list, h.entries[h.next:]...)
+	return append(list, h.entries[:h.next]...)
+}
+
+// record adds the instruction that the CPU with the given name is about
+// to execute to its history and returns the entry so that the code can be
+// filled in with the bytes the instruction fetches. Memory is not read
+// here as that has side effects on devices. When the CPU is stuck at the
+// same address, such as at a halt instruction, only the first is kept and
+// nil is returned.
+func (m *Mach) record(name string, pc int) *HistoryEntry {
+	h := m.history[name]
+	if h.stuck && h.entries[(h.next+len(h.entries)-1)%len(h.entries)].PC == pc {
+		return nil
+	}
+	e := h.add()
+	e.PC = pc
+	e.Code = [4]uint8{}
+	if h.regs != nil {
+		h.regs.SnapshotRegisters(&e.Regs)
+	}
+	return e
+}
+
+// History returns the instructions most recently executed by the CPU with
+// the given name, oldest first. Must be called from the machine goroutine
+// or while the machine is not running.
+func (m *Mach) History(cpu string) ([]HistoryEntry, error) {
+	if err := m.Init(); err != nil {
+		return nil, err
+	}
+	h, ok := m.history[cpu]
+	if !ok {
+		return nil, fmt.Errorf("no such CPU: %v", cpu)
+	}
+	return h.list(), nil
+}
+
+// FormatHistory formats an entry from the history of cpu on a single line.
+// The instruction is disassembled with dasm if it is not nil. The
+// registers are included if the CPU implements CPUHistory.
+func FormatHistory(e HistoryEntry, cpu CPU, dasm *Disassembler) string {
+	var line string
+	if dasm != nil {
+		line = dasm.Code(e.PC, e.Code[:])
+	} else {
+		line = fmt.Sprintf("$%04x:  % x", e.PC, e.Code)
+	}
+	if h, ok := cpu.(CPUHistory); ok {
+		line = fmt.Sprintf("%-36s  %v", line, h.FormatSnapshot(&e.Regs))
+	}
+	return line
+}
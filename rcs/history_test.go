@@ -0,0 +1,128 @@
+package rcs
+
+import (
+	"testing"
+)
+
+// haltCPU is a cycleCPU that never advances the program counter.
+type haltCPU struct {
+	cycleCPU
+}
+
+func (c *haltCPU) Next() { c.cycles += c.per }
+
+func TestHistory(t *testing.T) {
+	m, mem := newCoverageMach()
+	for addr := 0; addr <= mem.MaxAddr; addr++ {
+		mem.Write(addr, uint8(addr))
+	}
+	m.HistorySize = 4
+	if err := m.RunFrames(1); err != nil {
+		t.Fatal(err)
+	}
+	list, err := m.History("cpu1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 4 {
+		t.Fatalf("\n have: %v \n want: 4", len(list))
+	}
+	pc := m.CPU["cpu1"].PC()
+	for i, e := range list {
+		// only the bytes fetched, not the data read at $80
+		addr := (pc - 8 + i*2) & 0x3f
+		want := [4]uint8{uint8(addr), uint8(addr + 1), 0, 0}
+		if e.PC != addr || e.Code != want {
+			t.Errorf("\n have: $%x % x \n want: $%x % x", e.PC, e.Code, addr, want)
+		}
+	}
+}
+
+func TestHistoryStuck(t *testing.T) {
+	mem := NewMemory(1, 0x100)
+	mem.MapRAM(0, make([]uint8, 0x100))
+	cpu := &haltCPU{}
+	cpu.mem = mem
+	cpu.per = 4
+	cpu.pc = 0x10
+	m := &Mach{Clock: 3072000}
+	m.Comps = []Component{NewComponent("cpu1", "cpu", "", cpu)}
+	if err := m.RunFrames(1); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := m.History("cpu1")
+	if len(list) != 1 || list[0].PC != 0x10 {
+		t.Errorf("\n have: %+v \n want: one entry at $10", list)
+	}
+}
+
+func TestHistoryNotWatched(t *testing.T) {
+	m, cpu, hits := newWatchMach()
+	if err := m.SetWatchpoint("mem", 0x05, &Watchpoint{Read: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RunFrames(1); err != nil {
+		t.Fatal(err)
+	}
+	if len(*hits) != 0 {
+		t.Errorf("unexpected hits: %+v", *hits)
+	}
+	list, _ := m.History("cpu1")
+	last := list[len(list)-1]
+	if last.PC != cpu.pc-1 {
+		t.Errorf("\n have: $%x \n want: $%x", last.PC, cpu.pc-1)
+	}
+}
+
+// opcodeCPU fetches the opcode at the program counter and never advances.
+type opcodeCPU struct {
+	cycleCPU
+}
+
+func (c *opcodeCPU) Next() {
+	c.mem.Fetch(c.pc)
+	c.cycles += c.per
+}
+
+func TestHistoryNoLoad(t *testing.T) {
+	mem := NewMemory(1, 0x100)
+	mem.MapRAM(0, make([]uint8, 0x100))
+	mem.Write(0x0f, 0xea)
+	loads := 0
+	for addr := 0x10; addr < 0x20; addr++ {
+		mem.MapLoad(addr, func() uint8 { loads++; return 0xff })
+	}
+	cpu := &opcodeCPU{}
+	cpu.mem = mem
+	cpu.per = 4
+	cpu.pc = 0x0f
+	m := &Mach{Clock: 3072000}
+	m.Comps = []Component{NewComponent("cpu1", "cpu", "mem", cpu)}
+	if err := m.RunFrames(1); err != nil {
+		t.Fatal(err)
+	}
+	if loads != 0 {
+		t.Errorf("\n have: %v loads \n want: 0", loads)
+	}
+	list, _ := m.History("cpu1")
+	if want := [4]uint8{0xea}; len(list) != 1 || list[0].Code != want {
+		t.Errorf("\n have: %+v \n want: one entry with % x", list, want)
+	}
+}
+
+func TestFormatHistory(t *testing.T) {
+	e := HistoryEntry{PC: 0x1234, Code: [4]uint8{0xea, 0x01, 0x02, 0x03}}
+	have := FormatHistory(e, &cycleCPU{}, nil)
+	want := "$1234:  ea 01 02 03"
+	if have != want {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+}
+
+func TestHistoryNoCPU(t *testing.T) {
+	m := newCycleMach(3072000)
+	want := "no such CPU: foo"
+	if _, err := m.History("foo"); err == nil || err.Error() != want {
+		t.Errorf("\n have: %v \n want: %v", err, want)
+	}
+}
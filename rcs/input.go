@@ -0,0 +1,184 @@
+package rcs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Control is an input on an emulated system. Arcade machines have
+// joystick directions, buttons, coin slots and start buttons. Computers
+// have a keyboard where each key in the matrix is a control named after
+// the key. Systems may also define their own controls.
+type Control string
+
+// Arcade controls
+const (
+	Up      Control = "up"
+	Down    Control = "down"
+	Left    Control = "left"
+	Right   Control = "right"
+	Button1 Control = "button1"
+	Button2 Control = "button2"
+	Coin1   Control = "coin1"
+	Coin2   Control = "coin2"
+	Start1  Control = "start1"
+	Start2  Control = "start2"
+)
+
+// InputEvent is sent to a system when a control is pressed or released.
+type InputEvent struct {
+	Control Control
+	Pressed bool
+}
+
+func (e InputEvent) String() string {
+	if e.Pressed {
+		return fmt.Sprintf("%v pressed", e.Control)
+	}
+	return fmt.Sprintf("%v released", e.Control)
+}
+
+// Bindings maps the name of a key on the host to the controls that are
+// operated by that key. Key names are those used by SDL, for example,
+// "A", "Return", "Left Shift", or "Keypad 8".
+type Bindings map[string][]Control
+
+// Load reads bindings and adds them, replacing the existing binding for
+// any key that is listed. Each line has the name of the key, an equals
+// sign, and the controls separated by whitespace:
+//
+//	Up = lshift crsr-down
+//
+// A key without any controls is unbound. Blank lines and lines starting
+// with # are ignored.
+func (b Bindings) Load(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	lineNo := 0
+	for s.Scan() {
+		lineNo++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return fmt.Errorf("line %v: expecting '='", lineNo)
+		}
+		key := strings.TrimSpace(line[:i])
+		if key == "" {
+			return fmt.Errorf("line %v: no key name", lineNo)
+		}
+		var controls []Control
+		for _, name := range strings.Fields(line[i+1:]) {
+			controls = append(controls, Control(name))
+		}
+		if len(controls) == 0 {
+			delete(b, key)
+		} else {
+			b[key] = controls
+		}
+	}
+	return s.Err()
+}
+
+// LoadFile reads bindings from filename. See Load for the format.
+func (b Bindings) LoadFile(filename string) error {
+	in, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := b.Load(in); err != nil {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+	return nil
+}
+
+// Controls returns the names of all controls that are bound to a key in
+// sorted order.
+func (b Bindings) Controls() []string {
+	seen := make(map[Control]bool)
+	var names []string
+	for _, controls := range b {
+		for _, c := range controls {
+			if !seen[c] {
+				seen[c] = true
+				names = append(names, string(c))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// KeyMatrix tracks which keys are pressed on a keyboard that is wired as
+// a grid of rows and columns.
+type KeyMatrix struct {
+	keys    map[Control][2]int
+	pressed [][]bool
+}
+
+// NewKeyMatrix creates a matrix with the given layout which is indexed by
+// row and then by column.
+func NewKeyMatrix(layout [][]Control) *KeyMatrix {
+	k := &KeyMatrix{
+		keys:    make(map[Control][2]int),
+		pressed: make([][]bool, len(layout)),
+	}
+	for row, keys := range layout {
+		k.pressed[row] = make([]bool, len(keys))
+		for col, key := range keys {
+			k.keys[key] = [2]int{row, col}
+		}
+	}
+	return k
+}
+
+// Set changes the state of the key for the control. If the control is not
+// a key in the matrix, false is returned.
+func (k *KeyMatrix) Set(c Control, pressed bool) bool {
+	pos, ok := k.keys[c]
+	if !ok {
+		return false
+	}
+	k.pressed[pos[0]][pos[1]] = pressed
+	return true
+}
+
+// Pressed returns true if the key at row and col is pressed.
+func (k *KeyMatrix) Pressed(row int, col int) bool {
+	return k.pressed[row][col]
+}
+
+// Save encodes the keys that are pressed.
+func (k *KeyMatrix) Save(enc *Encoder) {
+	enc.Encode(k.pressed)
+}
+
+// Load decodes the keys that are pressed. An error is set if the matrix
+// that was saved has a different layout.
+func (k *KeyMatrix) Load(dec *Decoder) {
+	var pressed [][]bool
+	dec.Decode(&pressed)
+	if dec.Err != nil {
+		return
+	}
+	if len(pressed) != len(k.pressed) {
+		dec.Err = fmt.Errorf("expected %v rows but got %v", len(k.pressed), len(pressed))
+		return
+	}
+	for row := range pressed {
+		if len(pressed[row]) != len(k.pressed[row]) {
+			dec.Err = fmt.Errorf("expected %v columns in row %v but got %v",
+				len(k.pressed[row]), row, len(pressed[row]))
+			return
+		}
+	}
+	for row := range pressed {
+		copy(k.pressed[row], pressed[row])
+	}
+}
@@ -0,0 +1,94 @@
+package rcs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBindingsLoad(t *testing.T) {
+	b := Bindings{
+		"A":     {"a"},
+		"Space": {"space"},
+	}
+	src := `
+# comment
+Up = lshift crsr-down
+Left Shift = lshift
+Space =
+`
+	if err := b.Load(strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	want := Bindings{
+		"A":          {"a"},
+		"Up":         {"lshift", "crsr-down"},
+		"Left Shift": {"lshift"},
+	}
+	if !reflect.DeepEqual(b, want) {
+		t.Errorf("\n have: %v \n want: %v", b, want)
+	}
+}
+
+func TestBindingsLoadError(t *testing.T) {
+	tests := []string{
+		"Up up",
+		" = up",
+	}
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			err := Bindings{}.Load(strings.NewReader(test))
+			if err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
+
+func TestBindingsControls(t *testing.T) {
+	b := Bindings{
+		"Up":   {"lshift", "crsr-down"},
+		"Down": {"crsr-down"},
+	}
+	have := b.Controls()
+	want := []string{"crsr-down", "lshift"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+}
+
+func TestKeyMatrix(t *testing.T) {
+	k := NewKeyMatrix([][]Control{
+		{"a", "b"},
+		{"c", "d"},
+	})
+	if !k.Set("c", true) {
+		t.Fatalf("expected key")
+	}
+	if k.Set("e", true) {
+		t.Errorf("unexpected key")
+	}
+	if !k.Pressed(1, 0) || k.Pressed(0, 0) {
+		t.Errorf("unexpected state")
+	}
+	k.Set("c", false)
+	if k.Pressed(1, 0) {
+		t.Errorf("key not released")
+	}
+}
+
+func TestMachInput(t *testing.T) {
+	var have []InputEvent
+	m := &Mach{
+		Input: func(e InputEvent) error {
+			have = append(have, e)
+			return nil
+		},
+	}
+	m.Init()
+	m.handleCommand(message{Cmd: MachInput, Args: []interface{}{InputEvent{Coin1, true}}})
+	want := []InputEvent{{Coin1, true}}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+}
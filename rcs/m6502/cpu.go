@@ -29,6 +29,7 @@ type CPU struct {
 	ops         map[uint8]func(*CPU) // opcode table
 	addrLoad    int                  // memory address where the last value was loaded from
 	pageCross   bool                 // if set, add a one cycle penalty for crossing a page boundary
+	cycles      int                  // total number of cycles consumed
 	stopOnBreak bool
 }
 
@@ -72,14 +73,20 @@ func (c *CPU) Next() {
 	execute, ok := c.ops[opcode]
 	if !ok {
 		log.Printf("%04x: illegal instruction: 0x%02x", here, opcode)
+		c.cycles += cyclesIllegal
 		return
 	}
 	execute(c)
+	c.cycles += cycles[opcode]
+	if c.pageCross && pageCrossPenalty[opcode] {
+		c.cycles++
+	}
 
 	if c.IRQ {
 		c.IRQ = false
 		if c.SR&FlagI == 0 {
 			c.irqAck()
+			c.cycles += cyclesIRQ
 		}
 	}
 	if c.SR&FlagB != 0 {
@@ -124,6 +131,70 @@ func (c *CPU) Memory() *rcs.Memory {
 	return c.mem
 }
 
+// Cycles is the total number of clock cycles consumed since the CPU was
+// created.
+func (c *CPU) Cycles() int {
+	return c.cycles
+}
+
+// Registers returns the registers and flags by the names used in the
+// monitor, "r.a" or "f.c".
+func (c *CPU) Registers() map[string]rcs.Load {
+	reg := func(r *uint8) rcs.Load {
+		return func() int { return int(*r) }
+	}
+	flag := func(mask uint8) rcs.Load {
+		return func() int {
+			if c.SR&mask != 0 {
+				return 1
+			}
+			return 0
+		}
+	}
+	return map[string]rcs.Load{
+		"r.pc": c.PC,
+		"r.a":  reg(&c.A),
+		"r.x":  reg(&c.X),
+		"r.y":  reg(&c.Y),
+		"r.sp": reg(&c.SP),
+		"r.sr": reg(&c.SR),
+		"f.c":  flag(FlagC),
+		"f.z":  flag(FlagZ),
+		"f.i":  flag(FlagI),
+		"f.d":  flag(FlagD),
+		"f.b":  flag(FlagB),
+		"f.v":  flag(FlagV),
+		"f.n":  flag(FlagN),
+	}
+}
+
+// StackPointer returns the value of the stack pointer.
+func (c *CPU) StackPointer() int {
+	return int(c.SP)
+}
+
+// IsCall returns true if the next instruction is a JSR.
+func (c *CPU) IsCall() bool {
+	return c.mem.Peek(c.PC()+1) == 0x20
+}
+
+// IsReturn returns true if the next instruction is an RTS or RTI.
+func (c *CPU) IsReturn() bool {
+	op := c.mem.Peek(c.PC() + 1)
+	return op == 0x60 || op == 0x40
+}
+
+// SnapshotRegisters saves the registers for the execution history.
+func (c *CPU) SnapshotRegisters(r *rcs.RegisterSnapshot) {
+	r[0], r[1], r[2], r[3], r[4] = c.A, c.X, c.Y, c.SP, c.SR
+}
+
+// FormatSnapshot formats registers saved with SnapshotRegisters.
+func (c *CPU) FormatSnapshot(r *rcs.RegisterSnapshot) string {
+	return fmt.Sprintf("a:%02x x:%02x y:%02x sp:%02x sr:%02x",
+		r[0], r[1], r[2], r[3], r[4]|(1<<5))
+}
+
 // NewDisassembler creates a disassembler that can handle 6502 machine
 // code.
 func (c *CPU) NewDisassembler() *rcs.Disassembler {
@@ -131,6 +202,11 @@ func (c *CPU) NewDisassembler() *rcs.Disassembler {
 	return dasm
 }
 
+// NewAssembler creates an assembler that can produce 6502 machine code.
+func (c *CPU) NewAssembler() *rcs.Assembler {
+	return rcs.NewAssembler(Writer)
+}
+
 // String returns the status of the CPU in the form of:
 // 		 pc  sr ac xr yr sp  n v - b d i z c
 // 		1234 20 00 00 00 ff  . . * . . . . .
@@ -165,7 +241,7 @@ func (c *CPU) String() string {
 // program counter.
 func (c *CPU) fetch() uint8 {
 	c.pc++
-	return c.mem.Read(int(c.pc))
+	return c.mem.Fetch(int(c.pc))
 }
 
 // Like fetch, but return the next 16-bit value.
@@ -203,6 +279,8 @@ func (c *CPU) Save(enc *rcs.Encoder) {
 	enc.Encode(c.Y)
 	enc.Encode(c.SP)
 	enc.Encode(c.SR)
+	enc.Encode(c.IRQ)
+	enc.Encode(c.cycles)
 }
 
 func (c *CPU) Load(dec *rcs.Decoder) {
@@ -212,4 +290,6 @@ func (c *CPU) Load(dec *rcs.Decoder) {
 	dec.Decode(&c.Y)
 	dec.Decode(&c.SP)
 	dec.Decode(&c.SR)
+	dec.Decode(&c.IRQ)
+	dec.Decode(&c.cycles)
 }
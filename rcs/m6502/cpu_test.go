@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/blackchip-org/retro-cs/mock"
+	"github.com/blackchip-org/retro-cs/rcs"
 )
 
 func newTestCPU() *CPU {
@@ -92,3 +93,135 @@ func TestCPUString(t *testing.T) {
 		}
 	}
 }
+
+func TestCyclesTable(t *testing.T) {
+	for op := range opcodes {
+		if _, ok := cycles[op]; !ok {
+			t.Errorf("no cycle count for opcode $%02x", op)
+		}
+	}
+	for op := range cycles {
+		if _, ok := opcodes[op]; !ok {
+			t.Errorf("cycle count for unknown opcode $%02x", op)
+		}
+	}
+}
+
+func TestCycles(t *testing.T) {
+	var tests = []struct {
+		name  string
+		setup func(*CPU)
+		want  int
+	}{
+		{"nop", func(c *CPU) {
+			c.mem.WriteN(0x0200, 0xea)
+		}, 2},
+		{"lda absolute", func(c *CPU) {
+			c.mem.WriteN(0x0200, 0xad, 0x34, 0x12)
+		}, 4},
+		{"lda absolute,x", func(c *CPU) {
+			c.mem.WriteN(0x0200, 0xbd, 0x00, 0x12)
+			c.X = 0xff
+		}, 4},
+		{"lda absolute,x page cross", func(c *CPU) {
+			c.mem.WriteN(0x0200, 0xbd, 0x01, 0x12)
+			c.X = 0xff
+		}, 5},
+		{"ldx absolute,y page cross", func(c *CPU) {
+			c.mem.WriteN(0x0200, 0xbe, 0x01, 0x12)
+			c.Y = 0xff
+		}, 5},
+		{"lda (indirect),y", func(c *CPU) {
+			c.mem.WriteN(0x0200, 0xb1, 0x40)
+			c.mem.WriteN(0x0040, 0x00, 0x12)
+			c.Y = 0xff
+		}, 5},
+		{"lda (indirect),y page cross", func(c *CPU) {
+			c.mem.WriteN(0x0200, 0xb1, 0x40)
+			c.mem.WriteN(0x0040, 0x01, 0x12)
+			c.Y = 0xff
+		}, 6},
+		{"sta absolute,x page cross", func(c *CPU) {
+			c.mem.WriteN(0x0200, 0x9d, 0x01, 0x12)
+			c.X = 0xff
+		}, 5},
+		{"inc absolute,x page cross", func(c *CPU) {
+			c.mem.WriteN(0x0200, 0xfe, 0x01, 0x12)
+			c.X = 0xff
+		}, 7},
+		{"bne not taken", func(c *CPU) {
+			c.mem.WriteN(0x0200, 0xd0, 0x10)
+			c.SR = FlagZ
+		}, 2},
+		{"bne taken", func(c *CPU) {
+			c.mem.WriteN(0x0200, 0xd0, 0x10)
+		}, 3},
+		{"bne taken backward", func(c *CPU) {
+			c.mem.WriteN(0x0200, 0xd0, 0xfe)
+		}, 3},
+		{"bne taken page cross", func(c *CPU) {
+			c.mem.WriteN(0x0200, 0xd0, 0xf0)
+		}, 4},
+		{"jsr", func(c *CPU) {
+			c.mem.WriteN(0x0200, 0x20, 0x00, 0x30)
+		}, 6},
+		{"irq", func(c *CPU) {
+			c.mem.WriteN(0x0200, 0xea)
+			c.IRQ = true
+		}, 9},
+		{"irq disabled", func(c *CPU) {
+			c.mem.WriteN(0x0200, 0xea)
+			c.SR = FlagI
+			c.IRQ = true
+		}, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestCPU()
+			test.setup(c)
+			c.Next()
+			have := c.Cycles()
+			if have != test.want {
+				t.Errorf("\n have: %v \n want: %v", have, test.want)
+			}
+		})
+	}
+}
+
+func TestCallReturn(t *testing.T) {
+	tests := []struct {
+		name string
+		op   uint8
+		call bool
+		ret  bool
+	}{
+		{"jsr", 0x20, true, false},
+		{"rts", 0x60, false, true},
+		{"rti", 0x40, false, true},
+		{"jmp", 0x4c, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestCPU()
+			c.mem.Write(0x0200, test.op)
+			if c.IsCall() != test.call || c.IsReturn() != test.ret {
+				t.Errorf("\n have: %v %v \n want: %v %v", c.IsCall(), c.IsReturn(),
+					test.call, test.ret)
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	c := newTestCPU()
+	c.A, c.X, c.Y, c.SR = 0x12, 0x34, 0x56, FlagC
+	var r rcs.RegisterSnapshot
+	c.SnapshotRegisters(&r)
+	c.A = 0
+	have := c.FormatSnapshot(&r)
+	want := "a:12 x:34 y:56 sp:ff sr:21"
+	if have != want {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+}
@@ -0,0 +1,44 @@
+package m6502
+
+// http://www.6502.org/tutorials/6502opcodes.html
+// http://nesdev.com/6502_cpu.txt
+
+// Number of cycles used by each instruction without any penalties.
+var cycles = map[uint8]int{
+	0x00: 7, 0x01: 6, 0x05: 3, 0x06: 5, 0x08: 3, 0x09: 2, 0x0a: 2, 0x0d: 4, 0x0e: 6,
+	0x10: 2, 0x11: 5, 0x15: 4, 0x16: 6, 0x18: 2, 0x19: 4, 0x1d: 4, 0x1e: 7,
+	0x20: 6, 0x21: 6, 0x24: 3, 0x25: 3, 0x26: 5, 0x28: 4, 0x29: 2, 0x2a: 2, 0x2c: 4, 0x2d: 4, 0x2e: 6,
+	0x30: 2, 0x31: 5, 0x35: 4, 0x36: 6, 0x38: 2, 0x39: 4, 0x3d: 4, 0x3e: 7,
+	0x40: 6, 0x41: 6, 0x45: 3, 0x46: 5, 0x48: 3, 0x49: 2, 0x4a: 2, 0x4c: 3, 0x4d: 4, 0x4e: 6,
+	0x50: 2, 0x51: 5, 0x55: 4, 0x56: 6, 0x58: 2, 0x59: 4, 0x5d: 4, 0x5e: 7,
+	0x60: 6, 0x61: 6, 0x65: 3, 0x66: 5, 0x68: 4, 0x69: 2, 0x6a: 2, 0x6c: 5, 0x6d: 4, 0x6e: 6,
+	0x70: 2, 0x71: 5, 0x75: 4, 0x76: 6, 0x78: 2, 0x79: 4, 0x7d: 4, 0x7e: 7,
+	0x81: 6, 0x84: 3, 0x85: 3, 0x86: 3, 0x88: 2, 0x8a: 2, 0x8c: 4, 0x8d: 4, 0x8e: 4,
+	0x90: 2, 0x91: 6, 0x94: 4, 0x95: 4, 0x96: 4, 0x98: 2, 0x99: 5, 0x9a: 2, 0x9d: 5,
+	0xa0: 2, 0xa1: 6, 0xa2: 2, 0xa4: 3, 0xa5: 3, 0xa6: 3, 0xa8: 2, 0xa9: 2, 0xaa: 2, 0xac: 4, 0xad: 4, 0xae: 4,
+	0xb0: 2, 0xb1: 5, 0xb4: 4, 0xb5: 4, 0xb6: 4, 0xb8: 2, 0xb9: 4, 0xba: 2, 0xbc: 4, 0xbd: 4, 0xbe: 4,
+	0xc0: 2, 0xc1: 6, 0xc4: 3, 0xc5: 3, 0xc6: 5, 0xc8: 2, 0xc9: 2, 0xca: 2, 0xcc: 4, 0xcd: 4, 0xce: 6,
+	0xd0: 2, 0xd1: 5, 0xd5: 4, 0xd6: 6, 0xd8: 2, 0xd9: 4, 0xdd: 4, 0xde: 7,
+	0xe0: 2, 0xe1: 6, 0xe4: 3, 0xe5: 3, 0xe6: 5, 0xe8: 2, 0xe9: 2, 0xea: 2, 0xec: 4, 0xed: 4, 0xee: 6,
+	0xf0: 2, 0xf1: 5, 0xf5: 4, 0xf6: 6, 0xf8: 2, 0xf9: 4, 0xfd: 4, 0xfe: 7,
+}
+
+// Instructions that take an extra cycle when the indexed read crosses a
+// page boundary. Stores and read-modify-write instructions always take
+// the extra cycle and it is included in the base count.
+var pageCrossPenalty = map[uint8]bool{
+	0x11: true, 0x19: true, 0x1d: true, // ora
+	0x31: true, 0x39: true, 0x3d: true, // and
+	0x51: true, 0x59: true, 0x5d: true, // eor
+	0x71: true, 0x79: true, 0x7d: true, // adc
+	0xb1: true, 0xb9: true, 0xbd: true, // lda
+	0xbe: true,                         // ldx
+	0xbc: true,                         // ldy
+	0xd1: true, 0xd9: true, 0xdd: true, // cmp
+	0xf1: true, 0xf9: true, 0xfd: true, // sbc
+}
+
+const (
+	cyclesIllegal = 2 // cycles charged for an illegal instruction
+	cyclesIRQ     = 7 // cycles used to acknowledge an interrupt
+)
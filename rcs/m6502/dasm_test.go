@@ -2,6 +2,7 @@ package m6502
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/blackchip-org/retro-cs/mock"
@@ -222,3 +223,34 @@ func TestDisassembler(t *testing.T) {
 		})
 	}
 }
+
+func TestDisassemblerSymbols(t *testing.T) {
+	var tests = []struct {
+		bytes []uint8
+		want  string
+	}{
+		{[]uint8{0x20, 0xd2, 0xff}, "START:\n$1234:  20 d2 ff  jsr CHROUT"},
+		{[]uint8{0x4c, 0xd2, 0xff}, "START:\n$1234:  4c d2 ff  jmp CHROUT"},
+		{[]uint8{0xd0, 0xfa}, "START:\n$1234:  d0 fa     bne LOOP"},
+		{[]uint8{0xad, 0xd2, 0xff}, "START:\n$1234:  ad d2 ff  lda $ffd2"},
+		{[]uint8{0x20, 0xd5, 0xff}, "START:\n$1234:  20 d5 ff  jsr $ffd5"},
+	}
+	for _, test := range tests {
+		mock.ResetMemory()
+		mem := mock.TestMemory
+		mem.WriteN(0x1234, test.bytes...)
+		d := rcs.NewDisassembler(mem, Reader, Formatter())
+		d.Symbols = rcs.Symbols{0x1230: "LOOP", 0x1234: "START", 0xffd2: "CHROUT"}
+		d.SetPC(0x1234)
+		have := d.NextListing()
+		if test.want != have {
+			t.Errorf("\n have: %v \n want: %v", have, test.want)
+		}
+		// the label is only in a listing
+		d.SetPC(0x1234)
+		want := strings.TrimPrefix(test.want, "START:\n")
+		if have := d.Next(); have != want {
+			t.Errorf("\n have: %v \n want: %v", have, want)
+		}
+	}
+}
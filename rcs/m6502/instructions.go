@@ -112,11 +112,18 @@ func bit(c *CPU, load rcs.Load8) {
 func branch(c *CPU, do bool) {
 	displacement := int8(c.fetch())
 	if do {
+		// one extra cycle if the branch is taken and another if the
+		// target is on a different page than the next instruction
+		next := c.pc + 1
+		c.cycles++
 		if displacement >= 0 {
 			c.SetPC(c.PC() + int(displacement))
 		} else {
 			c.SetPC(c.PC() - int(displacement*-1))
 		}
+		if next&0xff00 != (c.pc+1)&0xff00 {
+			c.cycles++
+		}
 	}
 }
 
@@ -27,7 +27,7 @@ func Reader(e rcs.StmtEval) {
 		operand = e.Ptr.FetchLE()
 		e.Stmt.Bytes = append(e.Stmt.Bytes, uint8(operand), uint8(operand>>8))
 	}
-	e.Stmt.Op = op.inst + formatOp(op, operand, e.Stmt.Addr)
+	e.Stmt.Op = op.inst + formatOp(e, op, operand)
 	return
 }
 
@@ -40,7 +40,8 @@ func Formatter() rcs.CodeFormatter {
 	}
 }
 
-func formatOp(op op, operand int, addr int) string {
+func formatOp(e rcs.StmtEval, op op, operand int) string {
+	addr := e.Stmt.Addr
 	format, ok := operandFormats[op.mode]
 	result := ""
 	if ok {
@@ -56,6 +57,10 @@ func formatOp(op op, operand int, addr int) string {
 				value = addr - int(value8*-1) + 2
 			}
 		}
+		// Branch and jump targets use the name of the address if known
+		if op.mode == relative || (op.mode == absolute && isJump(op.inst)) {
+			return " " + e.Target(value)
+		}
 		// If the format does not contain a formatting directive, just use as is.
 		// For example: "asl a"
 		if strings.Contains(format, "%") {
@@ -66,3 +71,7 @@ func formatOp(op op, operand int, addr int) string {
 	}
 	return result
 }
+
+func isJump(inst string) bool {
+	return inst == "jmp" || inst == "jsr"
+}
@@ -0,0 +1,134 @@
+package m6502
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blackchip-org/retro-cs/rcs"
+)
+
+// asmTable is the opcode for each instruction and addressing mode found in
+// dasmTable.
+var asmTable = func() map[string]map[mode]uint8 {
+	table := make(map[string]map[mode]uint8)
+	for opcode := 0; opcode <= 0xff; opcode++ {
+		op, ok := dasmTable[uint8(opcode)]
+		if !ok {
+			continue
+		}
+		if _, ok := table[op.inst]; !ok {
+			table[op.inst] = make(map[mode]uint8)
+		}
+		if _, ok := table[op.inst][op.mode]; !ok {
+			table[op.inst][op.mode] = uint8(opcode)
+		}
+	}
+	return table
+}()
+
+// Writer encodes a 6502 instruction. Zero page addressing is used when the
+// value of the operand is known to fit in a byte and the instruction
+// supports it.
+func Writer(e rcs.AsmEval) ([]uint8, error) {
+	modes, ok := asmTable[e.Op]
+	if !ok {
+		return nil, fmt.Errorf("no such instruction: %v", e.Op)
+	}
+	operand := strings.TrimSpace(e.Operand)
+	lower := strings.ToLower(strings.Replace(operand, " ", "", -1))
+	_, hasIndirect := modes[indirect]
+	switch {
+	case operand == "":
+		if _, ok := modes[implied]; ok {
+			return encode(e, modes, implied, 0)
+		}
+		return encode(e, modes, accumulator, 0)
+	case lower == "a":
+		if _, ok := modes[accumulator]; ok {
+			return encode(e, modes, accumulator, 0)
+		}
+	case strings.HasPrefix(operand, "#"):
+		v, err := e.Eval(operand[1:])
+		if err != nil {
+			return nil, err
+		}
+		return encode(e, modes, immediate, v)
+	case strings.HasPrefix(lower, "(") && strings.HasSuffix(lower, ",x)"):
+		v, err := e.Eval(operand[1:strings.LastIndex(operand, ",")])
+		if err != nil {
+			return nil, err
+		}
+		return encode(e, modes, indirectX, v)
+	case strings.HasSuffix(lower, ",y") && rcs.IsWrapped(lower[:len(lower)-2]):
+		v, err := e.Eval(operand[:strings.LastIndex(operand, ",")])
+		if err != nil {
+			return nil, err
+		}
+		return encode(e, modes, indirectY, v)
+	case hasIndirect && rcs.IsWrapped(lower):
+		v, err := e.Eval(operand)
+		if err != nil {
+			return nil, err
+		}
+		return encode(e, modes, indirect, v)
+	case strings.HasSuffix(lower, ",x"):
+		return encodeIndexed(e, modes, operand, zeroPageX, absoluteX)
+	case strings.HasSuffix(lower, ",y"):
+		return encodeIndexed(e, modes, operand, zeroPageY, absoluteY)
+	}
+	v, err := e.Eval(operand)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := modes[relative]; ok {
+		return encodeRelative(e, modes[relative], v)
+	}
+	return encode(e, modes, choose(e, modes, v, zeroPage, absolute), v)
+}
+
+func encodeIndexed(e rcs.AsmEval, modes map[mode]uint8, operand string, zp mode, abs mode) ([]uint8, error) {
+	v, err := e.Eval(operand[:strings.LastIndex(operand, ",")])
+	if err != nil {
+		return nil, err
+	}
+	return encode(e, modes, choose(e, modes, v, zp, abs), v)
+}
+
+// choose returns the zero page mode if the value is known to fit in a
+// byte or if there is no absolute mode.
+func choose(e rcs.AsmEval, modes map[mode]uint8, v int, zp mode, abs mode) mode {
+	_, hasZP := modes[zp]
+	_, hasAbs := modes[abs]
+	if hasZP && (!hasAbs || (!e.Forward() && v >= 0 && v <= 0xff)) {
+		return zp
+	}
+	return abs
+}
+
+func encode(e rcs.AsmEval, modes map[mode]uint8, m mode, v int) ([]uint8, error) {
+	opcode, ok := modes[m]
+	if !ok {
+		return nil, fmt.Errorf("invalid addressing mode: %v %v", e.Op, e.Operand)
+	}
+	switch operandLengths[m] {
+	case 1:
+		if err := rcs.CheckByte(v); err != nil {
+			return nil, err
+		}
+		return []uint8{opcode, uint8(v)}, nil
+	case 2:
+		if err := rcs.CheckWord(v); err != nil {
+			return nil, err
+		}
+		return []uint8{opcode, uint8(v), uint8(v >> 8)}, nil
+	}
+	return []uint8{opcode}, nil
+}
+
+func encodeRelative(e rcs.AsmEval, opcode uint8, target int) ([]uint8, error) {
+	delta := target - (e.Addr + 2)
+	if e.Final && (delta < -0x80 || delta > 0x7f) {
+		return nil, fmt.Errorf("branch out of range: $%04x", target)
+	}
+	return []uint8{opcode, uint8(delta)}, nil
+}
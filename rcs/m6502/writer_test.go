@@ -0,0 +1,147 @@
+package m6502
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/blackchip-org/retro-cs/mock"
+	"github.com/blackchip-org/retro-cs/rcs"
+)
+
+// TestRoundTrip disassembles every opcode and checks that assembling the
+// result gives back the same bytes.
+func TestRoundTrip(t *testing.T) {
+	for opcode := range dasmTable {
+		t.Run(fmt.Sprintf("opcode $%02x", opcode), func(t *testing.T) {
+			mock.ResetMemory()
+			mem := mock.TestMemory
+			mem.WriteN(0x1234, opcode, 0x34, 0x12)
+			d := rcs.NewDisassembler(mem, Reader, Formatter())
+			d.SetPC(0x1234)
+			s := d.NextStmt()
+			a := rcs.NewAssembler(Writer)
+			have, err := a.AssembleLine(0x1234, s.Op)
+			if err != nil {
+				t.Fatalf("%v: %v", s.Op, err)
+			}
+			if !bytes.Equal(have, s.Bytes) {
+				t.Errorf("%v:\n have: % x \n want: % x", s.Op, have, s.Bytes)
+			}
+		})
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	src := `
+chrout = $ffd2
+        .org $c000
+start:  ldx #0
+loop:   lda msg,x
+        beq done
+        jsr chrout
+        inx
+        bne loop
+done:   rts
+msg:    .byte "HI", 13, 0
+        .word start, >msg
+`
+	a := rcs.NewAssembler(Writer)
+	prog, err := a.Assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint8{
+		0xa2, 0x00, // ldx #0
+		0xbd, 0x0e, 0xc0, // lda msg,x
+		0xf0, 0x06, // beq done
+		0x20, 0xd2, 0xff, // jsr chrout
+		0xe8,       // inx
+		0xd0, 0xf5, // bne loop
+		0x60,                   // rts
+		0x48, 0x49, 0x0d, 0x00, // msg
+		0x00, 0xc0, 0xc0, 0x00, // .word
+	}
+	if prog.Origin != 0xc000 || !bytes.Equal(prog.Code, want) {
+		t.Errorf("\n have: $%04x % x \n want: $c000 % x", prog.Origin, prog.Code, want)
+	}
+	if prog.Symbols[0xc002] != "loop" {
+		t.Errorf("\n have: %v \n want: loop", prog.Symbols[0xc002])
+	}
+}
+
+func TestAssembleModes(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []uint8
+	}{
+		{"asl", []uint8{0x0a}},
+		{"asl a", []uint8{0x0a}},
+		{"lda #<$1234", []uint8{0xa9, 0x34}},
+		{"lda #>$1234", []uint8{0xa9, 0x12}},
+		{"lda $12", []uint8{0xa5, 0x12}},
+		{"lda $0012", []uint8{0xa5, 0x12}},
+		{"lda $1234,x", []uint8{0xbd, 0x34, 0x12}},
+		{"lda $12, x", []uint8{0xb5, 0x12}},
+		{"ldx $12,y", []uint8{0xb6, 0x12}},
+		{"lda $12,y", []uint8{0xb9, 0x12, 0x00}},
+		{"lda ($12,x)", []uint8{0xa1, 0x12}},
+		{"lda ($12),y", []uint8{0xb1, 0x12}},
+		{"lda (1+2)*2", []uint8{0xa5, 0x06}},
+		{"jmp ($1234)", []uint8{0x6c, 0x34, 0x12}},
+		{"jmp *", []uint8{0x4c, 0x00, 0x10}},
+		{"BNE *", []uint8{0xd0, 0xfe}},
+	}
+	for _, test := range tests {
+		a := rcs.NewAssembler(Writer)
+		have, err := a.AssembleLine(0x1000, test.src)
+		if err != nil {
+			t.Errorf("%v: %v", test.src, err)
+			continue
+		}
+		if !bytes.Equal(have, test.want) {
+			t.Errorf("%v:\n have: % x \n want: % x", test.src, have, test.want)
+		}
+	}
+}
+
+func TestAssembleForward(t *testing.T) {
+	src := `
+        lda zp
+        lda abs
+zp = $12
+abs = zp + $1000
+`
+	a := rcs.NewAssembler(Writer)
+	prog, err := a.Assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// zero page is not used when the value is not yet known
+	want := []uint8{0xad, 0x12, 0x00, 0xad, 0x12, 0x10}
+	if !bytes.Equal(prog.Code, want) {
+		t.Errorf("\n have: % x \n want: % x", prog.Code, want)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"foo", "line 1: no such instruction: foo"},
+		{"\nlda #$100", "line 2: value out of range: 256"},
+		{"jmp nowhere", "line 1: undefined: nowhere"},
+		{"inx $12", "line 1: invalid addressing mode: inx $12"},
+		{"bne far\n.org $1000\nfar:", "line 1: branch out of range: $1000"},
+		{".foo", "line 1: no such directive: .foo"},
+	}
+	for _, test := range tests {
+		a := rcs.NewAssembler(Writer)
+		_, err := a.Assemble(strings.NewReader(test.src))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("\n have: %v \n want: %v", err, test.want)
+		}
+	}
+}
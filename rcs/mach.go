@@ -1,10 +1,17 @@
 package rcs
 
 import (
+	"errors"
 	"fmt"
+	"image"
+	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
 	"time"
 
+	"github.com/blackchip-org/retro-cs/config"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
@@ -17,8 +24,7 @@ const (
 )
 
 const (
-	vblank   = time.Duration(16670 * time.Microsecond)
-	perJiffy = 20000 // instructions per jiffy
+	vblank = time.Duration(16670 * time.Microsecond)
 )
 
 func (s Status) String() string {
@@ -33,6 +39,31 @@ func (s Status) String() string {
 	return "???"
 }
 
+// ErrBreak is returned when execution stops at a breakpoint.
+var ErrBreak = errors.New("break")
+
+// Breakpoint stops execution when a CPU reaches its address.
+type Breakpoint struct {
+	Cond   *Expr // Only stop when this is true, if set
+	Ignore int   // Number of hits remaining to pass through without stopping
+	Hits   int   // Number of times reached while the condition was true
+	Temp   bool  // Remove after the first stop
+}
+
+// hit records that the breakpoint was reached and returns true if
+// execution should stop.
+func (b *Breakpoint) hit() bool {
+	if b.Cond != nil && b.Cond.Eval() == 0 {
+		return false
+	}
+	b.Hits++
+	if b.Ignore > 0 {
+		b.Ignore--
+		return false
+	}
+	return true
+}
+
 type MachCmd int
 
 const (
@@ -43,22 +74,52 @@ const (
 	MachTrace
 	MachTraceAll
 	MachQuit
+	MachScreenshot
+	MachRecord
+	MachRecordStop
+	MachRecordAudio
+	MachRecordAudioStop
+	MachInput
+	MachRewind
+	MachMovieRecord
+	MachMovieStop
+	MachMoviePlay
+	MachExec // Runs the func() error given as the argument
+
+	// Queries return a value when used with Call
+	MachStatus     // Status of the machine
+	MachReadCPU    // Copy of the CPU with the given name
+	MachReadMemory // Values in a memory component: name, address, count
 )
 
+// ErrStopped is returned by Call when the machine is no longer running.
+var ErrStopped = errors.New("machine stopped")
+
 type message struct {
-	Cmd  MachCmd
-	Args []interface{}
+	Cmd   MachCmd
+	Args  []interface{}
+	reply chan result
+}
+
+type result struct {
+	val interface{}
+	err error
 }
 
 type MachEvent int
 
 const (
+	// StatusEvent is sent when the status changes with the new Status. A
+	// Break also has the name of the CPU that stopped.
 	StatusEvent MachEvent = iota
 	TraceEvent
 	ErrorEvent
+	WatchEvent
 )
 
 type Mach struct {
+	Name            string // Name of the system, "pacman"
+	ROMs            []ROM  // ROM set loaded by the system
 	Sys             interface{}
 	Comps           []Component
 	CharDecoders    map[string]CharDecoder
@@ -67,19 +128,75 @@ type Mach struct {
 	Screen          Screen
 	VBlankFunc      func()
 	QueueAudio      func() error
-	Keyboard        func(*sdl.KeyboardEvent) error
+
+	// Input is called when a control is pressed or released. Keys pressed
+	// on the host are converted to controls using Bindings.
+	Input    func(InputEvent) error
+	Bindings Bindings
+
+	// Synth generates the audio for the machine, if any. The audio it
+	// queues is captured when recording.
+	Synth *Synth
+
+	// StateVersion is the version of the state saved by the system and
+	// its components. It should be incremented whenever the data that is
+	// saved changes and a migration added to StateMigrations that
+	// converts a state from the previous version.
+	StateVersion    int
+	StateMigrations map[int]func(*State) error
+
+	// Clock is the frequency, in hertz, of the master clock that drives
+	// the CPUs. Each CPU is given the number of cycles that elapse in one
+	// frame before the vertical blank.
+	Clock int
+
+	// RewindInterval is the number of frames between the snapshots kept
+	// for rewinding and RewindSnapshots is the number of snapshots kept.
+	// DefaultRewindInterval and DefaultRewindSnapshots are used when
+	// these are zero. Snapshots are only taken when Sys is a Saver.
+	RewindInterval  int
+	RewindSnapshots int
+
+	// HistorySize is the number of instructions kept in the execution
+	// history of each CPU. DefaultHistorySize is used when zero.
+	HistorySize int
 
 	CPU         map[string]CPU
 	Proc        map[string]Proc
 	Status      Status
 	Callback    func(MachEvent, ...interface{})
-	Breakpoints map[string]map[int]struct{}
+	Breakpoints map[string]map[int]*Breakpoint
+	Symbols     map[string]Symbols // by CPU name
 
-	scanLines *sdl.Texture
-	init      bool
-	tracing   map[string]bool
-	quit      bool
-	cmd       chan message
+	frame       *image.RGBA  // the screen is drawn here
+	screenTex   *sdl.Texture // presents the frame in the window
+	scanLines   *sdl.Texture
+	init        bool
+	tracing     map[string]bool
+	quit        bool
+	cmd         chan message
+	done        chan struct{}  // closed when Run returns
+	running     int32          // set to one while Run is executing
+	cpuNames    []string       // CPU names in component order
+	procNames   []string       // processor names in component order
+	frameCycles int            // cycles executed by each CPU per frame
+	frameEnd    map[string]int // cycle count that ends the current frame
+	frames      int            // number of frames completed
+	recorder    *Recorder
+	audioRec    *WAVSink
+	rewind      *Rewind
+	movieRec    *movieRecorder
+	moviePlay   *moviePlayer
+	mems        map[string]*Memory             // memory components by name
+	watchpoints map[string]map[int]*Watchpoint // by memory name and address
+	execCPU     string                         // name of the CPU executing an instruction
+	execPC      int                            // address of that instruction
+	watchBreak  bool                           // stop after the instruction
+	step        *step                          // step in progress, if any
+	history     map[string]*history            // execution history by CPU name
+	profile     map[string]*cpuProfile         // instruction counts by CPU name
+	profiling   bool                           // counting instructions
+	cpuMems     map[string]*Memory             // memory of each CPU by name
 }
 
 func (m *Mach) Init() error {
@@ -89,15 +206,41 @@ func (m *Mach) Init() error {
 	m.CPU = make(map[string]CPU)
 	m.Proc = make(map[string]Proc)
 	m.tracing = make(map[string]bool)
+	m.frameEnd = make(map[string]int)
+	m.history = make(map[string]*history)
+	m.cpuMems = make(map[string]*Memory)
+	if m.Symbols == nil {
+		m.Symbols = make(map[string]Symbols)
+	}
+	m.cpuNames = nil
+	m.procNames = nil
+	if m.HistorySize <= 0 {
+		m.HistorySize = DefaultHistorySize
+	}
 	for _, comp := range m.Comps {
 		switch v := comp.C.(type) {
 		case CPU:
 			m.CPU[comp.Name] = v
+			m.cpuNames = append(m.cpuNames, comp.Name)
 			m.tracing[comp.Name] = false
+			m.frameEnd[comp.Name] = v.Cycles()
+			m.history[comp.Name] = newHistory(v, m.HistorySize)
+			if m.Symbols[comp.Name] == nil {
+				m.Symbols[comp.Name] = make(Symbols)
+			}
+			if mem := v.Memory(); mem != nil {
+				mem.EnableCoverage()
+				m.cpuMems[comp.Name] = mem
+			}
 		case Proc:
 			m.Proc[comp.Name] = v
+			m.procNames = append(m.procNames, comp.Name)
 		}
 	}
+	if len(m.CPU) > 0 && m.Clock <= 0 {
+		return fmt.Errorf("invalid clock frequency: %v", m.Clock)
+	}
+	m.frameCycles = int(int64(m.Clock) * int64(vblank) / int64(time.Second))
 
 	m.quit = false
 	if m.CharDecoders == nil {
@@ -107,20 +250,50 @@ func (m *Mach) Init() error {
 		m.DefaultEncoding = "ascii"
 	}
 	m.cmd = make(chan message, 10)
+	m.done = make(chan struct{})
 
-	m.Breakpoints = make(map[string]map[int]struct{})
+	m.Breakpoints = make(map[string]map[int]*Breakpoint)
 	for name := range m.CPU {
-		m.Breakpoints[name] = make(map[int]struct{})
+		m.Breakpoints[name] = make(map[int]*Breakpoint)
+	}
+	m.mems = make(map[string]*Memory)
+	m.watchpoints = make(map[string]map[int]*Watchpoint)
+	for _, comp := range m.Comps {
+		if mem, ok := comp.C.(*Memory); ok {
+			m.mems[comp.Name] = mem
+			m.watchpoints[comp.Name] = make(map[int]*Watchpoint)
+			mem.Callback = m.watchCallback(comp.Name)
+		}
 	}
 	if m.VBlankFunc == nil {
 		m.VBlankFunc = func() {}
 	}
-	if m.Keyboard == nil {
-		m.Keyboard = func(*sdl.KeyboardEvent) error { return nil }
+	if m.Input == nil {
+		m.Input = func(InputEvent) error { return nil }
+	}
+	if m.Bindings == nil {
+		m.Bindings = Bindings{}
+	}
+	if m.RewindInterval <= 0 {
+		m.RewindInterval = DefaultRewindInterval
+	}
+	if m.RewindSnapshots <= 0 {
+		m.RewindSnapshots = DefaultRewindSnapshots
+	}
+	if _, ok := m.Sys.(Saver); ok {
+		m.rewind = NewRewind(m.RewindSnapshots)
 	}
 
+	if m.Screen.W > 0 {
+		m.frame = image.NewRGBA(image.Rect(0, 0, int(m.Screen.W), int(m.Screen.H)))
+	}
 	if m.Ctx.Window != nil && m.Screen.W > 0 {
 		r := m.Ctx.Renderer
+		screenTex, err := NewTexture(r, m.frame)
+		if err != nil {
+			return err
+		}
+		m.screenTex = screenTex
 		winx, winy := m.Ctx.Window.GetSize()
 		FitInWindow(winx, winy, &m.Screen)
 		drawW := m.Screen.W * m.Screen.Scale
@@ -149,7 +322,10 @@ func (m *Mach) Run() error {
 	}
 	ticker := time.NewTicker(vblank)
 	panicked := true
+	atomic.StoreInt32(&m.running, 1)
 	defer func() {
+		atomic.StoreInt32(&m.running, 0)
+		close(m.done)
 		if panicked {
 			m.reportCrash()
 		}
@@ -166,42 +342,225 @@ func (m *Mach) Run() error {
 		}
 	}
 	panicked = false
-	return nil
+	var err error
+	if m.recorder != nil {
+		err = m.StopRecording()
+	}
+	if m.audioRec != nil {
+		if aerr := m.StopAudioRecording(); err == nil {
+			err = aerr
+		}
+	}
+	if m.movieRec != nil {
+		if merr := m.StopMovie(); err == nil {
+			err = merr
+		}
+	}
+	return err
 }
 
+// Command sends a command to the machine and returns immediately. The
+// command is handled by Run and any error is reported with an
+// ErrorEvent.
 func (m *Mach) Command(cmd MachCmd, args ...interface{}) {
 	m.cmd <- message{Cmd: cmd, Args: args}
 }
 
+// Call sends a command to the machine and waits for Run to handle it on
+// the machine goroutine. The result of a query, or nil for other commands,
+// is returned along with any error. If Run is not executing, the command
+// is handled immediately on the calling goroutine, so Run should already
+// be executing when Call is used from other goroutines. ErrStopped is
+// returned if Run finishes before the command is handled. Call must not
+// be used from a Callback as it is invoked on the machine goroutine.
+func (m *Mach) Call(cmd MachCmd, args ...interface{}) (interface{}, error) {
+	if err := m.Init(); err != nil {
+		return nil, err
+	}
+	msg := message{Cmd: cmd, Args: args}
+	if !m.Running() {
+		return m.do(msg)
+	}
+	reply := make(chan result, 1)
+	msg.reply = reply
+	select {
+	case m.cmd <- msg:
+	case <-m.done:
+		return nil, ErrStopped
+	}
+	select {
+	case r := <-reply:
+		return r.val, r.err
+	case <-m.done:
+		return nil, ErrStopped
+	}
+}
+
+// SetTrace turns tracing on or off for the CPU with the given name. While
+// on, a TraceEvent is sent for each instruction executed.
+func (m *Mach) SetTrace(name string, on bool) error {
+	if _, ok := m.tracing[name]; !ok {
+		return fmt.Errorf("no such CPU: %v", name)
+	}
+	m.tracing[name] = on
+	return nil
+}
+
+// Tracing returns true if the CPU with the given name is being traced.
+func (m *Mach) Tracing(name string) bool {
+	return m.tracing[name]
+}
+
+// Running returns true while Run is executing.
+func (m *Mach) Running() bool {
+	return atomic.LoadInt32(&m.running) == 1
+}
+
+// RunFrames executes n frames of emulation synchronously. Execution does
+// not wait for the vertical blank and SDL events, video, and commands
+// are not processed. Audio is generated for each frame. The machine is
+// run regardless of its status. If a breakpoint is encountered,
+// execution stops and ErrBreak is returned; calling RunFrames again
+// resumes the interrupted frame.
+func (m *Mach) RunFrames(n int) error {
+	if err := m.Init(); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		m.playMovie()
+		if !m.execute() {
+			return ErrBreak
+		}
+		m.queueAudio()
+		m.vblank()
+	}
+	return nil
+}
+
+// RunUntil executes frames synchronously, in the same manner as
+// RunFrames, until cond returns true. The condition is checked after each
+// frame. An error is returned if the condition is not met within max
+// frames.
+func (m *Mach) RunUntil(cond func() bool, max int) error {
+	if err := m.Init(); err != nil {
+		return err
+	}
+	for i := 0; i < max; i++ {
+		m.playMovie()
+		if !m.execute() {
+			return ErrBreak
+		}
+		m.queueAudio()
+		m.vblank()
+		if cond() {
+			return nil
+		}
+	}
+	return fmt.Errorf("condition not met after %v frames", max)
+}
+
+// Frames is the number of frames that have been completed.
+func (m *Mach) Frames() int {
+	return m.frames
+}
+
+// jiffy runs a single frame. Input from the host is handled after the
+// vertical blank so that, like input from commands, it always takes
+// effect between frames.
 func (m *Mach) jiffy() {
 	if m.Status == Run {
+		m.playMovie()
 		m.execute()
 	}
-	if m.QueueAudio != nil && m.Ctx.AudioSpec.Freq != 0 {
-		if err := m.QueueAudio(); err != nil {
-			m.event(ErrorEvent, err)
-		}
-	}
-	if m.Ctx.Renderer != nil && m.Screen.W > 0 {
+	m.queueAudio()
+	if m.screenTex != nil {
 		m.render()
 	} else {
 		time.Sleep(10 * time.Millisecond)
 	}
-	m.sdl()
 	if m.Status == Run {
-		m.VBlankFunc()
+		m.vblank()
+	}
+	m.sdl()
+}
+
+func (m *Mach) queueAudio() {
+	if m.QueueAudio != nil && m.Ctx.AudioSpec.Freq != 0 {
+		if err := m.QueueAudio(); err != nil {
+			m.event(ErrorEvent, err)
+		}
 	}
 }
 
-func (m *Mach) execute() {
-	for t := 0; t < perJiffy; t++ {
-		for name, cpu := range m.CPU {
+func (m *Mach) vblank() {
+	m.VBlankFunc()
+	m.frames++
+	m.snapshot()
+	m.endMovie()
+	if m.recorder != nil {
+		if err := m.recordFrame(); err != nil {
+			m.event(ErrorEvent, fmt.Sprintf("unable to record: %v", err))
+			m.StopRecording()
+		}
+	}
+}
+
+// execute runs each CPU for the number of cycles in a single frame. The
+// CPUs are stepped in lockstep, one instruction at a time, and the
+// processors are stepped once after each round. Cycles executed past the
+// end of a frame are deducted from the next frame. If execution stops at
+// a breakpoint or watchpoint, false is returned and the remainder of the
+// frame is executed on the next call.
+func (m *Mach) execute() bool {
+	for _, name := range m.cpuNames {
+		cycles := m.CPU[name].Cycles()
+		if cycles >= m.frameEnd[name] {
+			m.frameEnd[name] += m.frameCycles
+		}
+		// if the CPU was stepped outside of a frame, don't try to catch up
+		if cycles >= m.frameEnd[name] {
+			m.frameEnd[name] = cycles + m.frameCycles
+		}
+	}
+	for {
+		running := false
+		for _, name := range m.cpuNames {
+			cpu := m.CPU[name]
+			if cpu.Cycles() >= m.frameEnd[name] {
+				continue
+			}
+			running = true
 			ppc := cpu.PC()
+			stepping := m.step != nil && m.step.cpu == name
+			if stepping {
+				m.step.before(cpu)
+			}
+			m.execCPU, m.execPC = name, ppc+cpu.Offset()
+			e := m.record(name, m.execPC)
+			var start int
+			if m.profiling {
+				start = cpu.Cycles()
+			}
+			mem := m.cpuMems[name]
+			if mem != nil {
+				mem.beginInstruction()
+			}
 			cpu.Next()
+			if mem != nil {
+				code := mem.endInstruction()
+				if e != nil {
+					e.Code = code
+				}
+			}
+			m.execCPU = ""
+			if m.profiling {
+				m.profile[name].add(m.execPC, cpu.Cycles()-start)
+			}
 			// if the program counter didn't change, it is either stuck
 			// in an infinite loop or not advancing due to a halt-like
 			// instruction
 			stuck := ppc == cpu.PC()
+			m.history[name].stuck = stuck
 			if m.tracing[name] && !stuck {
 				m.event(TraceEvent, name, ppc)
 			}
@@ -209,20 +568,167 @@ func (m *Mach) execute() {
 			// when at a halt-like instruction, this causes a break once
 			// instead of each time.
 			addr := cpu.PC() + cpu.Offset()
-			if _, yes := m.Breakpoints[name][addr]; yes && !stuck {
-				m.setStatus(Break)
-				return
+			brk := false
+			if b, yes := m.Breakpoints[name][addr]; yes && !stuck && b.hit() {
+				if b.Temp {
+					delete(m.Breakpoints[name], addr)
+				}
+				brk = true
 			}
+			if stepping && m.step.done(cpu) {
+				brk = true
+			}
+			// also stop right after an instruction that accessed memory
+			// at a watchpoint
+			if brk || m.watchBreak {
+				m.watchBreak = false
+				m.setStatus(Break, name)
+				return false
+			}
+		}
+		if !running {
+			return true
 		}
-		for _, proc := range m.Proc {
-			proc.Next()
+		for _, name := range m.procNames {
+			m.Proc[name].Next()
 		}
 	}
 }
 
+// DrawScreen draws the contents of the screen into a new image. This can
+// be used without a window or renderer.
+func (m *Mach) DrawScreen() (*image.RGBA, error) {
+	if err := m.Init(); err != nil {
+		return nil, err
+	}
+	if m.frame == nil {
+		return nil, errors.New("no screen")
+	}
+	if err := m.Screen.Draw(m.frame); err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(m.frame.Rect)
+	copy(img.Pix, m.frame.Pix)
+	return img, nil
+}
+
+// Screenshot writes the contents of the screen to filename as a PNG
+// image.
+func (m *Mach) Screenshot(filename string) error {
+	img, err := m.DrawScreen()
+	if err != nil {
+		return err
+	}
+	return SavePNG(filename, img)
+}
+
+// StartRecording captures each frame, and the audio from the Synth, until
+// StopRecording is called. See Recorder for how the name of the recording
+// is used.
+func (m *Mach) StartRecording(name string) error {
+	if err := m.Init(); err != nil {
+		return err
+	}
+	if m.frame == nil {
+		return errors.New("no screen")
+	}
+	if m.recorder != nil {
+		return errors.New("already recording")
+	}
+	rate := 0
+	if m.Synth != nil && m.Ctx.AudioSpec.Freq != 0 {
+		rate = int(m.Synth.Spec.Freq)
+	}
+	r, err := NewRecorder(name, rate)
+	if err != nil {
+		return err
+	}
+	m.recorder = r
+	m.updateTap()
+	return nil
+}
+
+// StopRecording finishes the current recording.
+func (m *Mach) StopRecording() error {
+	if m.recorder == nil {
+		return errors.New("not recording")
+	}
+	r := m.recorder
+	m.recorder = nil
+	m.updateTap()
+	return r.Close()
+}
+
+// Recording returns true if a recording is in progress.
+func (m *Mach) Recording() bool {
+	return m.recorder != nil
+}
+
+// StartAudioRecording writes the audio from the Synth to filename as a
+// WAV file until StopAudioRecording is called.
+func (m *Mach) StartAudioRecording(filename string) error {
+	if m.Synth == nil {
+		return errors.New("no audio")
+	}
+	if m.audioRec != nil {
+		return errors.New("already recording audio")
+	}
+	w, err := NewWAVSink(filename, int(m.Synth.Spec.Freq))
+	if err != nil {
+		return err
+	}
+	m.audioRec = w
+	m.updateTap()
+	return nil
+}
+
+// StopAudioRecording finishes the current audio recording.
+func (m *Mach) StopAudioRecording() error {
+	if m.audioRec == nil {
+		return errors.New("not recording audio")
+	}
+	w := m.audioRec
+	m.audioRec = nil
+	m.updateTap()
+	return w.Close()
+}
+
+// updateTap sends a copy of the audio from the synth to each recording
+// in progress.
+func (m *Mach) updateTap() {
+	if m.Synth == nil {
+		return
+	}
+	var taps []io.Writer
+	if m.recorder != nil {
+		taps = append(taps, m.recorder)
+	}
+	if m.audioRec != nil {
+		taps = append(taps, m.audioRec)
+	}
+	switch len(taps) {
+	case 0:
+		m.Synth.Tap = nil
+	case 1:
+		m.Synth.Tap = taps[0]
+	default:
+		m.Synth.Tap = io.MultiWriter(taps...)
+	}
+}
+
+func (m *Mach) recordFrame() error {
+	if err := m.Screen.Draw(m.frame); err != nil {
+		return err
+	}
+	return m.recorder.Frame(m.frame)
+}
+
 func (m *Mach) render() error {
 	r := m.Ctx.Renderer
-	if err := m.Screen.Draw(r); err != nil {
+	if err := m.Screen.Draw(m.frame); err != nil {
+		return err
+	}
+	if err := UpdateTexture(m.screenTex, m.frame); err != nil {
 		return err
 	}
 	dest := sdl.Rect{
@@ -231,7 +737,7 @@ func (m *Mach) render() error {
 		W: m.Screen.W * m.Screen.Scale,
 		H: m.Screen.H * m.Screen.Scale,
 	}
-	r.Copy(m.Screen.Texture, nil, &dest)
+	r.Copy(m.screenTex, nil, &dest)
 	if m.scanLines != nil {
 		r.Copy(m.scanLines, nil, &dest)
 	}
@@ -246,97 +752,496 @@ func (m *Mach) sdl() {
 		} else if e, ok := event.(*sdl.KeyboardEvent); ok {
 			if e.Keysym.Sym == sdl.K_ESCAPE {
 				m.quit = true
+			} else if e.Keysym.Sym == sdl.K_F11 {
+				if e.Type == sdl.KEYDOWN {
+					m.rewindKey()
+				}
+			} else if e.Keysym.Sym == sdl.K_F12 {
+				if e.Type == sdl.KEYDOWN {
+					m.captureKey(e.Keysym.Mod&sdl.KMOD_SHIFT != 0)
+				}
 			} else {
-				m.Keyboard(e)
+				m.key(e)
 			}
 		}
 	}
 }
 
+// key sends an input event for each control bound to the key.
+func (m *Mach) key(e *sdl.KeyboardEvent) {
+	if e.Repeat != 0 {
+		return
+	}
+	name := sdl.GetKeyName(e.Keysym.Sym)
+	for _, c := range m.Bindings[name] {
+		m.input(InputEvent{Control: c, Pressed: e.Type == sdl.KEYDOWN})
+	}
+}
+
+func (m *Mach) input(e InputEvent) {
+	if err := m.cmdInput(e); err != nil {
+		m.event(ErrorEvent, err)
+	}
+}
+
+// captureKey takes a screenshot, or starts and stops a recording when
+// shift is held down. Files are named with the current time and stored in
+// the var directory.
+func (m *Mach) captureKey(shift bool) {
+	stamp := time.Now().Format("20060102-150405")
+	var err error
+	if !shift {
+		err = m.cmdScreenshot(filepath.Join(config.VarDir, "screenshot-"+stamp+".png"))
+	} else if m.recorder == nil {
+		err = m.cmdRecord(filepath.Join(config.VarDir, "recording-"+stamp))
+	} else {
+		err = m.cmdRecordStop()
+	}
+	if err != nil {
+		m.event(ErrorEvent, err)
+	}
+}
+
 func (m *Mach) handleCommand(msg message) {
+	v, err := m.do(msg)
+	if msg.reply != nil {
+		msg.reply <- result{val: v, err: err}
+		return
+	}
+	if err != nil {
+		m.event(ErrorEvent, err)
+	}
+}
+
+// do executes a command and returns the result. Commands that only
+// perform an action return a nil value.
+func (m *Mach) do(msg message) (interface{}, error) {
 	switch msg.Cmd {
 	case MachExport:
-		m.cmdExport(msg.Args...)
+		return nil, m.cmdExport(msg.Args...)
 	case MachImport:
-		m.cmdImport(msg.Args...)
+		return nil, m.cmdImport(msg.Args...)
 	case MachPause:
 		m.setStatus(Pause)
 	case MachStart:
 		m.setStatus(Run)
 	case MachTrace:
-		m.cmdTrace(msg.Args...)
+		return nil, m.cmdTrace(msg.Args...)
 	case MachTraceAll:
-		m.cmdTraceAll(msg.Args...)
+		return nil, m.cmdTraceAll(msg.Args...)
 	case MachQuit:
 		m.quit = true
+	case MachScreenshot:
+		return nil, m.cmdScreenshot(msg.Args...)
+	case MachRecord:
+		return nil, m.cmdRecord(msg.Args...)
+	case MachRecordStop:
+		return nil, m.cmdRecordStop()
+	case MachRecordAudio:
+		return nil, m.cmdRecordAudio(msg.Args...)
+	case MachRecordAudioStop:
+		return nil, m.cmdRecordAudioStop()
+	case MachInput:
+		return nil, m.cmdInput(msg.Args...)
+	case MachRewind:
+		return m.cmdRewind(msg.Args...)
+	case MachMovieRecord:
+		return nil, m.cmdMovieRecord(msg.Args...)
+	case MachMovieStop:
+		return nil, m.cmdMovieStop()
+	case MachMoviePlay:
+		return nil, m.cmdMoviePlay(msg.Args...)
+	case MachExec:
+		return nil, m.cmdExec(msg.Args...)
+	case MachStatus:
+		return m.Status, nil
+	case MachReadCPU:
+		return m.cmdReadCPU(msg.Args...)
+	case MachReadMemory:
+		return m.cmdReadMemory(msg.Args...)
 	default:
-		m.event(ErrorEvent, fmt.Errorf("unknown command: %v", msg.Cmd))
+		return nil, fmt.Errorf("unknown command: %v", msg.Cmd)
 	}
+	return nil, nil
 }
 
-func (m *Mach) cmdExport(args ...interface{}) {
-	sys, ok := m.Sys.(Saver)
-	if !ok {
-		m.event(ErrorEvent, "exporting is not supported")
-		return
+// stateComps returns the components that have state in the order they
+// are saved. The system itself is included, with the name of
+// SystemSection, if it is not already a component.
+func (m *Mach) stateComps() []Component {
+	var comps []Component
+	sysComp := false
+	for _, comp := range m.Comps {
+		if comp.C == m.Sys {
+			sysComp = true
+		}
+		comps = append(comps, comp)
+	}
+	if !sysComp && m.Sys != nil {
+		comps = append(comps, NewComponent(SystemSection, "", "", m.Sys))
+	}
+	return comps
+}
+
+// machTiming saves the frame count and where the current frame ends for
+// each CPU so that a restored machine starts its frames on the same
+// cycles.
+type machTiming struct {
+	m *Mach
+}
+
+func (t machTiming) Save(enc *Encoder) {
+	enc.Encode(t.m.frames)
+	for _, name := range t.m.cpuNames {
+		enc.Encode(t.m.frameEnd[name])
+	}
+}
+
+func (t machTiming) Load(dec *Decoder) {
+	dec.Decode(&t.m.frames)
+	for _, name := range t.m.cpuNames {
+		var end int
+		dec.Decode(&end)
+		t.m.frameEnd[name] = end
+	}
+}
+
+// SaveState saves the state of the system and each of its components
+// into a separate section.
+func (m *Mach) SaveState() (*State, error) {
+	if _, ok := m.Sys.(Saver); !ok {
+		return nil, errors.New("exporting is not supported")
+	}
+	if err := m.Init(); err != nil {
+		return nil, err
+	}
+	st := NewState(m.Name, m.StateVersion, m.ROMs)
+	if err := st.Put(MachSection, machTiming{m}); err != nil {
+		return nil, err
+	}
+	for _, comp := range m.stateComps() {
+		if s, ok := comp.C.(Saver); ok {
+			if err := st.Put(comp.Name, s); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return st, nil
+}
+
+// LoadState restores a state created with SaveState. An error is
+// returned if the state is for a different system or ROM set. States
+// from older versions are migrated before loading. If a section cannot
+// be loaded, the machine is left as it was.
+func (m *Mach) LoadState(st *State) error {
+	if _, ok := m.Sys.(Loader); !ok {
+		return errors.New("importing is not supported")
+	}
+	if err := m.Init(); err != nil {
+		return err
+	}
+	if err := st.Check(m.Name, m.ROMs); err != nil {
+		return err
+	}
+	if err := st.Migrate(m.StateVersion, m.StateMigrations); err != nil {
+		return err
+	}
+	loaders := make(map[string]Loader)
+	for _, comp := range m.stateComps() {
+		if l, ok := comp.C.(Loader); ok {
+			if _, ok := st.Sections[comp.Name]; !ok {
+				return fmt.Errorf("missing section: %v", comp.Name)
+			}
+			loaders[comp.Name] = l
+		}
+	}
+	for name := range st.Sections {
+		if _, ok := loaders[name]; !ok && name != MachSection {
+			return fmt.Errorf("unknown section: %v", name)
+		}
+	}
+	// components are loaded in place, so keep the current state to put
+	// back if a section fails to decode instead of leaving the machine
+	// half restored
+	prev, err := m.SaveState()
+	if err != nil {
+		return err
+	}
+	if err := m.loadSections(st, loaders); err != nil {
+		if perr := m.loadSections(prev, loaders); perr != nil {
+			return fmt.Errorf("%v, unable to restore previous state: %v", err, perr)
+		}
+		return err
+	}
+	return nil
+}
+
+// loadSections loads each component that has a section in the state.
+func (m *Mach) loadSections(st *State, loaders map[string]Loader) error {
+	for _, comp := range m.stateComps() {
+		l, ok := loaders[comp.Name]
+		if !ok {
+			continue
+		}
+		if _, ok := st.Sections[comp.Name]; !ok {
+			continue
+		}
+		if err := st.Get(comp.Name, l); err != nil {
+			return err
+		}
+	}
+	// states without timing start a new frame on the next execution
+	if _, ok := st.Sections[MachSection]; !ok {
+		for _, name := range m.cpuNames {
+			m.frameEnd[name] = m.CPU[name].Cycles()
+		}
+		return nil
+	}
+	return st.Get(MachSection, machTiming{m})
+}
+
+// Export writes the state of the machine to w.
+func (m *Mach) Export(w io.Writer) error {
+	st, err := m.SaveState()
+	if err != nil {
+		return err
+	}
+	return WriteState(w, st)
+}
+
+// Import reads the state of the machine from r. Snapshots kept for
+// rewinding are discarded. A state cannot be imported while a movie is
+// recorded or played as the frames of the movie would no longer match.
+func (m *Mach) Import(r io.Reader) error {
+	if m.movieRec != nil {
+		return errors.New("recording a movie")
+	}
+	if m.moviePlay != nil {
+		return errors.New("movie is playing")
+	}
+	st, err := ReadState(r)
+	if err != nil {
+		return err
+	}
+	if err := m.LoadState(st); err != nil {
+		return err
+	}
+	if m.rewind != nil {
+		m.rewind.Clear()
+	}
+	return nil
+}
+
+func (m *Mach) cmdExport(args ...interface{}) error {
+	filename, err := stringArg(args, 0)
+	if err != nil {
+		return err
 	}
-	filename := args[0].(string)
 	out, err := os.Create(filename)
 	if err != nil {
-		m.event(ErrorEvent, fmt.Sprintf("unable toe xport: %v", err))
-		return
+		return fmt.Errorf("unable to export: %v", err)
 	}
-	enc := NewEncoder(out)
-	sys.Save(enc)
-	if enc.Err != nil {
-		m.event(ErrorEvent, fmt.Sprintf("unable to export: %v", enc.Err))
-		return
+	defer out.Close()
+	if err := m.Export(out); err != nil {
+		return fmt.Errorf("unable to export: %v", err)
 	}
+	return nil
 }
 
-func (m *Mach) cmdImport(args ...interface{}) {
-	sys, ok := m.Sys.(Loader)
-	if !ok {
-		m.event(ErrorEvent, "importing is not supported")
-		return
+func (m *Mach) cmdImport(args ...interface{}) error {
+	filename, err := stringArg(args, 0)
+	if err != nil {
+		return err
 	}
-	filename := args[0].(string)
 	in, err := os.Open(filename)
 	if err != nil {
-		m.event(ErrorEvent, fmt.Sprintf("unable to import: %v", err))
-		return
+		return fmt.Errorf("unable to import: %v", err)
 	}
-	dec := NewDecoder(in)
-	sys.Load(dec)
-	if dec.Err != nil {
-		m.event(ErrorEvent, fmt.Sprintf("unable to import: %v", dec.Err))
-		return
+	defer in.Close()
+	if err := m.Import(in); err != nil {
+		return fmt.Errorf("unable to import: %v", err)
 	}
+	return nil
 }
 
-func (m *Mach) cmdTrace(args ...interface{}) {
-	name := args[0].(string)
+func (m *Mach) cmdScreenshot(args ...interface{}) error {
+	filename, err := stringArg(args, 0)
+	if err != nil {
+		return err
+	}
+	if err := m.Screenshot(filename); err != nil {
+		return fmt.Errorf("unable to save screenshot: %v", err)
+	}
+	return nil
+}
+
+func (m *Mach) cmdRecord(args ...interface{}) error {
+	name, err := stringArg(args, 0)
+	if err != nil {
+		return err
+	}
+	if err := m.StartRecording(name); err != nil {
+		return fmt.Errorf("unable to record: %v", err)
+	}
+	return nil
+}
+
+func (m *Mach) cmdRecordStop() error {
+	if err := m.StopRecording(); err != nil {
+		return fmt.Errorf("unable to stop recording: %v", err)
+	}
+	return nil
+}
+
+func (m *Mach) cmdRecordAudio(args ...interface{}) error {
+	filename, err := stringArg(args, 0)
+	if err != nil {
+		return err
+	}
+	if err := m.StartAudioRecording(filename); err != nil {
+		return fmt.Errorf("unable to record audio: %v", err)
+	}
+	return nil
+}
+
+func (m *Mach) cmdRecordAudioStop() error {
+	if err := m.StopAudioRecording(); err != nil {
+		return fmt.Errorf("unable to stop recording audio: %v", err)
+	}
+	return nil
+}
+
+func (m *Mach) cmdInput(args ...interface{}) error {
+	if len(args) < 1 {
+		return errors.New("missing argument 1")
+	}
+	e, ok := args[0].(InputEvent)
+	if !ok {
+		return fmt.Errorf("argument 1: expecting input event but got %T", args[0])
+	}
+	if err := m.SendInput(e); err != nil {
+		return fmt.Errorf("unable to handle input: %v", err)
+	}
+	return nil
+}
+
+func (m *Mach) cmdTrace(args ...interface{}) error {
+	name, err := stringArg(args, 0)
+	if err != nil {
+		return err
+	}
 	if len(args) == 1 {
-		m.tracing[name] = !m.tracing[name]
-		return
+		return m.SetTrace(name, !m.Tracing(name))
 	}
 	v, ok := args[1].(bool)
 	if !ok {
-		m.event(ErrorEvent, fmt.Sprintf("invalid trace mode: %v", args[0]))
-		return
+		return fmt.Errorf("invalid trace mode: %v", args[1])
 	}
-	m.tracing[name] = v
+	return m.SetTrace(name, v)
 }
 
-func (m *Mach) cmdTraceAll(args ...interface{}) {
+func (m *Mach) cmdTraceAll(args ...interface{}) error {
+	if len(args) < 1 {
+		return errors.New("missing argument 1")
+	}
 	v, ok := args[0].(bool)
 	if !ok {
-		m.event(ErrorEvent, fmt.Sprintf("invalid trace mode: %v", args[0]))
-		return
+		return fmt.Errorf("invalid trace mode: %v", args[0])
 	}
 	for name := range m.tracing {
 		m.tracing[name] = v
 	}
+	return nil
+}
+
+// cmdExec runs a function on the machine goroutine so that it can use
+// the components without racing the emulation.
+func (m *Mach) cmdExec(args ...interface{}) error {
+	if len(args) < 1 {
+		return errors.New("missing argument 1")
+	}
+	fn, ok := args[0].(func() error)
+	if !ok {
+		return fmt.Errorf("argument 1: expecting func() error but got %T", args[0])
+	}
+	return fn()
+}
+
+// cmdReadCPU returns a copy of the CPU with the given name. The registers
+// in the copy can be read without racing the machine but the memory is
+// still shared.
+func (m *Mach) cmdReadCPU(args ...interface{}) (interface{}, error) {
+	name, err := stringArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	cpu, ok := m.CPU[name]
+	if !ok {
+		return nil, fmt.Errorf("no such CPU: %v", name)
+	}
+	v := reflect.ValueOf(cpu)
+	if v.Kind() != reflect.Ptr {
+		return cpu, nil
+	}
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	return c.Interface(), nil
+}
+
+// cmdReadMemory returns a slice with the values read from the memory
+// component with the given name starting at an address.
+func (m *Mach) cmdReadMemory(args ...interface{}) (interface{}, error) {
+	name, err := stringArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := intArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	n, err := intArg(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	var mem *Memory
+	for _, comp := range m.Comps {
+		if v, ok := comp.C.(*Memory); ok && comp.Name == name {
+			mem = v
+		}
+	}
+	if mem == nil {
+		return nil, fmt.Errorf("no such memory: %v", name)
+	}
+	if addr < 0 || n < 0 || addr+n > mem.MaxAddr+1 {
+		return nil, fmt.Errorf("invalid range: $%x, %v bytes", addr, n)
+	}
+	values := make([]uint8, n, n)
+	for i := range values {
+		values[i] = mem.Read(addr + i)
+	}
+	return values, nil
+}
+
+func stringArg(args []interface{}, i int) (string, error) {
+	if i >= len(args) {
+		return "", fmt.Errorf("missing argument %v", i+1)
+	}
+	v, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("argument %v: expecting string but got %T", i+1, args[i])
+	}
+	return v, nil
+}
+
+func intArg(args []interface{}, i int) (int, error) {
+	if i >= len(args) {
+		return 0, fmt.Errorf("missing argument %v", i+1)
+	}
+	v, ok := args[i].(int)
+	if !ok {
+		return 0, fmt.Errorf("argument %v: expecting int but got %T", i+1, args[i])
+	}
+	return v, nil
 }
 
 func (m *Mach) event(evt MachEvent, args ...interface{}) {
@@ -346,14 +1251,56 @@ func (m *Mach) event(evt MachEvent, args ...interface{}) {
 	m.Callback(evt, args...)
 }
 
-func (m *Mach) setStatus(s Status) {
+func (m *Mach) setStatus(s Status, args ...interface{}) {
 	m.Status = s
-	m.event(StatusEvent, s)
+	// any other reason for stopping cancels a step in progress
+	if s != Run {
+		m.step = nil
+	}
+	m.event(StatusEvent, append([]interface{}{s}, args...)...)
 }
 
 func (m *Mach) reportCrash() {
-	for n, c := range m.CPU {
+	for _, n := range m.cpuNames {
+		c := m.CPU[n]
 		fmt.Printf("[panic: %v]\n", n)
 		fmt.Println(c)
+		var dasm *Disassembler
+		if d, ok := c.(CPUDisassembler); ok {
+			dasm = d.NewDisassembler()
+		}
+		fmt.Printf("[history: %v]\n", n)
+		for _, e := range m.history[n].list() {
+			fmt.Println(FormatHistory(e, c, dasm))
+		}
+	}
+	filename := filepath.Join(config.VarDir, "crash")
+	if err := m.saveCrash(filename); err != nil {
+		fmt.Printf("[%v]\n", err)
+		return
+	}
+	fmt.Printf("[state saved: %v]\n", filename)
+}
+
+// saveCrash exports the state after a panic. The state may be
+// inconsistent, so a panic while saving is returned as an error.
+func (m *Mach) saveCrash(filename string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unable to export: %v", r)
+		}
+	}()
+	st, err := m.SaveState()
+	if err != nil {
+		return fmt.Errorf("unable to export: %v", err)
 	}
+	out, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("unable to export: %v", err)
+	}
+	defer out.Close()
+	if err := WriteState(out, st); err != nil {
+		return fmt.Errorf("unable to export: %v", err)
+	}
+	return nil
 }
@@ -0,0 +1,263 @@
+package rcs
+
+import (
+	"runtime"
+	"testing"
+)
+
+// cycleCPU is a CPU that executes a "nop" for each instruction and
+// consumes a fixed number of cycles.
+type cycleCPU struct {
+	mem    *Memory
+	pc     int
+	per    int
+	cycles int
+}
+
+func (c *cycleCPU) Next()           { c.pc++; c.cycles += c.per }
+func (c *cycleCPU) PC() int         { return c.pc }
+func (c *cycleCPU) SetPC(pc int)    { c.pc = pc }
+func (c *cycleCPU) Offset() int     { return 0 }
+func (c *cycleCPU) Memory() *Memory { return c.mem }
+func (c *cycleCPU) Cycles() int     { return c.cycles }
+
+type countProc struct {
+	n int
+}
+
+func (p *countProc) Next() { p.n++ }
+
+func newCycleMach(clock int, cpus ...*cycleCPU) *Mach {
+	m := &Mach{Clock: clock}
+	names := []string{"cpu1", "cpu2", "cpu3"}
+	for i, cpu := range cpus {
+		m.Comps = append(m.Comps, NewComponent(names[i], "cpu", "", cpu))
+	}
+	return m
+}
+
+func TestMachFrameCycles(t *testing.T) {
+	cpu1 := &cycleCPU{per: 4}
+	cpu2 := &cycleCPU{per: 7}
+	proc := &countProc{}
+	m := newCycleMach(3072000, cpu1, cpu2)
+	m.Comps = append(m.Comps, NewComponent("proc", "proc", "", proc))
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	m.Status = Run
+	frame := 51210 // 3.072 MHz * 16.67 ms
+	for i := 1; i <= 3; i++ {
+		m.execute()
+		for _, cpu := range []*cycleCPU{cpu1, cpu2} {
+			have := cpu.cycles
+			min, max := frame*i, frame*i+cpu.per
+			if have < min || have >= max {
+				t.Errorf("frame %v: cycles %v not in [%v, %v)", i, have, min, max)
+			}
+		}
+	}
+	// processors are stepped once for each instruction of the CPU that
+	// executes the most instructions
+	have := proc.n
+	want := cpu1.pc
+	if have != want {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+}
+
+func TestMachBreakResume(t *testing.T) {
+	cpu := &cycleCPU{per: 4}
+	m := newCycleMach(3072000, cpu)
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	m.Status = Run
+	m.Breakpoints["cpu1"][100] = &Breakpoint{}
+	m.execute()
+	if m.Status != Break {
+		t.Fatalf("expected break")
+	}
+	if cpu.pc != 100 {
+		t.Fatalf("\n have: %v \n want: %v", cpu.pc, 100)
+	}
+	// the remainder of the frame is executed on resume
+	m.Status = Run
+	m.execute()
+	have := cpu.cycles
+	want := 51212
+	if have != want {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+}
+
+func TestMachInvalidClock(t *testing.T) {
+	m := newCycleMach(0, &cycleCPU{per: 1})
+	if err := m.Init(); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestMachRunFrames(t *testing.T) {
+	cpu := &cycleCPU{per: 4}
+	m := newCycleMach(3072000, cpu)
+	vblanks := 0
+	m.VBlankFunc = func() { vblanks++ }
+	if err := m.RunFrames(3); err != nil {
+		t.Fatal(err)
+	}
+	if vblanks != 3 || m.Frames() != 3 {
+		t.Errorf("\n have: %v vblanks, %v frames \n want: 3", vblanks, m.Frames())
+	}
+	min, max := 51210*3, 51210*3+4
+	if cpu.cycles < min || cpu.cycles >= max {
+		t.Errorf("cycles %v not in [%v, %v)", cpu.cycles, min, max)
+	}
+}
+
+func TestMachRunFramesBreak(t *testing.T) {
+	cpu := &cycleCPU{per: 4}
+	m := newCycleMach(3072000, cpu)
+	m.Init()
+	m.Breakpoints["cpu1"][20000] = &Breakpoint{}
+	err := m.RunFrames(3)
+	if err != ErrBreak {
+		t.Fatalf("\n have: %v \n want: %v", err, ErrBreak)
+	}
+	if cpu.pc != 20000 || m.Frames() != 1 {
+		t.Errorf("\n have: pc %v, frames %v \n want: pc 20000, frames 1", cpu.pc, m.Frames())
+	}
+}
+
+func TestMachBreakpointCond(t *testing.T) {
+	cpu := newRegCPU()
+	cpu.pc = 0
+	cpu.per = 4
+	m := &Mach{Clock: 3072000}
+	m.Comps = []Component{NewComponent("cpu1", "cpu", "", cpu)}
+	m.Init()
+	cond, err := CompileExpr("a == $42", cpu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Breakpoint{Cond: cond}
+	m.Breakpoints["cpu1"][100] = b
+	if err := m.RunFrames(1); err != nil {
+		t.Fatal(err)
+	}
+	if b.Hits != 0 {
+		t.Errorf("\n have: %v \n want: %v", b.Hits, 0)
+	}
+	cpu.pc = 0
+	cpu.a = 0x42
+	if err := m.RunFrames(1); err != ErrBreak {
+		t.Fatalf("\n have: %v \n want: %v", err, ErrBreak)
+	}
+	if cpu.pc != 100 || b.Hits != 1 {
+		t.Errorf("\n have: pc %v, hits %v \n want: pc 100, hits 1", cpu.pc, b.Hits)
+	}
+}
+
+func TestMachBreakpointIgnoreTemp(t *testing.T) {
+	cpu := &cycleCPU{per: 4}
+	m := newCycleMach(3072000, cpu)
+	m.Init()
+	b := &Breakpoint{Ignore: 1, Temp: true}
+	m.Breakpoints["cpu1"][100] = b
+	if err := m.RunFrames(1); err != nil {
+		t.Fatal(err)
+	}
+	if b.Hits != 1 || b.Ignore != 0 {
+		t.Errorf("\n have: hits %v, ignore %v \n want: hits 1, ignore 0", b.Hits, b.Ignore)
+	}
+	cpu.pc = 0
+	if err := m.RunFrames(1); err != ErrBreak {
+		t.Fatalf("\n have: %v \n want: %v", err, ErrBreak)
+	}
+	if b.Hits != 2 {
+		t.Errorf("\n have: %v \n want: %v", b.Hits, 2)
+	}
+	if _, ok := m.Breakpoints["cpu1"][100]; ok {
+		t.Errorf("temporary breakpoint not removed")
+	}
+}
+
+func TestMachRunUntil(t *testing.T) {
+	cpu := &cycleCPU{per: 4}
+	m := newCycleMach(3072000, cpu)
+	err := m.RunUntil(func() bool { return cpu.pc > 30000 }, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Frames() != 3 {
+		t.Errorf("\n have: %v \n want: %v", m.Frames(), 3)
+	}
+	err = m.RunUntil(func() bool { return false }, 2)
+	if err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestMachCall(t *testing.T) {
+	cpu := &cycleCPU{pc: 0x1234, per: 4}
+	mem := NewMemory(1, 0x10)
+	mem.MapRAM(0, []uint8{1, 2, 3, 4})
+	m := newCycleMach(3072000, cpu)
+	m.Comps = append(m.Comps, NewComponent("mem", "mem", "", mem))
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- m.Run() }()
+	for !m.Running() {
+		runtime.Gosched()
+	}
+
+	status, err := m.Call(MachStatus)
+	if err != nil || status != Pause {
+		t.Errorf("\n have: %v %v \n want: %v", status, err, Pause)
+	}
+	v, err := m.Call(MachReadCPU, "cpu1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := v.(*cycleCPU); !ok || c == cpu || c.pc != 0x1234 {
+		t.Errorf("expected copy of cpu: %v", v)
+	}
+	v, err = m.Call(MachReadMemory, "mem", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values := v.([]uint8); len(values) != 2 || values[0] != 2 || values[1] != 3 {
+		t.Errorf("\n have: %v \n want: [2 3]", values)
+	}
+
+	errTests := []struct {
+		cmd  MachCmd
+		args []interface{}
+		want string
+	}{
+		{MachReadCPU, []interface{}{"foo"}, "no such CPU: foo"},
+		{MachReadMemory, []interface{}{"mem", 0xf, 2}, "invalid range: $f, 2 bytes"},
+		{MachReadMemory, []interface{}{"mem", "0"}, "argument 2: expecting int but got string"},
+		{MachExport, nil, "missing argument 1"},
+		{MachCmd(-1), nil, "unknown command: -1"},
+	}
+	for _, test := range errTests {
+		_, err := m.Call(test.cmd, test.args...)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("\n have: %v \n want: %v", err, test.want)
+		}
+	}
+
+	if _, err := m.Call(MachQuit); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// handled directly once the machine is no longer running
+	if _, err := m.Call(MachStart); err != nil || m.Status != Run {
+		t.Errorf("\n have: %v %v \n want: %v", m.Status, err, Run)
+	}
+}
@@ -109,6 +109,8 @@ type Memory struct {
 	// read and write functions for the selected bank
 	read  []Load8
 	write []Store8
+
+	cover *coverage // nil unless coverage is enabled
 }
 
 // NewMemory creates a memory space of uint8 values that are addressable
@@ -146,18 +148,47 @@ func NewMemory(banks int, size int) *Memory {
 // Read returns the 8-bit value at the given address.
 func (m *Memory) Read(addr int) uint8 {
 	v := m.read[addr]()
+	if m.cover != nil && m.cover.active {
+		m.cover.flags[addr] |= CoverRead
+	}
+	return v
+}
+
+// Fetch returns the 8-bit value at the given address as part of the
+// instruction being executed. CPUs use it for the opcodes and operands
+// of instructions, and Read for everything else, so that coverage and
+// history know which values are code.
+func (m *Memory) Fetch(addr int) uint8 {
+	v := m.read[addr]()
+	if m.cover != nil && m.cover.active {
+		m.cover.fetch(addr, v)
+	}
 	return v
 }
 
+// Peek returns the 8-bit value at the given address without it being
+// seen as an access: watches are not triggered and coverage is not
+// recorded. Values mapped with MapLoad are still read through their
+// function.
+func (m *Memory) Peek(addr int) uint8 {
+	if prev := m.preads[m.bank][addr]; prev != nil {
+		return prev()
+	}
+	return m.read[addr]()
+}
+
 // Write sets the 8-bit value at the given address.
 func (m *Memory) Write(addr int, val uint8) {
 	m.write[addr](val)
+	if m.cover != nil && m.cover.active {
+		m.cover.flags[addr] |= CoverWrite
+	}
 }
 
 // WriteN sets multiple 8-bit values starting with the given address.
 func (m *Memory) WriteN(addr int, values ...uint8) {
 	for i, val := range values {
-		m.write[addr+i](val)
+		m.Write(addr+i, val)
 	}
 }
 
@@ -330,6 +361,26 @@ func (m *Memory) SetBank(bank int) {
 	m.write = m.writes[bank]
 }
 
+// Save encodes the selected bank. The contents of memory belong to the
+// system that maps it and are saved there.
+func (m *Memory) Save(enc *Encoder) {
+	enc.Encode(m.bank)
+}
+
+// Load decodes and selects the bank saved with Save.
+func (m *Memory) Load(dec *Decoder) {
+	var bank int
+	dec.Decode(&bank)
+	if dec.Err != nil {
+		return
+	}
+	if bank < 0 || bank >= m.NBank {
+		dec.Err = fmt.Errorf("invalid bank: %v", bank)
+		return
+	}
+	m.SetBank(bank)
+}
+
 func warnUnmappedRead(bank int, addr int) Load8 {
 	return func() uint8 {
 		log.Printf("unmapped memory read, bank %v, addr 0x%x", bank, addr)
@@ -242,6 +242,25 @@ func TestMemoryBank(t *testing.T) {
 	}
 }
 
+func TestMemoryPeek(t *testing.T) {
+	mem := NewMemory(1, 10)
+	mem.MapRAM(0, make([]uint8, 10, 10))
+	mem.Write(4, 44)
+	events := 0
+	mem.Callback = func(MemoryEvent) { events++ }
+	mem.WatchRO(4)
+	mem.EnableCoverage()
+	mem.beginInstruction()
+	have := mem.Peek(4)
+	mem.endInstruction()
+	if want := uint8(44); have != want {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+	if events != 0 || mem.Coverage(4) != 0 {
+		t.Errorf("access seen: %v events, coverage %v", events, mem.Coverage(4))
+	}
+}
+
 func TestMemoryMirror(t *testing.T) {
 	mem := NewMemory(1, 20)
 	ram := make([]uint8, 10, 10)
@@ -439,3 +458,24 @@ func TestLoadROMsChecksumError(t *testing.T) {
 		t.Errorf("expected error")
 	}
 }
+
+func TestMemorySaveLoad(t *testing.T) {
+	mem := NewMemory(4, 0x10)
+	mem.SetBank(2)
+	st := NewState("test", 1, nil)
+	if err := st.Put("mem", mem); err != nil {
+		t.Fatal(err)
+	}
+	mem2 := NewMemory(4, 0x10)
+	if err := st.Get("mem", mem2); err != nil {
+		t.Fatal(err)
+	}
+	if mem2.Bank() != 2 {
+		t.Errorf("\n have: %v \n want: %v", mem2.Bank(), 2)
+	}
+	err := st.Get("mem", NewMemory(2, 0x10))
+	want := "unable to load mem: invalid bank: 2"
+	if err == nil || err.Error() != want {
+		t.Errorf("\n have: %v \n want: %v", err, want)
+	}
+}
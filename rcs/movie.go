@@ -0,0 +1,297 @@
+package rcs
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// movieMagic starts every movie file.
+const movieMagic = "RCS-MOVIE\n"
+
+// MovieEvent is a change to the input that is applied after the given
+// number of frames have been completed since the start of the movie.
+type MovieEvent struct {
+	Frame int
+	Input InputEvent
+}
+
+// Movie is a recording of every change to the input of a machine. Since
+// emulation is deterministic, playing back the input from the same
+// starting point reproduces the original session.
+type Movie struct {
+	// Start is the state of the machine when recording started. When
+	// recording started at power-on, there are no sections and only the
+	// header is used to check that the movie is for the machine.
+	Start *State
+
+	// Frames is the length of the movie.
+	Frames int
+
+	Events []MovieEvent
+}
+
+// PowerOn returns true if the movie starts when the machine is turned
+// on instead of from a savestate.
+func (mv *Movie) PowerOn() bool {
+	return len(mv.Start.Sections) == 0
+}
+
+// WriteMovie writes the movie to w.
+func WriteMovie(w io.Writer, mv *Movie) error {
+	if _, err := io.WriteString(w, movieMagic); err != nil {
+		return err
+	}
+	return gob.NewEncoder(w).Encode(mv)
+}
+
+// ReadMovie reads a movie written with WriteMovie.
+func ReadMovie(r io.Reader) (*Movie, error) {
+	in := bufio.NewReader(r)
+	magic, err := in.Peek(len(movieMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if string(magic) != movieMagic {
+		return nil, errors.New("not a movie")
+	}
+	in.Discard(len(movieMagic))
+	mv := &Movie{}
+	if err := gob.NewDecoder(in).Decode(mv); err != nil {
+		return nil, fmt.Errorf("invalid movie: %v", err)
+	}
+	if mv.Start == nil {
+		return nil, errors.New("invalid movie: no starting state")
+	}
+	if mv.Start.Format > StateFormat {
+		return nil, fmt.Errorf("unsupported state format: %v", mv.Start.Format)
+	}
+	return mv, nil
+}
+
+// SaveMovie writes the movie to filename.
+func SaveMovie(filename string, mv *Movie) error {
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := WriteMovie(out, mv); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// LoadMovie reads a movie from filename.
+func LoadMovie(filename string) (*Movie, error) {
+	in, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	return ReadMovie(in)
+}
+
+type moviePlayer struct {
+	mv    *Movie
+	start int // frame count of the machine at the start of the movie
+	pos   int // index of the next event
+}
+
+type movieRecorder struct {
+	mv       *Movie
+	start    int
+	filename string
+}
+
+// StartMovie records each input sent with SendInput until StopMovie is
+// called and the movie is written to filename. If no frames have been run
+// yet, the movie starts at power-on. Otherwise, the current state is
+// saved and the movie starts from there.
+func (m *Mach) StartMovie(filename string) error {
+	if err := m.Init(); err != nil {
+		return err
+	}
+	if m.movieRec != nil {
+		return errors.New("already recording a movie")
+	}
+	if m.moviePlay != nil {
+		return errors.New("movie is playing")
+	}
+	start := NewState(m.Name, m.StateVersion, m.ROMs)
+	if m.frames > 0 {
+		st, err := m.SaveState()
+		if err != nil {
+			return err
+		}
+		start = st
+	}
+	m.movieRec = &movieRecorder{
+		mv:       &Movie{Start: start},
+		start:    m.frames,
+		filename: filename,
+	}
+	return nil
+}
+
+// StopMovie finishes the movie being recorded and writes it to the file.
+func (m *Mach) StopMovie() error {
+	if m.movieRec == nil {
+		return errors.New("not recording a movie")
+	}
+	r := m.movieRec
+	r.mv.Frames = m.frames - r.start
+	m.movieRec = nil
+	return SaveMovie(r.filename, r.mv)
+}
+
+// MovieRecording returns true if a movie is being recorded.
+func (m *Mach) MovieRecording() bool {
+	return m.movieRec != nil
+}
+
+// PlayMovie restores the starting state of the movie and sends its input
+// to the system as frames are executed. Input sent with SendInput is
+// ignored until the movie has finished. A movie that starts at power-on
+// can only be played before any frames have been run. When the movie
+// finishes, the machine is paused.
+func (m *Mach) PlayMovie(mv *Movie) error {
+	if err := m.Init(); err != nil {
+		return err
+	}
+	if m.movieRec != nil {
+		return errors.New("recording a movie")
+	}
+	if err := mv.Start.Check(m.Name, m.ROMs); err != nil {
+		return err
+	}
+	if mv.PowerOn() {
+		if m.frames > 0 {
+			return errors.New("movie starts at power-on")
+		}
+	} else {
+		if err := m.LoadState(mv.Start); err != nil {
+			return err
+		}
+		if m.rewind != nil {
+			m.rewind.Clear()
+		}
+	}
+	m.moviePlay = &moviePlayer{mv: mv, start: m.frames}
+	return nil
+}
+
+// MoviePlaying returns true if a movie is being played.
+func (m *Mach) MoviePlaying() bool {
+	return m.moviePlay != nil
+}
+
+// SendInput sends the input event to the system as if it came from the
+// host. The event is added to the movie being recorded and is ignored
+// while a movie is playing.
+func (m *Mach) SendInput(e InputEvent) error {
+	if m.moviePlay != nil {
+		return nil
+	}
+	if r := m.movieRec; r != nil {
+		r.mv.Events = append(r.mv.Events, MovieEvent{
+			Frame: m.frames - r.start,
+			Input: e,
+		})
+	}
+	return m.Input(e)
+}
+
+// playMovie sends the input from the movie for the next frame.
+func (m *Mach) playMovie() {
+	p := m.moviePlay
+	if p == nil {
+		return
+	}
+	frame := m.frames - p.start
+	for p.pos < len(p.mv.Events) && p.mv.Events[p.pos].Frame <= frame {
+		if err := m.Input(p.mv.Events[p.pos].Input); err != nil {
+			m.event(ErrorEvent, fmt.Sprintf("unable to handle input: %v", err))
+		}
+		p.pos++
+	}
+}
+
+// endMovie stops playback and pauses once the last frame of the movie
+// has been executed.
+func (m *Mach) endMovie() {
+	p := m.moviePlay
+	if p == nil || m.frames-p.start < p.mv.Frames {
+		return
+	}
+	m.moviePlay = nil
+	m.setStatus(Pause)
+}
+
+// checkRewindMovie returns an error if the frame being rewound to is
+// before the start of the movie being recorded or played.
+func (m *Mach) checkRewindMovie(frame int) error {
+	if r := m.movieRec; r != nil && frame < r.start {
+		return errors.New("unable to rewind past the start of the movie")
+	}
+	if p := m.moviePlay; p != nil && frame < p.start {
+		return errors.New("unable to rewind past the start of the movie")
+	}
+	return nil
+}
+
+// rewindMovie discards recorded input that comes after the frame being
+// rewound to, or moves playback back to it. The frame must have been
+// checked with checkRewindMovie.
+func (m *Mach) rewindMovie(frame int) {
+	if r := m.movieRec; r != nil {
+		events := r.mv.Events
+		n := len(events)
+		for n > 0 && events[n-1].Frame >= frame-r.start {
+			n--
+		}
+		r.mv.Events = events[:n]
+	}
+	if p := m.moviePlay; p != nil {
+		p.pos = 0
+		for p.pos < len(p.mv.Events) && p.mv.Events[p.pos].Frame < frame-p.start {
+			p.pos++
+		}
+	}
+}
+
+func (m *Mach) cmdMovieRecord(args ...interface{}) error {
+	filename, err := stringArg(args, 0)
+	if err != nil {
+		return err
+	}
+	if err := m.StartMovie(filename); err != nil {
+		return fmt.Errorf("unable to record movie: %v", err)
+	}
+	return nil
+}
+
+func (m *Mach) cmdMovieStop() error {
+	if err := m.StopMovie(); err != nil {
+		return fmt.Errorf("unable to stop movie: %v", err)
+	}
+	return nil
+}
+
+func (m *Mach) cmdMoviePlay(args ...interface{}) error {
+	filename, err := stringArg(args, 0)
+	if err != nil {
+		return err
+	}
+	mv, err := LoadMovie(filename)
+	if err != nil {
+		return fmt.Errorf("unable to play movie: %v", err)
+	}
+	if err := m.PlayMovie(mv); err != nil {
+		return fmt.Errorf("unable to play movie: %v", err)
+	}
+	return nil
+}
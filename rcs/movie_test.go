@@ -0,0 +1,198 @@
+package rcs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newMovieMach creates a machine where the system counts frames and
+// records the frame count each time a control is pressed.
+func newMovieMach() (*Mach, *stateComp) {
+	sys := &stateComp{}
+	m := newCycleMach(3072000, &cycleCPU{per: 4})
+	m.Name = "test"
+	m.ROMs = testROMs
+	m.Sys = sys
+	m.RewindInterval = 5
+	m.VBlankFunc = func() { sys.a++ }
+	m.Input = func(e InputEvent) error {
+		if e.Pressed {
+			sys.b = append(sys.b, sys.a)
+		}
+		return nil
+	}
+	return m, sys
+}
+
+func recordMovie(t *testing.T, m *Mach, before int) *Movie {
+	dir, err := ioutil.TempDir("", "rcs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "movie")
+
+	if err := m.RunFrames(before); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.StartMovie(filename); err != nil {
+		t.Fatal(err)
+	}
+	m.RunFrames(2)
+	m.SendInput(InputEvent{Control: Button1, Pressed: true})
+	m.RunFrames(3)
+	m.SendInput(InputEvent{Control: Button1, Pressed: false})
+	m.SendInput(InputEvent{Control: Button2, Pressed: true})
+	m.RunFrames(1)
+	if err := m.StopMovie(); err != nil {
+		t.Fatal(err)
+	}
+	mv, err := LoadMovie(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mv
+}
+
+func TestMoviePowerOn(t *testing.T) {
+	m1, sys1 := newMovieMach()
+	mv := recordMovie(t, m1, 0)
+	if !mv.PowerOn() || mv.Frames != 6 || len(mv.Events) != 3 {
+		t.Fatalf("unexpected movie: %+v", mv)
+	}
+	if mv.Events[2].Frame != 5 || mv.Events[2].Input.Control != Button2 {
+		t.Errorf("unexpected event: %+v", mv.Events[2])
+	}
+
+	m2, sys2 := newMovieMach()
+	if err := m2.PlayMovie(mv); err != nil {
+		t.Fatal(err)
+	}
+	m2.Status = Run
+	// ignored during playback
+	m2.SendInput(InputEvent{Control: Button1, Pressed: true})
+	if err := m2.RunFrames(6); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sys1.b, sys2.b) || sys2.a != 6 {
+		t.Errorf("\n have: %v %v \n want: %v %v", sys2.b, sys2.a, sys1.b, 6)
+	}
+	if m2.MoviePlaying() || m2.Status != Pause {
+		t.Errorf("movie did not end")
+	}
+
+	err := m2.PlayMovie(mv)
+	want := "movie starts at power-on"
+	if err == nil || err.Error() != want {
+		t.Errorf("\n have: %v \n want: %v", err, want)
+	}
+}
+
+func TestMovieFromState(t *testing.T) {
+	m1, sys1 := newMovieMach()
+	mv := recordMovie(t, m1, 4)
+	if mv.PowerOn() {
+		t.Fatalf("expected state")
+	}
+	m2, sys2 := newMovieMach()
+	if err := m2.RunFrames(20); err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.PlayMovie(mv); err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.RunFrames(mv.Frames); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sys1.b, sys2.b) || sys1.a != sys2.a {
+		t.Errorf("\n have: %v %v \n want: %v %v", sys2.b, sys2.a, sys1.b, sys1.a)
+	}
+}
+
+func TestMovieWrongSystem(t *testing.T) {
+	m1, _ := newMovieMach()
+	mv := recordMovie(t, m1, 0)
+	m2, _ := newMovieMach()
+	m2.Name = "other"
+	err := m2.PlayMovie(mv)
+	want := "state is for system test, not other"
+	if err == nil || err.Error() != want {
+		t.Errorf("\n have: %v \n want: %v", err, want)
+	}
+}
+
+func TestMovieRewind(t *testing.T) {
+	m, sys := newMovieMach()
+	if err := m.StartMovie("unused"); err != nil {
+		t.Fatal(err)
+	}
+	m.RunFrames(6)
+	m.SendInput(InputEvent{Control: Button1, Pressed: true})
+	m.RunFrames(6)
+	m.SendInput(InputEvent{Control: Button2, Pressed: true})
+	// back to frame 10, after the first press
+	if _, err := m.Rewind(2); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.movieRec.mv.Events) != 1 || !bytes.Equal(sys.b, []uint8{6}) {
+		t.Errorf("unexpected events: %+v", m.movieRec.mv.Events)
+	}
+	// back to frame 5, before the first press
+	if _, err := m.Rewind(5); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.movieRec.mv.Events) != 0 {
+		t.Errorf("unexpected events: %+v", m.movieRec.mv.Events)
+	}
+}
+
+func TestMovieRewindFailed(t *testing.T) {
+	m, _ := newMovieMach()
+	if err := m.StartMovie("unused"); err != nil {
+		t.Fatal(err)
+	}
+	m.RunFrames(6)
+	m.SendInput(InputEvent{Control: Button1, Pressed: true})
+	m.RunFrames(6)
+	m.SendInput(InputEvent{Control: Button2, Pressed: true})
+	st, _, _ := m.rewind.Find(10)
+	st.Sections[SystemSection] = nil
+	if _, err := m.Rewind(2); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(m.movieRec.mv.Events) != 2 {
+		t.Errorf("unexpected events: %+v", m.movieRec.mv.Events)
+	}
+}
+
+func TestMovieImport(t *testing.T) {
+	m, _ := newMovieMach()
+	m.RunFrames(4)
+	var buf bytes.Buffer
+	if err := m.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.StartMovie("unused"); err != nil {
+		t.Fatal(err)
+	}
+	m.RunFrames(2)
+	err := m.Import(bytes.NewReader(buf.Bytes()))
+	want := "recording a movie"
+	if err == nil || err.Error() != want {
+		t.Errorf("\n have: %v \n want: %v", err, want)
+	}
+	if m.frames != 6 {
+		t.Errorf("\n have: %v \n want: %v", m.frames, 6)
+	}
+}
+
+func TestReadMovieInvalid(t *testing.T) {
+	_, err := ReadMovie(bytes.NewReader([]byte("RCS-STATE\n")))
+	want := "not a movie"
+	if err == nil || err.Error() != want {
+		t.Errorf("\n have: %v \n want: %v", err, want)
+	}
+}
@@ -119,3 +119,15 @@ func (n *N06XX) Next() {
 		}
 	}
 }
+
+func (n *N06XX) Save(enc *rcs.Encoder) {
+	enc.Encode(n.ctrl)
+	enc.Encode(n.elapsed)
+	enc.Encode(n.timing)
+}
+
+func (n *N06XX) Load(dec *rcs.Decoder) {
+	dec.Decode(&n.ctrl)
+	dec.Decode(&n.elapsed)
+	dec.Decode(&n.timing)
+}
@@ -1,6 +1,10 @@
 package namco
 
-import "log"
+import (
+	"log"
+
+	"github.com/blackchip-org/retro-cs/rcs"
+)
 
 type N51XX struct {
 	WatchR bool
@@ -23,3 +27,10 @@ func (n *N51XX) Read() uint8 {
 	}
 	return 0
 }
+
+// Save does nothing as the N51XX is not emulated and has no state. It is
+// provided so that the component is included in savestates.
+func (n *N51XX) Save(enc *rcs.Encoder) {}
+
+// Load does nothing as the N51XX has no state.
+func (n *N51XX) Load(dec *rcs.Decoder) {}
@@ -2,10 +2,10 @@ package namco
 
 import (
 	"fmt"
+	"image"
 	"image/color"
 
 	"github.com/blackchip-org/retro-cs/rcs"
-	"github.com/veandco/go-sdl2/sdl"
 )
 
 type Data struct {
@@ -40,7 +40,6 @@ type Video struct {
 	TileMemory     []uint8
 	ColorMemory    []uint8
 
-	Texture  *sdl.Texture
 	config   Config
 	tiles    [64]rcs.TileSheet
 	sprites  [64]rcs.TileSheet
@@ -48,23 +47,19 @@ type Video struct {
 	palettes [][]color.RGBA
 }
 
-func NewVideo(r *sdl.Renderer, config Config, data Data) (*Video, error) {
-	tex, err := r.CreateTexture(sdl.PIXELFORMAT_RGBA8888, sdl.TEXTUREACCESS_TARGET, W, H)
-	if err != nil {
-		return nil, err
-	}
+func NewVideo(config Config, data Data) (*Video, error) {
 	colors := ColorTable(config, data.Colors)
 	palettes := PaletteTable(config, data.Palettes, colors)
 
 	var tiles, sprites [64]rcs.TileSheet
 	for pal := 0; pal < config.PaletteEntries; pal++ {
-		t, err := NewTileSheet(r, data.Tiles, config.TileLayout, palettes[pal])
+		t, err := NewTileSheet(data.Tiles, config.TileLayout, palettes[pal])
 		if err != nil {
 			return nil, err
 		}
 		tiles[pal] = t
 
-		s, err := NewTileSheet(r, data.Sprites, config.SpriteLayout, palettes[pal])
+		s, err := NewTileSheet(data.Sprites, config.SpriteLayout, palettes[pal])
 		if err != nil {
 			return nil, err
 		}
@@ -72,7 +67,6 @@ func NewVideo(r *sdl.Renderer, config Config, data Data) (*Video, error) {
 	}
 
 	v := &Video{
-		Texture:        tex,
 		SpriteCoords:   make([]SpriteCoord, 8, 8),
 		SpriteInfo:     make([]uint8, 8, 8),
 		SpritePalettes: make([]uint8, 8, 8),
@@ -87,21 +81,14 @@ func NewVideo(r *sdl.Renderer, config Config, data Data) (*Video, error) {
 	return v, nil
 }
 
-func (v *Video) Draw(r *sdl.Renderer) error {
-	r.SetRenderTarget(v.Texture)
-	r.SetDrawColorArray(0, 0, 0, 0xff)
-	r.Clear()
-	v.drawTiles(r)
-	v.drawSprites(r)
-	r.SetRenderTarget(nil)
+func (v *Video) Draw(img *image.RGBA) error {
+	rcs.FillRect(img, img.Rect, color.RGBA{0, 0, 0, 0xff})
+	v.drawTiles(img)
+	v.drawSprites(img)
 	return nil
 }
 
-func (v *Video) drawTiles(r *sdl.Renderer) error {
-	layout := v.config.TileLayout
-	tileW := layout.TileW
-	rowTiles := layout.TextureW / tileW
-
+func (v *Video) drawTiles(img *image.RGBA) error {
 	// Render tiles
 	for ty := 0; ty < 36; ty++ {
 		for tx := 0; tx < 28; tx++ {
@@ -114,33 +101,20 @@ func (v *Video) drawTiles(r *sdl.Renderer) error {
 				addr = 0x3a0 + (ty - 2) - (tx * 0x20)
 			}
 
-			tileN := int32(v.TileMemory[addr])
-			sheetX := (tileN % rowTiles) * tileW
-			sheetY := (tileN / rowTiles) * tileW
-			src := sdl.Rect{
-				X: int32(sheetX),
-				Y: int32(sheetY),
-				W: int32(layout.TileW),
-				H: int32(layout.TileH),
-			}
-			screenX := int32(tx) * 8
-			screenY := int32(ty) * 8
-			dest := sdl.Rect{
-				X: screenX,
-				Y: screenY,
-				W: layout.TileW,
-				H: layout.TileH,
-			}
+			tileN := int(v.TileMemory[addr])
+			screenX := tx * 8
+			screenY := ty * 8
 
 			// Only 64 palettes, strip out the higher bits
 			pal := v.ColorMemory[addr] & 0x3f
-			r.Copy(v.tiles[pal].Texture, &src, &dest)
+			sheet := v.tiles[pal]
+			rcs.DrawTile(img, sheet.Image, sheet.Tile(tileN), screenX, screenY, rcs.FlipNone)
 		}
 	}
 	return nil
 }
 
-func (v *Video) drawSprites(r *sdl.Renderer) error {
+func (v *Video) drawSprites(img *image.RGBA) error {
 	// FIXME: Galaga testing
 	if v.config.Hack {
 		return nil
@@ -148,19 +122,18 @@ func (v *Video) drawSprites(r *sdl.Renderer) error {
 	layout := v.config.SpriteLayout
 	spriteW := layout.TileW
 	spriteH := layout.TileH
-	rowTiles := layout.TextureW / spriteW
 
 	for s := 7; s >= 0; s-- {
 		coordX := int32(v.SpriteCoords[s].X)
 		coordY := int32(v.SpriteCoords[s].Y)
 		info := v.SpriteInfo[s]
-		spriteN := int32(info >> 2)
-		flip := sdl.FLIP_NONE
+		spriteN := int(info >> 2)
+		flip := rcs.FlipNone
 		if info&0x02 > 0 {
-			flip |= sdl.FLIP_HORIZONTAL
+			flip |= rcs.FlipHorizontal
 		}
 		if info&0x01 > 0 {
-			flip |= sdl.FLIP_VERTICAL
+			flip |= rcs.FlipVertical
 		}
 
 		// do not render of off screen
@@ -169,23 +142,10 @@ func (v *Video) drawSprites(r *sdl.Renderer) error {
 		}
 		screenX := (W - coordX + spriteW)
 		screenY := (H - coordY - spriteH)
-		sheetX := (spriteN % rowTiles) * spriteW
-		sheetY := (spriteN / rowTiles) * spriteH
-		src := sdl.Rect{
-			X: int32(sheetX),
-			Y: int32(sheetY),
-			W: spriteW,
-			H: spriteH,
-		}
-		dest := sdl.Rect{
-			X: screenX,
-			Y: screenY,
-			W: spriteW,
-			H: spriteH,
-		}
 		// Only 64 palettes, strip out the higher bits
 		pal := v.SpritePalettes[s] & 0x3f
-		r.CopyEx(v.sprites[pal].Texture, &src, &dest, 0, nil, flip)
+		sheet := v.sprites[pal]
+		rcs.DrawTile(img, sheet.Image, sheet.Tile(spriteN), int(screenX), int(screenY), flip)
 	}
 	return nil
 }
@@ -193,11 +153,33 @@ func (v *Video) drawSprites(r *sdl.Renderer) error {
 func (v *Video) Save(enc *rcs.Encoder) {
 	enc.Encode(v.TileMemory)
 	enc.Encode(v.ColorMemory)
+
+	coords := make([]uint8, 0, len(v.SpriteCoords)*2)
+	for _, c := range v.SpriteCoords {
+		coords = append(coords, c.X, c.Y)
+	}
+	enc.Encode(coords)
+	enc.Encode(v.SpriteInfo)
+	enc.Encode(v.SpritePalettes)
 }
 
 func (v *Video) Load(enc *rcs.Decoder) {
 	enc.Decode(&v.TileMemory)
 	enc.Decode(&v.ColorMemory)
+
+	// Sprite registers are mapped into memory by address so copy the
+	// values into the existing slices instead of replacing them.
+	var coords, info, palettes []uint8
+	enc.Decode(&coords)
+	enc.Decode(&info)
+	enc.Decode(&palettes)
+	for i := range v.SpriteCoords {
+		if i*2+1 < len(coords) {
+			v.SpriteCoords[i] = SpriteCoord{X: coords[i*2], Y: coords[i*2+1]}
+		}
+	}
+	copy(v.SpriteInfo, info)
+	copy(v.SpritePalettes, palettes)
 }
 
 var ViewerPalette = []color.RGBA{
@@ -217,13 +199,12 @@ type SheetLayout struct {
 	PixelReader  func([]byte, int, int) uint8
 }
 
-func NewTileSheet(r *sdl.Renderer, d []byte, l SheetLayout, pal []color.RGBA) (rcs.TileSheet, error) {
-	t, err := r.CreateTexture(sdl.PIXELFORMAT_RGBA8888,
-		sdl.TEXTUREACCESS_TARGET, l.TextureW, l.TextureH)
-	if err != nil {
-		return rcs.TileSheet{}, fmt.Errorf("unable to create sheet: %v", err)
+func NewTileSheet(d []byte, l SheetLayout, pal []color.RGBA) (rcs.TileSheet, error) {
+	need := int((l.TextureW / l.TileW) * (l.TextureH / l.TileH) * l.BytesPerCell)
+	if len(d) < need {
+		return rcs.TileSheet{}, fmt.Errorf("unable to create sheet: expected %v bytes but have %v", need, len(d))
 	}
-	r.SetRenderTarget(t)
+	img := image.NewRGBA(image.Rect(0, 0, int(l.TextureW), int(l.TextureH)))
 
 	rowTiles := l.TextureW / l.TileW
 	for i := int32(0); i < l.TextureW*l.TextureH; i++ {
@@ -238,19 +219,15 @@ func NewTileSheet(r *sdl.Renderer, d []byte, l SheetLayout, pal []color.RGBA) (r
 		pixelN := int(l.PixelLayout[offsetY][offsetX])
 		value := l.PixelReader(d, baseAddr, pixelN)
 
-		c := pal[value]
-		r.SetDrawColor(c.R, c.G, c.B, c.A)
-		r.DrawPoint(targetX, targetY)
+		img.SetRGBA(int(targetX), int(targetY), pal[value])
 	}
-	t.SetBlendMode(sdl.BLENDMODE_BLEND)
-	r.SetRenderTarget(nil)
 
 	return rcs.TileSheet{
 		TextureW: l.TextureW,
 		TextureH: l.TextureH,
 		TileW:    l.TileW,
 		TileH:    l.TileH,
-		Texture:  t,
+		Image:    img,
 	}, nil
 }
 
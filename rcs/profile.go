@@ -0,0 +1,125 @@
+package rcs
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// ProfileEntry is the number of times the instruction at an address was
+// executed by a CPU while profiling and the number of cycles consumed.
+// Cycles used to handle an interrupt are included with the instruction
+// that was executed before the interrupt was taken.
+type ProfileEntry struct {
+	CPU    string // Name of the CPU
+	Addr   int    // Address of the instruction
+	Count  int    // Number of times executed
+	Cycles int    // Number of cycles consumed
+}
+
+// cpuProfile holds the counts, indexed by address, for a single CPU.
+type cpuProfile struct {
+	counts []int
+	cycles []int
+}
+
+func newCPUProfile(cpu CPU) *cpuProfile {
+	size := 0x10000
+	if mem := cpu.Memory(); mem != nil {
+		size = mem.MaxAddr + 1
+	}
+	return &cpuProfile{
+		counts: make([]int, size),
+		cycles: make([]int, size),
+	}
+}
+
+func (p *cpuProfile) add(addr int, cycles int) {
+	if addr < 0 || addr >= len(p.counts) {
+		return
+	}
+	p.counts[addr]++
+	p.cycles[addr] += cycles
+}
+
+// StartProfile starts counting the instructions executed by each CPU.
+// Counts from a previous profile are kept until ResetProfile is used.
+// Must be called from the machine goroutine or while the machine is not
+// running.
+func (m *Mach) StartProfile() error {
+	if err := m.Init(); err != nil {
+		return err
+	}
+	if m.profile == nil {
+		m.ResetProfile()
+	}
+	m.profiling = true
+	return nil
+}
+
+// StopProfile stops counting instructions. The counts are kept.
+func (m *Mach) StopProfile() {
+	m.profiling = false
+}
+
+// Profiling returns true if instructions are being counted.
+func (m *Mach) Profiling() bool {
+	return m.profiling
+}
+
+// ResetProfile discards all counts.
+func (m *Mach) ResetProfile() {
+	m.Init()
+	m.profile = make(map[string]*cpuProfile)
+	for _, name := range m.cpuNames {
+		m.profile[name] = newCPUProfile(m.CPU[name])
+	}
+}
+
+// Profile returns the addresses of all instructions that have been counted
+// with the most executed first.
+func (m *Mach) Profile() []ProfileEntry {
+	var list []ProfileEntry
+	for _, name := range m.cpuNames {
+		p, ok := m.profile[name]
+		if !ok {
+			continue
+		}
+		for addr, count := range p.counts {
+			if count > 0 {
+				list = append(list, ProfileEntry{
+					CPU:    name,
+					Addr:   addr,
+					Count:  count,
+					Cycles: p.cycles[addr],
+				})
+			}
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Count > list[j].Count
+	})
+	return list
+}
+
+// WriteProfile writes the profile to w in CSV format with a header line.
+// Each line has the name of the CPU, the address in hex, the number of
+// times executed, the number of cycles, and the symbol for the address,
+// if known.
+func (m *Mach) WriteProfile(w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"cpu", "addr", "count", "cycles", "symbol"})
+	for _, e := range m.Profile() {
+		out.Write([]string{
+			e.CPU,
+			fmt.Sprintf("%04x", e.Addr),
+			strconv.Itoa(e.Count),
+			strconv.Itoa(e.Cycles),
+			m.Symbols[e.CPU].Lookup(e.Addr),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
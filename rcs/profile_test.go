@@ -0,0 +1,101 @@
+package rcs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// loopCPU is a cycleCPU that jumps back to $01 after executing the
+// instruction at $03.
+type loopCPU struct {
+	cycleCPU
+}
+
+func (c *loopCPU) Next() {
+	c.cycleCPU.Next()
+	if c.pc == 4 {
+		c.pc = 1
+	}
+}
+
+func newProfileMach() (*Mach, *loopCPU) {
+	cpu := &loopCPU{}
+	cpu.per = 4
+	m := &Mach{Clock: 3072000}
+	m.Comps = []Component{NewComponent("cpu1", "cpu", "", cpu)}
+	return m, cpu
+}
+
+func TestProfile(t *testing.T) {
+	m, cpu := newProfileMach()
+	if err := m.StartProfile(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RunFrames(1); err != nil {
+		t.Fatal(err)
+	}
+	m.StopProfile()
+	list := m.Profile()
+	if len(list) != 4 {
+		t.Fatalf("\n have: %+v \n want: 4 entries", list)
+	}
+	total := 0
+	for i, e := range list {
+		total += e.Count
+		if e.Cycles != e.Count*cpu.per {
+			t.Errorf("$%02x: cycles %v for count %v", e.Addr, e.Cycles, e.Count)
+		}
+		if i < 3 && (e.Addr != i+1 || e.Count < list[3].Count) {
+			t.Errorf("unexpected entry %v: %+v", i, e)
+		}
+	}
+	if list[3].Addr != 0 || list[3].Count != 1 {
+		t.Errorf("\n have: %+v \n want: $00 once", list[3])
+	}
+	if total != cpu.cycles/cpu.per {
+		t.Errorf("\n have: %v \n want: %v", total, cpu.cycles/cpu.per)
+	}
+
+	// stopped
+	if err := m.RunFrames(1); err != nil {
+		t.Fatal(err)
+	}
+	if have := m.Profile()[0].Count; have != list[0].Count {
+		t.Errorf("\n have: %v \n want: %v", have, list[0].Count)
+	}
+
+	m.ResetProfile()
+	if have := m.Profile(); len(have) != 0 {
+		t.Errorf("unexpected entries: %+v", have)
+	}
+}
+
+func TestWriteProfile(t *testing.T) {
+	m, _ := newProfileMach()
+	m.StartProfile()
+	m.Symbols["cpu1"] = Symbols{0x01: "LOOP"}
+	if err := m.RunFrames(1); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := m.WriteProfile(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("\n have: %v \n want: 5 lines", lines)
+	}
+	if lines[0] != "cpu,addr,count,cycles,symbol" {
+		t.Errorf("unexpected header: %v", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "cpu1,0001,") || !strings.HasSuffix(lines[1], ",LOOP") {
+		t.Errorf("unexpected line: %v", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], ",LOOP+$1") {
+		t.Errorf("unexpected line: %v", lines[2])
+	}
+	if lines[4] != "cpu1,0000,1,4," {
+		t.Errorf("unexpected line: %v", lines[4])
+	}
+}
@@ -123,11 +123,13 @@ var ASCIIDecoder = func(code uint8) (rune, bool) {
 }
 
 // SDLContext contains the window for rendering and the audio specs
-// available for use.
+// available for use. Audio is played on the SDL audio device unless
+// an AudioSink is provided.
 type SDLContext struct {
 	Window    *sdl.Window
 	Renderer  *sdl.Renderer
 	AudioSpec sdl.AudioSpec
+	AudioSink AudioSink
 }
 
 type Encoder struct {
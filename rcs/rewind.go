@@ -0,0 +1,156 @@
+package rcs
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// DefaultRewindInterval is the number of frames between snapshots
+	// when Mach.RewindInterval is not set, about one second.
+	DefaultRewindInterval = 60
+
+	// DefaultRewindSnapshots is the number of snapshots kept when
+	// Mach.RewindSnapshots is not set.
+	DefaultRewindSnapshots = 30
+)
+
+type snapshot struct {
+	frame int
+	st    *State
+}
+
+// Rewind is a ring buffer of snapshots of a machine. Once the buffer is
+// full, adding a snapshot replaces the oldest one.
+type Rewind struct {
+	snaps []snapshot
+	start int // index of the oldest snapshot
+	n     int // number of snapshots in the buffer
+}
+
+// NewRewind creates a buffer that holds up to size snapshots.
+func NewRewind(size int) *Rewind {
+	return &Rewind{snaps: make([]snapshot, size, size)}
+}
+
+// Len is the number of snapshots in the buffer.
+func (r *Rewind) Len() int {
+	return r.n
+}
+
+// Push adds the state that was saved at the given frame.
+func (r *Rewind) Push(frame int, st *State) {
+	if len(r.snaps) == 0 {
+		return
+	}
+	if r.n < len(r.snaps) {
+		r.snaps[(r.start+r.n)%len(r.snaps)] = snapshot{frame: frame, st: st}
+		r.n++
+		return
+	}
+	r.snaps[r.start] = snapshot{frame: frame, st: st}
+	r.start = (r.start + 1) % len(r.snaps)
+}
+
+// Find returns the most recent snapshot that was saved at or before the
+// given frame along with the frame it was saved at. If there is no such
+// snapshot, false is returned.
+func (r *Rewind) Find(frame int) (*State, int, bool) {
+	for i := r.n - 1; i >= 0; i-- {
+		s := r.snaps[(r.start+i)%len(r.snaps)]
+		if s.frame <= frame {
+			return s.st, s.frame, true
+		}
+	}
+	return nil, 0, false
+}
+
+// Truncate removes the snapshots saved after the given frame.
+func (r *Rewind) Truncate(frame int) {
+	for r.n > 0 {
+		i := (r.start + r.n - 1) % len(r.snaps)
+		if r.snaps[i].frame <= frame {
+			return
+		}
+		r.snaps[i] = snapshot{}
+		r.n--
+	}
+}
+
+// Clear removes all snapshots.
+func (r *Rewind) Clear() {
+	for i := range r.snaps {
+		r.snaps[i] = snapshot{}
+	}
+	r.start = 0
+	r.n = 0
+}
+
+// snapshot saves the state into the rewind buffer if it is time to do so.
+// Rewinding is disabled if the state cannot be saved.
+func (m *Mach) snapshot() {
+	if m.rewind == nil || m.frames%m.RewindInterval != 0 {
+		return
+	}
+	st, err := m.SaveState()
+	if err != nil {
+		m.event(ErrorEvent, fmt.Sprintf("unable to save snapshot, rewind disabled: %v", err))
+		m.rewind = nil
+		return
+	}
+	m.rewind.Push(m.frames, st)
+}
+
+// Rewind restores the machine to the most recent snapshot taken at least
+// the given number of frames ago. The snapshots that come after it are
+// discarded along with any input recorded for a movie. The number of
+// frames actually rewound is returned which is only exact when it falls
+// on a snapshot.
+func (m *Mach) Rewind(frames int) (int, error) {
+	if err := m.Init(); err != nil {
+		return 0, err
+	}
+	if m.rewind == nil {
+		return 0, errors.New("rewind is not supported")
+	}
+	if frames < 0 {
+		return 0, fmt.Errorf("invalid number of frames: %v", frames)
+	}
+	st, frame, ok := m.rewind.Find(m.frames - frames)
+	if !ok {
+		return 0, fmt.Errorf("no snapshot %v frames ago", frames)
+	}
+	now := m.frames
+	if err := m.checkRewindMovie(frame); err != nil {
+		return 0, err
+	}
+	if err := m.LoadState(st); err != nil {
+		return 0, err
+	}
+	// input is only discarded once the state is restored
+	m.rewindMovie(frame)
+	m.rewind.Truncate(frame)
+	return now - frame, nil
+}
+
+// rewindKey rewinds by one snapshot interval.
+func (m *Mach) rewindKey() {
+	if _, err := m.cmdRewind(m.RewindInterval); err != nil {
+		m.event(ErrorEvent, err)
+	}
+}
+
+// cmdRewind rewinds and pauses the machine. The number of frames actually
+// rewound is returned.
+func (m *Mach) cmdRewind(args ...interface{}) (interface{}, error) {
+	frames, err := intArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	n, err := m.Rewind(frames)
+	if err != nil {
+		return nil, fmt.Errorf("unable to rewind: %v", err)
+	}
+	m.setStatus(Pause)
+	return n, nil
+}
@@ -0,0 +1,71 @@
+package rcs
+
+import (
+	"testing"
+)
+
+func TestRewindRing(t *testing.T) {
+	r := NewRewind(3)
+	for frame := 10; frame <= 50; frame += 10 {
+		r.Push(frame, &State{StateHeader: StateHeader{Version: frame}})
+	}
+	if r.Len() != 3 {
+		t.Fatalf("\n have: %v \n want: %v", r.Len(), 3)
+	}
+	// 10 and 20 were replaced
+	if _, _, ok := r.Find(29); ok {
+		t.Errorf("expected no snapshot")
+	}
+	st, frame, ok := r.Find(45)
+	if !ok || frame != 40 || st.Version != 40 {
+		t.Errorf("\n have: %v %v \n want: %v %v", frame, ok, 40, true)
+	}
+	r.Truncate(35)
+	if _, frame, _ := r.Find(100); frame != 30 || r.Len() != 1 {
+		t.Errorf("\n have: %v %v \n want: %v %v", frame, r.Len(), 30, 1)
+	}
+	r.Push(60, &State{})
+	if _, frame, _ := r.Find(100); frame != 60 || r.Len() != 2 {
+		t.Errorf("\n have: %v %v \n want: %v %v", frame, r.Len(), 60, 2)
+	}
+}
+
+func TestRewind(t *testing.T) {
+	sys := &stateComp{}
+	m := newCycleMach(3072000, &cycleCPU{per: 4})
+	m.Sys = sys
+	m.RewindInterval = 10
+	m.RewindSnapshots = 4
+	m.VBlankFunc = func() { sys.a++ }
+	if err := m.RunFrames(55); err != nil {
+		t.Fatal(err)
+	}
+	n, err := m.Rewind(22)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 25 || m.Frames() != 30 || sys.a != 30 {
+		t.Errorf("\n have: %v %v %v \n want: %v %v %v", n, m.Frames(), sys.a, 25, 30, 30)
+	}
+	// snapshots at 20 and 30 remain, 10 was replaced
+	if _, err := m.Rewind(10); err != nil {
+		t.Fatal(err)
+	}
+	if m.Frames() != 20 || sys.a != 20 {
+		t.Errorf("\n have: %v %v \n want: %v %v", m.Frames(), sys.a, 20, 20)
+	}
+	_, err = m.Rewind(5)
+	want := "no snapshot 5 frames ago"
+	if err == nil || err.Error() != want {
+		t.Errorf("\n have: %v \n want: %v", err, want)
+	}
+}
+
+func TestRewindNotSupported(t *testing.T) {
+	m := newCycleMach(3072000, &cycleCPU{per: 4})
+	_, err := m.Rewind(10)
+	want := "rewind is not supported"
+	if err == nil || err.Error() != want {
+		t.Errorf("\n have: %v \n want: %v", err, want)
+	}
+}
@@ -0,0 +1,98 @@
+package rcs
+
+import (
+	"io"
+	"os"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// AudioSink receives the audio generated by a Synth. The data written to
+// the sink is 16-bit signed little endian samples with the two channels
+// interleaved.
+//
+// The synth generates audio once per frame. Request is called before
+// each write to find out how many samples the sink would like.
+// A frame is perFrame samples long and sinks that are not played in real
+// time should return this value.
+type AudioSink interface {
+	io.WriteCloser
+	Request(perFrame int) int
+}
+
+// SDLSink queues audio for playback on the SDL audio device. Enough
+// samples are requested to keep the device buffer full.
+type SDLSink struct {
+	size int
+}
+
+// NewSDLSink creates a sink for the audio device opened with spec.
+func NewSDLSink(spec sdl.AudioSpec) *SDLSink {
+	return &SDLSink{size: int(spec.Samples) * Buffer}
+}
+
+func (s *SDLSink) Request(perFrame int) int {
+	q := sdl.GetQueuedAudioSize(1) / 4
+	return s.size - int(q)
+}
+
+func (s *SDLSink) Write(data []byte) (int, error) {
+	if err := sdl.QueueAudio(1, data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (s *SDLSink) Close() error {
+	return nil
+}
+
+// NullSink discards all audio. Samples are still generated at the normal
+// rate.
+type NullSink struct{}
+
+func NewNullSink() NullSink {
+	return NullSink{}
+}
+
+func (s NullSink) Request(perFrame int) int       { return perFrame }
+func (s NullSink) Write(data []byte) (int, error) { return len(data), nil }
+func (s NullSink) Close() error                   { return nil }
+
+// WAVSink writes audio to a WAV file.
+type WAVSink struct {
+	out *os.File
+	wav *WAVWriter
+}
+
+// NewWAVSink creates filename to store stereo audio that is sampled at the
+// rate given in hertz.
+func NewWAVSink(filename string, rate int) (*WAVSink, error) {
+	out, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	wav, err := NewWAVWriter(out, rate, Channels)
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	return &WAVSink{out: out, wav: wav}, nil
+}
+
+func (s *WAVSink) Request(perFrame int) int {
+	return perFrame
+}
+
+func (s *WAVSink) Write(data []byte) (int, error) {
+	return s.wav.Write(data)
+}
+
+// Close updates the WAV header and closes the file.
+func (s *WAVSink) Close() error {
+	if err := s.wav.Close(); err != nil {
+		s.out.Close()
+		return err
+	}
+	return s.out.Close()
+}
@@ -0,0 +1,225 @@
+package rcs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// stateMagic starts every savestate file. Files without it were written
+// before the container format existed.
+const stateMagic = "RCS-STATE\n"
+
+// StateFormat is the version of the savestate container.
+const StateFormat = 1
+
+// LegacySection is the name of the only section in a state that was
+// written before the container format existed. It contains the bare gob
+// stream produced by the system's Save method and has a version of zero.
+const LegacySection = "legacy"
+
+// SystemSection is the name of the section that holds the state of
+// Mach.Sys when it is not also one of the components.
+const SystemSection = "system"
+
+// MachSection is the name of the section that holds the frame timing of
+// the machine itself.
+const MachSection = "mach"
+
+// StateHeader describes the contents of a savestate.
+type StateHeader struct {
+	Format  int               // Version of the container
+	System  string            // Name of the system, "pacman"
+	Version int               // Version of the system state
+	ROMs    map[string]string // SHA1 checksums indexed by ROM file name
+}
+
+// State is a savestate of a machine. The state of each component is
+// kept in its own named section so that the data for one component does
+// not depend on the data for another.
+type State struct {
+	StateHeader
+	Sections map[string][]byte
+}
+
+// NewState creates an empty state with the header filled in using the
+// system name, state version, and ROM set.
+func NewState(system string, version int, roms []ROM) *State {
+	st := &State{
+		StateHeader: StateHeader{
+			Format:  StateFormat,
+			System:  system,
+			Version: version,
+			ROMs:    make(map[string]string),
+		},
+		Sections: make(map[string][]byte),
+	}
+	for _, rom := range roms {
+		st.ROMs[rom.File] = rom.Checksum
+	}
+	return st
+}
+
+// Put saves s into the section with the given name.
+func (st *State) Put(name string, s Saver) error {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	s.Save(enc)
+	if enc.Err != nil {
+		return fmt.Errorf("unable to save %v: %v", name, enc.Err)
+	}
+	st.Sections[name] = buf.Bytes()
+	return nil
+}
+
+// Get loads l from the section with the given name.
+func (st *State) Get(name string, l Loader) error {
+	data, ok := st.Sections[name]
+	if !ok {
+		return fmt.Errorf("missing section: %v", name)
+	}
+	dec := NewDecoder(bytes.NewReader(data))
+	l.Load(dec)
+	if dec.Err != nil {
+		return fmt.Errorf("unable to load %v: %v", name, dec.Err)
+	}
+	return nil
+}
+
+// Extend migrates a section that was saved before new values were
+// appended to the end of its encoding. The section is loaded into c,
+// values missing at the end keep the defaults already set in c, and the
+// section is saved again with the current encoding.
+func (st *State) Extend(name string, c interface {
+	Saver
+	Loader
+}) error {
+	data, ok := st.Sections[name]
+	if !ok {
+		return fmt.Errorf("missing section: %v", name)
+	}
+	dec := NewDecoder(bytes.NewReader(data))
+	c.Load(dec)
+	if dec.Err != nil && dec.Err != io.EOF {
+		return fmt.Errorf("unable to load %v: %v", name, dec.Err)
+	}
+	return st.Put(name, c)
+}
+
+// SplitLegacy moves the stream in LegacySection into the sections of the
+// container format. The CPU was saved first: load decodes it from the
+// start of the stream and cpu is then saved to the "cpu" section. The rest
+// of the stream is the system and is moved to the named section as is.
+// Only values of basic types were encoded so no type definitions are
+// shared between the two parts.
+func (st *State) SplitLegacy(section string, cpu Saver, load func(*Decoder)) error {
+	r := bytes.NewReader(st.Sections[LegacySection])
+	dec := NewDecoder(r)
+	load(dec)
+	if dec.Err != nil {
+		return dec.Err
+	}
+	rest, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	delete(st.Sections, LegacySection)
+	st.Sections[section] = rest
+	return st.Put("cpu", cpu)
+}
+
+// Check returns an error if the state is not for the given system or
+// was made with a different ROM set. States without a header, from before
+// the container format, are not checked.
+func (st *State) Check(system string, roms []ROM) error {
+	if st.Format == 0 {
+		return nil
+	}
+	if st.System != system {
+		return fmt.Errorf("state is for system %v, not %v", st.System, system)
+	}
+	var diff []string
+	want := make(map[string]bool)
+	for _, rom := range roms {
+		want[rom.File] = true
+		have, ok := st.ROMs[rom.File]
+		if !ok {
+			diff = append(diff, rom.File+" (missing)")
+		} else if have != rom.Checksum {
+			diff = append(diff, rom.File+" (checksum)")
+		}
+	}
+	for file := range st.ROMs {
+		if !want[file] {
+			diff = append(diff, file+" (extra)")
+		}
+	}
+	if len(diff) > 0 {
+		sort.Strings(diff)
+		return fmt.Errorf("state was made with a different ROM set: %v",
+			strings.Join(diff, ", "))
+	}
+	return nil
+}
+
+// Migrate brings the state up to the given version. Migration n converts
+// a state from version n to version n + 1.
+func (st *State) Migrate(version int, migrations map[int]func(*State) error) error {
+	if st.Version > version {
+		return fmt.Errorf("state version %v is newer than the supported version %v",
+			st.Version, version)
+	}
+	for st.Version < version {
+		migrate, ok := migrations[st.Version]
+		if !ok {
+			return fmt.Errorf("unable to migrate state from version %v", st.Version)
+		}
+		if err := migrate(st); err != nil {
+			return fmt.Errorf("unable to migrate state from version %v: %v", st.Version, err)
+		}
+		st.Version++
+	}
+	return nil
+}
+
+// WriteState writes the state in the container format.
+func WriteState(w io.Writer, st *State) error {
+	if _, err := io.WriteString(w, stateMagic); err != nil {
+		return err
+	}
+	return gob.NewEncoder(w).Encode(st)
+}
+
+// ReadState reads a state written with WriteState. If the data was
+// written before the container format existed, it is returned as version
+// zero with the contents in LegacySection.
+func ReadState(r io.Reader) (*State, error) {
+	in := bufio.NewReader(r)
+	magic, err := in.Peek(len(stateMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if string(magic) != stateMagic {
+		data, err := ioutil.ReadAll(in)
+		if err != nil {
+			return nil, err
+		}
+		return &State{
+			Sections: map[string][]byte{LegacySection: data},
+		}, nil
+	}
+	in.Discard(len(stateMagic))
+	st := &State{}
+	if err := gob.NewDecoder(in).Decode(st); err != nil {
+		return nil, fmt.Errorf("invalid state: %v", err)
+	}
+	if st.Format > StateFormat {
+		return nil, fmt.Errorf("unsupported state format: %v", st.Format)
+	}
+	return st, nil
+}
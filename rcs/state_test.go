@@ -0,0 +1,271 @@
+package rcs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type stateComp struct {
+	a uint8
+	b []uint8
+}
+
+func (c *stateComp) Save(enc *Encoder) {
+	enc.Encode(c.a)
+	enc.Encode(c.b)
+}
+
+func (c *stateComp) Load(dec *Decoder) {
+	dec.Decode(&c.a)
+	dec.Decode(&c.b)
+}
+
+var testROMs = []ROM{
+	NewROM("code", "code.rom", "1111"),
+	NewROM("tiles", "tiles.rom", "2222"),
+}
+
+func newStateMach(sys *stateComp, comp *stateComp) *Mach {
+	return &Mach{
+		Name:         "test",
+		ROMs:         testROMs,
+		Sys:          sys,
+		Comps:        []Component{NewComponent("comp", "comp", "", comp)},
+		StateVersion: 1,
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	m1 := newStateMach(&stateComp{a: 1, b: []uint8{2, 3}}, &stateComp{a: 4})
+	var buf bytes.Buffer
+	if err := m1.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	sys, comp := &stateComp{}, &stateComp{}
+	m2 := newStateMach(sys, comp)
+	if err := m2.Import(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if sys.a != 1 || !bytes.Equal(sys.b, []uint8{2, 3}) || comp.a != 4 {
+		t.Errorf("unexpected state: %+v %+v", sys, comp)
+	}
+}
+
+func TestStateSections(t *testing.T) {
+	m := newStateMach(&stateComp{}, &stateComp{})
+	st, err := m.SaveState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Sections) != 3 || st.Sections["comp"] == nil ||
+		st.Sections[SystemSection] == nil || st.Sections[MachSection] == nil {
+		t.Errorf("unexpected sections: %v", st.Sections)
+	}
+	// system is a component, only saved once
+	sys := &stateComp{}
+	m = newStateMach(sys, &stateComp{})
+	m.Comps = append(m.Comps, NewComponent("sys", "sys", "", sys))
+	st, err = m.SaveState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Sections) != 3 || st.Sections["sys"] == nil {
+		t.Errorf("unexpected sections: %v", st.Sections)
+	}
+}
+
+func TestStateReject(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*State)
+		want   string
+	}{
+		{"system", func(st *State) { st.System = "other" },
+			"state is for system other, not test"},
+		{"checksum", func(st *State) { st.ROMs["code.rom"] = "3333" },
+			"state was made with a different ROM set: code.rom (checksum)"},
+		{"missing rom", func(st *State) { delete(st.ROMs, "tiles.rom") },
+			"state was made with a different ROM set: tiles.rom (missing)"},
+		{"extra rom", func(st *State) { st.ROMs["extra.rom"] = "4444" },
+			"state was made with a different ROM set: extra.rom (extra)"},
+		{"newer", func(st *State) { st.Version = 2 },
+			"state version 2 is newer than the supported version 1"},
+		{"missing section", func(st *State) { delete(st.Sections, "comp") },
+			"missing section: comp"},
+		{"unknown section", func(st *State) { st.Sections["foo"] = nil },
+			"unknown section: foo"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newStateMach(&stateComp{}, &stateComp{})
+			st, err := m.SaveState()
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.modify(st)
+			err = m.LoadState(st)
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			if err.Error() != test.want {
+				t.Errorf("\n have: %v \n want: %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestStateLoadFailed(t *testing.T) {
+	st, err := newStateMach(&stateComp{a: 1}, &stateComp{a: 2}).SaveState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the system is loaded after the components
+	st.Sections[SystemSection] = st.Sections[SystemSection][:1]
+	sys, comp := &stateComp{a: 3}, &stateComp{a: 4, b: []uint8{5}}
+	m := newStateMach(sys, comp)
+	if err := m.LoadState(st); err == nil {
+		t.Fatal("expected error")
+	}
+	if sys.a != 3 || comp.a != 4 || !bytes.Equal(comp.b, []uint8{5}) {
+		t.Errorf("state not restored: %+v %+v", sys, comp)
+	}
+}
+
+func TestStateMigrate(t *testing.T) {
+	sys, comp := &stateComp{}, &stateComp{}
+	m := newStateMach(sys, comp)
+	m.StateVersion = 3
+	m.StateMigrations = map[int]func(*State) error{
+		1: func(st *State) error {
+			st.Sections["extra"] = nil
+			return nil
+		},
+		2: func(st *State) error {
+			delete(st.Sections, "extra")
+			return st.Put(SystemSection, &stateComp{a: 42})
+		},
+	}
+	st, err := newStateMach(&stateComp{a: 1}, &stateComp{a: 2}).SaveState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.LoadState(st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Version != 3 || sys.a != 42 || comp.a != 2 {
+		t.Errorf("unexpected state: version %v, %+v %+v", st.Version, sys, comp)
+	}
+
+	delete(m.StateMigrations, 2)
+	st.Version = 1
+	err = m.LoadState(st)
+	want := "unable to migrate state from version 2"
+	if err == nil || err.Error() != want {
+		t.Errorf("\n have: %v \n want: %v", err, want)
+	}
+}
+
+func TestStateLegacy(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.Encode(uint8(7))
+	enc.Encode([]uint8{8})
+	legacy := buf.Bytes()
+
+	st, err := ReadState(bytes.NewReader(legacy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Format != 0 || st.Version != 0 || !bytes.Equal(st.Sections[LegacySection], legacy) {
+		t.Fatalf("unexpected state: %+v", st)
+	}
+
+	sys := &stateComp{}
+	m := newStateMach(sys, &stateComp{})
+	m.Comps = nil
+	m.StateMigrations = map[int]func(*State) error{
+		0: func(st *State) error {
+			st.Sections[SystemSection] = st.Sections[LegacySection]
+			delete(st.Sections, LegacySection)
+			return nil
+		},
+	}
+	if err := m.LoadState(st); err != nil {
+		t.Fatal(err)
+	}
+	if sys.a != 7 || !bytes.Equal(sys.b, []uint8{8}) {
+		t.Errorf("unexpected state: %+v", sys)
+	}
+}
+
+func TestStateNotSupported(t *testing.T) {
+	m := &Mach{}
+	_, err := m.SaveState()
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("expected not supported error: %v", err)
+	}
+}
+
+func TestStateExtend(t *testing.T) {
+	// version without the b field
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.Encode(uint8(5))
+	st := NewState("test", 1, testROMs)
+	st.Sections["comp"] = buf.Bytes()
+
+	c := &stateComp{b: []uint8{9}}
+	if err := st.Extend("comp", c); err != nil {
+		t.Fatal(err)
+	}
+	have := &stateComp{}
+	if err := st.Get("comp", have); err != nil {
+		t.Fatal(err)
+	}
+	if have.a != 5 || !bytes.Equal(have.b, []uint8{9}) {
+		t.Errorf("unexpected state: %+v", have)
+	}
+
+	err := st.Extend("foo", c)
+	want := "missing section: foo"
+	if err == nil || err.Error() != want {
+		t.Errorf("\n have: %v \n want: %v", err, want)
+	}
+}
+
+func TestStateTiming(t *testing.T) {
+	cpu1 := &cycleCPU{per: 7}
+	m1 := newCycleMach(3072000, cpu1)
+	m1.Sys = &stateComp{}
+	if err := m1.RunFrames(2); err != nil {
+		t.Fatal(err)
+	}
+	st, err := m1.SaveState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// CPU state is not saved by the test CPU so copy it over
+	cpu2 := &cycleCPU{per: 7, cycles: cpu1.cycles}
+	m2 := newCycleMach(3072000, cpu2)
+	m2.Sys = &stateComp{}
+	if err := m2.LoadState(st); err != nil {
+		t.Fatal(err)
+	}
+	if m2.Frames() != 2 || m2.frameEnd["cpu1"] != m1.frameEnd["cpu1"] {
+		t.Errorf("\n have: %v %v \n want: %v %v", m2.Frames(), m2.frameEnd["cpu1"],
+			m1.Frames(), m1.frameEnd["cpu1"])
+	}
+
+	// without timing, the next frame starts at the current cycle
+	delete(st.Sections, MachSection)
+	m3 := newCycleMach(3072000, &cycleCPU{per: 7, cycles: 1234})
+	m3.Sys = &stateComp{}
+	if err := m3.LoadState(st); err != nil {
+		t.Fatal(err)
+	}
+	if have := m3.frameEnd["cpu1"]; have != 1234 {
+		t.Errorf("\n have: %v \n want: %v", have, 1234)
+	}
+}
@@ -0,0 +1,126 @@
+package rcs
+
+import (
+	"fmt"
+)
+
+const (
+	stepNext = iota // stop after the next instruction
+	stepOver        // stop when the stack is back to where it started
+	stepOut         // stop after returning to a caller
+	stepTo          // stop at an address
+)
+
+// step runs a single CPU until a stopping point while the machine, and any
+// other CPUs, keep running.
+type step struct {
+	cpu  string
+	mode int
+	sp   int  // stack pointer when the step started
+	addr int  // address to stop at for stepTo
+	ret  bool // instruction being executed is a return
+}
+
+// before is called before each instruction executed by the CPU.
+func (s *step) before(cpu CPU) {
+	if s.mode == stepOut {
+		s.ret = cpu.(CPUStepper).IsReturn()
+	}
+}
+
+// done is called after each instruction executed by the CPU and returns
+// true when the step is complete.
+func (s *step) done(cpu CPU) bool {
+	switch s.mode {
+	case stepOver:
+		return cpu.(CPUStepper).StackPointer() >= s.sp
+	case stepOut:
+		// an interrupt return only brings the stack back to where the
+		// step started
+		return s.ret && cpu.(CPUStepper).StackPointer() > s.sp
+	case stepTo:
+		return cpu.PC()+cpu.Offset() == s.addr
+	}
+	return true
+}
+
+// Step runs the CPU with the given name for one instruction. Other CPUs
+// keep running and the machine is put in the Break status once the
+// instruction is complete. Must be called from the machine goroutine or
+// while the machine is not running.
+func (m *Mach) Step(cpu string) error {
+	if err := m.Init(); err != nil {
+		return err
+	}
+	if _, ok := m.CPU[cpu]; !ok {
+		return fmt.Errorf("no such CPU: %v", cpu)
+	}
+	m.startStep(&step{cpu: cpu, mode: stepNext})
+	return nil
+}
+
+// StepOver runs the CPU with the given name for one instruction. If that
+// instruction calls a subroutine, execution continues until the subroutine
+// returns. Other CPUs keep running and the machine is put in the Break
+// status once the step is complete. Must be called from the machine
+// goroutine or while the machine is not running.
+func (m *Mach) StepOver(cpu string) error {
+	c, err := m.stepper(cpu)
+	if err != nil {
+		return err
+	}
+	mode := stepNext
+	if c.IsCall() {
+		mode = stepOver
+	}
+	m.startStep(&step{cpu: cpu, mode: mode, sp: c.StackPointer()})
+	return nil
+}
+
+// StepOut runs the CPU with the given name until the subroutine it is
+// executing returns. Other CPUs keep running and the machine is put in the
+// Break status once the step is complete. Must be called from the machine
+// goroutine or while the machine is not running.
+func (m *Mach) StepOut(cpu string) error {
+	c, err := m.stepper(cpu)
+	if err != nil {
+		return err
+	}
+	m.startStep(&step{cpu: cpu, mode: stepOut, sp: c.StackPointer()})
+	return nil
+}
+
+// RunTo runs the CPU with the given name until it reaches the address.
+// Other CPUs keep running and the machine is put in the Break status once
+// the address is reached. Must be called from the machine goroutine or
+// while the machine is not running.
+func (m *Mach) RunTo(cpu string, addr int) error {
+	if err := m.Init(); err != nil {
+		return err
+	}
+	if _, ok := m.CPU[cpu]; !ok {
+		return fmt.Errorf("no such CPU: %v", cpu)
+	}
+	m.startStep(&step{cpu: cpu, mode: stepTo, addr: addr})
+	return nil
+}
+
+func (m *Mach) stepper(cpu string) (CPUStepper, error) {
+	if err := m.Init(); err != nil {
+		return nil, err
+	}
+	c, ok := m.CPU[cpu]
+	if !ok {
+		return nil, fmt.Errorf("no such CPU: %v", cpu)
+	}
+	s, ok := c.(CPUStepper)
+	if !ok {
+		return nil, fmt.Errorf("stepping not supported by CPU: %v", cpu)
+	}
+	return s, nil
+}
+
+func (m *Mach) startStep(s *step) {
+	m.setStatus(Run)
+	m.step = s
+}
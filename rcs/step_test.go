@@ -0,0 +1,154 @@
+package rcs
+
+import (
+	"reflect"
+	"testing"
+)
+
+// stackCPU is a cycleCPU with subroutines. Opcode $01 calls the address
+// in the next byte, $02 returns if there is anything on the stack, and
+// anything else does nothing.
+type stackCPU struct {
+	cycleCPU
+	stack []int
+}
+
+func (c *stackCPU) Next() {
+	switch c.mem.Read(c.pc) {
+	case 0x01:
+		c.stack = append(c.stack, c.pc+2)
+		c.pc = int(c.mem.Read(c.pc + 1))
+	case 0x02:
+		if len(c.stack) == 0 {
+			c.pc = (c.pc + 1) & 0xff
+			break
+		}
+		c.pc = c.stack[len(c.stack)-1]
+		c.stack = c.stack[:len(c.stack)-1]
+	default:
+		c.pc = (c.pc + 1) & 0xff
+	}
+	c.cycles += c.per
+}
+
+func (c *stackCPU) StackPointer() int { return 0x100 - len(c.stack) }
+func (c *stackCPU) IsCall() bool      { return c.mem.Read(c.pc) == 0x01 }
+func (c *stackCPU) IsReturn() bool    { return c.mem.Read(c.pc) == 0x02 }
+
+// newStepMach has a stackCPU, "cpu1", with the following program and a
+// cycleCPU, "cpu2":
+//
+//	$00: call $10
+//	$02: nop
+//	$10: nop
+//	$11: call $20
+//	$13: ret
+//	$20: nop
+//	$21: ret
+func newStepMach() (*Mach, *stackCPU, *cycleCPU) {
+	mem := NewMemory(1, 0x100)
+	mem.MapRAM(0, make([]uint8, 0x100))
+	mem.WriteN(0x00, 0x01, 0x10)
+	mem.WriteN(0x11, 0x01, 0x20, 0x02)
+	mem.WriteN(0x21, 0x02)
+	cpu1 := &stackCPU{}
+	cpu1.mem = mem
+	cpu1.per = 4
+	cpu2 := &cycleCPU{per: 4}
+	m := &Mach{Clock: 3072000}
+	m.Comps = []Component{
+		NewComponent("mem", "mem", "", mem),
+		NewComponent("cpu1", "cpu", "mem", cpu1),
+		NewComponent("cpu2", "cpu", "", cpu2),
+	}
+	return m, cpu1, cpu2
+}
+
+func TestStep(t *testing.T) {
+	tests := []struct {
+		name string
+		pc   int
+		fn   func(m *Mach) error
+		want int
+	}{
+		{"next", 0x00, func(m *Mach) error { return m.Step("cpu1") }, 0x10},
+		{"over call", 0x00, func(m *Mach) error { return m.StepOver("cpu1") }, 0x02},
+		{"over nop", 0x10, func(m *Mach) error { return m.StepOver("cpu1") }, 0x11},
+		{"out", 0x20, func(m *Mach) error { return m.StepOut("cpu1") }, 0x13},
+		{"out twice", 0x20, func(m *Mach) error {
+			if err := m.StepOut("cpu1"); err != nil {
+				return err
+			}
+			if err := m.RunFrames(1); err != ErrBreak {
+				return err
+			}
+			return m.StepOut("cpu1")
+		}, 0x02},
+		{"run to", 0x00, func(m *Mach) error { return m.RunTo("cpu1", 0x21) }, 0x21},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, cpu1, cpu2 := newStepMach()
+			cpu1.pc = test.pc
+			// called from $00 and $11
+			if test.pc == 0x20 {
+				cpu1.stack = []int{0x02, 0x13}
+			}
+			if err := test.fn(m); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.RunFrames(1); err != ErrBreak {
+				t.Fatalf("\n have: %v \n want: %v", err, ErrBreak)
+			}
+			if cpu1.pc != test.want || m.Status != Break {
+				t.Errorf("\n have: $%02x %v \n want: $%02x %v", cpu1.pc, m.Status, test.want, Break)
+			}
+			// the other CPU keeps running when more than one instruction
+			// is executed
+			if cpu1.cycles > cpu1.per && cpu2.cycles == 0 {
+				t.Errorf("cpu2 did not run")
+			}
+			// and the step is over
+			if err := m.RunFrames(1); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestStepBreakEvent(t *testing.T) {
+	m, _, _ := newStepMach()
+	var have []interface{}
+	m.Callback = func(evt MachEvent, args ...interface{}) {
+		if evt == StatusEvent {
+			have = args
+		}
+	}
+	if err := m.Step("cpu2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RunFrames(1); err != ErrBreak {
+		t.Fatalf("\n have: %v \n want: %v", err, ErrBreak)
+	}
+	want := []interface{}{Break, "cpu2"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+}
+
+func TestStepErrors(t *testing.T) {
+	m, _, _ := newStepMach()
+	if err := m.StepOver("foo"); err == nil || err.Error() != "no such CPU: foo" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	want := "stepping not supported by CPU: cpu2"
+	if err := m.StepOut("cpu2"); err == nil || err.Error() != want {
+		t.Errorf("\n have: %v \n want: %v", err, want)
+	}
+	if err := m.Step("foo"); err == nil || err.Error() != "no such CPU: foo" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := m.RunTo("cpu2", 0x10); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,199 @@
+package rcs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Symbols are the names of addresses in the memory of a CPU, such as the
+// entry points of routines.
+type Symbols map[int]string
+
+// SymbolExts are the extensions of the files checked by LoadSymbols.
+var SymbolExts = []string{".sym", ".lbl", ".dbg"}
+
+// dbgKeywords start the lines found in a ca65 debug info file.
+var dbgKeywords = map[string]bool{
+	"csym": true, "file": true, "info": true, "lib": true, "line": true,
+	"mod": true, "scope": true, "seg": true, "span": true, "sym": true,
+	"type": true, "version": true,
+}
+
+// ReadSymbols reads symbols with one on each line. The format of each line
+// is detected and can be any of the following:
+//
+//	al C:ffd2 .CHROUT                       VICE or ld65 -Ln labels
+//	sym id=0,name="CHROUT",...,val=0xFFD2   ca65 debug info (labels only)
+//	CHROUT = $ffd2                          assignment
+//	$ffd2 CHROUT                            address and name
+//
+// Addresses in the last two formats are written the same as in
+// expressions: $ffd2, 0xffd2, or 65490. Blank lines and lines that start
+// with "#" or ";" are ignored.
+func ReadSymbols(r io.Reader) (Symbols, error) {
+	syms := make(Symbols)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		var addr int
+		var name string
+		var err error
+		fields := strings.Fields(line)
+		switch {
+		case fields[0] == "al":
+			addr, name, err = parseVICESymbol(fields)
+		case dbgKeywords[fields[0]]:
+			if fields[0] != "sym" {
+				continue
+			}
+			addr, name, err = parseDbgSymbol(strings.TrimSpace(line[3:]))
+			if err == nil && name == "" {
+				continue
+			}
+		case strings.Contains(line, "="):
+			i := strings.Index(line, "=")
+			name = strings.TrimSpace(line[:i])
+			addr, err = parseNumber(strings.TrimSpace(line[i+1:]))
+			if err == nil && (name == "" || strings.ContainsAny(name, " \t")) {
+				err = fmt.Errorf("invalid name: %v", name)
+			}
+		case len(fields) == 2:
+			name = fields[1]
+			addr, err = parseNumber(fields[0])
+		default:
+			err = fmt.Errorf("expecting address and name")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", n, err)
+		}
+		syms[addr] = name
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return syms, nil
+}
+
+func parseVICESymbol(fields []string) (int, string, error) {
+	if len(fields) != 3 {
+		return 0, "", fmt.Errorf("expecting address and name")
+	}
+	str := fields[1]
+	if i := strings.Index(str, ":"); i >= 0 {
+		str = str[i+1:]
+	}
+	addr, err := strconv.ParseInt(str, 16, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid number: %v", fields[1])
+	}
+	return int(addr), strings.TrimPrefix(fields[2], "."), nil
+}
+
+// parseDbgSymbol returns the name and value of a label. An empty name is
+// returned for other symbols, such as constants.
+func parseDbgSymbol(str string) (int, string, error) {
+	attrs := make(map[string]string)
+	for _, attr := range strings.Split(str, ",") {
+		kv := strings.SplitN(attr, "=", 2)
+		if len(kv) == 2 {
+			attrs[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+	if attrs["type"] != "lab" {
+		return 0, "", nil
+	}
+	addr, err := parseNumber(attrs["val"])
+	if err != nil {
+		return 0, "", err
+	}
+	return addr, attrs["name"], nil
+}
+
+// Lookup returns the name of addr. If addr does not have a name, the
+// nearest name below it is used with the offset added, "CHROUT+$3". An
+// empty string is returned if there are no names at or below addr.
+func (s Symbols) Lookup(addr int) string {
+	if name, ok := s[addr]; ok {
+		return name
+	}
+	near, found := 0, false
+	for a := range s {
+		if a < addr && (!found || a > near) {
+			near, found = a, true
+		}
+	}
+	if !found {
+		return ""
+	}
+	return fmt.Sprintf("%v+$%x", s[near], addr-near)
+}
+
+// Addr returns the address with the given name. Names are first matched
+// exactly and then without regard to case.
+func (s Symbols) Addr(name string) (int, bool) {
+	for addr, n := range s {
+		if n == name {
+			return addr, true
+		}
+	}
+	for addr, n := range s {
+		if strings.EqualFold(n, name) {
+			return addr, true
+		}
+	}
+	return 0, false
+}
+
+// Names returns all names in sorted order.
+func (s Symbols) Names() []string {
+	names := make([]string, 0, len(s))
+	for _, name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Add copies all symbols in other to s, replacing any existing names.
+func (s Symbols) Add(other Symbols) {
+	for addr, name := range other {
+		s[addr] = name
+	}
+}
+
+// LoadSymbols adds the symbols for each CPU found in dir. The files for a
+// CPU have the name of the CPU and one of the extensions in SymbolExts,
+// "cpu.sym". Files that do not exist are skipped.
+func (m *Mach) LoadSymbols(dir string) error {
+	if err := m.Init(); err != nil {
+		return err
+	}
+	for _, name := range m.cpuNames {
+		for _, ext := range SymbolExts {
+			filename := filepath.Join(dir, name+ext)
+			in, err := os.Open(filename)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			syms, err := ReadSymbols(in)
+			in.Close()
+			if err != nil {
+				return fmt.Errorf("%v: %v", filename, err)
+			}
+			m.Symbols[name].Add(syms)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package rcs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSymbols(t *testing.T) {
+	src := `
+# kernal
+$ffd2 CHROUT
+0xffe4  GETIN
+; basic
+40960 BASIC
+`
+	syms, err := ReadSymbols(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		addr int
+		want string
+	}{
+		{0xffd2, "CHROUT"},
+		{0xffd5, "CHROUT+$3"},
+		{0xffe4, "GETIN"},
+		{0xa000, "BASIC"},
+		{0x1000, ""},
+	}
+	for _, test := range tests {
+		if have := syms.Lookup(test.addr); have != test.want {
+			t.Errorf("$%04x:\n have: %v \n want: %v", test.addr, have, test.want)
+		}
+	}
+}
+
+func TestSymbolsErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"$ffd2", "line 1: expecting address and name"},
+		{"\n$zz CHROUT", "line 2: invalid number: $zz"},
+	}
+	for _, test := range tests {
+		_, err := ReadSymbols(strings.NewReader(test.src))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("\n have: %v \n want: %v", err, test.want)
+		}
+	}
+}
+
+func TestSymbolsFormats(t *testing.T) {
+	src := `
+al C:ffd2 .CHROUT
+al 00FFE4 .GETIN
+version	major=2,minor=0
+sym	id=0,name="CLRSCR",addrsize=absolute,scope=0,def=1,ref=3,val=0xE544,seg=1,type=lab
+sym	id=1,name="COLS",addrsize=zeropage,scope=0,def=2,val=0x28,type=equ
+BASIC = $a000
+`
+	syms, err := ReadSymbols(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Symbols{0xffd2: "CHROUT", 0xffe4: "GETIN", 0xe544: "CLRSCR", 0xa000: "BASIC"}
+	if len(syms) != len(want) {
+		t.Fatalf("\n have: %v \n want: %v", syms, want)
+	}
+	for addr, name := range want {
+		if syms[addr] != name {
+			t.Errorf("\n have: %v \n want: %v", syms[addr], name)
+		}
+	}
+}
+
+func TestSymbolsAddr(t *testing.T) {
+	syms := Symbols{0xffd2: "CHROUT", 0xffe4: "GETIN"}
+	tests := []struct {
+		name string
+		addr int
+		ok   bool
+	}{
+		{"CHROUT", 0xffd2, true},
+		{"getin", 0xffe4, true},
+		{"PLOT", 0, false},
+	}
+	for _, test := range tests {
+		addr, ok := syms.Addr(test.name)
+		if addr != test.addr || ok != test.ok {
+			t.Errorf("%v:\n have: $%04x %v \n want: $%04x %v", test.name, addr, ok, test.addr, test.ok)
+		}
+	}
+}
+
+func TestLoadSymbols(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "cpu1.lbl"), []byte("al C:0010 .LOOP\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "cpu1.sym"), []byte("START = $0000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := newCycleMach(3072000, &cycleCPU{})
+	if err := m.LoadSymbols(dir); err != nil {
+		t.Fatal(err)
+	}
+	syms := m.Symbols["cpu1"]
+	if syms[0x10] != "LOOP" || syms[0x00] != "START" {
+		t.Errorf("\n have: %v \n want: map[0:START 16:LOOP]", syms)
+	}
+}
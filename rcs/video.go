@@ -2,33 +2,96 @@ package rcs
 
 import (
 	"fmt"
+	"image"
 	"image/color"
+	"image/draw"
 	"math"
 
 	"github.com/veandco/go-sdl2/sdl"
 )
 
+// TileSheet is an image that contains tiles of equal size arranged in
+// rows.
 type TileSheet struct {
 	TextureW int32
 	TextureH int32
 	TileW    int32
 	TileH    int32
-	Texture  *sdl.Texture
+	Image    *image.RGBA
 }
 
+// Tile returns the bounds of the nth tile in the sheet.
+func (t TileSheet) Tile(n int) image.Rectangle {
+	rowTiles := int(t.TextureW / t.TileW)
+	x := (n % rowTiles) * int(t.TileW)
+	y := (n / rowTiles) * int(t.TileH)
+	return image.Rect(x, y, x+int(t.TileW), y+int(t.TileH))
+}
+
+// Screen is the display of a system. The video hardware draws the
+// contents of the screen into an image using Draw. The image is W pixels
+// wide and H pixels high. When a window is available, the image is
+// presented at X and Y and enlarged by Scale.
 type Screen struct {
 	W         int32
 	H         int32
 	X         int32
 	Y         int32
 	Scale     int32
-	Texture   *sdl.Texture
 	ScanLineH bool
 	ScanLineV bool
-	Draw      func(*sdl.Renderer) error
+	Draw      func(*image.RGBA) error
 }
 
-func NewColorSheet(r *sdl.Renderer, palettes [][]color.RGBA) (TileSheet, error) {
+// Flip indicates if a tile should be mirrored when drawn.
+type Flip int
+
+const (
+	FlipNone       Flip = 0
+	FlipHorizontal Flip = 1 << 0
+	FlipVertical   Flip = 1 << 1
+)
+
+// DrawTile copies the area r from the src image to the dest image with
+// the upper left corner at x and y. Pixels that are fully transparent in
+// the source are not copied. Pixels that fall outside of the destination
+// are clipped.
+func DrawTile(dest *image.RGBA, src *image.RGBA, r image.Rectangle, x int, y int, flip Flip) {
+	w, h := r.Dx(), r.Dy()
+	for ty := 0; ty < h; ty++ {
+		dy := y + ty
+		if dy < dest.Rect.Min.Y || dy >= dest.Rect.Max.Y {
+			continue
+		}
+		sy := r.Min.Y + ty
+		if flip&FlipVertical != 0 {
+			sy = r.Max.Y - 1 - ty
+		}
+		for tx := 0; tx < w; tx++ {
+			dx := x + tx
+			if dx < dest.Rect.Min.X || dx >= dest.Rect.Max.X {
+				continue
+			}
+			sx := r.Min.X + tx
+			if flip&FlipHorizontal != 0 {
+				sx = r.Max.X - 1 - tx
+			}
+			si := src.PixOffset(sx, sy)
+			if src.Pix[si+3] == 0 {
+				continue
+			}
+			di := dest.PixOffset(dx, dy)
+			copy(dest.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+}
+
+// FillRect fills the area r in the dest image with a single color.
+func FillRect(dest *image.RGBA, r image.Rectangle, c color.RGBA) {
+	draw.Draw(dest, r, &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+func NewColorSheet(palettes [][]color.RGBA) (TileSheet, error) {
 	tileW := int32(32)
 	tileH := int32(32)
 
@@ -38,24 +101,12 @@ func NewColorSheet(r *sdl.Renderer, palettes [][]color.RGBA) (TileSheet, error)
 	texW := per * tileW
 	texH := per * tileH
 
-	t, err := r.CreateTexture(sdl.PIXELFORMAT_RGBA8888,
-		sdl.TEXTUREACCESS_TARGET, texW, texH)
-	if err != nil {
-		return TileSheet{}, fmt.Errorf("unable to create sheet: %v", err)
-	}
-	r.SetRenderTarget(t)
-
+	img := image.NewRGBA(image.Rect(0, 0, int(texW), int(texH)))
 	x := int32(0)
 	y := int32(0)
 	for _, pal := range palettes {
 		for _, c := range pal {
-			r.SetDrawColor(c.R, c.G, c.B, c.A)
-			r.FillRect(&sdl.Rect{
-				X: x,
-				Y: y,
-				W: tileW,
-				H: tileH,
-			})
+			FillRect(img, image.Rect(int(x), int(y), int(x+tileW), int(y+tileH)), c)
 			x += tileW
 			if x >= texW {
 				x = 0
@@ -63,16 +114,40 @@ func NewColorSheet(r *sdl.Renderer, palettes [][]color.RGBA) (TileSheet, error)
 			}
 		}
 	}
-	r.SetRenderTarget(nil)
 	return TileSheet{
 		TextureW: texW,
 		TextureH: texH,
 		TileW:    tileW,
 		TileH:    tileH,
-		Texture:  t,
+		Image:    img,
 	}, nil
 }
 
+// NewTexture creates a texture that can be used to present the image
+// with the renderer.
+func NewTexture(r *sdl.Renderer, img *image.RGBA) (*sdl.Texture, error) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	t, err := r.CreateTexture(uint32(sdl.PIXELFORMAT_RGBA32),
+		sdl.TEXTUREACCESS_STREAMING, int32(w), int32(h))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create texture: %v", err)
+	}
+	if err := UpdateTexture(t, img); err != nil {
+		return nil, err
+	}
+	t.SetBlendMode(sdl.BLENDMODE_BLEND)
+	return t, nil
+}
+
+// UpdateTexture replaces the contents of a texture created with
+// NewTexture with the pixels in the image.
+func UpdateTexture(t *sdl.Texture, img *image.RGBA) error {
+	if err := t.Update(nil, img.Pix, img.Stride); err != nil {
+		return fmt.Errorf("unable to update texture: %v", err)
+	}
+	return nil
+}
+
 func NewScanLinesV(r *sdl.Renderer, w int32, h int32, size int32) (*sdl.Texture, error) {
 	tex, err := r.CreateTexture(sdl.PIXELFORMAT_RGBA8888,
 		sdl.TEXTUREACCESS_TARGET, w, h)
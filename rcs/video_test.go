@@ -0,0 +1,109 @@
+package rcs
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+var (
+	black = color.RGBA{0x00, 0x00, 0x00, 0xff}
+	red   = color.RGBA{0xff, 0x00, 0x00, 0xff}
+	green = color.RGBA{0x00, 0xff, 0x00, 0xff}
+	clear = color.RGBA{0x00, 0x00, 0x00, 0x00}
+)
+
+// 2x2 tile with red on the top left and bottom right, green on the top
+// right, and transparent on the bottom left.
+func newTestTile() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.SetRGBA(0, 0, red)
+	img.SetRGBA(1, 0, green)
+	img.SetRGBA(0, 1, clear)
+	img.SetRGBA(1, 1, red)
+	return img
+}
+
+func TestDrawTile(t *testing.T) {
+	var tests = []struct {
+		name string
+		x    int
+		y    int
+		flip Flip
+		want []color.RGBA // dest pixels in row order
+	}{
+		{"none", 0, 0, FlipNone, []color.RGBA{
+			red, green, black,
+			black, red, black,
+			black, black, black,
+		}},
+		{"offset", 1, 1, FlipNone, []color.RGBA{
+			black, black, black,
+			black, red, green,
+			black, black, red,
+		}},
+		{"horizontal", 0, 0, FlipHorizontal, []color.RGBA{
+			green, red, black,
+			red, black, black,
+			black, black, black,
+		}},
+		{"vertical", 0, 0, FlipVertical, []color.RGBA{
+			black, red, black,
+			red, green, black,
+			black, black, black,
+		}},
+		{"clipped", -1, 2, FlipNone, []color.RGBA{
+			black, black, black,
+			black, black, black,
+			green, black, black,
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dest := image.NewRGBA(image.Rect(0, 0, 3, 3))
+			FillRect(dest, dest.Rect, black)
+			src := newTestTile()
+			DrawTile(dest, src, src.Rect, test.x, test.y, test.flip)
+			for i, want := range test.want {
+				x, y := i%3, i/3
+				have := dest.RGBAAt(x, y)
+				if have != want {
+					t.Errorf("(%v, %v)\n have: %v \n want: %v", x, y, have, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTileSheetTile(t *testing.T) {
+	sheet := TileSheet{TextureW: 32, TextureH: 16, TileW: 8, TileH: 8}
+	have := sheet.Tile(5)
+	want := image.Rect(8, 8, 16, 16)
+	if have != want {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+}
+
+func TestMachDrawScreen(t *testing.T) {
+	m := &Mach{
+		Screen: Screen{
+			W: 2,
+			H: 2,
+			Draw: func(img *image.RGBA) error {
+				FillRect(img, img.Rect, red)
+				return nil
+			},
+		},
+	}
+	img, err := m.DrawScreen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Rect != image.Rect(0, 0, 2, 2) {
+		t.Fatalf("unexpected bounds: %v", img.Rect)
+	}
+	if have := img.RGBAAt(1, 1); have != red {
+		t.Errorf("\n have: %v \n want: %v", have, red)
+	}
+}
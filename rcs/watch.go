@@ -0,0 +1,110 @@
+package rcs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Watchpoint reports each time a value at an address in memory is read or
+// written with a WatchEvent. Execution can also be stopped right after the
+// instruction that made the access.
+type Watchpoint struct {
+	Read  bool // Report reads
+	Write bool // Report writes
+	Break bool // Stop execution after the instruction
+
+	// If Filter is set, only values from Min to Max, inclusive, are
+	// reported.
+	Filter bool
+	Min    int
+	Max    int
+
+	Hits int // Number of accesses reported
+}
+
+// WatchHit is a read or write of a watched address and is sent as the
+// argument to a WatchEvent. When the access was made by an instruction,
+// the CPU that executed it and its address are included. Otherwise, CPU
+// is blank.
+type WatchHit struct {
+	MemoryEvent
+	Mem string // Name of the memory component
+	CPU string // Name of the CPU
+	PC  int    // Address of the instruction
+}
+
+// SetWatchpoint watches the address in the memory component with the given
+// name. Any watchpoint already at that address is replaced. Only the
+// selected bank is watched.
+func (m *Mach) SetWatchpoint(mem string, addr int, w *Watchpoint) error {
+	if err := m.Init(); err != nil {
+		return err
+	}
+	mm, ok := m.mems[mem]
+	if !ok {
+		return fmt.Errorf("no such memory: %v", mem)
+	}
+	if addr < 0 || addr > mm.MaxAddr {
+		return fmt.Errorf("invalid address: $%x", addr)
+	}
+	if !w.Read && !w.Write {
+		return errors.New("watchpoint must be for reads, writes, or both")
+	}
+	mm.Unwatch(addr)
+	if w.Read {
+		mm.WatchRO(addr)
+	}
+	if w.Write {
+		mm.WatchWO(addr)
+	}
+	m.watchpoints[mem][addr] = w
+	return nil
+}
+
+// ClearWatchpoint removes the watchpoint at the address in the memory
+// component with the given name, if any.
+func (m *Mach) ClearWatchpoint(mem string, addr int) error {
+	if err := m.Init(); err != nil {
+		return err
+	}
+	mm, ok := m.mems[mem]
+	if !ok {
+		return fmt.Errorf("no such memory: %v", mem)
+	}
+	if _, ok := m.watchpoints[mem][addr]; ok {
+		mm.Unwatch(addr)
+		delete(m.watchpoints[mem], addr)
+	}
+	return nil
+}
+
+// Watchpoints returns the watchpoints in the memory component with the
+// given name indexed by address. The map must not be modified.
+func (m *Mach) Watchpoints(mem string) map[int]*Watchpoint {
+	m.Init()
+	return m.watchpoints[mem]
+}
+
+// watchCallback returns the function that handles the watch events for
+// the memory component with the given name.
+func (m *Mach) watchCallback(mem string) func(MemoryEvent) {
+	return func(e MemoryEvent) {
+		w, ok := m.watchpoints[mem][e.Addr]
+		if !ok || (e.Read && !w.Read) || (!e.Read && !w.Write) {
+			return
+		}
+		if w.Filter && (int(e.Value) < w.Min || int(e.Value) > w.Max) {
+			return
+		}
+		w.Hits++
+		hit := WatchHit{MemoryEvent: e, Mem: mem}
+		if m.execCPU != "" {
+			hit.CPU = m.execCPU
+			hit.PC = m.execPC
+			if w.Break {
+				m.watchBreak = true
+			}
+		}
+		m.event(WatchEvent, hit)
+	}
+}
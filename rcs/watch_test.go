@@ -0,0 +1,112 @@
+package rcs
+
+import (
+	"testing"
+)
+
+// storeCPU is a cycleCPU that stores the low byte of the program counter
+// at $10 for each instruction.
+type storeCPU struct {
+	cycleCPU
+}
+
+func (c *storeCPU) Next() {
+	c.mem.Write(0x10, uint8(c.pc))
+	c.cycleCPU.Next()
+}
+
+func newWatchMach() (*Mach, *storeCPU, *[]WatchHit) {
+	mem := NewMemory(1, 0x100)
+	mem.MapRAM(0, make([]uint8, 0x100))
+	cpu := &storeCPU{}
+	cpu.mem = mem
+	cpu.per = 4
+	m := &Mach{Clock: 3072000}
+	m.Comps = []Component{
+		NewComponent("mem", "mem", "", mem),
+		NewComponent("cpu1", "cpu", "mem", cpu),
+	}
+	var hits []WatchHit
+	m.Callback = func(evt MachEvent, args ...interface{}) {
+		if evt == WatchEvent {
+			hits = append(hits, args[0].(WatchHit))
+		}
+	}
+	return m, cpu, &hits
+}
+
+func TestWatchpointBreak(t *testing.T) {
+	m, cpu, hits := newWatchMach()
+	w := &Watchpoint{Write: true, Break: true, Filter: true, Min: 100, Max: 110}
+	if err := m.SetWatchpoint("mem", 0x10, w); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RunFrames(1); err != ErrBreak {
+		t.Fatalf("\n have: %v \n want: %v", err, ErrBreak)
+	}
+	// stopped right after the instruction at 100
+	want := WatchHit{
+		MemoryEvent: MemoryEvent{Addr: 0x10, Value: 100},
+		Mem:         "mem",
+		CPU:         "cpu1",
+		PC:          100,
+	}
+	if len(*hits) != 1 || (*hits)[0] != want || cpu.pc != 101 || m.Status != Break {
+		t.Fatalf("\n have: %+v pc %v \n want: %+v pc 101", *hits, cpu.pc, want)
+	}
+	if err := m.RunFrames(1); err != ErrBreak {
+		t.Fatalf("\n have: %v \n want: %v", err, ErrBreak)
+	}
+	if cpu.pc != 102 || w.Hits != 2 {
+		t.Errorf("\n have: pc %v, hits %v \n want: pc 102, hits 2", cpu.pc, w.Hits)
+	}
+	if err := m.ClearWatchpoint("mem", 0x10); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RunFrames(1); err != nil {
+		t.Fatal(err)
+	}
+	if len(*hits) != 2 {
+		t.Errorf("\n have: %v \n want: %v", len(*hits), 2)
+	}
+}
+
+func TestWatchpointRead(t *testing.T) {
+	m, cpu, hits := newWatchMach()
+	if err := m.SetWatchpoint("mem", 0x20, &Watchpoint{Read: true}); err != nil {
+		t.Fatal(err)
+	}
+	cpu.mem.Write(0x20, 0x42)
+	if len(*hits) != 0 {
+		t.Fatalf("unexpected hits: %+v", *hits)
+	}
+	// not made by an instruction, so no CPU
+	cpu.mem.Read(0x20)
+	want := WatchHit{
+		MemoryEvent: MemoryEvent{Read: true, Addr: 0x20, Value: 0x42},
+		Mem:         "mem",
+	}
+	if len(*hits) != 1 || (*hits)[0] != want {
+		t.Errorf("\n have: %+v \n want: %+v", *hits, want)
+	}
+}
+
+func TestWatchpointErrors(t *testing.T) {
+	m, _, _ := newWatchMach()
+	tests := []struct {
+		mem  string
+		addr int
+		w    *Watchpoint
+		want string
+	}{
+		{"foo", 0x10, &Watchpoint{Read: true}, "no such memory: foo"},
+		{"mem", 0x100, &Watchpoint{Read: true}, "invalid address: $100"},
+		{"mem", 0x10, &Watchpoint{}, "watchpoint must be for reads, writes, or both"},
+	}
+	for _, test := range tests {
+		err := m.SetWatchpoint(test.mem, test.addr, test.w)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("\n have: %v \n want: %v", err, test.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package rcs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const wavHeaderLen = 44
+
+// WAVWriter writes 16-bit PCM audio data to a WAV file. The sizes in the
+// header are not known until all the data has been written so they are
+// filled in when the writer is closed.
+type WAVWriter struct {
+	w    io.WriteSeeker
+	size int
+}
+
+// NewWAVWriter writes the WAV header to w for audio sampled at the rate
+// given in hertz with the given number of channels.
+func NewWAVWriter(w io.WriteSeeker, rate int, channels int) (*WAVWriter, error) {
+	wav := &WAVWriter{w: w}
+	if err := wav.writeHeader(rate, channels); err != nil {
+		return nil, fmt.Errorf("unable to write WAV header: %v", err)
+	}
+	return wav, nil
+}
+
+// Write appends the samples in data which must be 16-bit signed little
+// endian values with the channels interleaved.
+func (wav *WAVWriter) Write(data []byte) (int, error) {
+	n, err := wav.w.Write(data)
+	wav.size += n
+	return n, err
+}
+
+// Close updates the header with the size of the audio data. The
+// underlying writer is not closed.
+func (wav *WAVWriter) Close() error {
+	if _, err := wav.w.Seek(4, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(wav.w, binary.LittleEndian, uint32(wavHeaderLen-8+wav.size)); err != nil {
+		return err
+	}
+	if _, err := wav.w.Seek(wavHeaderLen-4, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(wav.w, binary.LittleEndian, uint32(wav.size)); err != nil {
+		return err
+	}
+	_, err := wav.w.Seek(0, io.SeekEnd)
+	return err
+}
+
+func (wav *WAVWriter) writeHeader(rate int, channels int) error {
+	blockAlign := channels * 2
+	header := []interface{}{
+		[]byte("RIFF"),
+		uint32(wavHeaderLen - 8), // file size, updated on close
+		[]byte("WAVE"),
+		[]byte("fmt "),
+		uint32(16), // length of format chunk
+		uint16(1),  // PCM
+		uint16(channels),
+		uint32(rate),
+		uint32(rate * blockAlign), // bytes per second
+		uint16(blockAlign),
+		uint16(16), // bits per sample
+		[]byte("data"),
+		uint32(0), // data size, updated on close
+	}
+	for _, v := range header {
+		if err := binary.Write(wav.w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
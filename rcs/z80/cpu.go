@@ -59,8 +59,9 @@ type CPU struct {
 	opcodesDDCB map[uint8]func(*CPU)
 	opcodesFDCB map[uint8]func(*CPU)
 
-	mem   *rcs.Memory
-	delta uint8
+	mem    *rcs.Memory
+	cycles int // total number of T-states consumed
+	delta  uint8
 	// address used to load on the last (IX+d) or (IY+d) instruction
 	iaddr int
 }
@@ -113,6 +114,8 @@ func New(mem *rcs.Memory) *CPU {
 func (c *CPU) Next() {
 	if !c.Halt {
 		c.execute()
+	} else {
+		c.cycles += tstatesHalt
 	}
 	if c.IRQ {
 		c.IRQ = false
@@ -137,35 +140,42 @@ func (c *CPU) execute() {
 
 	prefix := ""
 	var table map[uint8]func(*CPU)
+	times := &tstates
 	switch opcode {
 	case 0xcb:
 		table = c.opcodesCB
+		times = &tstatesCB
 		opcode = c.fetch()
 		c.refreshR()
 		prefix = "cb"
 	case 0xed:
 		table = c.opcodesED
+		times = &tstatesED
 		opcode = c.fetch()
 		c.refreshR()
 		prefix = "ed"
 	case 0xdd:
 		table = c.opcodesDD
+		times = &tstatesXY
 		opcode = c.fetch()
 		c.refreshR()
 		prefix = "dd"
 		if opcode == 0xcb {
 			table = c.opcodesDDCB
+			times = &tstatesXYCB
 			c.fetchd()
 			opcode = c.fetch()
 			prefix = "ddcb"
 		}
 	case 0xfd:
 		table = c.opcodesFD
+		times = &tstatesXY
 		opcode = c.fetch()
 		c.refreshR()
 		prefix = "fd"
 		if opcode == 0xcb {
 			table = c.opcodesFDCB
+			times = &tstatesXYCB
 			c.fetchd()
 			opcode = c.fetch()
 			prefix = "fdcb"
@@ -174,6 +184,7 @@ func (c *CPU) execute() {
 		table = c.opcodes
 	}
 
+	c.cycles += times[opcode]
 	opFunc, ok := table[opcode]
 	if !ok {
 		log.Printf("%04x: illegal instruction: %v%02x", here, prefix, opcode)
@@ -198,12 +209,15 @@ func (c *CPU) irqAck() {
 	if c.IM == 2 {
 		vector := int(c.I)<<8 | int(c.IRQData)
 		c.SetPC(c.mem.ReadLE(vector))
+		c.cycles += tstatesIM2
 	} else {
 		c.pc = 0x0038
+		c.cycles += tstatesIM1
 	}
 }
 
 func (c *CPU) nmiAck() {
+	c.cycles += tstatesNMI
 	c.SP -= 2
 	c.mem.WriteLE(int(c.SP), c.PC())
 	c.pc = 0x0066
@@ -240,6 +254,131 @@ func (c *CPU) Memory() *rcs.Memory {
 	return c.mem
 }
 
+// Cycles is the total number of T-states consumed since the CPU was
+// created.
+func (c *CPU) Cycles() int {
+	return c.cycles
+}
+
+// Registers returns the registers and flags by the names used in the
+// monitor, "r.hl" or "f.z".
+func (c *CPU) Registers() map[string]rcs.Load {
+	reg := func(r *uint8) rcs.Load {
+		return func() int { return int(*r) }
+	}
+	pair := func(hi, lo *uint8) rcs.Load {
+		return func() int { return int(*hi)<<8 | int(*lo) }
+	}
+	boolean := func(b *bool) rcs.Load {
+		return func() int {
+			if *b {
+				return 1
+			}
+			return 0
+		}
+	}
+	flag := func(mask uint8) rcs.Load {
+		return func() int {
+			if c.F&mask != 0 {
+				return 1
+			}
+			return 0
+		}
+	}
+	return map[string]rcs.Load{
+		"r.pc": c.PC,
+		"r.a":  reg(&c.A),
+		"r.f":  reg(&c.F),
+		"r.b":  reg(&c.B),
+		"r.c":  reg(&c.C),
+		"r.d":  reg(&c.D),
+		"r.e":  reg(&c.E),
+		"r.h":  reg(&c.H),
+		"r.l":  reg(&c.L),
+
+		"r.a1": reg(&c.A1),
+		"r.f1": reg(&c.F1),
+		"r.b1": reg(&c.B1),
+		"r.c1": reg(&c.C1),
+		"r.d1": reg(&c.D1),
+		"r.e1": reg(&c.E1),
+		"r.h1": reg(&c.H1),
+		"r.l1": reg(&c.L1),
+
+		"r.af": pair(&c.A, &c.F),
+		"r.bc": pair(&c.B, &c.C),
+		"r.de": pair(&c.D, &c.E),
+		"r.hl": pair(&c.H, &c.L),
+
+		"r.af1": pair(&c.A1, &c.F1),
+		"r.bc1": pair(&c.B1, &c.C1),
+		"r.de1": pair(&c.D1, &c.E1),
+		"r.hl1": pair(&c.H1, &c.L1),
+
+		"r.i":   reg(&c.I),
+		"r.r":   reg(&c.R),
+		"r.ixh": reg(&c.IXH),
+		"r.ixl": reg(&c.IXL),
+		"r.iyh": reg(&c.IYH),
+		"r.iyl": reg(&c.IYL),
+		"r.sp":  func() int { return int(c.SP) },
+		"r.ix":  pair(&c.IXH, &c.IXL),
+		"r.iy":  pair(&c.IYH, &c.IYL),
+
+		"r.iff1": boolean(&c.IFF1),
+		"r.iff2": boolean(&c.IFF2),
+		"r.im":   reg(&c.IM),
+
+		"f.c": flag(FlagC),
+		"f.n": flag(FlagN),
+		"f.v": flag(FlagV),
+		"f.p": flag(FlagP),
+		"f.3": flag(Flag3),
+		"f.h": flag(FlagH),
+		"f.5": flag(Flag5),
+		"f.z": flag(FlagZ),
+		"f.s": flag(FlagS),
+	}
+}
+
+// StackPointer returns the value of the stack pointer.
+func (c *CPU) StackPointer() int {
+	return int(c.SP)
+}
+
+// IsCall returns true if the next instruction is a CALL, conditional or
+// not, or an RST.
+func (c *CPU) IsCall() bool {
+	op := c.mem.Peek(int(c.pc))
+	return op == 0xcd || op&0xc7 == 0xc4 || op&0xc7 == 0xc7
+}
+
+// IsReturn returns true if the next instruction is a RET, conditional or
+// not, a RETI, or a RETN.
+func (c *CPU) IsReturn() bool {
+	op := c.mem.Peek(int(c.pc))
+	if op == 0xed {
+		return c.mem.Peek(int(c.pc+1))&0xc7 == 0x45
+	}
+	return op == 0xc9 || op&0xc7 == 0xc0
+}
+
+// SnapshotRegisters saves the registers for the execution history.
+func (c *CPU) SnapshotRegisters(r *rcs.RegisterSnapshot) {
+	r[0], r[1], r[2], r[3], r[4], r[5], r[6], r[7] =
+		c.A, c.F, c.B, c.C, c.D, c.E, c.H, c.L
+	r[8], r[9], r[10], r[11] = c.IXH, c.IXL, c.IYH, c.IYL
+	r[12], r[13] = uint8(c.SP>>8), uint8(c.SP)
+}
+
+// FormatSnapshot formats registers saved with SnapshotRegisters.
+func (c *CPU) FormatSnapshot(r *rcs.RegisterSnapshot) string {
+	return fmt.Sprintf("af:%02x%02x bc:%02x%02x de:%02x%02x hl:%02x%02x "+
+		"ix:%02x%02x iy:%02x%02x sp:%02x%02x",
+		r[0], r[1], r[2], r[3], r[4], r[5], r[6], r[7],
+		r[8], r[9], r[10], r[11], r[12], r[13])
+}
+
 // NewDisassembler creates a disassembler that can handle Z80 machine
 // code.
 func (c *CPU) NewDisassembler() *rcs.Disassembler {
@@ -247,9 +386,14 @@ func (c *CPU) NewDisassembler() *rcs.Disassembler {
 	return dasm
 }
 
+// NewAssembler creates an assembler that can produce Z80 machine code.
+func (c *CPU) NewAssembler() *rcs.Assembler {
+	return rcs.NewAssembler(Writer)
+}
+
 func (c *CPU) fetch() uint8 {
 	c.pc++
-	return c.mem.Read(int(c.pc - 1))
+	return c.mem.Fetch(int(c.pc - 1))
 }
 
 func (c *CPU) fetch2() int {
@@ -349,6 +493,16 @@ func (c *CPU) Save(enc *rcs.Encoder) {
 	enc.Encode(c.IFF2)
 	enc.Encode(c.IM)
 	enc.Encode(c.Halt)
+
+	// added after the initial format and kept at the end so that older
+	// states can be extended
+	enc.Encode(c.E)
+	enc.Encode(c.E1)
+	enc.Encode(c.IRQ)
+	enc.Encode(c.IRQData)
+	enc.Encode(c.NMI)
+	enc.Encode(c.RESET)
+	enc.Encode(c.cycles)
 }
 
 func (c *CPU) Load(dec *rcs.Decoder) {
@@ -381,6 +535,14 @@ func (c *CPU) Load(dec *rcs.Decoder) {
 	dec.Decode(&c.IFF2)
 	dec.Decode(&c.IM)
 	dec.Decode(&c.Halt)
+
+	dec.Decode(&c.E)
+	dec.Decode(&c.E1)
+	dec.Decode(&c.IRQ)
+	dec.Decode(&c.IRQData)
+	dec.Decode(&c.NMI)
+	dec.Decode(&c.RESET)
+	dec.Decode(&c.cycles)
 }
 
 func (c *CPU) prefix() string {
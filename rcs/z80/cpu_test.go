@@ -2,6 +2,9 @@ package z80
 
 import (
 	"testing"
+
+	"github.com/blackchip-org/retro-cs/mock"
+	"github.com/blackchip-org/retro-cs/rcs"
 )
 
 func TestString(t *testing.T) {
@@ -43,3 +46,91 @@ func TestString(t *testing.T) {
 		t.Errorf("\n have: \n%v \n want: \n%v", have, want)
 	}
 }
+
+func TestInterruptTStates(t *testing.T) {
+	var tests = []struct {
+		name  string
+		setup func(*CPU)
+		want  int
+	}{
+		{"halt", func(c *CPU) {
+			c.Halt = true
+		}, 4},
+		{"irq mode 1", func(c *CPU) {
+			c.IM = 1
+			c.IFF1 = true
+			c.IRQ = true
+		}, 4 + 13},
+		{"irq mode 2", func(c *CPU) {
+			c.IM = 2
+			c.IFF1 = true
+			c.IRQ = true
+		}, 4 + 19},
+		{"irq disabled", func(c *CPU) {
+			c.IM = 1
+			c.IRQ = true
+		}, 4},
+		{"nmi", func(c *CPU) {
+			c.NMI = true
+		}, 4 + 11},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock.ResetMemory()
+			cpu := New(mock.TestMemory)
+			cpu.SP = 0x8000
+			test.setup(cpu)
+			cpu.Next()
+			have := cpu.Cycles()
+			if have != test.want {
+				t.Errorf("\n have: %v \n want: %v", have, test.want)
+			}
+		})
+	}
+}
+
+func TestCallReturn(t *testing.T) {
+	tests := []struct {
+		name string
+		code []uint8
+		call bool
+		ret  bool
+	}{
+		{"call", []uint8{0xcd, 0x00, 0x30}, true, false},
+		{"call nz", []uint8{0xc4, 0x00, 0x30}, true, false},
+		{"call m", []uint8{0xfc, 0x00, 0x30}, true, false},
+		{"rst 38h", []uint8{0xff}, true, false},
+		{"ret", []uint8{0xc9}, false, true},
+		{"ret z", []uint8{0xc8}, false, true},
+		{"reti", []uint8{0xed, 0x4d}, false, true},
+		{"retn", []uint8{0xed, 0x45}, false, true},
+		{"jp", []uint8{0xc3, 0x00, 0x30}, false, false},
+		{"ld a,i", []uint8{0xed, 0x57}, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock.ResetMemory()
+			cpu := New(mock.TestMemory)
+			cpu.mem.WriteN(0, test.code...)
+			if cpu.IsCall() != test.call || cpu.IsReturn() != test.ret {
+				t.Errorf("\n have: %v %v \n want: %v %v", cpu.IsCall(), cpu.IsReturn(),
+					test.call, test.ret)
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	cpu := New(mock.TestMemory)
+	cpu.A, cpu.F, cpu.H, cpu.L = 0x12, 0x34, 0x56, 0x78
+	cpu.IXH, cpu.IYL, cpu.SP = 0x9a, 0xbc, 0xdef0
+	var r rcs.RegisterSnapshot
+	cpu.SnapshotRegisters(&r)
+	cpu.A = 0
+	have := cpu.FormatSnapshot(&r)
+	want := "af:1234 bc:0000 de:0000 hl:5678 ix:9a00 iy:00bc sp:def0"
+	if have != want {
+		t.Errorf("\n have: %v \n want: %v", have, want)
+	}
+}
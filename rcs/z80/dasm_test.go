@@ -136,3 +136,31 @@ func TestInvalidFDCB(t *testing.T) {
 		})
 	}
 }
+
+func TestDasmSymbols(t *testing.T) {
+	var tests = []struct {
+		name  string
+		bytes []uint8
+		want  string
+	}{
+		{"jp", []uint8{0xc3, 0x38, 0x00}, "jp   RST38"},
+		{"call", []uint8{0xcd, 0x38, 0x00}, "call RST38"},
+		{"call nz", []uint8{0xc4, 0x38, 0x00}, "call nz,RST38"},
+		{"jr", []uint8{0x18, 0x26}, "jr   RST38"},
+		{"ld", []uint8{0x21, 0x38, 0x00}, "ld   hl,$0038"},
+		{"unknown", []uint8{0xc3, 0x40, 0x00}, "jp   $0040"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock.ResetMemory()
+			mock.TestMemory.WriteN(0x10, test.bytes...)
+			dasm := NewDisassembler(mock.TestMemory)
+			dasm.Symbols = rcs.Symbols{0x10: "START", 0x38: "RST38"}
+			dasm.SetPC(0x10)
+			s := dasm.NextStmt()
+			if s.Op != test.want || s.Label != "START" {
+				t.Errorf("\n have: %v %v \n want: START %v", s.Label, s.Op, test.want)
+			}
+		})
+	}
+}
@@ -191,6 +191,7 @@ func call(cpu *CPU, flag uint8, condition bool, load rcs.Load) {
 		cpu.SP -= 2
 		cpu.mem.WriteLE(int(cpu.SP), cpu.PC())
 		cpu.SetPC(addr)
+		cpu.cycles += tstatesCall
 	}
 }
 
@@ -298,6 +299,7 @@ func cpxr(cpu *CPU, increment int) {
 		return
 	}
 	cpu.SetPC(cpu.PC() - 2)
+	cpu.cycles += tstatesRepeat
 }
 
 // decimal adjust in a
@@ -414,6 +416,7 @@ func djnz(cpu *CPU, load rcs.Load8) {
 	cpu.B--
 	if cpu.B != 0 {
 		cpu.SetPC(cpu.PC() + int(int8(delta)))
+		cpu.cycles += tstatesJR
 	}
 }
 
@@ -552,10 +555,9 @@ func inx(cpu *CPU, increment int) {
 // port in, blocked, repeat
 func inxr(cpu *CPU, increment int) {
 	inx(cpu, increment)
-	for cpu.B != 0 {
-		cpu.refreshR()
-		cpu.refreshR()
-		inx(cpu, increment)
+	if cpu.B != 0 {
+		cpu.SetPC(cpu.PC() - 2)
+		cpu.cycles += tstatesRepeat
 	}
 }
 
@@ -578,6 +580,7 @@ func jr(cpu *CPU, flag uint8, condition bool, load rcs.Load8) {
 	flagSet := cpu.F&flag != 0
 	if flagSet == condition {
 		cpu.SetPC(cpu.PC() + delta)
+		cpu.cycles += tstatesJR
 	}
 }
 
@@ -650,10 +653,9 @@ func ldx(cpu *CPU, increment int) {
 
 func ldxr(cpu *CPU, increment int) {
 	ldx(cpu, increment)
-	for cpu.B != 0 || cpu.C != 0 {
-		cpu.refreshR()
-		cpu.refreshR()
-		ldx(cpu, increment)
+	if cpu.B != 0 || cpu.C != 0 {
+		cpu.SetPC(cpu.PC() - 2)
+		cpu.cycles += tstatesRepeat
 	}
 }
 
@@ -732,10 +734,9 @@ func outx(cpu *CPU, increment int) {
 // port out, blocked, repeat
 func outxr(cpu *CPU, increment int) {
 	outx(cpu, increment)
-	for cpu.B != 0 {
-		cpu.refreshR()
-		cpu.refreshR()
-		outx(cpu, increment)
+	if cpu.B != 0 {
+		cpu.SetPC(cpu.PC() - 2)
+		cpu.cycles += tstatesRepeat
 	}
 }
 
@@ -761,6 +762,7 @@ func res(cpu *CPU, n int, store rcs.Store8, load rcs.Load8) {
 func ret(cpu *CPU, flag uint8, value bool) {
 	if (cpu.F&flag != 0) == value {
 		reta(cpu)
+		cpu.cycles += tstatesRet
 	}
 }
 
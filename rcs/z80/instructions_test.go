@@ -50,10 +50,9 @@ func TestOps(t *testing.T) {
 						break
 					}
 				} else {
-					if cpu.mem.Read(cpu.PC()) == 0 && cpu.PC() != 0 {
-						break
-					}
-					if test.tstates == 1 {
+					// run until the number of T-states in the test
+					// have elapsed
+					if cpu.Cycles() >= test.tstates {
 						break
 					}
 				}
@@ -67,6 +66,9 @@ func TestOps(t *testing.T) {
 			if cpu.String() != expected.String() {
 				t.Errorf("\n have: \n%v \n want: \n%v", cpu.String(), expected.String())
 			}
+			if cpu.Cycles() != fuseExpected[test.name].tstates {
+				t.Errorf("\n have: %v tstates \n want: %v tstates", cpu.Cycles(), fuseExpected[test.name].tstates)
+			}
 			testMemory(t, cpu.mem, fuseExpected[test.name].memory)
 			testMemory(t, cpu.Ports, fuseExpected[test.name].portWrites)
 			testHalt(t, cpu, fuseExpected[test.name])
@@ -44,14 +44,18 @@ func op1(e rcs.StmtEval, parts ...string) {
 			delta := e.Ptr.Fetch()
 			e.Stmt.Bytes = append(e.Stmt.Bytes, delta)
 			addr := displace(e.Stmt.Addr+2, delta)
-			v = fmt.Sprintf("$%04x", addr)
+			v = e.Target(int(addr))
 		case part == "&0000":
 			lo := e.Ptr.Fetch()
 			e.Stmt.Bytes = append(e.Stmt.Bytes, lo)
 			hi := e.Ptr.Fetch()
 			e.Stmt.Bytes = append(e.Stmt.Bytes, hi)
 			addr := int(hi)<<8 | int(lo)
-			v = fmt.Sprintf("$%04x", addr)
+			if parts[0] == "jp" || parts[0] == "call" {
+				v = e.Target(addr)
+			} else {
+				v = fmt.Sprintf("$%04x", addr)
+			}
 		case part == "(&0000)":
 			lo := e.Ptr.Fetch()
 			e.Stmt.Bytes = append(e.Stmt.Bytes, lo)
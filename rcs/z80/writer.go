@@ -0,0 +1,273 @@
+package z80
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/blackchip-org/retro-cs/rcs"
+)
+
+// asmTemplate is the encoding of an instruction found by disassembling it.
+// Arguments that are values use placeholders of "<n>" for a byte, "<nn>"
+// for a word, "<e>" for a relative address, and "<d>" for an index
+// displacement, "(ix+<d>)".
+type asmTemplate struct {
+	args  []string // arguments, "a", "(<nn>)"
+	code  []uint8  // encoding with zeros for the values
+	slots []int    // index in code of each value
+}
+
+// placeholder is the byte used for values when disassembling instructions
+// to build the templates. A word becomes $3434 and a relative address is
+// $34 bytes after the instruction.
+const placeholder = 0x34
+
+// templateOrigin is the address used when disassembling instructions to
+// build the templates.
+const templateOrigin = 0x1000
+
+var (
+	asmTemplates    map[string][]asmTemplate
+	asmTemplateOnce sync.Once
+)
+
+// buildTemplates disassembles every opcode to find the encoding of each
+// instruction. When more than one opcode disassembles to the same
+// instruction, the first one found is used, with unprefixed opcodes
+// before prefixed ones.
+func buildTemplates() {
+	asmTemplates = make(map[string][]asmTemplate)
+	ram := make([]uint8, 0x10000)
+	mem := rcs.NewMemory(1, len(ram))
+	mem.MapRAM(0, ram)
+	dasm := NewDisassembler(mem)
+	seen := make(map[string]bool)
+
+	prefixes := [][]uint8{{}, {0xcb}, {0xed}, {0xdd}, {0xfd}, {0xdd, 0xcb}, {0xfd, 0xcb}}
+	for _, prefix := range prefixes {
+		for opcode := 0; opcode <= 0xff; opcode++ {
+			code := append(append([]uint8{}, prefix...), uint8(opcode))
+			var slots []int
+			if len(prefix) == 2 {
+				// displacement comes before the opcode, "dd cb d op"
+				code = []uint8{prefix[0], prefix[1], placeholder, uint8(opcode)}
+				slots = append(slots, 2)
+			}
+			for i := 0; i < 8; i++ {
+				ram[templateOrigin+i] = placeholder
+			}
+			copy(ram[templateOrigin:], code)
+			dasm.SetPC(templateOrigin)
+			s := dasm.NextStmt()
+			if strings.HasPrefix(s.Op, "?") || len(s.Bytes) < len(code) {
+				continue
+			}
+			for i := len(code); i < len(s.Bytes); i++ {
+				slots = append(slots, i)
+			}
+			code = append(code, make([]uint8, len(s.Bytes)-len(code))...)
+			for _, i := range slots {
+				code[i] = 0
+			}
+
+			fields := strings.SplitN(s.Op, " ", 2)
+			var args []string
+			if len(fields) > 1 {
+				args = rcs.SplitOperands(fields[1])
+			}
+			size := 0
+			for i, arg := range args {
+				args[i] = templateArg(arg)
+				size += argSize(args[i])
+			}
+			if size != len(slots) {
+				continue
+			}
+			key := fields[0] + " " + strings.Join(args, ",")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			asmTemplates[fields[0]] = append(asmTemplates[fields[0]], asmTemplate{
+				args:  args,
+				code:  code,
+				slots: slots,
+			})
+		}
+	}
+}
+
+// templateArg replaces the placeholder values in a disassembled argument
+// with their names.
+func templateArg(arg string) string {
+	switch arg {
+	case "$3434":
+		return "<nn>"
+	case "($3434)":
+		return "(<nn>)"
+	case "$34":
+		return "<n>"
+	case "($34)":
+		return "(<n>)"
+	case "(ix+$34)":
+		return "(ix+<d>)"
+	case "(iy+$34)":
+		return "(iy+<d>)"
+	case fmt.Sprintf("$%04x", templateOrigin+2+placeholder):
+		return "<e>"
+	}
+	return arg
+}
+
+// argSize returns the number of bytes used by the value in an argument.
+func argSize(arg string) int {
+	switch arg {
+	case "<nn>", "(<nn>)":
+		return 2
+	case "<n>", "(<n>)", "<e>", "(ix+<d>)", "(iy+<d>)":
+		return 1
+	}
+	return 0
+}
+
+// registers are names that cannot be used as values in an argument.
+var registers = map[string]bool{
+	"a": true, "b": true, "c": true, "d": true, "e": true, "h": true,
+	"l": true, "i": true, "r": true, "af": true, "af'": true, "bc": true,
+	"de": true, "hl": true, "sp": true, "ix": true, "iy": true,
+	"ixh": true, "ixl": true, "iyh": true, "iyl": true, "nz": true,
+	"z": true, "nc": true, "po": true, "pe": true, "p": true, "m": true,
+}
+
+// Writer encodes a Z80 instruction. The instructions are those known to
+// the disassembler. Arguments that are registers or conditions are
+// matched exactly while the others are expressions.
+func Writer(e rcs.AsmEval) ([]uint8, error) {
+	asmTemplateOnce.Do(buildTemplates)
+	templates, ok := asmTemplates[e.Op]
+	if !ok {
+		return nil, fmt.Errorf("no such instruction: %v", e.Op)
+	}
+	args := rcs.SplitOperands(e.Operand)
+	// Prefer an exact match so that "ld a,(hl)" is not mistaken for
+	// "ld a,(<nn>)" with a label named "hl".
+	for _, exact := range []bool{true, false} {
+		for _, t := range templates {
+			code, ok, err := t.encode(e, args, exact)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return code, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid arguments: %v %v", e.Op, e.Operand)
+}
+
+// encode returns false if the arguments do not match the template. When
+// exact is true, only templates without values are considered.
+func (t asmTemplate) encode(e rcs.AsmEval, args []string, exact bool) ([]uint8, bool, error) {
+	if len(args) != len(t.args) {
+		return nil, false, nil
+	}
+	var exprs []string
+	for i, arg := range t.args {
+		have := strings.ToLower(strings.Replace(args[i], " ", "", -1))
+		switch {
+		case argSize(arg) == 0:
+			if !matchLiteral(e, arg, have) {
+				return nil, false, nil
+			}
+			continue
+		case exact:
+			return nil, false, nil
+		case arg == "(ix+<d>)" || arg == "(iy+<d>)":
+			if !isIndex(have) || !strings.HasPrefix(have, arg[:3]) {
+				return nil, false, nil
+			}
+			expr := strings.TrimSpace(args[i])
+			expr = strings.TrimSpace(strings.TrimSpace(expr[1 : len(expr)-1])[2:])
+			switch {
+			case expr == "":
+				expr = "0"
+			case expr[0] == '+':
+				expr = expr[1:]
+			case expr[0] != '-':
+				return nil, false, nil
+			}
+			exprs = append(exprs, expr)
+		case strings.HasPrefix(arg, "("):
+			if !rcs.IsWrapped(have) || isIndex(have) || registers[have[1:len(have)-1]] {
+				return nil, false, nil
+			}
+			expr := strings.TrimSpace(args[i])
+			exprs = append(exprs, expr[1:len(expr)-1])
+		default:
+			if rcs.IsWrapped(have) || registers[have] {
+				return nil, false, nil
+			}
+			exprs = append(exprs, args[i])
+		}
+	}
+
+	code := append([]uint8{}, t.code...)
+	slot := 0
+	for _, arg := range t.args {
+		size := argSize(arg)
+		if size == 0 {
+			continue
+		}
+		v, err := e.Eval(exprs[0])
+		if err != nil {
+			return nil, false, err
+		}
+		exprs = exprs[1:]
+		if arg == "<e>" {
+			delta := v - (e.Addr + len(code))
+			if e.Final && (delta < -0x80 || delta > 0x7f) {
+				return nil, false, fmt.Errorf("branch out of range: $%04x", v)
+			}
+			v = delta
+		}
+		if size == 1 {
+			if err := rcs.CheckByte(v); err != nil {
+				return nil, false, err
+			}
+			code[t.slots[slot]] = uint8(v)
+		} else {
+			if err := rcs.CheckWord(v); err != nil {
+				return nil, false, err
+			}
+			code[t.slots[slot]] = uint8(v)
+			code[t.slots[slot+1]] = uint8(v >> 8)
+		}
+		slot += size
+	}
+	return code, true, nil
+}
+
+// isIndex returns true if the argument is an index register with a
+// displacement, "(ix+5)", or without one, "(ix)".
+func isIndex(have string) bool {
+	if !rcs.IsWrapped(have) || len(have) < 4 {
+		return false
+	}
+	if !strings.HasPrefix(have, "(ix") && !strings.HasPrefix(have, "(iy") {
+		return false
+	}
+	next := have[3]
+	return next == '+' || next == '-' || next == ')'
+}
+
+// matchLiteral returns true if the argument is the same as the one in the
+// template. Numbers in the template, such as the address in "rst $38",
+// are compared by value.
+func matchLiteral(e rcs.AsmEval, want string, have string) bool {
+	if strings.HasPrefix(want, "$") {
+		v, err := e.Eval(have)
+		return err == nil && fmt.Sprintf("$%02x", v) == want
+	}
+	return want == have
+}
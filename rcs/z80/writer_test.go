@@ -0,0 +1,138 @@
+package z80
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/blackchip-org/retro-cs/mock"
+	"github.com/blackchip-org/retro-cs/rcs"
+)
+
+// TestRoundTrip disassembles every opcode, assembles the result, and
+// checks that the new bytes disassemble to the same instruction. The bytes
+// may differ when more than one opcode performs the same instruction.
+func TestRoundTrip(t *testing.T) {
+	prefixes := [][]uint8{{}, {0xcb}, {0xed}, {0xdd}, {0xfd}, {0xdd, 0xcb}, {0xfd, 0xcb}}
+	for _, prefix := range prefixes {
+		for i := 0; i <= 0xff; i++ {
+			code := append(append([]uint8{}, prefix...), uint8(i), 0x56, 0x12)
+			if len(prefix) == 2 {
+				code = []uint8{prefix[0], prefix[1], 0xfe, uint8(i)}
+			}
+			name := fmt.Sprintf("% x", code[:len(code)-2])
+			t.Run(name, func(t *testing.T) {
+				mock.ResetMemory()
+				mock.TestMemory.WriteN(0x1000, code...)
+				dasm := NewDisassembler(mock.TestMemory)
+				dasm.SetPC(0x1000)
+				want := dasm.NextStmt()
+				if strings.HasPrefix(want.Op, "?") {
+					return
+				}
+				a := rcs.NewAssembler(Writer)
+				out, err := a.AssembleLine(0x1000, want.Op)
+				if err != nil {
+					t.Fatalf("%v: %v", want.Op, err)
+				}
+				mock.TestMemory.WriteN(0x1000, out...)
+				dasm.SetPC(0x1000)
+				have := dasm.NextStmt()
+				if have.Op != want.Op {
+					t.Errorf("\n have: %v % x \n want: %v % x", have.Op, have.Bytes, want.Op, want.Bytes)
+				}
+			})
+		}
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	src := `
+        .org $0038
+rst38:  push af
+        ld   hl,msg
+loop:   ld   a,(hl)
+        or   a
+        jr   z,done
+        out  ($01),a
+        inc  hl
+        jr   loop
+done:   pop  af
+        reti
+msg:    .byte "OK", 0
+`
+	a := rcs.NewAssembler(Writer)
+	prog, err := a.Assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint8{
+		0xf5,             // push af
+		0x21, 0x48, 0x00, // ld hl,msg
+		0x7e,       // ld a,(hl)
+		0xb7,       // or a
+		0x28, 0x05, // jr z,done
+		0xd3, 0x01, // out ($01),a
+		0x23,       // inc hl
+		0x18, 0xf7, // jr loop
+		0xf1,       // pop af
+		0xed, 0x4d, // reti
+		0x4f, 0x4b, 0x00, // msg
+	}
+	if prog.Origin != 0x38 || !bytes.Equal(prog.Code, want) {
+		t.Errorf("\n have: $%04x % x \n want: $0038 % x", prog.Origin, prog.Code, want)
+	}
+}
+
+func TestAssembleArgs(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []uint8
+	}{
+		{"ld a,b", []uint8{0x78}},
+		{"LD A,(HL)", []uint8{0x7e}},
+		{"ld a,($1234)", []uint8{0x3a, 0x34, 0x12}},
+		{"ld a,(1+2)*3", []uint8{0x3e, 0x09}},
+		{"ld (ix+5),$12", []uint8{0xdd, 0x36, 0x05, 0x12}},
+		{"ld b,(iy-2)", []uint8{0xfd, 0x46, 0xfe}},
+		{"ld c,(ix)", []uint8{0xdd, 0x4e, 0x00}},
+		{"bit 7,(ix+1)", []uint8{0xdd, 0xcb, 0x01, 0x7e}},
+		{"rst $38", []uint8{0xff}},
+		{"rst 8", []uint8{0xcf}},
+		{"ex af,af'", []uint8{0x08}},
+		{"jp (hl)", []uint8{0xe9}},
+		{"djnz *", []uint8{0x10, 0xfe}},
+	}
+	for _, test := range tests {
+		a := rcs.NewAssembler(Writer)
+		have, err := a.AssembleLine(0x1000, test.src)
+		if err != nil {
+			t.Errorf("%v: %v", test.src, err)
+			continue
+		}
+		if !bytes.Equal(have, test.want) {
+			t.Errorf("%v:\n have: % x \n want: % x", test.src, have, test.want)
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"foo", "no such instruction: foo"},
+		{"ld bc,(hl)", "invalid arguments: ld bc,(hl)"},
+		{"ld a,$100", "value out of range: 256"},
+		{"jr $2000", "branch out of range: $2000"},
+		{"rst 3", "invalid arguments: rst 3"},
+	}
+	for _, test := range tests {
+		a := rcs.NewAssembler(Writer)
+		_, err := a.AssembleLine(0x1000, test.src)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("\n have: %v \n want: %v", err, test.want)
+		}
+	}
+}
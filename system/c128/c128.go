@@ -23,13 +23,27 @@ type System struct {
 	IO      *rcs.Memory
 }
 
+// stateVersion is the version of the state saved by the system.
+const stateVersion = 1
+
+// banks is the number of memory configurations, one for each value of the
+// configuration register.
+const banks = 256
+
 func New(ctx rcs.SDLContext) (*rcs.Mach, error) {
-	s := &System{}
 	roms, err := rcs.LoadROMs(config.DataDir, SystemROM)
 	if err != nil {
 		return nil, err
 	}
-	s.mem = rcs.NewMemory(256, 0x10000)
+	return newMach(ctx, roms, banks)
+}
+
+// newMach creates the machine with memory for the first n configurations.
+// Fewer than all of them are only used by tests that do not change the
+// configuration as each one has its own mappings for every address.
+func newMach(ctx rcs.SDLContext, roms map[string][]byte, n int) (*rcs.Mach, error) {
+	s := &System{}
+	s.mem = rcs.NewMemory(n, 0x10000)
 	s.BasicLo = roms["basiclo"]
 	s.BasicHi = roms["basichi"]
 	s.CharGen = roms["chargen"]
@@ -49,7 +63,7 @@ func New(ctx rcs.SDLContext) (*rcs.Mach, error) {
 	}
 
 	// map banks
-	for i := 0; i < 256; i++ {
+	for i := 0; i < n; i++ {
 		s.mem.SetBank(i)
 		cr := uint8(i)
 		blockRAM := rcs.SliceBits(cr, 6, 7)
@@ -121,7 +135,10 @@ func New(ctx rcs.SDLContext) (*rcs.Mach, error) {
 	s.cpu = m6502.New(s.mem)
 
 	mach := &rcs.Mach{
-		Sys: s,
+		Name:  "c128",
+		ROMs:  SystemROM,
+		Sys:   s,
+		Clock: 1022727, // 1.023 MHz (NTSC)
 		Comps: []rcs.Component{
 			rcs.NewComponent("cpu", "m6502", "mem", s.cpu),
 			rcs.NewComponent("mem", "mem", "", s.mem),
@@ -133,14 +150,30 @@ func New(ctx rcs.SDLContext) (*rcs.Mach, error) {
 			"screen":          cbm.ScreenDecoder,
 			"screen-shifted":  cbm.ScreenShiftedDecoder,
 		},
+		Symbols: map[string]rcs.Symbols{
+			"cpu": cbm.KernalSymbols(),
+		},
 		DefaultEncoding: "petscii",
 		Ctx:             ctx,
 		VBlankFunc: func() {
 			s.cpu.IRQ = true
 		},
+		StateVersion: stateVersion,
 	}
 	return mach, nil
 }
 
+func (s *System) Save(enc *rcs.Encoder) {
+	enc.Encode(s.RAM0)
+	enc.Encode(s.RAM1)
+	enc.Encode(s.IORAM)
+}
+
+func (s *System) Load(dec *rcs.Decoder) {
+	dec.Decode(&s.RAM0)
+	dec.Decode(&s.RAM1)
+	dec.Decode(&s.IORAM)
+}
+
 func mapBanks(s *System) {
 }
@@ -68,3 +68,15 @@ func (m *MMU) SetPCR(i int, v uint8) {
 	}
 	m.pcr[i] = v
 }
+
+// Save encodes the load and pre-configuration registers. The
+// configuration register is the bank of the memory and is saved there.
+func (m *MMU) Save(enc *rcs.Encoder) {
+	enc.Encode(m.lcr)
+	enc.Encode(m.pcr)
+}
+
+func (m *MMU) Load(dec *rcs.Decoder) {
+	dec.Decode(&m.lcr)
+	dec.Decode(&m.pcr)
+}
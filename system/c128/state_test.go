@@ -0,0 +1,48 @@
+package c128
+
+import (
+	"testing"
+
+	"github.com/blackchip-org/retro-cs/mock"
+	"github.com/blackchip-org/retro-cs/rcs"
+)
+
+// testROMs creates ROMs with a KERNAL that increments screen memory while
+// the interrupt handler increments a pre-configuration register.
+func testROMs() map[string][]byte {
+	kernal := make([]byte, 0x4000)
+	copy(kernal[0x0000:], []byte{
+		0x58,       // cli
+		0xa2, 0x00, // ldx #$00
+		0xfe, 0x00, 0x04, // loop: inc $0400,x
+		0xe8,             // inx
+		0x4c, 0x03, 0xc0, // jmp loop
+		0xee, 0x01, 0xd5, // irq: inc $d501
+		0x40, // rti
+	})
+	kernal[0x3ffc] = 0x00 // reset vector
+	kernal[0x3ffd] = 0xc0
+	kernal[0x3ffe] = 0x0a // irq vector
+	kernal[0x3fff] = 0xc0
+
+	return map[string][]byte{
+		"basiclo": make([]byte, 0x4000),
+		"basichi": make([]byte, 0x4000),
+		"chargen": make([]byte, 0x1000),
+		"kernal":  kernal,
+	}
+}
+
+func TestState(t *testing.T) {
+	mock.TestState(t, mock.StateTest{
+		NewMach: func(roms map[string][]byte) (*rcs.Mach, error) {
+			// the program stays in the first configuration and the
+			// mappings of all of them would take gigabytes for the two
+			// machines
+			return newMach(rcs.SDLContext{}, roms, 1)
+		},
+		ROMs:   testROMs(),
+		Before: 10,
+		Frames: 10,
+	})
+}
@@ -9,39 +9,40 @@ import (
 )
 
 type system struct {
-	cpu  *m6502.CPU
-	mem  *rcs.Memory
-	ram  []uint8
-	io   []uint8
-	bank uint8
+	cpu   *m6502.CPU
+	mem   *rcs.Memory
+	ram   []uint8
+	io    []uint8
+	bank  uint8
+	video *video
+	kb    *keyboard
 }
 
+// stateVersion is the version of the state saved by the system.
+const stateVersion = 2
+
 func New(ctx rcs.SDLContext) (*rcs.Mach, error) {
-	s := &system{}
 	roms, err := rcs.LoadROMs(config.DataDir, SystemROM)
 	if err != nil {
 		return nil, err
 	}
+	return newMach(ctx, roms)
+}
+
+func newMach(ctx rcs.SDLContext, roms map[string][]byte) (*rcs.Mach, error) {
+	s := &system{}
 	s.ram = make([]uint8, 0x10000, 0x10000)
 	s.io = make([]uint8, 0x1000, 0x1000)
 
 	s.mem = newMemory(s.ram, s.io, roms)
 	kb := newKeyboard()
 
-	var screen rcs.Screen
-	video := &video{}
-	if ctx.Renderer != nil {
-		video, err = newVideo(ctx.Renderer, s.mem, roms["chargen"])
-		if err != nil {
-			return nil, err
-		}
-		screen = rcs.Screen{
-			W:         screenW,
-			H:         screenH,
-			Texture:   video.texture,
-			ScanLineH: true,
-			Draw:      video.draw,
-		}
+	video := newVideo(s.mem, roms["chargen"])
+	screen := rcs.Screen{
+		W:         screenW,
+		H:         screenH,
+		ScanLineH: true,
+		Draw:      video.draw,
 	}
 
 	for b := 0; b < 32; b++ {
@@ -53,11 +54,10 @@ func New(ctx rcs.SDLContext) (*rcs.Mach, error) {
 		s.mem.MapRW(0xd020, &video.borderColor)
 		s.mem.MapRW(0xd021, &video.bgColor)
 
-		s.mem.MapRW(0x0091, &kb.stkey) // stop key
-		s.mem.MapRW(0x00c6, &kb.ndx)   // buffer index
-		s.mem.MapRAM(0x0277, kb.buf)
-
-		s.mem.MapRW(0xdc00, &kb.joy2)
+		// CIA #1 ports for the keyboard and joystick
+		s.mem.MapLoad(0xdc00, kb.loadPRA)
+		s.mem.MapStore(0xdc00, kb.storePRA)
+		s.mem.MapLoad(0xdc01, kb.loadPRB)
 	}
 	// Initialize to bank 31
 	s.mem.SetBank(31)
@@ -69,9 +69,14 @@ func New(ctx rcs.SDLContext) (*rcs.Mach, error) {
 	// CPU should be created after memory is completely setup to obtain
 	// the correct reset vector
 	s.cpu = m6502.New(s.mem)
+	s.video = video
+	s.kb = kb
 
 	mach := &rcs.Mach{
-		Sys: s,
+		Name:  "c64",
+		ROMs:  SystemROM,
+		Sys:   s,
+		Clock: 1022727, // 1.023 MHz (NTSC)
 		Comps: []rcs.Component{
 			rcs.NewComponent("c64", "c64", "", s),
 			rcs.NewComponent("cpu", "m6502", "mem", s.cpu),
@@ -83,13 +88,23 @@ func New(ctx rcs.SDLContext) (*rcs.Mach, error) {
 			"screen":          cbm.ScreenDecoder,
 			"screen-shifted":  cbm.ScreenShiftedDecoder,
 		},
+		Symbols: map[string]rcs.Symbols{
+			"cpu": cbm.KernalSymbols(),
+		},
 		DefaultEncoding: "petscii",
 		Ctx:             ctx,
 		VBlankFunc: func() {
 			s.cpu.IRQ = true
 		},
 		Screen:   screen,
-		Keyboard: kb.handle,
+		Input:    kb.handle,
+		Bindings: bindings(),
+
+		StateVersion: stateVersion,
+		StateMigrations: map[int]func(*rcs.State) error{
+			0: migrateLegacy,
+			1: migrate1,
+		},
 	}
 
 	return mach, nil
@@ -108,13 +123,67 @@ func (s *system) ioPortLoad() uint8 {
 }
 
 func (s *system) Save(enc *rcs.Encoder) {
-	s.cpu.Save(enc)
 	enc.Encode(s.ram)
 	enc.Encode(s.io)
+	enc.Encode(s.bank)
+	enc.Encode(s.video.borderColor)
+	enc.Encode(s.video.bgColor)
+	enc.Encode(s.kb.pra)
+	enc.Encode(s.kb.joy2)
+	s.kb.keys.Save(enc)
 }
 
 func (s *system) Load(dec *rcs.Decoder) {
-	s.cpu.Load(dec)
 	dec.Decode(&s.ram)
 	dec.Decode(&s.io)
+	dec.Decode(&s.bank)
+	dec.Decode(&s.video.borderColor)
+	dec.Decode(&s.video.bgColor)
+	dec.Decode(&s.kb.pra)
+	dec.Decode(&s.kb.joy2)
+	s.kb.keys.Load(dec)
+}
+
+// migrateLegacy splits a state exported before the container format
+// existed into the cpu section and the c64 section, which holds the
+// same data as in version 1.
+func migrateLegacy(st *rcs.State) error {
+	cpu := &m6502.CPU{}
+	return st.SplitLegacy("c64", cpu, func(dec *rcs.Decoder) {
+		loadLegacyCPU(dec, cpu)
+	})
+}
+
+// loadLegacyCPU decodes the CPU as it was saved in the first version of
+// the state, before the interrupt line and cycle count were included.
+func loadLegacyCPU(dec *rcs.Decoder, cpu *m6502.CPU) {
+	var pc uint16
+	dec.Decode(&pc)
+	cpu.SetPC(int(pc))
+	dec.Decode(&cpu.A)
+	dec.Decode(&cpu.X)
+	dec.Decode(&cpu.Y)
+	dec.Decode(&cpu.SP)
+	dec.Decode(&cpu.SR)
+}
+
+// migrate1 adds the bank, video colors, keyboard and joystick ports, and
+// the keys that are pressed to the c64 section, the remaining CPU state,
+// and the memory section. The values that were not saved are set to those
+// used after the KERNAL starts with nothing pressed.
+func migrate1(st *rcs.State) error {
+	if err := st.Extend("cpu", &m6502.CPU{}); err != nil {
+		return err
+	}
+	s := &system{
+		bank:  0x1f,
+		video: &video{borderColor: 14, bgColor: 6},
+		kb:    newKeyboard(),
+	}
+	if err := st.Extend("c64", s); err != nil {
+		return err
+	}
+	mem := rcs.NewMemory(32, 0)
+	mem.SetBank(31)
+	return st.Put("mem", mem)
 }
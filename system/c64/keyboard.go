@@ -1,213 +1,140 @@
 package c64
 
 import (
-	"github.com/veandco/go-sdl2/sdl"
+	"github.com/blackchip-org/retro-cs/rcs"
 )
 
-const kbBufLen = 10 // length of keyboard buffer
+// Keyboard matrix as seen by CIA #1. Rows are selected by writing to
+// port A and the columns with pressed keys are read from port B.
+// https://www.c64-wiki.com/wiki/Keyboard
+var matrix = [][]rcs.Control{
+	{"del", "return", "crsr-right", "f7", "f1", "f3", "f5", "crsr-down"},
+	{"3", "w", "a", "4", "z", "s", "e", "lshift"},
+	{"5", "r", "d", "6", "c", "f", "t", "x"},
+	{"7", "y", "g", "8", "b", "h", "u", "v"},
+	{"9", "i", "j", "0", "m", "k", "o", "n"},
+	{"plus", "p", "l", "minus", "period", "colon", "at", "comma"},
+	{"pound", "asterisk", "semicolon", "home", "rshift", "equals", "up-arrow", "slash"},
+	{"1", "left-arrow", "ctrl", "2", "space", "commodore", "q", "run-stop"},
+}
+
+// Keys are bound by their position on the keyboard. Joystick #2 is
+// on the numeric keypad.
+func bindings() rcs.Bindings {
+	b := rcs.Bindings{
+		"Backspace":   {"del"},
+		"Return":      {"return"},
+		"Space":       {"space"},
+		"Left Shift":  {"lshift"},
+		"Right Shift": {"rshift"},
+		"Tab":         {"ctrl"},
+		"Left Ctrl":   {"commodore"},
+		"End":         {"run-stop"},
+		"Home":        {"home"},
+		"Page Up":     {"up-arrow"},
+		"`":           {"left-arrow"},
+		"-":           {"minus"},
+		"=":           {"equals"},
+		"[":           {"at"},
+		"]":           {"asterisk"},
+		"\\":          {"pound"},
+		";":           {"semicolon"},
+		"'":           {"colon"},
+		",":           {"comma"},
+		".":           {"period"},
+		"/":           {"slash"},
+		"Keypad +":    {"plus"},
+		"Keypad -":    {"minus"},
+		"Keypad *":    {"asterisk"},
+		"Keypad /":    {"slash"},
+		"F1":          {"f1"},
+		"F2":          {"lshift", "f1"},
+		"F3":          {"f3"},
+		"F4":          {"lshift", "f3"},
+		"F5":          {"f5"},
+		"F6":          {"lshift", "f5"},
+		"F7":          {"f7"},
+		"F8":          {"lshift", "f7"},
+		"Down":        {"crsr-down"},
+		"Right":       {"crsr-right"},
+		"Up":          {"lshift", "crsr-down"},
+		"Left":        {"lshift", "crsr-right"},
+		"Keypad 8":    {rcs.Up},
+		"Keypad 2":    {rcs.Down},
+		"Keypad 4":    {rcs.Left},
+		"Keypad 6":    {rcs.Right},
+		"Keypad 0":    {rcs.Button1},
+		"Right Ctrl":  {rcs.Button1},
+	}
+	for c := '0'; c <= '9'; c++ {
+		b[string(c)] = []rcs.Control{rcs.Control(c)}
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		b[string(c-'a'+'A')] = []rcs.Control{rcs.Control(c)}
+	}
+	return b
+}
 
 type keyboard struct {
-	buf   []uint8
-	ndx   uint8 // Number of characters in keyboard buffer
-	stkey uint8 // Was STOP Key Pressed?
-	joy2  uint8 // HACK: joystick 2, move elsewhere
+	keys *rcs.KeyMatrix
+	pra  uint8 // rows selected by port A, active low
+	joy2 uint8 // joystick #2, active low
 }
 
 func newKeyboard() *keyboard {
 	return &keyboard{
-		buf:  make([]uint8, kbBufLen, kbBufLen),
+		keys: rcs.NewKeyMatrix(matrix),
+		pra:  0xff,
 		joy2: 0xff,
 	}
 }
 
-func (k *keyboard) handle(e *sdl.KeyboardEvent) error {
-	ch, ok := k.lookup(e)
-	if !ok {
+func (k *keyboard) handle(e rcs.InputEvent) error {
+	bit := -1
+	switch e.Control {
+	case rcs.Up:
+		bit = 0
+	case rcs.Down:
+		bit = 1
+	case rcs.Left:
+		bit = 2
+	case rcs.Right:
+		bit = 3
+	case rcs.Button1:
+		bit = 4
+	default:
+		k.keys.Set(e.Control, e.Pressed)
 		return nil
 	}
-	if k.ndx >= kbBufLen {
-		return nil
+	if e.Pressed {
+		k.joy2 &^= 1 << uint(bit)
+	} else {
+		k.joy2 |= 1 << uint(bit)
 	}
-	k.buf[k.ndx] = ch
-	k.ndx++
 	return nil
 }
 
-const (
-	keyCursorDown  = uint8(0x11)
-	keyCursorLeft  = uint8(0x9d)
-	keyCursorRight = uint8(0x1d)
-	keyCursorUp    = uint8(0x91)
-)
-
-// https://wiki.libsdl.org/SDLKeycodeLookup
-type keymap map[sdl.Keycode]uint8
-
-var keys = keymap{
-	sdl.K_BACKSPACE:    0x14,
-	sdl.K_RETURN:       0x0d,
-	sdl.K_SPACE:        0x20,
-	sdl.K_QUOTE:        0x27,
-	sdl.K_PERIOD:       0x2e,
-	sdl.K_COMMA:        0x2c,
-	sdl.K_SLASH:        0x2f,
-	sdl.K_0:            0x30,
-	sdl.K_1:            0x31,
-	sdl.K_2:            0x32,
-	sdl.K_3:            0x33,
-	sdl.K_4:            0x34,
-	sdl.K_5:            0x35,
-	sdl.K_6:            0x36,
-	sdl.K_7:            0x37,
-	sdl.K_8:            0x38,
-	sdl.K_9:            0x39,
-	sdl.K_SEMICOLON:    0x3b,
-	sdl.K_EQUALS:       0x3d,
-	sdl.K_LEFTBRACKET:  0x5b,
-	sdl.K_BACKSLASH:    0x5c, // british pound
-	sdl.K_RIGHTBRACKET: 0x5d,
-	sdl.K_a:            0x41,
-	sdl.K_b:            0x42,
-	sdl.K_c:            0x43,
-	sdl.K_d:            0x44,
-	sdl.K_e:            0x45,
-	sdl.K_f:            0x46,
-	sdl.K_g:            0x47,
-	sdl.K_h:            0x48,
-	sdl.K_i:            0x49,
-	sdl.K_j:            0x4a,
-	sdl.K_k:            0x4b,
-	sdl.K_l:            0x4c,
-	sdl.K_m:            0x4d,
-	sdl.K_n:            0x4e,
-	sdl.K_o:            0x4f,
-	sdl.K_p:            0x50,
-	sdl.K_q:            0x51,
-	sdl.K_r:            0x52,
-	sdl.K_s:            0x53,
-	sdl.K_t:            0x54,
-	sdl.K_u:            0x55,
-	sdl.K_v:            0x56,
-	sdl.K_w:            0x57,
-	sdl.K_x:            0x58,
-	sdl.K_y:            0x59,
-	sdl.K_z:            0x5a,
-	sdl.K_DOWN:         keyCursorDown,
-	sdl.K_LEFT:         keyCursorLeft,
-	sdl.K_RIGHT:        keyCursorRight,
-	sdl.K_UP:           keyCursorUp,
-}
-
-var shifted = keymap{
-	sdl.K_QUOTE:     0x22,
-	sdl.K_PERIOD:    0x3e,
-	sdl.K_COMMA:     0x3c,
-	sdl.K_SLASH:     0x3f,
-	sdl.K_0:         0x29,
-	sdl.K_1:         0x21,
-	sdl.K_2:         0x40,
-	sdl.K_3:         0x23,
-	sdl.K_4:         0x24,
-	sdl.K_5:         0x25,
-	sdl.K_6:         0x5e,
-	sdl.K_7:         0x26,
-	sdl.K_8:         0x2a,
-	sdl.K_9:         0x28,
-	sdl.K_SEMICOLON: 0x3a,
-	sdl.K_EQUALS:    0x2b,
-	sdl.K_a:         0xc1,
-	sdl.K_b:         0xc2,
-	sdl.K_c:         0xc3,
-	sdl.K_d:         0xc4,
-	sdl.K_e:         0xc5,
-	sdl.K_f:         0xc6,
-	sdl.K_g:         0xc7,
-	sdl.K_h:         0xc8,
-	sdl.K_i:         0xc9,
-	sdl.K_j:         0xca,
-	sdl.K_k:         0xcb,
-	sdl.K_l:         0xcc,
-	sdl.K_m:         0xcd,
-	sdl.K_n:         0xce,
-	sdl.K_o:         0xcf,
-	sdl.K_p:         0xd0,
-	sdl.K_q:         0xd1,
-	sdl.K_r:         0xd2,
-	sdl.K_s:         0xd3,
-	sdl.K_t:         0xd4,
-	sdl.K_u:         0xd5,
-	sdl.K_v:         0xd6,
-	sdl.K_w:         0xd7,
-	sdl.K_x:         0xd8,
-	sdl.K_y:         0xd9,
-	sdl.K_z:         0xda,
+func (k *keyboard) storePRA(v uint8) {
+	k.pra = v
 }
 
-var keymaps = map[sdl.Keymod]keymap{
-	sdl.KMOD_NONE:   keys,
-	sdl.KMOD_LSHIFT: shifted,
-	sdl.KMOD_RSHIFT: shifted,
+func (k *keyboard) loadPRA() uint8 {
+	return k.pra & k.joy2
 }
 
-func (k *keyboard) lookup(e *sdl.KeyboardEvent) (uint8, bool) {
-	keysym := e.Keysym
-	switch {
-	/*
-		case keysym.Mod&sdl.KMOD_CTRL > 0 && keysym.Sym == sdl.K_ESCAPE:
-				if e.Type == sdl.KEYUP {
-					k.mach.Reset()
-					return 0, false
-				}
-	*/
-	case keysym.Mod&sdl.KMOD_CTRL > 0 && keysym.Sym == sdl.K_c:
-		if e.Type == sdl.KEYDOWN {
-			k.stkey = 0x7f
+// loadPRB returns the columns that have a key pressed in any of the rows
+// selected with port A.
+func (k *keyboard) loadPRB() uint8 {
+	v := uint8(0xff)
+	for row := uint(0); row < 8; row++ {
+		if k.pra&(1<<row) != 0 {
+			continue
+		}
+		for col := uint(0); col < 8; col++ {
+			if k.keys.Pressed(int(row), int(col)) {
+				v &^= 1 << col
+			}
 		}
-	case keysym.Sym == sdl.K_c && e.Type == sdl.KEYUP:
-		k.stkey = 0xff
-
-	case keysym.Sym == sdl.K_UP && e.Type == sdl.KEYDOWN:
-		k.joy2 &^= (1 << 0)
-	case keysym.Sym == sdl.K_DOWN && e.Type == sdl.KEYDOWN:
-		k.joy2 &^= (1 << 1)
-	case keysym.Sym == sdl.K_LEFT && e.Type == sdl.KEYDOWN:
-		k.joy2 &^= (1 << 2)
-	case keysym.Sym == sdl.K_RIGHT && e.Type == sdl.KEYDOWN:
-		k.joy2 &^= (1 << 3)
-	case keysym.Sym == sdl.K_SPACE && e.Type == sdl.KEYDOWN:
-		k.joy2 &^= (1 << 4)
-
-	case keysym.Sym == sdl.K_UP && e.Type == sdl.KEYUP:
-		k.joy2 |= (1 << 0)
-	case keysym.Sym == sdl.K_DOWN && e.Type == sdl.KEYUP:
-		k.joy2 |= (1 << 1)
-	case keysym.Sym == sdl.K_LEFT && e.Type == sdl.KEYUP:
-		k.joy2 |= (1 << 2)
-	case keysym.Sym == sdl.K_RIGHT && e.Type == sdl.KEYUP:
-		k.joy2 |= (1 << 3)
-	case keysym.Sym == sdl.K_SPACE && e.Type == sdl.KEYUP:
-		k.joy2 |= (1 << 4)
-	}
-
-	if e.Type != sdl.KEYDOWN {
-		return 0, false
-	}
-	keymap0 := keymaps[sdl.KMOD_NONE]
-	mod := sdl.Keymod(keysym.Mod & 0x03) // Just take the lower two bits
-	keymap, ok := keymaps[mod]
-	if !ok {
-		keymap = keymap0
-	}
-	ch, ok := keymap[keysym.Sym]
-	if !ok {
-		ch, ok = keymap0[keysym.Sym]
-	}
-	if !ok {
-		return 0, false
 	}
-	return ch, true
-}
-
-func (k *keyboard) special(keysym sdl.Keysym) bool {
-	return false
+	return v
 }
@@ -0,0 +1,51 @@
+package c64
+
+import (
+	"testing"
+
+	"github.com/blackchip-org/retro-cs/rcs"
+)
+
+func TestKeyboardMatrix(t *testing.T) {
+	k := newKeyboard()
+	k.handle(rcs.InputEvent{Control: "a", Pressed: true})        // row 1, col 2
+	k.handle(rcs.InputEvent{Control: "run-stop", Pressed: true}) // row 7, col 7
+
+	tests := []struct {
+		pra uint8
+		prb uint8
+	}{
+		{0xff, 0xff}, // no rows selected
+		{0x00, 0x7b}, // all rows
+		{0xfd, 0xfb}, // row 1
+		{0x7f, 0x7f}, // row 7
+		{0xfe, 0xff}, // row 0
+	}
+	for _, test := range tests {
+		k.storePRA(test.pra)
+		have := k.loadPRB()
+		if have != test.prb {
+			t.Errorf("pra %02x: \n have: %02x \n want: %02x", test.pra, have, test.prb)
+		}
+	}
+
+	k.handle(rcs.InputEvent{Control: "a", Pressed: false})
+	k.storePRA(0xfd)
+	if have := k.loadPRB(); have != 0xff {
+		t.Errorf("\n have: %02x \n want: ff", have)
+	}
+}
+
+func TestJoystick2(t *testing.T) {
+	k := newKeyboard()
+	k.storePRA(0xff)
+	k.handle(rcs.InputEvent{Control: rcs.Up, Pressed: true})
+	k.handle(rcs.InputEvent{Control: rcs.Button1, Pressed: true})
+	if have := k.loadPRA(); have != 0xee {
+		t.Errorf("\n have: %02x \n want: ee", have)
+	}
+	k.handle(rcs.InputEvent{Control: rcs.Up, Pressed: false})
+	if have := k.loadPRA(); have != 0xef {
+		t.Errorf("\n have: %02x \n want: ef", have)
+	}
+}
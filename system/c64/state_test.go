@@ -0,0 +1,124 @@
+package c64
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/blackchip-org/retro-cs/mock"
+	"github.com/blackchip-org/retro-cs/rcs"
+	"github.com/blackchip-org/retro-cs/rcs/m6502"
+)
+
+func TestMigrateLegacy(t *testing.T) {
+	// state as written by the original export: the CPU followed by the
+	// system in a single stream
+	var buf bytes.Buffer
+	enc := rcs.NewEncoder(&buf)
+	enc.Encode(uint16(0xe000)) // PC
+	enc.Encode(uint8(0x12))    // A
+	enc.Encode(uint8(0))       // X
+	enc.Encode(uint8(0))       // Y
+	enc.Encode(uint8(0xf0))    // SP
+	enc.Encode(uint8(0x20))    // SR
+	enc.Encode([]uint8{1, 2})  // ram
+	enc.Encode([]uint8{3})     // io
+	if enc.Err != nil {
+		t.Fatal(enc.Err)
+	}
+
+	st, err := rcs.ReadState(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations := map[int]func(*rcs.State) error{
+		0: migrateLegacy,
+		1: migrate1,
+	}
+	if err := st.Migrate(stateVersion, migrations); err != nil {
+		t.Fatal(err)
+	}
+	s := &system{cpu: &m6502.CPU{}, video: &video{}, kb: &keyboard{keys: rcs.NewKeyMatrix(matrix)}}
+	if err := st.Get("cpu", s.cpu); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Get("c64", s); err != nil {
+		t.Fatal(err)
+	}
+	mem := rcs.NewMemory(32, 0x10000)
+	if err := st.Get("mem", mem); err != nil {
+		t.Fatal(err)
+	}
+	if s.cpu.A != 0x12 || s.cpu.PC() != 0xe000 || s.cpu.SP != 0xf0 {
+		t.Errorf("cpu not migrated: %v", s.cpu)
+	}
+	if !bytes.Equal(s.ram, []uint8{1, 2}) || !bytes.Equal(s.io, []uint8{3}) {
+		t.Errorf("system not migrated")
+	}
+	if s.bank != 0x1f || mem.Bank() != 31 || s.kb.pra != 0xff || s.kb.joy2 != 0xff ||
+		s.video.borderColor != 14 {
+		t.Errorf("defaults not set: bank %v, mem %v, pra %v, joy2 %v, border %v",
+			s.bank, mem.Bank(), s.kb.pra, s.kb.joy2, s.video.borderColor)
+	}
+}
+
+// testROMs creates ROMs with a KERNAL that increments screen memory,
+// scans the keyboard into the border color, and switches between banks
+// while the interrupt handler increments the background color and adds
+// the values of both CIA ports to totals in zero page.
+func testROMs() map[string][]byte {
+	kernal := make([]byte, 0x2000)
+	copy(kernal[0x0000:], []byte{
+		0x58,       // cli
+		0xa2, 0x00, // ldx #$00
+		0xfe, 0x00, 0x04, // loop: inc $0400,x
+		0xe8,             // inx
+		0x8e, 0x00, 0xdc, // stx $dc00
+		0xad, 0x01, 0xdc, // lda $dc01
+		0x8d, 0x20, 0xd0, // sta $d020
+		0x8a,       // txa
+		0x29, 0x01, // and #$01
+		0x09, 0x06, // ora #$06
+		0x85, 0x01, // sta $01
+		0x4c, 0x03, 0xe0, // jmp loop
+		0x48,             // irq: pha
+		0xee, 0x21, 0xd0, // inc $d021
+		0xad, 0x00, 0xdc, // lda $dc00
+		0x18,       // clc
+		0x65, 0x02, // adc $02
+		0x85, 0x02, // sta $02
+		0xad, 0x01, 0xdc, // lda $dc01
+		0x18,       // clc
+		0x65, 0x03, // adc $03
+		0x85, 0x03, // sta $03
+		0x68, // pla
+		0x40, // rti
+	})
+	kernal[0x1ffc] = 0x00 // reset vector
+	kernal[0x1ffd] = 0xe0
+	kernal[0x1ffe] = 0x1a // irq vector
+	kernal[0x1fff] = 0xe0
+
+	return map[string][]byte{
+		"basic":   make([]byte, 0x2000),
+		"kernal":  kernal,
+		"chargen": mock.Pattern(0x1000),
+	}
+}
+
+func TestState(t *testing.T) {
+	mock.TestState(t, mock.StateTest{
+		NewMach: func(roms map[string][]byte) (*rcs.Mach, error) {
+			return newMach(rcs.SDLContext{}, roms)
+		},
+		ROMs:   testROMs(),
+		Before: 10,
+		Frames: 10,
+		Inputs: []rcs.MovieEvent{
+			{Frame: 0, Input: rcs.InputEvent{Control: "a", Pressed: true}},
+			{Frame: 2, Input: rcs.InputEvent{Control: rcs.Left, Pressed: true}},
+			{Frame: 4, Input: rcs.InputEvent{Control: "a", Pressed: false}},
+			{Frame: 6, Input: rcs.InputEvent{Control: "run-stop", Pressed: true}},
+			{Frame: 7, Input: rcs.InputEvent{Control: rcs.Left, Pressed: false}},
+		},
+	})
+}
@@ -1,10 +1,11 @@
 package c64
 
 import (
+	"fmt"
+	"image"
 	"image/color"
 
 	"github.com/blackchip-org/retro-cs/rcs"
-	"github.com/veandco/go-sdl2/sdl"
 )
 
 const (
@@ -21,103 +22,59 @@ const (
 type video struct {
 	borderColor uint8
 	bgColor     uint8
-	texture     *sdl.Texture
-	charSheet   rcs.TileSheet
+	charData    []uint8
 	mem         *rcs.Memory
 }
 
-func newVideo(r *sdl.Renderer, mem *rcs.Memory, charData []uint8) (*video, error) {
-	t, err := r.CreateTexture(sdl.PIXELFORMAT_RGBA8888, sdl.TEXTUREACCESS_TARGET,
-		screenW, screenH)
-	if err != nil {
-		return nil, err
-	}
-	charSheet, err := CharGen(r, charData)
-	if err != nil {
-		return nil, err
-	}
+func newVideo(mem *rcs.Memory, charData []uint8) *video {
 	return &video{
-		texture:   t,
-		charSheet: charSheet,
-		mem:       mem,
-	}, nil
+		charData: charData,
+		mem:      mem,
+	}
 }
 
-func (v *video) draw(r *sdl.Renderer) error {
+func (v *video) draw(img *image.RGBA) error {
 	v.mem.Write(0xd012, 00) // HACK: set raster line to zero
-	r.SetRenderTarget(v.texture)
-	r.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
-	v.drawBorder(r)
-	v.drawBackground(r)
-	v.drawCharacters(r)
-	r.SetRenderTarget(nil)
+	v.drawBorder(img)
+	v.drawBackground(img)
+	v.drawCharacters(img)
 	return nil
 }
 
-func (v *video) drawBorder(r *sdl.Renderer) {
+func (v *video) drawBorder(img *image.RGBA) {
 	c := Palette[v.borderColor&0x0f]
-	r.SetDrawColor(c.R, c.G, c.B, c.A)
-	topBorder := sdl.Rect{
-		X: 0,
-		Y: 0,
-		W: screenW,
-		H: borderH,
-	}
-	r.FillRect(&topBorder)
-	bottomBorder := sdl.Rect{
-		X: 0,
-		Y: borderH + height,
-		W: screenW,
-		H: borderH,
-	}
-	r.FillRect(&bottomBorder)
-	leftBorder := sdl.Rect{
-		X: 0,
-		Y: borderH,
-		W: borderW,
-		H: height,
-	}
-	r.FillRect(&leftBorder)
-	rightBorder := sdl.Rect{
-		X: borderW + width,
-		Y: borderH,
-		W: borderW,
-		H: height,
-	}
-	r.FillRect(&rightBorder)
+	topBorder := image.Rect(0, 0, screenW, borderH)
+	rcs.FillRect(img, topBorder, c)
+	bottomBorder := image.Rect(0, borderH+height, screenW, screenH)
+	rcs.FillRect(img, bottomBorder, c)
+	leftBorder := image.Rect(0, borderH, borderW, borderH+height)
+	rcs.FillRect(img, leftBorder, c)
+	rightBorder := image.Rect(borderW+width, borderH, screenW, borderH+height)
+	rcs.FillRect(img, rightBorder, c)
 }
 
-func (v *video) drawBackground(r *sdl.Renderer) {
+func (v *video) drawBackground(img *image.RGBA) {
 	c := Palette[v.bgColor&0x0f]
-	r.SetDrawColor(c.R, c.G, c.B, c.A)
-	background := sdl.Rect{
-		X: borderW,
-		Y: borderH,
-		W: width,
-		H: height,
-	}
-	r.FillRect(&background)
+	background := image.Rect(borderW, borderH, borderW+width, borderH+height)
+	rcs.FillRect(img, background, c)
 }
 
-func (v *video) drawCharacters(r *sdl.Renderer) {
+func (v *video) drawCharacters(img *image.RGBA) {
 	addrScreenMem := 0x0400
 	addrColorMem := 0xd800
 	baseX := 0
 	baseY := 0
 	for baseY < height {
-		ch := v.mem.Read(addrScreenMem)
+		ch := int(v.mem.Read(addrScreenMem))
 		clr := Palette[v.mem.Read(addrColorMem)&0x0f]
-		v.charSheet.Texture.SetColorMod(clr.R, clr.G, clr.B)
-		chx := int32(ch) % charSheetW * 8
-		chy := int32(ch) / charSheetW * 8
-		src := sdl.Rect{X: chx, Y: chy, W: 8, H: 8}
-		dest := sdl.Rect{
-			X: int32(baseX + borderW),
-			Y: int32(baseY + borderH),
-			W: 8,
-			H: 8,
+		for y := 0; y < 8; y++ {
+			line := v.charData[ch*8+y]
+			for x := 0; x < 8; x++ {
+				if line&(0x80>>uint(x)) != 0 {
+					img.SetRGBA(baseX+borderW+x, baseY+borderH+y, clr)
+				}
+			}
 		}
-		r.Copy(v.charSheet.Texture, &src, &dest)
 		addrScreenMem++
 		addrColorMem++
 		baseX += 8
@@ -149,23 +106,21 @@ var (
 	}
 )
 
-func CharGen(r *sdl.Renderer, data []uint8) (rcs.TileSheet, error) {
+// CharGen creates a tile sheet of the characters found in the character
+// generator ROM.
+func CharGen(data []uint8) (rcs.TileSheet, error) {
 	tileW, tileH := int32(8), int32(8)
-	texW := tileW * 32
-	texH := tileH * 16
-	t, err := r.CreateTexture(sdl.PIXELFORMAT_RGBA8888,
-		sdl.TEXTUREACCESS_TARGET, texW, texH)
-	if err != nil {
-		return rcs.TileSheet{}, err
+	texW := tileW * charSheetW
+	texH := tileH * charSheetH
+	if len(data) < int(charSheetW*charSheetH*8) {
+		return rcs.TileSheet{}, fmt.Errorf("invalid character data length: %v", len(data))
 	}
-	r.SetRenderTarget(t)
-	r.SetDrawColor(0, 0, 0, 0)
-	r.FillRect(nil)
-	r.SetDrawColor(0xff, 0xff, 0xff, 0xff)
-	baseX := int32(0)
-	baseY := int32(0)
+	img := image.NewRGBA(image.Rect(0, 0, int(texW), int(texH)))
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	baseX := 0
+	baseY := 0
 	addr := 0
-	for baseY < texH {
+	for baseY < int(texH) {
 		for y := baseY; y < baseY+8; y++ {
 			line := data[addr]
 			addr++
@@ -173,23 +128,21 @@ func CharGen(r *sdl.Renderer, data []uint8) (rcs.TileSheet, error) {
 				bit := line & 0x80
 				line = line << 1
 				if bit != 0 {
-					r.DrawPoint(x, y)
+					img.SetRGBA(x, y, white)
 				}
 			}
 		}
 		baseX += 8
-		if baseX >= texW {
+		if baseX >= int(texW) {
 			baseX = 0
 			baseY += 8
 		}
 	}
-	t.SetBlendMode(sdl.BLENDMODE_BLEND)
-	r.SetRenderTarget(nil)
 	return rcs.TileSheet{
 		TextureW: texW,
 		TextureH: texH,
 		TileW:    tileW,
 		TileH:    tileH,
-		Texture:  t,
+		Image:    img,
 	}, nil
 }
@@ -0,0 +1,51 @@
+package c64
+
+import (
+	"image"
+	"testing"
+
+	"github.com/blackchip-org/retro-cs/rcs"
+)
+
+func TestVideoDraw(t *testing.T) {
+	mem := rcs.NewMemory(1, 0x10000)
+	mem.MapRAM(0, make([]uint8, 0x10000, 0x10000))
+	charData := make([]uint8, 4096, 4096)
+	// character 1 is a vertical bar in the leftmost column
+	for i := 8; i < 16; i++ {
+		charData[i] = 0x80
+	}
+	v := newVideo(mem, charData)
+	v.borderColor = 14   // light blue
+	v.bgColor = 6        // blue
+	mem.Write(0x0400, 1) // first character on screen
+	mem.Write(0xd800, 1) // in white
+
+	img := image.NewRGBA(image.Rect(0, 0, screenW, screenH))
+	if err := v.draw(img); err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		name string
+		x    int
+		y    int
+		want uint8
+	}{
+		{"border", 0, 0, 14},
+		{"border right", screenW - 1, borderH, 14},
+		{"border bottom", borderW, screenH - 1, 14},
+		{"character", borderW, borderH, 1},
+		{"character bottom", borderW, borderH + 7, 1},
+		{"character background", borderW + 1, borderH, 6},
+		{"background", borderW + width - 1, borderH + height - 1, 6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			have := img.RGBAAt(test.x, test.y)
+			want := Palette[test.want]
+			if have != want {
+				t.Errorf("\n have: %v \n want: %v", have, want)
+			}
+		})
+	}
+}
@@ -9,12 +9,15 @@ import (
 )
 
 type System struct {
-	cpu   [3]*z80.CPU
-	mem   [3]*rcs.Memory
-	ram   []uint8
-	n06xx *namco.N06XX
-	n51xx *namco.N51XX
-	n54xx *namco.N54XX
+	cpu     [3]*z80.CPU
+	mem     [3]*rcs.Memory
+	ram     []uint8
+	ram6800 []uint8
+	ram7000 []uint8
+	ramA000 []uint8
+	n06xx   *namco.N06XX
+	n51xx   *namco.N51XX
+	n54xx   *namco.N54XX
 
 	video *namco.Video
 
@@ -25,18 +28,28 @@ type System struct {
 	dipSwitches      [8]uint8
 }
 
-func new(ctx rcs.SDLContext, set []rcs.ROM) (*rcs.Mach, error) {
-	s := &System{}
+// stateVersion is the version of the state saved by the system.
+const stateVersion = 1
+
+func new(ctx rcs.SDLContext, name string, set []rcs.ROM) (*rcs.Mach, error) {
 	roms, err := rcs.LoadROMs(config.DataDir, set)
 	if err != nil {
 		return nil, err
 	}
+	return newMach(ctx, name, set, roms)
+}
+
+func newMach(ctx rcs.SDLContext, name string, set []rcs.ROM, roms map[string][]byte) (*rcs.Mach, error) {
+	s := &System{}
 
 	// construct the common memory first
 	mem := rcs.NewMemory(1, 0x10000)
 	ram := make([]uint8, 0x2000, 0x2000)
+	s.ram6800 = make([]uint8, 0x100, 0x100)
+	s.ram7000 = make([]uint8, 0x1000, 0x1000)
+	s.ramA000 = make([]uint8, 0x1000, 0x1000)
 
-	mem.MapRAM(0x6800, make([]uint8, 0x100, 0x100)) // temporary
+	mem.MapRAM(0x6800, s.ram6800) // temporary
 	for i := 0; i < 8; i++ {
 		mem.MapRW(0x6800+i, &s.dipSwitches[i])
 	}
@@ -45,9 +58,9 @@ func new(ctx rcs.SDLContext, set []rcs.ROM) (*rcs.Mach, error) {
 	mem.MapRW(0x6822, &s.InterruptEnable2)
 	mem.MapRW(0x6823, &s.reset)
 
-	mem.MapRAM(0x7000, make([]uint8, 0x1000, 0x1000))
+	mem.MapRAM(0x7000, s.ram7000)
 	mem.MapRAM(0x8000, ram)
-	mem.MapRAM(0xa000, make([]uint8, 0x1000, 0x1000))
+	mem.MapRAM(0xa000, s.ramA000)
 
 	s.n51xx = namco.NewN51XX()
 	s.n54xx = namco.NewN54XX()
@@ -68,29 +81,24 @@ func new(ctx rcs.SDLContext, set []rcs.ROM) (*rcs.Mach, error) {
 		mem.MapStore(addr, s.n06xx.WriteCtrl(j))
 	}
 
-	var screen rcs.Screen
-	var video *namco.Video
-	if ctx.Renderer != nil {
-		data := namco.Data{
-			Palettes: roms["palettes"],
-			Colors:   roms["colors"],
-			Tiles:    roms["tiles"],
-			Sprites:  roms["sprites"],
-		}
-		video, err = newVideo(ctx.Renderer, data)
-		if err != nil {
-			return nil, err
-		}
-		mem.MapRAM(0x8000, video.TileMemory)
-		mem.MapRAM(0x8400, video.ColorMemory)
-
-		screen = rcs.Screen{
-			W:         namco.W,
-			H:         namco.H,
-			Texture:   video.Texture,
-			ScanLineV: true,
-			Draw:      video.Draw,
-		}
+	data := namco.Data{
+		Palettes: roms["palettes"],
+		Colors:   roms["colors"],
+		Tiles:    roms["tiles"],
+		Sprites:  roms["sprites"],
+	}
+	video, err := newVideo(data)
+	if err != nil {
+		return nil, err
+	}
+	mem.MapRAM(0x8000, video.TileMemory)
+	mem.MapRAM(0x8400, video.ColorMemory)
+
+	screen := rcs.Screen{
+		W:         namco.W,
+		H:         namco.H,
+		ScanLineV: true,
+		Draw:      video.Draw,
 	}
 
 	s.dipSwitches[3] = 1
@@ -145,8 +153,14 @@ func new(ctx rcs.SDLContext, set []rcs.ROM) (*rcs.Mach, error) {
 		s.cpu[0].NMI = true
 	}
 
+	s.ram = ram
+	s.video = video
+
 	mach := &rcs.Mach{
-		Sys: s,
+		Name:  name,
+		ROMs:  set,
+		Sys:   s,
+		Clock: 3072000, // 3.072 MHz
 		Comps: []rcs.Component{
 			rcs.NewComponent("galaga", "galaga", "", s),
 			rcs.NewComponent("mem1", "mem", "", s.mem[0]),
@@ -165,10 +179,38 @@ func new(ctx rcs.SDLContext, set []rcs.ROM) (*rcs.Mach, error) {
 		Ctx:        ctx,
 		Screen:     screen,
 		VBlankFunc: vblank,
+
+		StateVersion: stateVersion,
 	}
 	return mach, nil
 }
 
+func (s *System) Save(enc *rcs.Encoder) {
+	s.video.Save(enc)
+	enc.Encode(s.ram)
+	enc.Encode(s.ram6800)
+	enc.Encode(s.ram7000)
+	enc.Encode(s.ramA000)
+	enc.Encode(s.InterruptEnable0)
+	enc.Encode(s.InterruptEnable1)
+	enc.Encode(s.InterruptEnable2)
+	enc.Encode(s.reset)
+	enc.Encode(s.dipSwitches)
+}
+
+func (s *System) Load(dec *rcs.Decoder) {
+	s.video.Load(dec)
+	dec.Decode(&s.ram)
+	dec.Decode(&s.ram6800)
+	dec.Decode(&s.ram7000)
+	dec.Decode(&s.ramA000)
+	dec.Decode(&s.InterruptEnable0)
+	dec.Decode(&s.InterruptEnable1)
+	dec.Decode(&s.InterruptEnable2)
+	dec.Decode(&s.reset)
+	dec.Decode(&s.dipSwitches)
+}
+
 func New(ctx rcs.SDLContext) (*rcs.Mach, error) {
-	return new(ctx, ROM["galaga"])
+	return new(ctx, "galaga", ROM["galaga"])
 }
@@ -0,0 +1,79 @@
+package galaga
+
+import (
+	"testing"
+
+	"github.com/blackchip-org/retro-cs/mock"
+	"github.com/blackchip-org/retro-cs/rcs"
+)
+
+// testROMs creates ROMs where the main CPU scrambles tile memory with
+// the refresh register, counts interrupts and non-maskable interrupts
+// from the n06xx, and the other two CPUs count in shared RAM.
+func testROMs() map[string][]byte {
+	code1 := make([]byte, 0x4000)
+	copy(code1[0x0000:], []byte{
+		0x31, 0x00, 0x90, // ld sp,$9000
+		0x3e, 0x01, // ld a,1
+		0x32, 0x20, 0x68, // ld ($6820),a
+		0x32, 0x00, 0x71, // ld ($7100),a
+		0xed, 0x56, // im 1
+		0xfb,             // ei
+		0x21, 0x00, 0x80, // ld hl,$8000
+		0xed, 0x5f, // loop: ld a,r
+		0xae,       // xor (hl)
+		0x77,       // ld (hl),a
+		0x23,       // inc hl
+		0x7c,       // ld a,h
+		0xe6, 0x83, // and $83
+		0x67,       // ld h,a
+		0x18, 0xf5, // jr loop
+	})
+	copy(code1[0x0038:], []byte{
+		0xf5,             // push af
+		0x3a, 0x00, 0x98, // ld a,($9800)
+		0x3c,             // inc a
+		0x32, 0x00, 0x98, // ld ($9800),a
+		0x32, 0x10, 0x68, // ld ($6810),a
+		0xf1,       // pop af
+		0xfb,       // ei
+		0xed, 0x4d, // reti
+	})
+	copy(code1[0x0066:], []byte{
+		0xf5,             // push af
+		0x3a, 0x01, 0x98, // ld a,($9801)
+		0x3c,             // inc a
+		0x32, 0x01, 0x98, // ld ($9801),a
+		0xf1,       // pop af
+		0xed, 0x45, // retn
+	})
+	counter := func(addr uint8) []byte {
+		code := make([]byte, 0x1000)
+		copy(code, []byte{
+			0x21, 0x00, addr, // ld hl,addr
+			0x34,       // loop: inc (hl)
+			0x18, 0xfd, // jr loop
+		})
+		return code
+	}
+	return map[string][]byte{
+		"code1":    code1,
+		"code2":    counter(0xa1),
+		"code3":    counter(0xa2),
+		"tiles":    mock.Pattern(0x1000),
+		"sprites":  mock.Pattern(0x2000),
+		"palettes": mock.Pattern(0x100),
+		"colors":   mock.Pattern(0x20),
+	}
+}
+
+func TestState(t *testing.T) {
+	mock.TestState(t, mock.StateTest{
+		NewMach: func(roms map[string][]byte) (*rcs.Mach, error) {
+			return newMach(rcs.SDLContext{}, "galaga", ROM["galaga"], roms)
+		},
+		ROMs:   testROMs(),
+		Before: 10,
+		Frames: 10,
+	})
+}
@@ -3,11 +3,10 @@ package galaga
 import (
 	"github.com/blackchip-org/retro-cs/rcs"
 	"github.com/blackchip-org/retro-cs/rcs/namco"
-	"github.com/veandco/go-sdl2/sdl"
 )
 
-func newVideo(r *sdl.Renderer, data namco.Data) (*namco.Video, error) {
-	return namco.NewVideo(r, VideoConfig, data)
+func newVideo(data namco.Data) (*namco.Video, error) {
+	return namco.NewVideo(VideoConfig, data)
 }
 
 var VideoConfig = namco.Config{
@@ -22,21 +22,27 @@ type audio struct {
 	synth     *rcs.Synth
 }
 
-func newAudio(spec sdl.AudioSpec, data audioData) (*audio, error) {
+// newVoices creates the sound registers for the three voices.
+func newVoices() []voice {
+	voices := make([]voice, 3, 3)
+	voices[0].acc = make([]uint8, 5, 5)
+	voices[0].freq = make([]uint8, 5, 5)
+	voices[1].acc = make([]uint8, 4, 4)
+	voices[1].freq = make([]uint8, 4, 4)
+	voices[2].acc = make([]uint8, 4, 4)
+	voices[2].freq = make([]uint8, 4, 4)
+	return voices
+}
+
+func newAudio(spec sdl.AudioSpec, data audioData, voices []voice) (*audio, error) {
 	synth, err := rcs.NewSynth(spec, 3)
 	if err != nil {
 		return nil, err
 	}
 	a := &audio{
-		voices: make([]voice, 3, 3),
+		voices: voices,
 		synth:  synth,
 	}
-	a.voices[0].acc = make([]uint8, 5, 5)
-	a.voices[0].freq = make([]uint8, 5, 5)
-	a.voices[1].acc = make([]uint8, 4, 4)
-	a.voices[1].freq = make([]uint8, 4, 4)
-	a.voices[2].acc = make([]uint8, 4, 4)
-	a.voices[2].freq = make([]uint8, 4, 4)
 
 	for i := 0; i < 16; i++ {
 		addr := uint16(i * 32)
@@ -64,6 +70,25 @@ func (a *audio) queue() error {
 	return a.synth.Queue()
 }
 
+func saveVoices(enc *rcs.Encoder, voices []voice) {
+	for _, v := range voices {
+		enc.Encode(v.acc)
+		enc.Encode(v.waveform)
+		enc.Encode(v.freq)
+		enc.Encode(v.vol)
+	}
+}
+
+func loadVoices(dec *rcs.Decoder, voices []voice) {
+	for i := range voices {
+		v := &voices[i]
+		dec.Decode(&v.acc)
+		dec.Decode(&v.waveform)
+		dec.Decode(&v.freq)
+		dec.Decode(&v.vol)
+	}
+}
+
 func rescale(d []uint8, addr uint16) []float64 {
 	out := make([]float64, 32, 32)
 	for i := uint16(0); i < 32; i++ {
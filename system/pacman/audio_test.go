@@ -0,0 +1,76 @@
+package pacman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blackchip-org/retro-cs/rcs"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+var testSpec = sdl.AudioSpec{
+	Freq:     22050,
+	Format:   sdl.AUDIO_S16LSB,
+	Channels: 2,
+	Samples:  367,
+}
+
+// Record two frames of a square wave on voice 0 and compare with the
+// expected output.
+func TestRecordWSG(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pacman")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// waveform 0 is high for the first half and low for the second
+	data := audioData{waveforms: make([]uint8, 512)}
+	for i := 0; i < 16; i++ {
+		data.waveforms[i] = 15
+	}
+	a, err := newAudio(testSpec, data, newVoices())
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "wsg.wav")
+	sink, err := rcs.NewWAVSink(filename, int(testSpec.Freq))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.synth.Sink = sink
+
+	// 0x444 * 375 / 4096 = 99 Hz
+	copy(a.voices[0].freq, []uint8{4, 4, 4, 0, 0})
+	a.voices[0].vol = 15
+	for i := 0; i < 2; i++ {
+		if err := a.queue(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 367.57 samples per frame with a period of 222 samples. The mix of
+	// the three voices is (15 - 7.5) / 8 / 3 at full volume.
+	var want bytes.Buffer
+	for i := 0; i < 367+368; i++ {
+		v := int16(10239)
+		if i%222 >= 111 {
+			v = -10239
+		}
+		binary.Write(&want, binary.LittleEndian, []int16{v, v})
+	}
+	have, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have[44:], want.Bytes()) {
+		t.Errorf("recorded audio does not match")
+	}
+}
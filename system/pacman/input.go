@@ -0,0 +1,59 @@
+package pacman
+
+import (
+	"github.com/blackchip-org/retro-cs/rcs"
+)
+
+const rackAdvance rcs.Control = "rack-advance"
+
+func bindings() rcs.Bindings {
+	return rcs.Bindings{
+		"1":     {rcs.Start1},
+		"2":     {rcs.Start2},
+		"C":     {rcs.Coin1},
+		"R":     {rackAdvance},
+		"Up":    {rcs.Up},
+		"Left":  {rcs.Left},
+		"Right": {rcs.Right},
+		"Down":  {rcs.Down},
+	}
+}
+
+type input struct {
+	s *system
+}
+
+func newInput(s *system) *input {
+	return &input{s: s}
+}
+
+func (in *input) handle(e rcs.InputEvent) error {
+	s := in.s
+	// joystick inputs are active low
+	switch e.Control {
+	case rcs.Start1:
+		s.in1 = setBit(s.in1, 5, e.Pressed)
+	case rcs.Start2:
+		s.in1 = setBit(s.in1, 6, e.Pressed)
+	case rcs.Coin1:
+		s.in0 = setBit(s.in0, 5, e.Pressed)
+	case rackAdvance:
+		s.in0 = setBit(s.in0, 4, e.Pressed)
+	case rcs.Up:
+		s.in0 = setBit(s.in0, 0, !e.Pressed)
+	case rcs.Left:
+		s.in0 = setBit(s.in0, 1, !e.Pressed)
+	case rcs.Right:
+		s.in0 = setBit(s.in0, 2, !e.Pressed)
+	case rcs.Down:
+		s.in0 = setBit(s.in0, 3, !e.Pressed)
+	}
+	return nil
+}
+
+func setBit(v uint8, n uint, on bool) uint8 {
+	if on {
+		return v | 1<<n
+	}
+	return v &^ (1 << n)
+}
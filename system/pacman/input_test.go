@@ -0,0 +1,38 @@
+package pacman
+
+import (
+	"testing"
+
+	"github.com/blackchip-org/retro-cs/rcs"
+)
+
+func TestInput(t *testing.T) {
+	tests := []struct {
+		control rcs.Control
+		in0     uint8
+		in1     uint8
+	}{
+		{rcs.Up, 0x8e, 0x9f},
+		{rcs.Left, 0x8d, 0x9f},
+		{rcs.Right, 0x8b, 0x9f},
+		{rcs.Down, 0x87, 0x9f},
+		{rackAdvance, 0x9f, 0x9f},
+		{rcs.Coin1, 0xaf, 0x9f},
+		{rcs.Start1, 0x8f, 0xbf},
+		{rcs.Start2, 0x8f, 0xdf},
+	}
+	for _, test := range tests {
+		t.Run(string(test.control), func(t *testing.T) {
+			s := &system{in0: 0x8f, in1: 0x9f}
+			in := newInput(s)
+			in.handle(rcs.InputEvent{Control: test.control, Pressed: true})
+			if s.in0 != test.in0 || s.in1 != test.in1 {
+				t.Errorf("\n have: %02x %02x \n want: %02x %02x", s.in0, s.in1, test.in0, test.in1)
+			}
+			in.handle(rcs.InputEvent{Control: test.control, Pressed: false})
+			if s.in0 != 0x8f || s.in1 != 0x9f {
+				t.Errorf("\n have: %02x %02x \n want: 8f 9f", s.in0, s.in1)
+			}
+		})
+	}
+}
@@ -2,6 +2,9 @@
 package pacman
 
 import (
+	"bytes"
+	"fmt"
+
 	"github.com/blackchip-org/retro-cs/config"
 	"github.com/blackchip-org/retro-cs/rcs"
 	"github.com/blackchip-org/retro-cs/rcs/namco"
@@ -9,10 +12,11 @@ import (
 )
 
 type system struct {
-	cpu   *z80.CPU
-	mem   *rcs.Memory
-	ram   []uint8
-	video *namco.Video
+	cpu    *z80.CPU
+	mem    *rcs.Memory
+	ram    []uint8
+	video  *namco.Video
+	voices []voice
 
 	intSelect       uint8 // value sent during interrupt to select vector (port 0)
 	in0             uint8 // joystick #1, rack advance, coin slot, service button
@@ -29,13 +33,19 @@ type system struct {
 	watchdogReset   uint8
 }
 
-func new(ctx rcs.SDLContext, set []rcs.ROM) (*rcs.Mach, error) {
-	s := &system{}
+// stateVersion is the version of the state saved by the system.
+const stateVersion = 2
+
+func new(ctx rcs.SDLContext, name string, set []rcs.ROM) (*rcs.Mach, error) {
 	roms, err := rcs.LoadROMs(config.DataDir, set)
 	if err != nil {
 		return nil, err
 	}
+	return newMach(ctx, name, set, roms)
+}
 
+func newMach(ctx rcs.SDLContext, name string, set []rcs.ROM, roms map[string][]byte) (*rcs.Mach, error) {
+	s := &system{}
 	s.mem = rcs.NewMemory(1, 0x10000)
 	ram := make([]uint8, 0x1000, 0x1000)
 
@@ -83,90 +93,92 @@ func new(ctx rcs.SDLContext, set []rcs.ROM) (*rcs.Mach, error) {
 	cpu := z80.New(s.mem)
 	cpu.Ports.MapRW(0x00, &s.intSelect)
 
-	var screen rcs.Screen
-	var video *namco.Video
-	if ctx.Renderer != nil {
-		data := namco.Data{
-			Palettes: roms["palettes"],
-			Colors:   roms["colors"],
-			Tiles:    roms["tiles"],
-			Sprites:  roms["sprites"],
-		}
-		video, err = newVideo(ctx.Renderer, data)
-		if err != nil {
-			return nil, err
-		}
-		s.mem.MapRAM(0x4000, video.TileMemory)
-		s.mem.MapRAM(0x4400, video.ColorMemory)
-
-		// Pacman is missing address line A15 so an access to $c000 is the
-		// same as accessing $4000. Ms. Pacman has additional ROMs in high
-		// memory so it has an A15 line but it appears to have the RAM mapped at
-		// $c000 as well. Text for HIGH SCORE and CREDIT accesses this high
-		// memory when writing to video memory. Copy protection?
-		s.mem.MapRAM(0xc000, video.TileMemory)
-		s.mem.MapRAM(0xc400, video.ColorMemory)
-
-		for i := 0; i < 8; i++ {
-			s.mem.MapRW(0x5060+(i*2), &video.SpriteCoords[i].X)
-			s.mem.MapRW(0x5061+(i*2), &video.SpriteCoords[i].Y)
-			s.mem.MapRW(0x4ff0+(i*2), &video.SpriteInfo[i])
-			s.mem.MapRW(0x4ff1+(i*2), &video.SpritePalettes[i])
-		}
-		screen = rcs.Screen{
-			W:         namco.W,
-			H:         namco.H,
-			Texture:   video.Texture,
-			ScanLineV: true,
-			Draw:      video.Draw,
-		}
+	data := namco.Data{
+		Palettes: roms["palettes"],
+		Colors:   roms["colors"],
+		Tiles:    roms["tiles"],
+		Sprites:  roms["sprites"],
 	}
+	video, err := newVideo(data)
+	if err != nil {
+		return nil, err
+	}
+	s.mem.MapRAM(0x4000, video.TileMemory)
+	s.mem.MapRAM(0x4400, video.ColorMemory)
+
+	// Pacman is missing address line A15 so an access to $c000 is the
+	// same as accessing $4000. Ms. Pacman has additional ROMs in high
+	// memory so it has an A15 line but it appears to have the RAM mapped at
+	// $c000 as well. Text for HIGH SCORE and CREDIT accesses this high
+	// memory when writing to video memory. Copy protection?
+	s.mem.MapRAM(0xc000, video.TileMemory)
+	s.mem.MapRAM(0xc400, video.ColorMemory)
+
+	for i := 0; i < 8; i++ {
+		s.mem.MapRW(0x5060+(i*2), &video.SpriteCoords[i].X)
+		s.mem.MapRW(0x5061+(i*2), &video.SpriteCoords[i].Y)
+		s.mem.MapRW(0x4ff0+(i*2), &video.SpriteInfo[i])
+		s.mem.MapRW(0x4ff1+(i*2), &video.SpritePalettes[i])
+	}
+	screen := rcs.Screen{
+		W:         namco.W,
+		H:         namco.H,
+		ScanLineV: true,
+		Draw:      video.Draw,
+	}
+
+	// Sound registers are mapped even when there is no audio output so
+	// that they are kept in savestates.
+	s.voices = newVoices()
+	s.mem.MapWO(0x5040, &s.voices[0].acc[0])
+	s.mem.MapWO(0x5041, &s.voices[0].acc[1])
+	s.mem.MapWO(0x5042, &s.voices[0].acc[2])
+	s.mem.MapWO(0x5043, &s.voices[0].acc[3])
+	s.mem.MapWO(0x5044, &s.voices[0].acc[4])
+	s.mem.MapWO(0x5045, &s.voices[0].waveform)
+	s.mem.MapWO(0x5046, &s.voices[1].acc[0])
+	s.mem.MapWO(0x5047, &s.voices[1].acc[1])
+	s.mem.MapWO(0x5048, &s.voices[1].acc[2])
+	s.mem.MapWO(0x5049, &s.voices[1].acc[3])
+	s.mem.MapWO(0x504a, &s.voices[1].waveform)
+	s.mem.MapWO(0x504b, &s.voices[2].acc[0])
+	s.mem.MapWO(0x504c, &s.voices[2].acc[1])
+	s.mem.MapWO(0x504d, &s.voices[2].acc[2])
+	s.mem.MapWO(0x504e, &s.voices[2].acc[3])
+	s.mem.MapRW(0x504f, &s.voices[2].waveform)
+
+	s.mem.MapWO(0x5050, &s.voices[0].freq[0])
+	s.mem.MapWO(0x5051, &s.voices[0].freq[1])
+	s.mem.MapWO(0x5052, &s.voices[0].freq[2])
+	s.mem.MapWO(0x5053, &s.voices[0].freq[3])
+	s.mem.MapWO(0x5054, &s.voices[0].freq[4])
+	s.mem.MapWO(0x5055, &s.voices[0].vol)
+	s.mem.MapWO(0x5056, &s.voices[1].freq[0])
+	s.mem.MapWO(0x5057, &s.voices[1].freq[1])
+	s.mem.MapWO(0x5058, &s.voices[1].freq[2])
+	s.mem.MapWO(0x5059, &s.voices[1].freq[3])
+	s.mem.MapWO(0x505a, &s.voices[1].vol)
+	s.mem.MapWO(0x505b, &s.voices[2].freq[0])
+	s.mem.MapWO(0x505c, &s.voices[2].freq[1])
+	s.mem.MapWO(0x505d, &s.voices[2].freq[2])
+	s.mem.MapWO(0x505e, &s.voices[2].freq[3])
+	s.mem.MapRW(0x505f, &s.voices[2].vol)
 
 	var synth *audio
 	if ctx.AudioSpec.Channels > 0 {
 		data := audioData{
 			waveforms: roms["waveforms"],
 		}
-		synth, err = newAudio(ctx.AudioSpec, data)
+		synth, err = newAudio(ctx.AudioSpec, data, s.voices)
 		if err != nil {
 			return nil, err
 		}
-		s.mem.MapWO(0x5040, &synth.voices[0].acc[0])
-		s.mem.MapWO(0x5041, &synth.voices[0].acc[1])
-		s.mem.MapWO(0x5042, &synth.voices[0].acc[2])
-		s.mem.MapWO(0x5043, &synth.voices[0].acc[3])
-		s.mem.MapWO(0x5044, &synth.voices[0].acc[4])
-		s.mem.MapWO(0x5045, &synth.voices[0].waveform)
-		s.mem.MapWO(0x5046, &synth.voices[1].acc[0])
-		s.mem.MapWO(0x5047, &synth.voices[1].acc[1])
-		s.mem.MapWO(0x5048, &synth.voices[1].acc[2])
-		s.mem.MapWO(0x5049, &synth.voices[1].acc[3])
-		s.mem.MapWO(0x504a, &synth.voices[1].waveform)
-		s.mem.MapWO(0x504b, &synth.voices[2].acc[0])
-		s.mem.MapWO(0x504c, &synth.voices[2].acc[1])
-		s.mem.MapWO(0x504d, &synth.voices[2].acc[2])
-		s.mem.MapWO(0x504e, &synth.voices[2].acc[3])
-		s.mem.MapRW(0x504f, &synth.voices[2].waveform)
-
-		s.mem.MapWO(0x5050, &synth.voices[0].freq[0])
-		s.mem.MapWO(0x5051, &synth.voices[0].freq[1])
-		s.mem.MapWO(0x5052, &synth.voices[0].freq[2])
-		s.mem.MapWO(0x5053, &synth.voices[0].freq[3])
-		s.mem.MapWO(0x5054, &synth.voices[0].freq[4])
-		s.mem.MapWO(0x5055, &synth.voices[0].vol)
-		s.mem.MapWO(0x5056, &synth.voices[1].freq[0])
-		s.mem.MapWO(0x5057, &synth.voices[1].freq[1])
-		s.mem.MapWO(0x5058, &synth.voices[1].freq[2])
-		s.mem.MapWO(0x5059, &synth.voices[1].freq[3])
-		s.mem.MapWO(0x505a, &synth.voices[1].vol)
-		s.mem.MapWO(0x505b, &synth.voices[2].freq[0])
-		s.mem.MapWO(0x505c, &synth.voices[2].freq[1])
-		s.mem.MapWO(0x505d, &synth.voices[2].freq[2])
-		s.mem.MapWO(0x505e, &synth.voices[2].freq[3])
-		s.mem.MapRW(0x505f, &synth.voices[2].vol)
+		if ctx.AudioSink != nil {
+			synth.synth.Sink = ctx.AudioSink
+		}
 	}
 
-	keyboard := newKeyboard(s)
+	input := newInput(s)
 
 	// Note: If in0 and in1 are not initialized to valid values, the
 	// game will crash during the game demo in attract mode.
@@ -200,7 +212,10 @@ func new(ctx rcs.SDLContext, set []rcs.ROM) (*rcs.Mach, error) {
 	s.video = video
 
 	mach := &rcs.Mach{
-		Sys: s,
+		Name:  name,
+		ROMs:  set,
+		Sys:   s,
+		Clock: 3072000, // 3.072 MHz
 		Comps: []rcs.Component{
 			rcs.NewComponent("mem", "mem", "", s.mem),
 			rcs.NewComponent("cpu", "z80", "mem", s.cpu),
@@ -208,11 +223,24 @@ func new(ctx rcs.SDLContext, set []rcs.ROM) (*rcs.Mach, error) {
 		CharDecoders: map[string]rcs.CharDecoder{
 			"pacman": PacmanDecoder,
 		},
+		Symbols: map[string]rcs.Symbols{
+			"cpu": symbols(),
+		},
 		Ctx:        ctx,
 		Screen:     screen,
 		VBlankFunc: vblank,
 		QueueAudio: synth.queue,
-		Keyboard:   keyboard.handle,
+		Input:      input.handle,
+		Bindings:   bindings(),
+
+		StateVersion: stateVersion,
+		StateMigrations: map[int]func(*rcs.State) error{
+			0: migrateLegacy,
+			1: migrate1,
+		},
+	}
+	if synth != nil {
+		mach.Synth = synth.synth
 	}
 
 	return mach, nil
@@ -223,10 +251,19 @@ func (s *system) Components() []*rcs.Component {
 }
 
 func (s *system) Save(enc *rcs.Encoder) {
-	s.cpu.Save(enc)
-	if s.video != nil {
-		s.video.Save(enc)
-	}
+	s.video.Save(enc)
+	s.saveRegisters(enc)
+	saveVoices(enc, s.voices)
+}
+
+func (s *system) Load(dec *rcs.Decoder) {
+	s.video.Load(dec)
+	s.loadRegisters(dec)
+	loadVoices(dec, s.voices)
+}
+
+// saveRegisters encodes the RAM and the memory mapped registers.
+func (s *system) saveRegisters(enc *rcs.Encoder) {
 	enc.Encode(s.ram)
 	enc.Encode(s.intSelect)
 	enc.Encode(s.in0)
@@ -243,11 +280,7 @@ func (s *system) Save(enc *rcs.Encoder) {
 	enc.Encode(s.watchdogReset)
 }
 
-func (s *system) Load(dec *rcs.Decoder) {
-	s.cpu.Load(dec)
-	if s.video != nil {
-		s.video.Load(dec)
-	}
+func (s *system) loadRegisters(dec *rcs.Decoder) {
 	dec.Decode(&s.ram)
 	dec.Decode(&s.intSelect)
 	dec.Decode(&s.in0)
@@ -264,10 +297,103 @@ func (s *system) Load(dec *rcs.Decoder) {
 	dec.Decode(&s.watchdogReset)
 }
 
+// migrateLegacy splits a state exported before the container format
+// existed into the cpu section and the system section, which holds the
+// same data as in version 1.
+func migrateLegacy(st *rcs.State) error {
+	cpu := &z80.CPU{}
+	return st.SplitLegacy(rcs.SystemSection, cpu, func(dec *rcs.Decoder) {
+		loadLegacyCPU(dec, cpu)
+	})
+}
+
+// loadLegacyCPU decodes the CPU as it was saved in the first version of
+// the state, before the E registers, interrupt lines, and cycle count
+// were included.
+func loadLegacyCPU(dec *rcs.Decoder, cpu *z80.CPU) {
+	regs := []*uint8{
+		&cpu.A, &cpu.F, &cpu.B, &cpu.C, &cpu.D, &cpu.H, &cpu.L,
+		&cpu.A1, &cpu.F1, &cpu.B1, &cpu.C1, &cpu.D1, &cpu.H1, &cpu.L1,
+		&cpu.I, &cpu.R, &cpu.IXH, &cpu.IXL, &cpu.IYH, &cpu.IYL,
+	}
+	for _, r := range regs {
+		dec.Decode(r)
+	}
+	var pc uint16
+	dec.Decode(&cpu.SP)
+	dec.Decode(&pc)
+	cpu.SetPC(int(pc))
+	dec.Decode(&cpu.IFF1)
+	dec.Decode(&cpu.IFF2)
+	dec.Decode(&cpu.IM)
+	dec.Decode(&cpu.Halt)
+}
+
+// migrate1 adds the sprite registers and sound registers to the system
+// section, the remaining CPU state, and the memory section.
+func migrate1(st *rcs.State) error {
+	if err := st.Extend("cpu", &z80.CPU{}); err != nil {
+		return err
+	}
+	data, ok := st.Sections[rcs.SystemSection]
+	if !ok {
+		return fmt.Errorf("missing section: %v", rcs.SystemSection)
+	}
+	s := &system{
+		video: &namco.Video{
+			SpriteCoords:   make([]namco.SpriteCoord, 8, 8),
+			SpriteInfo:     make([]uint8, 8, 8),
+			SpritePalettes: make([]uint8, 8, 8),
+		},
+		voices: newVoices(),
+	}
+	dec := rcs.NewDecoder(bytes.NewReader(data))
+	dec.Decode(&s.video.TileMemory)
+	dec.Decode(&s.video.ColorMemory)
+	s.loadRegisters(dec)
+	if dec.Err != nil {
+		return dec.Err
+	}
+	if err := st.Put(rcs.SystemSection, s); err != nil {
+		return err
+	}
+	return st.Put("mem", rcs.NewMemory(1, 0))
+}
+
 func New(ctx rcs.SDLContext) (*rcs.Mach, error) {
-	return new(ctx, ROM["pacman"])
+	return new(ctx, "pacman", ROM["pacman"])
 }
 
 func NewMs(ctx rcs.SDLContext) (*rcs.Mach, error) {
-	return new(ctx, ROM["mspacman"])
+	return new(ctx, "mspacman", ROM["mspacman"])
+}
+
+// symbols returns the names of the restart and interrupt entry points and
+// the memory mapped registers.
+func symbols() rcs.Symbols {
+	return rcs.Symbols{
+		0x0000: "RESET",
+		0x0008: "RST08",
+		0x0010: "RST10",
+		0x0018: "RST18",
+		0x0020: "RST20",
+		0x0028: "RST28",
+		0x0030: "RST30",
+		0x0038: "RST38",
+		0x0066: "NMI",
+		0x4000: "TILERAM",
+		0x4400: "COLORRAM",
+		0x4ff0: "SPRITEINFO",
+		0x5000: "IN0",
+		0x5001: "SOUNDENABLE",
+		0x5003: "FLIPSCREEN",
+		0x5004: "LAMP1",
+		0x5005: "LAMP2",
+		0x5006: "COINLOCKOUT",
+		0x5007: "COINCOUNTER",
+		0x5040: "IN1",
+		0x5060: "SPRITECOORDS",
+		0x5080: "DSW1",
+		0x50c0: "WATCHDOG",
+	}
 }
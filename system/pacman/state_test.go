@@ -0,0 +1,152 @@
+package pacman
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/blackchip-org/retro-cs/mock"
+	"github.com/blackchip-org/retro-cs/rcs"
+	"github.com/blackchip-org/retro-cs/rcs/namco"
+	"github.com/blackchip-org/retro-cs/rcs/z80"
+)
+
+func TestMigrateLegacy(t *testing.T) {
+	// state as written by the original export: the CPU followed by the
+	// system in a single stream
+	var buf bytes.Buffer
+	enc := rcs.NewEncoder(&buf)
+	enc.Encode(uint8(0x12)) // A
+	for i := 0; i < 19; i++ {
+		enc.Encode(uint8(0)) // F through IYL
+	}
+	enc.Encode(uint16(0x4ff0)) // SP
+	enc.Encode(uint16(0x1234)) // PC
+	enc.Encode(true)           // IFF1
+	enc.Encode(true)           // IFF2
+	enc.Encode(uint8(1))       // IM
+	enc.Encode(false)          // Halt
+	enc.Encode([]uint8{1, 2})  // tiles
+	enc.Encode([]uint8{3})     // colors
+	enc.Encode([]uint8{4, 5})  // ram
+	for i := 0; i < 13; i++ {
+		enc.Encode(uint8(0xbf)) // registers
+	}
+	if enc.Err != nil {
+		t.Fatal(enc.Err)
+	}
+
+	st, err := rcs.ReadState(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations := map[int]func(*rcs.State) error{0: migrateLegacy, 1: migrate1}
+	if err := st.Migrate(stateVersion, migrations); err != nil {
+		t.Fatal(err)
+	}
+	s := &system{
+		cpu: &z80.CPU{},
+		video: &namco.Video{
+			SpriteInfo: []uint8{9},
+		},
+		voices: newVoices(),
+	}
+	if err := st.Get("cpu", s.cpu); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Get(rcs.SystemSection, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Get("mem", rcs.NewMemory(1, 0x10000)); err != nil {
+		t.Fatal(err)
+	}
+	if s.cpu.A != 0x12 || s.cpu.SP != 0x4ff0 || s.cpu.PC() != 0x1234 || s.cpu.IM != 1 {
+		t.Errorf("cpu not migrated: %v", s.cpu)
+	}
+	if s.in0 != 0xbf || s.watchdogReset != 0xbf || !bytes.Equal(s.ram, []uint8{4, 5}) ||
+		!bytes.Equal(s.video.TileMemory, []uint8{1, 2}) {
+		t.Errorf("system not migrated")
+	}
+	if s.video.SpriteInfo[0] != 0 {
+		t.Errorf("sprites not reset")
+	}
+	if _, ok := st.Sections[rcs.LegacySection]; ok {
+		t.Errorf("legacy section not removed")
+	}
+}
+
+// testROMs creates ROMs with a program that enables interrupts and then
+// scrambles video memory with the refresh register. The interrupt handler
+// counts frames in RAM, writes the count to the sprite and sound
+// registers, counts again with a sound register, and adds the value of
+// the IN0 port to a total in RAM.
+func testROMs() map[string][]byte {
+	code := make([]byte, 0x4000)
+	copy(code[0x0000:], []byte{
+		0x31, 0xf0, 0x4f, // ld sp,$4ff0
+		0x3e, 0x01, // ld a,1
+		0x32, 0x00, 0x50, // ld ($5000),a
+		0xed, 0x56, // im 1
+		0xfb,             // ei
+		0x21, 0x00, 0x40, // ld hl,$4000
+		0xed, 0x5f, // loop: ld a,r
+		0xae,       // xor (hl)
+		0x77,       // ld (hl),a
+		0x23,       // inc hl
+		0x7c,       // ld a,h
+		0xe6, 0x47, // and $47
+		0x67,       // ld h,a
+		0x18, 0xf5, // jr loop
+	})
+	copy(code[0x0038:], []byte{
+		0xf5,             // push af
+		0x3a, 0x00, 0x48, // ld a,($4800)
+		0x3c,             // inc a
+		0x32, 0x00, 0x48, // ld ($4800),a
+		0x32, 0x60, 0x50, // ld ($5060),a
+		0x32, 0xf0, 0x4f, // ld ($4ff0),a
+		0x32, 0x45, 0x50, // ld ($5045),a
+		0x3a, 0x5f, 0x50, // ld a,($505f)
+		0x3c,             // inc a
+		0x32, 0x5f, 0x50, // ld ($505f),a
+		0x3a, 0x00, 0x50, // ld a,($5000)
+		0xe5,             // push hl
+		0x21, 0x01, 0x48, // ld hl,$4801
+		0x86,       // add a,(hl)
+		0x77,       // ld (hl),a
+		0xe1,       // pop hl
+		0xf1,       // pop af
+		0xfb,       // ei
+		0xed, 0x4d, // reti
+	})
+	palettes := make([]byte, 256)
+	for i := range palettes {
+		palettes[i] = byte(i % 16)
+	}
+	return map[string][]byte{
+		"code":      code,
+		"tiles":     mock.Pattern(0x1000),
+		"sprites":   mock.Pattern(0x1000),
+		"colors":    mock.Pattern(32),
+		"palettes":  palettes,
+		"waveforms": make([]byte, 512),
+	}
+}
+
+func TestState(t *testing.T) {
+	mock.TestState(t, mock.StateTest{
+		NewMach: func(roms map[string][]byte) (*rcs.Mach, error) {
+			return newMach(rcs.SDLContext{}, "pacman", ROM["pacman"], roms)
+		},
+		ROMs:   testROMs(),
+		Before: 10,
+		Frames: 20,
+		Inputs: []rcs.MovieEvent{
+			{Frame: 3, Input: rcs.InputEvent{Control: rcs.Coin1, Pressed: true}},
+			{Frame: 5, Input: rcs.InputEvent{Control: rcs.Coin1, Pressed: false}},
+			{Frame: 8, Input: rcs.InputEvent{Control: rcs.Start1, Pressed: true}},
+			{Frame: 9, Input: rcs.InputEvent{Control: rcs.Start1, Pressed: false}},
+			{Frame: 10, Input: rcs.InputEvent{Control: rcs.Up, Pressed: true}},
+			{Frame: 15, Input: rcs.InputEvent{Control: rcs.Up, Pressed: false}},
+		},
+	})
+}